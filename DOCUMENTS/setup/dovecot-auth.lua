@@ -0,0 +1,91 @@
+-- Dovecot auth-lua script for the Go-PostfixAdmin /dovecot endpoints.
+--
+-- Requires Dovecot 2.3.19+ (dovecot.http) and a JSON module (lua-dkjson).
+-- Enable [dovecot] in config.toml and use the same secret below.
+--
+-- /etc/dovecot/conf.d/auth-lua.conf.ext:
+--
+--   passdb {
+--     driver = lua
+--     args = file=/etc/dovecot/dovecot-auth.lua blocking=yes
+--   }
+--   userdb {
+--     driver = lua
+--     args = file=/etc/dovecot/dovecot-auth.lua blocking=yes
+--   }
+
+local json = require("dkjson")
+
+local base_url = "http://127.0.0.1:8080/dovecot"
+local secret = "change-me"
+
+local http_client
+
+function script_init()
+  http_client = dovecot.http.client({ timeout = 5000, max_attempts = 2 })
+  return 0
+end
+
+function script_deinit()
+end
+
+local function call(method, path, body)
+  local req = http_client:request({ url = base_url .. path, method = method })
+  req:add_header("Authorization", "Bearer " .. secret)
+  if body then
+    req:add_header("Content-Type", "application/json")
+    req:set_payload(json.encode(body))
+  end
+  local resp = req:submit()
+  local data = json.decode(resp:payload() or "")
+  return resp:status(), data
+end
+
+local function userdb_fields(u)
+  return {
+    user = u.user,
+    home = u.home,
+    uid = u.uid,
+    gid = u.gid,
+    quota_rule = u.quota_rule,
+  }
+end
+
+-- Password check: the server verifies the mailbox password and app passwords,
+-- refuses SMTP logins of mailboxes with smtp_active off and applies the login lockout.
+function auth_password_verify(req, pass)
+  local status, body = call("POST", "/auth", {
+    user = req.user,
+    password = pass,
+    service = req.service,
+    remote_ip = req.remote_ip,
+  })
+  if status == 200 then
+    -- Alias-domain logins are renamed to the real mailbox
+    return dovecot.auth.PASSDB_RESULT_OK, { user = body.data.user }
+  end
+  if status == 401 or status == 403 then
+    return dovecot.auth.PASSDB_RESULT_PASSWORD_MISMATCH, "authentication failed"
+  end
+  return dovecot.auth.PASSDB_RESULT_INTERNAL_FAILURE, "go-postfixadmin returned " .. tostring(status)
+end
+
+function auth_userdb_lookup(req)
+  local status, body = call("GET", "/userdb/" .. req.user)
+  if status == 200 then
+    return dovecot.auth.USERDB_RESULT_OK, userdb_fields(body.data)
+  end
+  if status == 404 then
+    return dovecot.auth.USERDB_RESULT_USER_UNKNOWN, "no such user"
+  end
+  return dovecot.auth.USERDB_RESULT_INTERNAL_FAILURE, "go-postfixadmin returned " .. tostring(status)
+end
+
+-- User iteration for doveadm -A
+function auth_userdb_iterate()
+  local status, body = call("GET", "/users")
+  if status ~= 200 then
+    return {}
+  end
+  return body.data
+end
@@ -2,15 +2,12 @@ package admin
 
 import (
 	"fmt"
-	"log/slog"
-	"os"
+	"io"
 	"strings"
 
 	"go-postfixadmin/internal/models"
 	"go-postfixadmin/internal/utils"
 
-	"github.com/jedib0t/go-pretty/v6/table"
-	"github.com/jedib0t/go-pretty/v6/text"
 	"gorm.io/gorm"
 )
 
@@ -34,188 +31,174 @@ func FormatQuota(bytes int64) string {
 	return fmt.Sprintf("%s %cB", strings.TrimSuffix(val, ".0"), "KMGTPE"[exp])
 }
 
-// ListAllDomains lists all domains in the database
-func ListAllDomains(db *gorm.DB) {
+// ListAllDomains lists the domains in the database
+func ListAllDomains(db *gorm.DB, w io.Writer, opts ListOptions) error {
+	query, err := opts.query(db, "domain = @domain", "active", "domain", "description")
+	if err != nil {
+		return err
+	}
 	var domains []models.Domain
-	if err := db.Where("domain != ?", "ALL").Order("domain ASC").Find(&domains).Error; err != nil {
-		slog.Error("Failed to fetch domains", "error", err)
-		os.Exit(1)
+	if err := query.Where("domain != ?", "ALL").Order("domain ASC").Find(&domains).Error; err != nil {
+		return fmt.Errorf("failed to fetch domains: %w", err)
 	}
 
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Domain", "Description", "Aliases", "Mailboxes", "Quota", "Active", "Modified"})
-
+	l := listing{
+		Title: "List All Domains",
+		Columns: []column{
+			{"Domain", "domain"}, {"Description", "description"}, {"Aliases", "aliases"}, {"Mailboxes", "mailboxes"},
+			{"Quota", "quota"}, {"Active", "active"}, {"Modified", "modified"},
+		},
+	}
 	for _, d := range domains {
-		active := "No"
-		if d.Active {
-			active = "Yes"
-		}
-		// Domain quota stored in MB/units, apply multiplier * multiplier for display?
-		unit := utils.GetQuotaMultiplier()
-		t.AppendRow(table.Row{d.Domain, d.Description, d.Aliases, d.Mailboxes, FormatQuota(d.Quota * unit * unit), active, d.Modified.Format("2006-01-02 15:04:05")})
-	}
-	style := table.StyleDefault
-	style.Format.Footer = text.FormatDefault
-	t.SetStyle(style)
-	t.AppendFooter(table.Row{"List All Domains", strings.Join(os.Args, " ")})
-	t.Render()
+		l.Rows = append(l.Rows, []interface{}{d.Domain, d.Description, d.Aliases, d.Mailboxes, quotaMB(d.Quota), d.Active, d.Modified})
+	}
+	return l.Write(w, opts.Output)
 }
 
-// ListAllMailboxes lists all mailboxes in the database
-func ListAllMailboxes(db *gorm.DB) {
+// ListAllMailboxes lists the mailboxes in the database
+func ListAllMailboxes(db *gorm.DB, w io.Writer, opts ListOptions) error {
+	query, err := opts.query(db, "domain = @domain", "active", "username", "name")
+	if err != nil {
+		return err
+	}
 	var mailboxes []models.Mailbox
-	if err := db.Order("domain ASC, username ASC").Find(&mailboxes).Error; err != nil {
-		slog.Error("Failed to fetch mailboxes", "error", err)
-		os.Exit(1)
+	if err := query.Order("domain ASC, username ASC").Find(&mailboxes).Error; err != nil {
+		return fmt.Errorf("failed to fetch mailboxes: %w", err)
 	}
 
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Username", "Name", "Domain", "Quota", "Active", "Modified"})
-
+	l := listing{
+		Title: "List All Mailboxes",
+		Columns: []column{
+			{"Username", "username"}, {"Name", "name"}, {"Domain", "domain"}, {"Quota", "quota"},
+			{"Active", "active"}, {"Modified", "modified"},
+		},
+	}
+	// Mailbox quota is stored in bytes
+	unit := utils.GetQuotaMultiplier()
 	for _, m := range mailboxes {
-		active := "No"
-		if m.Active {
-			active = "Yes"
-		}
-		unit := utils.GetQuotaMultiplier()
-		t.AppendRow(table.Row{m.Username, m.Name, m.Domain, FormatQuota(m.Quota * unit), active, m.Modified.Format("2006-01-02 15:04:05")})
-
-	}
-	style := table.StyleDefault
-	style.Format.Footer = text.FormatDefault
-	t.SetStyle(style)
-	t.AppendFooter(table.Row{"List All Mailboxes", strings.Join(os.Args, " ")})
-	t.Render()
+		l.Rows = append(l.Rows, []interface{}{m.Username, m.Name, m.Domain, quotaMB(m.Quota / unit), m.Active, m.Modified})
+	}
+	return l.Write(w, opts.Output)
 }
 
-// ListAllAdmins lists all administrators in the database
-func ListAllAdmins(db *gorm.DB) {
+// ListAllAdmins lists the administrators in the database. The domain filter selects the
+// administrators managing that domain, superadmins included.
+func ListAllAdmins(db *gorm.DB, w io.Writer, opts ListOptions) error {
+	query, err := opts.query(db, "username IN (SELECT username FROM domain_admins WHERE domain IN (@domain, 'ALL'))", "active", "username")
+	if err != nil {
+		return err
+	}
 	var admins []models.Admin
-	if err := db.Order("username ASC").Find(&admins).Error; err != nil {
-		slog.Error("Failed to fetch admins", "error", err)
-		os.Exit(1)
+	if err := query.Order("username ASC").Find(&admins).Error; err != nil {
+		return fmt.Errorf("failed to fetch admins: %w", err)
 	}
 
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Username", "Superadmin", "Active", "Modified"})
-
+	l := listing{
+		Title: "List All Admins",
+		Columns: []column{
+			{"Username", "username"}, {"Superadmin", "superadmin"}, {"Active", "active"}, {"Modified", "modified"},
+		},
+	}
 	for _, a := range admins {
-		active := "No"
-		if a.Active {
-			active = "Yes"
-		}
-		super := "No"
-		if a.Superadmin {
-			super = "Yes"
-		}
-		t.AppendRow(table.Row{a.Username, super, active, a.Modified.Format("2006-01-02 15:04:05")})
-	}
-	style := table.StyleDefault
-	style.Format.Footer = text.FormatDefault
-	t.SetStyle(style)
-	t.AppendFooter(table.Row{"List All Admins", strings.Join(os.Args, " ")})
-	t.Render()
+		l.Rows = append(l.Rows, []interface{}{a.Username, a.Superadmin, a.Active, a.Modified})
+	}
+	return l.Write(w, opts.Output)
 }
 
-// ListAllAliases lists all aliases in the database
-func ListAllAliases(db *gorm.DB) {
+// ListAllAliases lists the aliases in the database
+func ListAllAliases(db *gorm.DB, w io.Writer, opts ListOptions) error {
+	query, err := opts.query(db, "domain = @domain", "active", "address", "goto")
+	if err != nil {
+		return err
+	}
 	var aliases []models.Alias
-	if err := db.Order("domain ASC, address ASC").Find(&aliases).Error; err != nil {
-		slog.Error("Failed to fetch aliases", "error", err)
-		os.Exit(1)
+	if err := query.Order("domain ASC, address ASC").Find(&aliases).Error; err != nil {
+		return fmt.Errorf("failed to fetch aliases: %w", err)
 	}
 
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Address", "Goto", "Domain", "Active", "Modified"})
-
+	l := listing{
+		Title: "List All Aliases",
+		Columns: []column{
+			{"Address", "address"}, {"Goto", "goto"}, {"Domain", "domain"}, {"Active", "active"}, {"Modified", "modified"},
+		},
+	}
 	for _, a := range aliases {
-		active := "No"
-		if a.Active {
-			active = "Yes"
-		}
-		t.AppendRow(table.Row{a.Address, a.Goto, a.Domain, active, a.Modified.Format("2006-01-02 15:04:05")})
-	}
-	style := table.StyleDefault
-	style.Format.Footer = text.FormatDefault
-	t.SetStyle(style)
-	t.AppendFooter(table.Row{"List All Aliases", strings.Join(os.Args, " ")})
-	t.Render()
+		l.Rows = append(l.Rows, []interface{}{a.Address, a.Goto, a.Domain, a.Active, a.Modified})
+	}
+	return l.Write(w, opts.Output)
 }
 
-// ListAllAliasDomains lists all alias domains in the database
-func ListAllAliasDomains(db *gorm.DB) {
+// ListAllAliasDomains lists the alias domains in the database. The domain filter matches
+// both the alias and the target domain.
+func ListAllAliasDomains(db *gorm.DB, w io.Writer, opts ListOptions) error {
+	query, err := opts.query(db, "(alias_domain = @domain OR target_domain = @domain)", "active", "alias_domain", "target_domain")
+	if err != nil {
+		return err
+	}
 	var aliasDomains []models.AliasDomain
-	if err := db.Order("alias_domain ASC").Find(&aliasDomains).Error; err != nil {
-		slog.Error("Failed to fetch alias domains", "error", err)
-		os.Exit(1)
+	if err := query.Order("alias_domain ASC").Find(&aliasDomains).Error; err != nil {
+		return fmt.Errorf("failed to fetch alias domains: %w", err)
 	}
 
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Alias Domain", "Target Domain", "Active", "Modified"})
-
+	l := listing{
+		Title: "List All Alias Domains",
+		Columns: []column{
+			{"Alias Domain", "alias_domain"}, {"Target Domain", "target_domain"}, {"Active", "active"}, {"Modified", "modified"},
+		},
+	}
 	for _, ad := range aliasDomains {
-		active := "No"
-		if ad.Active {
-			active = "Yes"
-		}
-		t.AppendRow(table.Row{ad.AliasDomain, ad.TargetDomain, active, ad.Modified.Format("2006-01-02 15:04:05")})
-	}
-	style := table.StyleDefault
-	style.Format.Footer = text.FormatDefault
-	t.SetStyle(style)
-	t.AppendFooter(table.Row{"List All Alias Domains", strings.Join(os.Args, " ")})
-	t.Render()
+		l.Rows = append(l.Rows, []interface{}{ad.AliasDomain, ad.TargetDomain, ad.Active, ad.Modified})
+	}
+	return l.Write(w, opts.Output)
 }
 
-// ListDomainAdmins lists all domain administrators in the database
-func ListDomainAdmins(db *gorm.DB) {
+// ListDomainAdmins lists the domain administrators in the database
+func ListDomainAdmins(db *gorm.DB, w io.Writer, opts ListOptions) error {
+	query, err := opts.query(db, "domain = @domain", "active", "username")
+	if err != nil {
+		return err
+	}
 	var domainAdmins []models.DomainAdmin
-	if err := db.Order("domain ASC").Find(&domainAdmins).Error; err != nil {
-		slog.Error("Failed to fetch domain admins", "error", err)
-		os.Exit(1)
+	if err := query.Order("domain ASC").Find(&domainAdmins).Error; err != nil {
+		return fmt.Errorf("failed to fetch domain admins: %w", err)
 	}
 
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Username", "Domain", "Active", "Created"})
-
+	l := listing{
+		Title: "List All Domain Admins",
+		Columns: []column{
+			{"Username", "username"}, {"Domain", "domain"}, {"Active", "active"}, {"Created", "created"},
+		},
+	}
 	for _, da := range domainAdmins {
-		active := "No"
-		if da.Active {
-			active = "Yes"
-		}
-		t.AppendRow(table.Row{da.Username, da.Domain, active, da.Created.Format("2006-01-02 15:04:05")})
-	}
-	style := table.StyleDefault
-	style.Format.Footer = text.FormatDefault
-	t.SetStyle(style)
-	t.AppendFooter(table.Row{"List All Domain Admins", strings.Join(os.Args, " ")})
-	t.Render()
+		l.Rows = append(l.Rows, []interface{}{da.Username, da.Domain, da.Active, da.Created})
+	}
+	return l.Write(w, opts.Output)
 }
 
-// ListLogs lists all system logs in the database
-func ListLogs(db *gorm.DB) {
+// ListLogs lists the system logs, newest first. Without a page size the last 100 are listed.
+func ListLogs(db *gorm.DB, w io.Writer, opts ListOptions) error {
+	title := "List System Logs"
+	if opts.PerPage == 0 {
+		opts.PerPage = 100
+		title = "List System Logs (Last 100)"
+	}
+	query, err := opts.query(db, "domain = @domain", "", "username", "action", "data")
+	if err != nil {
+		return err
+	}
 	var logs []models.Log
-	if err := db.Order("id DESC").Limit(100).Find(&logs).Error; err != nil {
-		slog.Error("Failed to fetch logs", "error", err)
-		os.Exit(1)
+	if err := query.Order("id DESC").Find(&logs).Error; err != nil {
+		return fmt.Errorf("failed to fetch logs: %w", err)
 	}
 
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Date", "Username", "Domain", "Action", "Data"})
-
-	for _, l := range logs {
-		t.AppendRow(table.Row{l.Timestamp.Format("2006-01-02 15:04:05"), l.Username, l.Domain, strings.ToUpper(l.Action), l.Data})
+	l := listing{
+		Title: title,
+		Columns: []column{
+			{"Date", "timestamp"}, {"Username", "username"}, {"Domain", "domain"}, {"Action", "action"}, {"Data", "data"},
+		},
+	}
+	for _, lg := range logs {
+		l.Rows = append(l.Rows, []interface{}{lg.Timestamp, lg.Username, lg.Domain, strings.ToUpper(lg.Action), lg.Data})
 	}
-	style := table.StyleDefault
-	style.Format.Footer = text.FormatDefault
-	t.SetStyle(style)
-	t.AppendFooter(table.Row{"List System Logs (Last 100)", strings.Join(os.Args, " ")})
-	t.Render()
+	return l.Write(w, opts.Output)
 }
@@ -56,8 +56,8 @@ func AddSuperAdmin(db *gorm.DB, input string) {
 		fmt.Printf("Generated Password: %s\n", password)
 	}
 
-	if len(password) < 8 {
-		slog.Error("Password must be at least 8 characters long")
+	if err := utils.ValidatePassword(db, utils.TOTPKindAdmin, username, password); err != nil {
+		slog.Error("Password rejected by the password policy", "error", err)
 		os.Exit(1)
 	}
 
@@ -87,6 +87,12 @@ func AddSuperAdmin(db *gorm.DB, input string) {
 		os.Exit(1)
 	}
 
+	if err := utils.RecordPasswordHistory(tx, utils.TOTPKindAdmin, username, crypted); err != nil {
+		tx.Rollback()
+		slog.Error("Failed to record password history", "error", err)
+		os.Exit(1)
+	}
+
 	// Assign ALL domain for superadmin
 	da := models.DomainAdmin{
 		Username: username,
@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// AddAlias creates an alias forwarding to a comma-separated list of recipients
+func AddAlias(db *gorm.DB, address, recipients string, active bool) {
+	localPart, domain := utils.SplitEmail(address)
+	alias, err := utils.NewAlias(db, localPart, domain)
+	if err != nil {
+		slog.Error("Failed to create alias", "alias", address, "error", err)
+		os.Exit(1)
+	}
+	alias.Active = active
+	if err := utils.SetAliasGoto(&alias, recipients); err != nil {
+		slog.Error("Failed to create alias", "alias", address, "error", err)
+		os.Exit(1)
+	}
+
+	if err := utils.CreateAlias(db, &alias, cliUser, cliIP); err != nil {
+		slog.Error("Failed to create alias", "alias", address, "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Alias '%s' created successfully.\n", alias.Address)
+}
+
+// EditAlias changes the recipients or active flag of an alias. Nil arguments are left as they are.
+func EditAlias(db *gorm.DB, address string, recipients *string, active *bool) {
+	alias := findAlias(db, address)
+	if recipients != nil {
+		if err := utils.SetAliasGoto(&alias, *recipients); err != nil {
+			slog.Error("Failed to update alias", "alias", address, "error", err)
+			os.Exit(1)
+		}
+	}
+	if active != nil {
+		alias.Active = *active
+	}
+
+	if err := utils.UpdateAlias(db, &alias, cliUser, cliIP); err != nil {
+		slog.Error("Failed to update alias", "alias", address, "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Alias '%s' updated successfully.\n", alias.Address)
+}
+
+// DeleteAlias removes an alias. The alias of a mailbox goes with the mailbox.
+func DeleteAlias(db *gorm.DB, address string) {
+	alias := findAlias(db, address)
+
+	if err := utils.DeleteAlias(db, alias, cliUser, cliIP); err != nil {
+		if errors.Is(err, utils.ErrMailboxAlias) {
+			slog.Error("Alias belongs to a mailbox, delete the mailbox instead", "alias", address)
+		} else {
+			slog.Error("Failed to delete alias", "alias", address, "error", err)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("Alias '%s' deleted successfully.\n", alias.Address)
+}
+
+// AddAliasDomain makes every address of aliasDomain deliver to the same address of target
+func AddAliasDomain(db *gorm.DB, aliasDomain, target string, active bool) {
+	ad := models.AliasDomain{
+		AliasDomain:  aliasDomain,
+		TargetDomain: target,
+		Active:       active,
+	}
+
+	if err := utils.CreateAliasDomain(db, &ad, cliUser, cliIP); err != nil {
+		slog.Error("Failed to create alias domain", "alias_domain", aliasDomain, "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Alias domain '%s' -> '%s' created successfully.\n", ad.AliasDomain, ad.TargetDomain)
+}
+
+// EditAliasDomain changes the target or active flag of an alias domain. Nil arguments are left
+// as they are.
+func EditAliasDomain(db *gorm.DB, aliasDomain string, target *string, active *bool) {
+	ad := findAliasDomain(db, aliasDomain)
+	if target != nil {
+		ad.TargetDomain = *target
+	}
+	if active != nil {
+		ad.Active = *active
+	}
+
+	if err := utils.UpdateAliasDomain(db, &ad, cliUser, cliIP); err != nil {
+		slog.Error("Failed to update alias domain", "alias_domain", aliasDomain, "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Alias domain '%s' updated successfully.\n", ad.AliasDomain)
+}
+
+// DeleteAliasDomain removes an alias domain
+func DeleteAliasDomain(db *gorm.DB, aliasDomain string) {
+	ad := findAliasDomain(db, aliasDomain)
+
+	if err := utils.DeleteAliasDomain(db, ad, cliUser, cliIP); err != nil {
+		slog.Error("Failed to delete alias domain", "alias_domain", aliasDomain, "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Alias domain '%s' deleted successfully.\n", ad.AliasDomain)
+}
+
+func findAlias(db *gorm.DB, address string) models.Alias {
+	var alias models.Alias
+	if err := db.Where("address = ?", strings.ToLower(address)).First(&alias).Error; err != nil {
+		slog.Error("Alias not found", "alias", address)
+		os.Exit(1)
+	}
+	return alias
+}
+
+func findAliasDomain(db *gorm.DB, aliasDomain string) models.AliasDomain {
+	var ad models.AliasDomain
+	if err := db.Where("alias_domain = ?", strings.ToLower(aliasDomain)).First(&ad).Error; err != nil {
+		slog.Error("Alias domain not found", "alias_domain", aliasDomain)
+		os.Exit(1)
+	}
+	return ad
+}
@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gorm.io/gorm"
+)
+
+// CheckDNS checks the mail DNS records of a domain, or of every active domain when domain is
+// "ALL", and exits with status 1 when a check fails
+func CheckDNS(db *gorm.DB, domain string) {
+	var domains []string
+	query := db.Model(&models.Domain{}).Where("domain != ?", "ALL")
+	if strings.EqualFold(domain, "ALL") {
+		query = query.Where("active = ?", true)
+	} else {
+		query = query.Where("domain = ?", strings.ToLower(domain))
+	}
+	if err := query.Order("domain ASC").Pluck("domain", &domains).Error; err != nil {
+		slog.Error("Failed to fetch domains", "error", err)
+		os.Exit(1)
+	}
+	if len(domains) == 0 {
+		slog.Error("Domain not found", "domain", domain)
+		os.Exit(1)
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Domain", "Check", "Record", "Status", "Details"})
+
+	checker := utils.NewDNSChecker()
+	failed := false
+	for _, d := range domains {
+		var keys []models.DKIM
+		db.Where("domain_name = ?", d).Order("selector ASC").Find(&keys)
+
+		report := checker.Check(context.Background(), d, keys)
+		for _, c := range report.Checks {
+			details := strings.Join(c.Found, "\n")
+			if c.Message != "" {
+				details = strings.TrimSpace(details + "\n" + c.Message)
+			}
+			t.AppendRow(table.Row{d, c.Name, c.Record, strings.ToUpper(c.Status), details})
+		}
+		t.AppendSeparator()
+		if report.Status() == utils.DNSStatusError {
+			failed = true
+		}
+	}
+	style := table.StyleDefault
+	style.Format.Footer = text.FormatDefault
+	t.SetStyle(style)
+	t.AppendFooter(table.Row{fmt.Sprintf("DNS Checks for %d Domains", len(domains)), strings.Join(os.Args, " ")})
+	t.Render()
+
+	if failed {
+		os.Exit(1)
+	}
+}
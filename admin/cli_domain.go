@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// Changes made from the command line are logged as this user and address
+const (
+	cliUser = "CLI"
+	cliIP   = "127.0.0.1"
+)
+
+// DomainOptions holds the domain settings given on the command line. Nil fields keep their
+// current value, or the default of the web form when adding a domain.
+type DomainOptions struct {
+	Description    *string
+	Aliases        *int
+	Mailboxes      *int
+	Quota          *int64 // MB
+	Transport      *string
+	BackupMX       *bool
+	Active         *bool
+	PasswordExpiry *int // days, 0 disables expiry
+	SendLimit      *int
+}
+
+func (o DomainOptions) apply(d *models.Domain) {
+	if o.Description != nil {
+		d.Description = *o.Description
+	}
+	if o.Aliases != nil {
+		d.Aliases = *o.Aliases
+	}
+	if o.Mailboxes != nil {
+		d.Mailboxes = *o.Mailboxes
+	}
+	if o.Quota != nil {
+		d.Quota = *o.Quota
+	}
+	if o.Transport != nil {
+		d.Transport = *o.Transport
+	}
+	if o.BackupMX != nil {
+		d.BackupMX = *o.BackupMX
+	}
+	if o.Active != nil {
+		d.Active = *o.Active
+	}
+	if o.PasswordExpiry != nil {
+		d.PasswordExpiry = o.PasswordExpiry
+	}
+	if o.SendLimit != nil {
+		d.SendLimit = *o.SendLimit
+	}
+}
+
+// AddDomain creates a domain
+func AddDomain(db *gorm.DB, name string, opts DomainOptions) {
+	// Same defaults as the web form
+	domain := models.Domain{
+		Domain:    name,
+		Aliases:   10,
+		Mailboxes: 10,
+		Quota:     2048,
+		Active:    true,
+	}
+	opts.apply(&domain)
+
+	if err := utils.CreateDomain(db, &domain, cliUser, cliIP); err != nil {
+		slog.Error("Failed to create domain", "domain", name, "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Domain '%s' created successfully.\n", domain.Domain)
+}
+
+// EditDomain changes the settings of a domain
+func EditDomain(db *gorm.DB, name string, opts DomainOptions) {
+	domain := findDomain(db, name)
+	wasActive := domain.Active
+	opts.apply(&domain)
+
+	if err := utils.UpdateDomain(db, &domain, wasActive, cliUser, cliIP); err != nil {
+		slog.Error("Failed to update domain", "domain", name, "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Domain '%s' updated successfully.\n", domain.Domain)
+}
+
+// DeleteDomain removes a domain with its mailboxes, aliases and every other record
+func DeleteDomain(db *gorm.DB, name string) {
+	domain := findDomain(db, name)
+
+	if err := utils.DeleteDomain(db, domain.Domain, cliUser, cliIP); err != nil {
+		slog.Error("Failed to delete domain", "domain", name, "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Domain '%s' deleted successfully.\n", domain.Domain)
+}
+
+func findDomain(db *gorm.DB, name string) models.Domain {
+	var domain models.Domain
+	if err := db.Where("domain = ? AND domain != ?", strings.ToLower(name), "ALL").First(&domain).Error; err != nil {
+		slog.Error("Domain not found", "domain", name)
+		os.Exit(1)
+	}
+	return domain
+}
@@ -0,0 +1,29 @@
+package admin
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"go-postfixadmin/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// GrantDomainAdmin lets an administrator manage a domain
+func GrantDomainAdmin(db *gorm.DB, username, domain string) {
+	if err := utils.GrantDomainAdmin(db, username, domain, cliUser, cliIP); err != nil {
+		slog.Error("Failed to grant domain", "username", username, "domain", domain, "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Administrator '%s' now manages '%s'.\n", username, domain)
+}
+
+// RevokeDomainAdmin stops an administrator from managing a domain
+func RevokeDomainAdmin(db *gorm.DB, username, domain string) {
+	if err := utils.RevokeDomainAdmin(db, username, domain, cliUser, cliIP); err != nil {
+		slog.Error("Failed to revoke domain", "username", username, "domain", domain, "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Administrator '%s' no longer manages '%s'.\n", username, domain)
+}
@@ -0,0 +1,114 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-postfixadmin/internal/utils"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gorm.io/gorm"
+)
+
+// ExportDomain writes a domain with all its rows as a JSON or YAML bundle to file, or to
+// stdout when file is empty or "-"
+func ExportDomain(db *gorm.DB, name, file, format string) error {
+	format = bundleFormat(file, format)
+	bundle, err := utils.ExportDomainBundle(db, name)
+	if err != nil {
+		return fmt.Errorf("failed to export domain %s: %w", name, err)
+	}
+
+	if file == "" || file == "-" {
+		if err := bundle.Write(os.Stdout, format); err != nil {
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+		return nil
+	}
+
+	// A new file only the owner can read: the bundle holds password hashes and private keys
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle file: %w", err)
+	}
+	if err := bundle.Write(f, format); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write bundle to %s: %w", file, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle to %s: %w", file, err)
+	}
+	fmt.Printf("Domain '%s' exported to '%s' successfully.\n", bundle.Domain.Domain, file)
+	return nil
+}
+
+// ImportDomain recreates a domain from a bundle written by ExportDomain, read from file or
+// from stdin with "-"
+func ImportDomain(db *gorm.DB, file, format, onConflict string, dryRun bool) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("failed to open bundle file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	bundle, err := utils.ReadDomainBundle(r, bundleFormat(file, format))
+	if err != nil {
+		return fmt.Errorf("failed to read bundle %s: %w", file, err)
+	}
+
+	report, err := utils.ImportDomainBundle(db, bundle, onConflict, dryRun, cliUser, cliIP)
+	if report != nil {
+		printBundleReport(report)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to import domain %s: %w", bundle.Domain.Domain, err)
+	}
+
+	if dryRun {
+		fmt.Printf("Dry run: domain '%s' was not imported.\n", bundle.Domain.Domain)
+	} else {
+		fmt.Printf("Domain '%s' imported successfully.\n", bundle.Domain.Domain)
+	}
+	return nil
+}
+
+func printBundleReport(report *utils.BundleImportReport) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Table", "Created", "Updated", "Skipped"})
+	for _, tr := range report.Tables {
+		t.AppendRow(table.Row{tr.Table, tr.Created, tr.Updated, tr.Skipped})
+	}
+	style := table.StyleDefault
+	style.Format.Footer = text.FormatDefault
+	t.SetStyle(style)
+	t.AppendFooter(table.Row{"Import Domain", strings.Join(os.Args, " ")})
+	t.Render()
+
+	for _, c := range report.Conflicts {
+		fmt.Printf("Exists: %s\n", c)
+	}
+	for _, w := range report.Warnings {
+		fmt.Printf("Warning: %s\n", w)
+	}
+}
+
+// bundleFormat returns format, or the format matching the file extension when it is empty
+func bundleFormat(file, format string) string {
+	if format != "" {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return "json"
+}
@@ -0,0 +1,124 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-postfixadmin/internal/utils"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gorm.io/gorm"
+)
+
+// ImportAccounts imports mailboxes and aliases from a CSV or JSON file, or from stdin with
+// "-". An empty format is taken from the file extension. Generated passwords are written to
+// credentialsFile, or to stdout when it is empty.
+func ImportAccounts(db *gorm.DB, file, format string, opts utils.ImportOptions, credentialsFile string) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("failed to open import file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	if format == "" {
+		format = "csv"
+		if strings.EqualFold(filepath.Ext(file), ".json") {
+			format = "json"
+		}
+	}
+
+	var rows []utils.ImportRow
+	var err error
+	switch format {
+	case "csv":
+		rows, err = utils.ParseImportCSV(r)
+	case "json":
+		rows, err = utils.ParseImportJSON(r)
+	default:
+		return fmt.Errorf("unknown import format %q, use csv or json", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read import file %s: %w", file, err)
+	}
+
+	report, err := utils.ImportAccounts(db, rows, opts, cliUser, cliIP)
+	printImportReport(report)
+	// Batches imported before a failure stay, so their passwords are written either way
+	if credErr := writeImportCredentials(report, credentialsFile); credErr != nil {
+		if err != nil {
+			return fmt.Errorf("import failed: %w (%v)", err, credErr)
+		}
+		return credErr
+	}
+	if err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+
+	if opts.DryRun {
+		fmt.Printf("Dry run: %d mailboxes and %d aliases would be imported.\n", report.Mailboxes, report.Aliases)
+	} else {
+		fmt.Printf("%d mailboxes and %d aliases imported successfully.\n", report.Mailboxes, report.Aliases)
+	}
+	return nil
+}
+
+func printImportReport(report *utils.ImportReport) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Line", "Type", "Address", "Status"})
+	for _, res := range report.Results {
+		status := "Valid"
+		switch {
+		case res.Error != "":
+			status = res.Error
+		case res.Imported:
+			status = "Imported"
+		}
+		t.AppendRow(table.Row{res.Line, res.Type, res.Address, status})
+	}
+	style := table.StyleDefault
+	style.Format.Footer = text.FormatDefault
+	t.SetStyle(style)
+	t.AppendFooter(table.Row{"Import Accounts", strings.Join(os.Args, " ")})
+	t.Render()
+}
+
+// writeImportCredentials writes the generated passwords of the imported rows to
+// credentialsFile, or to stdout when it is empty
+func writeImportCredentials(report *utils.ImportReport, credentialsFile string) error {
+	if !report.GeneratedPasswords() {
+		return nil
+	}
+	if credentialsFile == "" {
+		fmt.Println("Generated passwords (shown only once):")
+		if err := report.WriteCredentials(os.Stdout); err != nil {
+			return fmt.Errorf("failed to write credentials: %w", err)
+		}
+		return nil
+	}
+	if err := writeCredentialsFile(report, credentialsFile); err != nil {
+		return fmt.Errorf("failed to write credentials to %s: %w", credentialsFile, err)
+	}
+	fmt.Printf("Generated passwords written to '%s'.\n", credentialsFile)
+	return nil
+}
+
+// writeCredentialsFile writes the generated passwords to a new file only the owner can read
+func writeCredentialsFile(report *utils.ImportReport, name string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteCredentials(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/testdb"
+	"go-postfixadmin/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+func TestImportAccountsWritesCredentialsOfImportedBatches(t *testing.T) {
+	db := testdb.Open(t)
+	if err := db.Create(&models.Domain{Domain: "example.com", Active: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// The second batch fails while it is created, after the first one was committed
+	err := db.Callback().Create().Before("gorm:create").Register("test:fail_jane", func(tx *gorm.DB) {
+		if m, ok := tx.Statement.Dest.(*models.Mailbox); ok && m.LocalPart == "jane" {
+			tx.AddError(errors.New("disk full"))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "accounts.csv")
+	if err := os.WriteFile(file, []byte("address\njohn@example.com\njane@example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	credentials := filepath.Join(dir, "credentials.csv")
+	opts := utils.ImportOptions{GeneratePasswords: true, BatchSize: 1}
+	if err := ImportAccounts(db, file, "", opts, credentials); err == nil {
+		t.Fatal("expected the second batch to fail")
+	}
+
+	written, err := os.ReadFile(credentials)
+	if err != nil {
+		t.Fatalf("credentials of the imported batch were not written: %v", err)
+	}
+	if !strings.Contains(string(written), "john@example.com,") || strings.Contains(string(written), "jane@example.com") {
+		t.Errorf("unexpected credentials %q", written)
+	}
+}
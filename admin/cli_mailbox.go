@@ -0,0 +1,131 @@
+package admin
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// MailboxOptions holds the mailbox settings given on the command line. Nil fields keep their
+// current value, or the default when adding a mailbox.
+type MailboxOptions struct {
+	Name       *string
+	Quota      *int64 // MB, 0 is unlimited
+	Active     *bool
+	SMTPActive *bool
+	SendLimit  *int
+	EmailOther *string
+}
+
+func (o MailboxOptions) apply(m *models.Mailbox) {
+	if o.Name != nil {
+		m.Name = strings.TrimSpace(*o.Name)
+	}
+	if o.Quota != nil {
+		m.Quota = *o.Quota * utils.GetQuotaMultiplier()
+	}
+	if o.Active != nil {
+		m.Active = *o.Active
+	}
+	if o.SMTPActive != nil {
+		m.SMTPActive = *o.SMTPActive
+	}
+	if o.SendLimit != nil {
+		m.SendLimit = *o.SendLimit
+	}
+	if o.EmailOther != nil {
+		m.EmailOther = strings.TrimSpace(*o.EmailOther)
+	}
+}
+
+// AddMailbox creates a mailbox and its alias. A password is generated and printed when
+// password is empty.
+func AddMailbox(db *gorm.DB, address, password string, opts MailboxOptions) {
+	localPart, domain := utils.SplitEmail(address)
+	mailbox, err := utils.NewMailbox(db, localPart, domain)
+	if err != nil {
+		slog.Error("Failed to create mailbox", "mailbox", address, "error", err)
+		os.Exit(1)
+	}
+	opts.apply(&mailbox)
+
+	generated := password == ""
+	if generated {
+		password = utils.GenerateComplexPassword()
+	}
+	if err := utils.SetMailboxPassword(db, &mailbox, password); err != nil {
+		slog.Error("Password rejected", "mailbox", address, "error", err)
+		os.Exit(1)
+	}
+	if err := utils.CreateMailbox(db, &mailbox, cliUser, cliIP); err != nil {
+		slog.Error("Failed to create mailbox", "mailbox", address, "error", err)
+		os.Exit(1)
+	}
+
+	if generated {
+		fmt.Printf("Generated Password: %s\n", password)
+	}
+	fmt.Printf("Mailbox '%s' created successfully.\n", mailbox.Username)
+}
+
+// EditMailbox changes the settings of a mailbox
+func EditMailbox(db *gorm.DB, address string, opts MailboxOptions) {
+	mailbox := findMailbox(db, address)
+	opts.apply(&mailbox)
+
+	if err := utils.UpdateMailbox(db, &mailbox, false, cliUser, cliIP); err != nil {
+		slog.Error("Failed to update mailbox", "mailbox", address, "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Mailbox '%s' updated successfully.\n", mailbox.Username)
+}
+
+// SetMailboxPassword changes the password of a mailbox. A password is generated and printed
+// when password is empty.
+func SetMailboxPassword(db *gorm.DB, address, password string) {
+	mailbox := findMailbox(db, address)
+
+	generated := password == ""
+	if generated {
+		password = utils.GenerateComplexPassword()
+	}
+	if err := utils.SetMailboxPassword(db, &mailbox, password); err != nil {
+		slog.Error("Password rejected", "mailbox", address, "error", err)
+		os.Exit(1)
+	}
+	if err := utils.UpdateMailbox(db, &mailbox, true, cliUser, cliIP); err != nil {
+		slog.Error("Failed to update mailbox", "mailbox", address, "error", err)
+		os.Exit(1)
+	}
+
+	if generated {
+		fmt.Printf("Generated Password: %s\n", password)
+	}
+	fmt.Printf("Password of '%s' changed successfully.\n", mailbox.Username)
+}
+
+// DeleteMailbox removes a mailbox with its alias, vacation and app passwords
+func DeleteMailbox(db *gorm.DB, address string) {
+	mailbox := findMailbox(db, address)
+
+	if err := utils.DeleteMailbox(db, mailbox, cliUser, cliIP); err != nil {
+		slog.Error("Failed to delete mailbox", "mailbox", address, "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Mailbox '%s' deleted successfully.\n", mailbox.Username)
+}
+
+func findMailbox(db *gorm.DB, address string) models.Mailbox {
+	var mailbox models.Mailbox
+	if err := db.Where("username = ?", strings.ToLower(address)).First(&mailbox).Error; err != nil {
+		slog.Error("Mailbox not found", "mailbox", address)
+		os.Exit(1)
+	}
+	return mailbox
+}
@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go-postfixadmin/internal/utils"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gorm.io/gorm"
+)
+
+// MigrateFromPostfixAdmin copies a PHP PostfixAdmin database into db and prints the
+// reconciliation of every table: rows in the source, created, updated and skipped, and rows
+// in the target afterwards
+func MigrateFromPostfixAdmin(src, db *gorm.DB, opts utils.PostfixAdminImportOptions) error {
+	report, err := utils.ImportPostfixAdmin(src, db, opts, cliUser, cliIP)
+	if report != nil && len(report.Tables) > 0 {
+		version := report.SchemaVersion
+		if version == "" {
+			version = "unknown (no config table)"
+		}
+		fmt.Printf("Source schema version: %s\n", version)
+
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Table", "Source", "Created", "Updated", "Skipped", "Target"})
+		for _, tr := range report.Tables {
+			t.AppendRow(table.Row{tr.Table, tr.Source, tr.Created, tr.Updated, tr.Skipped, tr.Target})
+		}
+		style := table.StyleDefault
+		style.Format.Footer = text.FormatDefault
+		t.SetStyle(style)
+		t.AppendFooter(table.Row{"Migrate From PostfixAdmin", strings.Join(os.Args, " ")})
+		t.Render()
+	}
+	if report != nil {
+		// With skip and overwrite the counts above tell the conflicts
+		if err != nil {
+			for _, c := range report.Conflicts {
+				fmt.Printf("Exists: %s\n", c)
+			}
+		}
+		for _, w := range report.Warnings {
+			fmt.Printf("Warning: %s\n", w)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate from PostfixAdmin: %w", err)
+	}
+
+	if opts.DryRun {
+		fmt.Printf("Dry run: nothing was imported.\n")
+	} else {
+		fmt.Printf("PostfixAdmin database imported successfully.\n")
+	}
+	return nil
+}
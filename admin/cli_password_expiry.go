@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"go-postfixadmin/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ListExpiringPasswords lists the mailboxes whose password expires within the given number of days
+func ListExpiringPasswords(db *gorm.DB, days int, w io.Writer, opts ListOptions) error {
+	query, err := opts.query(db, "mailbox.domain = @domain", "", "mailbox.username", "mailbox.name")
+	if err != nil {
+		return err
+	}
+	mailboxes, err := utils.ExpiringMailboxes(query, days)
+	if err != nil {
+		return fmt.Errorf("failed to fetch expiring mailboxes: %w", err)
+	}
+
+	l := listing{
+		Title: fmt.Sprintf("Passwords Expiring Within %d Days", days),
+		Columns: []column{
+			{"Username", "username"}, {"Name", "name"}, {"Domain", "domain"},
+			{"Password Expiry", "password_expiry"}, {"Days Left", "days_left"},
+		},
+	}
+	now := time.Now()
+	for _, m := range mailboxes {
+		left := daysLeft(-1)
+		if m.PasswordExpiry.After(now) {
+			left = daysLeft(m.PasswordExpiry.Sub(now).Hours() / 24)
+		}
+		l.Rows = append(l.Rows, []interface{}{m.Username, m.Name, m.Domain, m.PasswordExpiry, left})
+	}
+	return l.Write(w, opts.Output)
+}
+
+// SendPasswordExpiryReminders emails the mailboxes whose password expires within the given number of days
+func SendPasswordExpiryReminders(db *gorm.DB, days int, from string) {
+	db = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+
+	sent, err := utils.SendPasswordExpiryReminders(db, days, from)
+	if err != nil {
+		slog.Error("Failed to send password expiry reminders", "sent", sent, "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d password expiry reminders sent.\n", sent)
+}
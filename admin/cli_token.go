@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go-postfixadmin/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// CreateAPIToken issues an API token for an admin and prints it once
+func CreateAPIToken(db *gorm.DB, owner, name, domains string, readOnly bool) {
+	db = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+
+	if name == "" {
+		name = "cli"
+	}
+
+	var scope []string
+	if domains != "" {
+		scope = strings.Split(domains, ",")
+	}
+
+	token, record, err := utils.CreateAPIToken(db, owner, name, scope, readOnly, "CLI", "127.0.0.1")
+	if err != nil {
+		slog.Error("Failed to create API token", "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("API token %d created for '%s'. Store it now, it will not be shown again:\n%s\n", record.ID, owner, token)
+}
+
+// ListAPITokens lists the API tokens in the database. The domain filter selects the tokens
+// restricted to that domain.
+func ListAPITokens(db *gorm.DB, w io.Writer, opts ListOptions) error {
+	query, err := opts.query(db, "CONCAT(',', domains, ',') LIKE CONCAT('%,', @domain, ',%')", "", "name", "username", "prefix")
+	if err != nil {
+		return err
+	}
+	tokens, err := utils.ListAPITokens(query, "", true)
+	if err != nil {
+		return fmt.Errorf("failed to fetch API tokens: %w", err)
+	}
+
+	l := listing{
+		Title: "List API Tokens",
+		Columns: []column{
+			{"ID", "id"}, {"Name", "name"}, {"Prefix", "prefix"}, {"Admin", "username"}, {"Domains", "domains"},
+			{"Read-only", "read_only"}, {"Created", "created"}, {"Last Used", "last_used"},
+		},
+	}
+	for _, tk := range tokens {
+		domains := tk.Domains
+		if domains == "" {
+			domains = "ALL"
+		}
+		l.Rows = append(l.Rows, []interface{}{tk.ID, tk.Name, tk.Prefix, tk.Username, domains, tk.ReadOnly, tk.Created, tk.LastUsed})
+	}
+	return l.Write(w, opts.Output)
+}
+
+// RevokeAPIToken deletes an API token by ID
+func RevokeAPIToken(db *gorm.DB, id int) {
+	db = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+
+	if err := utils.RevokeAPIToken(db, id, "CLI", true, "127.0.0.1"); err != nil {
+		slog.Error("Failed to revoke API token", "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("API token %d revoked.\n", id)
+}
@@ -0,0 +1,286 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/utils"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"go.yaml.in/yaml/v3"
+	"gorm.io/gorm"
+)
+
+// Output formats of the list commands
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputCSV   = "csv"
+	OutputYAML  = "yaml"
+)
+
+// ListOptions selects the records of a list command and how they are written
+type ListOptions struct {
+	Output  string // table (default), json, csv or yaml
+	Domain  string // only records of this domain
+	Active  *bool  // only active or inactive records, nil for both
+	Search  string // only records containing this text
+	Page    int    // 1-based page, with PerPage
+	PerPage int    // records per page, 0 lists every record
+}
+
+// Validate checks the output format and pagination
+func (o ListOptions) Validate() error {
+	switch o.Output {
+	case "", OutputTable, OutputJSON, OutputCSV, OutputYAML:
+	default:
+		return fmt.Errorf("unknown output format %q, use table, json, csv or yaml", o.Output)
+	}
+	if o.Page < 0 || o.PerPage < 0 {
+		return fmt.Errorf("page and per-page cannot be negative")
+	}
+	if o.Page > 1 && o.PerPage == 0 {
+		return fmt.Errorf("a page needs a page size")
+	}
+	return nil
+}
+
+// query restricts db to the selected domain, active flag, search text and page.
+// domainWhere is a condition on the named argument @domain; an empty domainWhere or
+// activeColumn means the list has no such field and the option is rejected.
+func (o ListOptions) query(db *gorm.DB, domainWhere, activeColumn string, searchColumns ...string) (*gorm.DB, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	query := db
+	if o.Domain != "" {
+		if domainWhere == "" {
+			return nil, fmt.Errorf("this list cannot be filtered by domain")
+		}
+		query = query.Where(domainWhere, map[string]interface{}{"domain": strings.ToLower(o.Domain)})
+	}
+	if o.Active != nil {
+		if activeColumn == "" {
+			return nil, fmt.Errorf("this list cannot be filtered by active flag")
+		}
+		query = query.Where(activeColumn+" = ?", *o.Active)
+	}
+	if o.Search != "" && len(searchColumns) > 0 {
+		searchLike := "%" + o.Search + "%"
+		search := db.Where(searchColumns[0]+" LIKE ?", searchLike)
+		for _, col := range searchColumns[1:] {
+			search = search.Or(col+" LIKE ?", searchLike)
+		}
+		query = query.Where(search)
+	}
+	if o.PerPage > 0 {
+		page := o.Page
+		if page < 1 {
+			page = 1
+		}
+		query = query.Limit(o.PerPage).Offset((page - 1) * o.PerPage)
+	}
+	return query, nil
+}
+
+// column of a listing: Header is shown in tables, Key names the field in JSON, CSV and YAML
+type column struct {
+	Header string
+	Key    string
+}
+
+// listing holds the rows of a list command. Values keep their type so that JSON and YAML
+// get numbers, booleans and timestamps while tables show them formatted.
+type listing struct {
+	Title   string
+	Columns []column
+	Rows    [][]interface{}
+}
+
+// quotaMB is a quota in MB like in the API, shown human-readable in tables
+type quotaMB int64
+
+func (q quotaMB) String() string {
+	unit := utils.GetQuotaMultiplier()
+	return FormatQuota(int64(q) * unit * unit)
+}
+
+// daysLeft is the number of days until a date, negative once it has passed
+type daysLeft int
+
+func (d daysLeft) String() string {
+	if d < 0 {
+		return "Expired"
+	}
+	return strconv.Itoa(int(d))
+}
+
+// Write writes the listing to w in the given output format
+func (l listing) Write(w io.Writer, format string) error {
+	switch format {
+	case "", OutputTable:
+		l.writeTable(w)
+		return nil
+	case OutputJSON:
+		return l.writeJSON(w)
+	case OutputCSV:
+		return l.writeCSV(w)
+	case OutputYAML:
+		return l.writeYAML(w)
+	}
+	return fmt.Errorf("unknown output format %q, use table, json, csv or yaml", format)
+}
+
+func (l listing) writeTable(w io.Writer) {
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	header := make(table.Row, len(l.Columns))
+	for i, c := range l.Columns {
+		header[i] = c.Header
+	}
+	t.AppendHeader(header)
+
+	for _, r := range l.Rows {
+		row := make(table.Row, len(r))
+		for i, v := range r {
+			row[i] = displayValue(v)
+		}
+		t.AppendRow(row)
+	}
+	style := table.StyleDefault
+	style.Format.Footer = text.FormatDefault
+	t.SetStyle(style)
+	t.AppendFooter(table.Row{l.Title, strings.Join(os.Args, " ")})
+	t.Render()
+}
+
+// writeJSON writes an array of objects, keeping the column order
+func (l listing) writeJSON(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, r := range l.Rows {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('{')
+		for j, v := range r {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(l.Columns[j].Key)
+			value, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(']')
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func (l listing) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(l.Columns))
+	for i, c := range l.Columns {
+		header[i] = c.Key
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range l.Rows {
+		record := make([]string, len(r))
+		for i, v := range r {
+			record[i] = rawValue(v)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeYAML writes a sequence of mappings, keeping the column order
+func (l listing) writeYAML(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, r := range l.Rows {
+		item := &yaml.Node{Kind: yaml.MappingNode}
+		for i, v := range r {
+			value := &yaml.Node{}
+			if err := value.Encode(v); err != nil {
+				return err
+			}
+			item.Content = append(item.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: l.Columns[i].Key}, value)
+		}
+		doc.Content = append(doc.Content, item)
+	}
+	if len(doc.Content) == 0 {
+		doc.Style = yaml.FlowStyle
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// displayValue formats a value for a table
+func displayValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return "Yes"
+		}
+		return "No"
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	case *time.Time:
+		if v == nil {
+			return "Never"
+		}
+		return v.Format("2006-01-02 15:04:05")
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+// rawValue formats a value for CSV
+func rawValue(v interface{}) string {
+	switch v := v.(type) {
+	case quotaMB:
+		return strconv.FormatInt(int64(v), 10)
+	case daysLeft:
+		return strconv.Itoa(int(v))
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testListing() listing {
+	modified := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	return listing{
+		Title:   "Test",
+		Columns: []column{{"Username", "username"}, {"Quota", "quota"}, {"Active", "active"}, {"Modified", "modified"}, {"Last Used", "last_used"}},
+		Rows: [][]interface{}{
+			{"john@example.com", quotaMB(2048), true, modified, (*time.Time)(nil)},
+		},
+	}
+}
+
+func TestListingJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testListing().Write(&buf, OutputJSON); err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {
+    "username": "john@example.com",
+    "quota": 2048,
+    "active": true,
+    "modified": "2026-03-01T12:30:00Z",
+    "last_used": null
+  }
+]
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestListingCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testListing().Write(&buf, OutputCSV); err != nil {
+		t.Fatal(err)
+	}
+	want := "username,quota,active,modified,last_used\njohn@example.com,2048,true,2026-03-01T12:30:00Z,\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestListingYAML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testListing().Write(&buf, OutputYAML); err != nil {
+		t.Fatal(err)
+	}
+	want := `- username: john@example.com
+  quota: 2048
+  active: true
+  modified: 2026-03-01T12:30:00Z
+  last_used: null
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := (listing{Columns: testListing().Columns}).Write(&buf, OutputYAML); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("empty listing: got %q", buf.String())
+	}
+}
+
+func TestListingTable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testListing().Write(&buf, OutputTable); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"USERNAME", "john@example.com", "QUOTA", "Yes", "2026-03-01 12:30:00", "Never"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("table is missing %q:\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestListOptionsValidate(t *testing.T) {
+	valid := []ListOptions{{}, {Output: OutputCSV}, {Page: 3, PerPage: 20}}
+	for _, o := range valid {
+		if err := o.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error %v", o, err)
+		}
+	}
+	invalid := []ListOptions{{Output: "xml"}, {PerPage: -1}, {Page: 2}}
+	for _, o := range invalid {
+		if err := o.Validate(); err == nil {
+			t.Errorf("%+v: expected an error", o)
+		}
+	}
+}
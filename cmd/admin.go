@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"io"
 	"log/slog"
 	"os"
 
@@ -8,6 +9,8 @@ import (
 	"go-postfixadmin/internal/utils"
 
 	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 var (
@@ -21,33 +24,41 @@ var (
 	addSuperAdmin    string
 	cleanupMaildirs  bool
 	baseDir          string
+	listOutput       string
+	listDomain       string
+	listActive       bool
+	listSearch       string
+	listPage         int
+	listPerPage      int
 )
 
 var adminCmd = &cobra.Command{
 	Use:   "admin",
 	Short: "Admin management utilities",
 	Run: func(cmd *cobra.Command, args []string) {
-		// Connect to Database
-		db, err := utils.ConnectDB(dbUrl, dbDriver)
-		if err != nil {
-			slog.Error("Database connection failed", "error", err)
-			os.Exit(1)
+		opts := listOptions(cmd)
+
+		// Connect to Database, silently so that list output stays machine-readable
+		db := connectAdminDB()
+
+		list := func(lister func(*gorm.DB, io.Writer, admin.ListOptions) error) {
+			runList(db, opts, lister)
 		}
 
 		if listDomains {
-			admin.ListAllDomains(db)
+			list(admin.ListAllDomains)
 		} else if listMailboxes {
-			admin.ListAllMailboxes(db)
+			list(admin.ListAllMailboxes)
 		} else if listAdmins {
-			admin.ListAllAdmins(db)
+			list(admin.ListAllAdmins)
 		} else if listAliases {
-			admin.ListAllAliases(db)
+			list(admin.ListAllAliases)
 		} else if listAliasDomains {
-			admin.ListAllAliasDomains(db)
+			list(admin.ListAllAliasDomains)
 		} else if listDomainAdmins {
-			admin.ListDomainAdmins(db)
+			list(admin.ListDomainAdmins)
 		} else if listLogs {
-			admin.ListLogs(db)
+			list(admin.ListLogs)
 		} else if cleanupMaildirs {
 			admin.CleanupMaildirs(db, baseDir)
 		} else if addSuperAdmin != "" {
@@ -58,6 +69,59 @@ var adminCmd = &cobra.Command{
 	},
 }
 
+// connectAdminDB connects to the database for the admin subcommands, with the SQL logger silenced
+func connectAdminDB() *gorm.DB {
+	db, err := utils.ConnectDB(dbUrl, dbDriver)
+	if err != nil {
+		slog.Error("Database connection failed", "error", err)
+		os.Exit(1)
+	}
+	return db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+}
+
+// addListFlags adds the output, filter and pagination flags of list commands to cmd
+func addListFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&listOutput, "output", "o", "table", "Output format of list commands: table, json, csv or yaml")
+	cmd.Flags().StringVar(&listDomain, "domain", "", "Only list records of this domain")
+	cmd.Flags().BoolVar(&listActive, "active", true, "Only list active (--active) or inactive (--active=false) records")
+	cmd.Flags().StringVar(&listSearch, "search", "", "Only list records containing this text")
+	cmd.Flags().IntVar(&listPage, "page", 1, "Page to list (with --per-page)")
+	cmd.Flags().IntVar(&listPerPage, "per-page", 0, "Records per page (0 lists every record)")
+}
+
+// listOptions returns the list flags given to cmd, exiting when they are invalid
+func listOptions(cmd *cobra.Command) admin.ListOptions {
+	opts := admin.ListOptions{
+		Output:  listOutput,
+		Domain:  listDomain,
+		Active:  changed(cmd, "active", listActive),
+		Search:  listSearch,
+		Page:    listPage,
+		PerPage: listPerPage,
+	}
+	if err := opts.Validate(); err != nil {
+		slog.Error("Invalid list options", "error", err)
+		os.Exit(1)
+	}
+	return opts
+}
+
+// runList writes the records of lister to stdout, exiting when the listing fails
+func runList(db *gorm.DB, opts admin.ListOptions, lister func(*gorm.DB, io.Writer, admin.ListOptions) error) {
+	if err := lister(db, os.Stdout, opts); err != nil {
+		slog.Error("Failed to list records", "error", err)
+		os.Exit(1)
+	}
+}
+
+// changed returns a pointer to v when the flag was given on the command line, nil otherwise
+func changed[T any](cmd *cobra.Command, name string, v T) *T {
+	if !cmd.Flags().Changed(name) {
+		return nil
+	}
+	return &v
+}
+
 func init() {
 	rootCmd.AddCommand(adminCmd)
 	adminCmd.Flags().BoolVarP(&listDomains, "list-domains", "d", false, "List all domains")
@@ -70,4 +134,5 @@ func init() {
 	adminCmd.Flags().BoolVarP(&cleanupMaildirs, "cleanup-maildir", "c", false, "Clean up orphaned maildirs on the server")
 	adminCmd.Flags().StringVar(&addSuperAdmin, "add-superadmin", "", "Add a new superadmin (format: email:password)")
 	adminCmd.Flags().StringVar(&baseDir, "base-dir", "/var/vmail", "Base directory for maildirs")
+	addListFlags(adminCmd)
 }
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"go-postfixadmin/admin"
+
+	"github.com/spf13/cobra"
+)
+
+var aliasFlags struct {
+	recipients string
+	target     string
+	active     bool
+}
+
+var adminAliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Add, edit or delete aliases",
+}
+
+var adminAliasAddCmd = &cobra.Command{
+	Use:   "add <email> <recipients>",
+	Short: "Add an alias forwarding to a comma-separated list of recipients",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.AddAlias(connectAdminDB(), args[0], args[1], aliasFlags.active)
+	},
+}
+
+var adminAliasEditCmd = &cobra.Command{
+	Use:   "edit <email>",
+	Short: "Change the recipients or active flag of an alias",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.EditAlias(connectAdminDB(), args[0],
+			changed(cmd, "goto", aliasFlags.recipients),
+			changed(cmd, "active", aliasFlags.active))
+	},
+}
+
+var adminAliasDeleteCmd = &cobra.Command{
+	Use:   "delete <email>",
+	Short: "Delete an alias",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.DeleteAlias(connectAdminDB(), args[0])
+	},
+}
+
+var adminAliasDomainCmd = &cobra.Command{
+	Use:   "alias-domain",
+	Short: "Add, edit or delete alias domains",
+}
+
+var adminAliasDomainAddCmd = &cobra.Command{
+	Use:   "add <alias-domain> <target-domain>",
+	Short: "Add an alias domain delivering to the same addresses of the target domain",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.AddAliasDomain(connectAdminDB(), args[0], args[1], aliasFlags.active)
+	},
+}
+
+var adminAliasDomainEditCmd = &cobra.Command{
+	Use:   "edit <alias-domain>",
+	Short: "Change the target or active flag of an alias domain",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.EditAliasDomain(connectAdminDB(), args[0],
+			changed(cmd, "target", aliasFlags.target),
+			changed(cmd, "active", aliasFlags.active))
+	},
+}
+
+var adminAliasDomainDeleteCmd = &cobra.Command{
+	Use:   "delete <alias-domain>",
+	Short: "Delete an alias domain",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.DeleteAliasDomain(connectAdminDB(), args[0])
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{adminAliasAddCmd, adminAliasEditCmd, adminAliasDomainAddCmd, adminAliasDomainEditCmd} {
+		c.Flags().BoolVar(&aliasFlags.active, "active", true, "Whether the alias is active")
+	}
+	adminAliasEditCmd.Flags().StringVar(&aliasFlags.recipients, "goto", "", "Comma-separated list of recipients")
+	adminAliasDomainEditCmd.Flags().StringVar(&aliasFlags.target, "target", "", "Target domain")
+
+	adminAliasCmd.AddCommand(adminAliasAddCmd, adminAliasEditCmd, adminAliasDeleteCmd)
+	adminAliasDomainCmd.AddCommand(adminAliasDomainAddCmd, adminAliasDomainEditCmd, adminAliasDomainDeleteCmd)
+	adminCmd.AddCommand(adminAliasCmd, adminAliasDomainCmd)
+}
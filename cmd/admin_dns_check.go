@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"go-postfixadmin/admin"
+
+	"github.com/spf13/cobra"
+)
+
+var adminDNSCheckCmd = &cobra.Command{
+	Use:   "dns-check <domain>",
+	Short: "Check the DNS records of a domain, or of every active domain with ALL",
+	Long: `Check the MX, SPF, DMARC, DKIM, MTA-STS and TLS-RPT records of a domain against the
+configured mail hosts, or of every active domain with ALL. Exits with status 1 when a check fails.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.CheckDNS(connectAdminDB(), args[0])
+	},
+}
+
+func init() {
+	adminCmd.AddCommand(adminDNSCheckCmd)
+}
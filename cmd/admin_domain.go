@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"go-postfixadmin/admin"
+
+	"github.com/spf13/cobra"
+)
+
+var domainFlags struct {
+	description    string
+	aliases        int
+	mailboxes      int
+	quota          int64
+	transport      string
+	backupMX       bool
+	active         bool
+	passwordExpiry int
+	sendLimit      int
+}
+
+var adminDomainCmd = &cobra.Command{
+	Use:   "domain",
+	Short: "Add, edit, delete, export or import domains",
+}
+
+var adminDomainAddCmd = &cobra.Command{
+	Use:   "add <domain>",
+	Short: "Add a domain",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.AddDomain(connectAdminDB(), args[0], domainOptions(cmd))
+	},
+}
+
+var adminDomainEditCmd = &cobra.Command{
+	Use:   "edit <domain>",
+	Short: "Change the settings of a domain",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.EditDomain(connectAdminDB(), args[0], domainOptions(cmd))
+	},
+}
+
+var adminDomainDeleteCmd = &cobra.Command{
+	Use:   "delete <domain>",
+	Short: "Delete a domain with all its mailboxes and aliases",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.DeleteDomain(connectAdminDB(), args[0])
+	},
+}
+
+var domainBundleFlags struct {
+	output     string
+	format     string
+	onConflict string
+	dryRun     bool
+}
+
+var adminDomainExportCmd = &cobra.Command{
+	Use:   "export <domain>",
+	Short: "Export a domain with all its rows as a JSON or YAML bundle",
+	Long: `Export a domain with its mailboxes, aliases, alias domains, domain admins, vacations,
+fetchmail entries and DKIM keys as one JSON or YAML document, for "admin domain import" on
+another instance. The bundle contains password hashes and DKIM private keys; fetchmail
+passwords stay encrypted with [fetchmail] encryption_key. Maildirs are not included.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := admin.ExportDomain(connectAdminDB(), args[0], domainBundleFlags.output, domainBundleFlags.format); err != nil {
+			slog.Error("Failed to export domain", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var adminDomainImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Recreate a domain from a bundle written by export",
+	Long: `Recreate a domain from a bundle written by "admin domain export", in one transaction.
+Rows that already exist are kept (--on-conflict skip), replaced (overwrite) or make the
+whole import fail (fail). --dry-run reports what would happen without changing anything.
+Use - to read the bundle from stdin.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := admin.ImportDomain(connectAdminDB(), args[0], domainBundleFlags.format, domainBundleFlags.onConflict, domainBundleFlags.dryRun); err != nil {
+			slog.Error("Failed to import domain", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func domainOptions(cmd *cobra.Command) admin.DomainOptions {
+	return admin.DomainOptions{
+		Description:    changed(cmd, "description", domainFlags.description),
+		Aliases:        changed(cmd, "aliases", domainFlags.aliases),
+		Mailboxes:      changed(cmd, "mailboxes", domainFlags.mailboxes),
+		Quota:          changed(cmd, "quota", domainFlags.quota),
+		Transport:      changed(cmd, "transport", domainFlags.transport),
+		BackupMX:       changed(cmd, "backup-mx", domainFlags.backupMX),
+		Active:         changed(cmd, "active", domainFlags.active),
+		PasswordExpiry: changed(cmd, "password-expiry", domainFlags.passwordExpiry),
+		SendLimit:      changed(cmd, "send-limit", domainFlags.sendLimit),
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{adminDomainAddCmd, adminDomainEditCmd} {
+		c.Flags().StringVar(&domainFlags.description, "description", "", "Description of the domain")
+		c.Flags().IntVar(&domainFlags.aliases, "aliases", 10, "Maximum number of aliases (0 = unlimited, -1 = disabled)")
+		c.Flags().IntVar(&domainFlags.mailboxes, "mailboxes", 10, "Maximum number of mailboxes (0 = unlimited, -1 = disabled)")
+		c.Flags().Int64Var(&domainFlags.quota, "quota", 2048, "Maximum quota limit in MB (0 = unlimited)")
+		c.Flags().StringVar(&domainFlags.transport, "transport", "", "Postfix transport of the domain")
+		c.Flags().BoolVar(&domainFlags.backupMX, "backup-mx", false, "Act as backup MX for the domain")
+		c.Flags().BoolVar(&domainFlags.active, "active", true, "Whether the domain is active")
+		c.Flags().IntVar(&domainFlags.passwordExpiry, "password-expiry", 0, "Days after which mailbox passwords expire (0 = never)")
+		c.Flags().IntVar(&domainFlags.sendLimit, "send-limit", 0, "Messages per hour for all mailboxes together (0 = unlimited)")
+	}
+	for _, c := range []*cobra.Command{adminDomainExportCmd, adminDomainImportCmd} {
+		c.Flags().StringVar(&domainBundleFlags.format, "format", "", "Bundle format: json or yaml (default: from the file extension, else json)")
+	}
+	adminDomainExportCmd.Flags().StringVarP(&domainBundleFlags.output, "output", "o", "", "Write the bundle to this new file instead of stdout")
+	adminDomainImportCmd.Flags().StringVar(&domainBundleFlags.onConflict, "on-conflict", "fail", "What to do with rows that already exist: skip, overwrite or fail")
+	adminDomainImportCmd.Flags().BoolVar(&domainBundleFlags.dryRun, "dry-run", false, "Only report what would be imported")
+
+	adminDomainCmd.AddCommand(adminDomainAddCmd, adminDomainEditCmd, adminDomainDeleteCmd, adminDomainExportCmd, adminDomainImportCmd)
+	adminCmd.AddCommand(adminDomainCmd)
+}
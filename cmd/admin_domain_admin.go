@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"go-postfixadmin/admin"
+
+	"github.com/spf13/cobra"
+)
+
+var adminDomainAdminCmd = &cobra.Command{
+	Use:   "domain-admin",
+	Short: "Grant or revoke the domains an administrator manages",
+}
+
+var adminDomainAdminGrantCmd = &cobra.Command{
+	Use:   "grant <admin> <domain>",
+	Short: "Let an administrator manage a domain",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.GrantDomainAdmin(connectAdminDB(), args[0], args[1])
+	},
+}
+
+var adminDomainAdminRevokeCmd = &cobra.Command{
+	Use:   "revoke <admin> <domain>",
+	Short: "Stop an administrator from managing a domain",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.RevokeDomainAdmin(connectAdminDB(), args[0], args[1])
+	},
+}
+
+func init() {
+	adminDomainAdminCmd.AddCommand(adminDomainAdminGrantCmd, adminDomainAdminRevokeCmd)
+	adminCmd.AddCommand(adminDomainAdminCmd)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"go-postfixadmin/admin"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var importFlags struct {
+	format      string
+	dryRun      bool
+	generate    bool
+	batchSize   int
+	credentials string
+}
+
+var adminImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import mailboxes and aliases from a CSV or JSON file",
+	Long: `Create mailboxes and aliases from a CSV file with a header line, or a JSON array of
+objects with the same fields: type (mailbox or alias), address, name, password, quota (MB),
+goto and active. For an alias, goto lists its recipients; for a mailbox, the addresses it
+forwards a copy to. Use - to read from stdin.
+
+Every row is validated first, including the mailbox and alias limits of its domain. Nothing
+is imported while a row is invalid; --dry-run only shows the validation result. Rows are
+created in one transaction per batch; when one fails, the batches before it stay imported
+and their generated passwords are still written.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := utils.ImportOptions{
+			DryRun:            importFlags.dryRun,
+			GeneratePasswords: importFlags.generate,
+			BatchSize:         importFlags.batchSize,
+		}
+		if err := admin.ImportAccounts(connectAdminDB(), args[0], importFlags.format, opts, importFlags.credentials); err != nil {
+			slog.Error("Failed to import accounts", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	adminImportCmd.Flags().StringVar(&importFlags.format, "format", "", "File format: csv or json (default: from the file extension)")
+	adminImportCmd.Flags().BoolVar(&importFlags.dryRun, "dry-run", false, "Only validate the rows")
+	adminImportCmd.Flags().BoolVar(&importFlags.generate, "generate-passwords", false, "Generate the password of mailboxes without one")
+	adminImportCmd.Flags().IntVar(&importFlags.batchSize, "batch-size", 100, "Rows per transaction")
+	adminImportCmd.Flags().StringVar(&importFlags.credentials, "credentials", "", "Write generated passwords to this new file instead of stdout")
+	adminCmd.AddCommand(adminImportCmd)
+}
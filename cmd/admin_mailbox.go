@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"go-postfixadmin/admin"
+
+	"github.com/spf13/cobra"
+)
+
+var mailboxFlags struct {
+	password   string
+	name       string
+	quota      int64
+	active     bool
+	smtpActive bool
+	sendLimit  int
+	emailOther string
+}
+
+var adminMailboxCmd = &cobra.Command{
+	Use:   "mailbox",
+	Short: "Add, edit or delete mailboxes and change their password",
+}
+
+var adminMailboxAddCmd = &cobra.Command{
+	Use:   "add <email>",
+	Short: "Add a mailbox, generating a password unless --password is given",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.AddMailbox(connectAdminDB(), args[0], mailboxFlags.password, mailboxOptions(cmd))
+	},
+}
+
+var adminMailboxEditCmd = &cobra.Command{
+	Use:   "edit <email>",
+	Short: "Change the settings of a mailbox",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.EditMailbox(connectAdminDB(), args[0], mailboxOptions(cmd))
+	},
+}
+
+var adminMailboxPasswdCmd = &cobra.Command{
+	Use:   "passwd <email>",
+	Short: "Change the password of a mailbox, generating one unless --password is given",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.SetMailboxPassword(connectAdminDB(), args[0], mailboxFlags.password)
+	},
+}
+
+var adminMailboxDeleteCmd = &cobra.Command{
+	Use:   "delete <email>",
+	Short: "Delete a mailbox with its alias, vacation and app passwords",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.DeleteMailbox(connectAdminDB(), args[0])
+	},
+}
+
+func mailboxOptions(cmd *cobra.Command) admin.MailboxOptions {
+	return admin.MailboxOptions{
+		Name:       changed(cmd, "name", mailboxFlags.name),
+		Quota:      changed(cmd, "quota", mailboxFlags.quota),
+		Active:     changed(cmd, "active", mailboxFlags.active),
+		SMTPActive: changed(cmd, "smtp-active", mailboxFlags.smtpActive),
+		SendLimit:  changed(cmd, "send-limit", mailboxFlags.sendLimit),
+		EmailOther: changed(cmd, "email-other", mailboxFlags.emailOther),
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{adminMailboxAddCmd, adminMailboxEditCmd} {
+		c.Flags().StringVar(&mailboxFlags.name, "name", "", "Full name of the mailbox owner")
+		c.Flags().Int64Var(&mailboxFlags.quota, "quota", 0, "Quota in MB (0 = unlimited)")
+		c.Flags().BoolVar(&mailboxFlags.active, "active", true, "Whether the mailbox is active")
+		c.Flags().BoolVar(&mailboxFlags.smtpActive, "smtp-active", true, "Whether the mailbox may send mail")
+		c.Flags().IntVar(&mailboxFlags.sendLimit, "send-limit", 0, "Messages per hour (0 = unlimited)")
+		c.Flags().StringVar(&mailboxFlags.emailOther, "email-other", "", "Recovery email address")
+	}
+	for _, c := range []*cobra.Command{adminMailboxAddCmd, adminMailboxPasswdCmd} {
+		c.Flags().StringVar(&mailboxFlags.password, "password", "", "Password (generated when empty)")
+	}
+	adminMailboxCmd.AddCommand(adminMailboxAddCmd, adminMailboxEditCmd, adminMailboxPasswdCmd, adminMailboxDeleteCmd)
+	adminCmd.AddCommand(adminMailboxCmd)
+}
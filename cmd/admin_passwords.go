@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"go-postfixadmin/admin"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var passwordsFlags struct {
+	sendReminders bool
+	reminderFrom  string
+}
+
+var adminPasswordsCmd = &cobra.Command{
+	Use:   "passwords",
+	Short: "Mailbox password expiry",
+}
+
+var adminPasswordsExpiringCmd = &cobra.Command{
+	Use:   "expiring <days>",
+	Short: "List mailboxes whose password expires within the given number of days",
+	Long: `List mailboxes whose password expires within the given number of days.
+
+With --send-reminders each of them is emailed a reminder instead, e.g. from a daily cron job.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		days, err := strconv.Atoi(args[0])
+		if err != nil || days <= 0 {
+			slog.Error("Invalid number of days", "days", args[0])
+			os.Exit(1)
+		}
+		if passwordsFlags.sendReminders {
+			admin.SendPasswordExpiryReminders(connectAdminDB(), days, passwordsFlags.reminderFrom)
+			return
+		}
+		opts := listOptions(cmd)
+		runList(connectAdminDB(), opts, func(db *gorm.DB, w io.Writer, opts admin.ListOptions) error {
+			return admin.ListExpiringPasswords(db, days, w, opts)
+		})
+	},
+}
+
+func init() {
+	adminPasswordsExpiringCmd.Flags().BoolVar(&passwordsFlags.sendReminders, "send-reminders", false, "Email a reminder to each expiring mailbox")
+	adminPasswordsExpiringCmd.Flags().StringVar(&passwordsFlags.reminderFrom, "reminder-from", "", "Sender of reminder emails (default: postmaster@<mailbox domain>)")
+	addListFlags(adminPasswordsExpiringCmd)
+
+	adminPasswordsCmd.AddCommand(adminPasswordsExpiringCmd)
+	adminCmd.AddCommand(adminPasswordsCmd)
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+
+	"go-postfixadmin/admin"
+
+	"github.com/spf13/cobra"
+)
+
+var tokenFlags struct {
+	name     string
+	domains  string
+	readOnly bool
+}
+
+var adminTokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Create, list or revoke API tokens",
+}
+
+var adminTokenCreateCmd = &cobra.Command{
+	Use:   "create <admin>",
+	Short: "Create an API token acting as the given admin",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		admin.CreateAPIToken(connectAdminDB(), args[0], tokenFlags.name, tokenFlags.domains, tokenFlags.readOnly)
+	},
+}
+
+var adminTokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all API tokens",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := listOptions(cmd)
+		runList(connectAdminDB(), opts, admin.ListAPITokens)
+	},
+}
+
+var adminTokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revoke the API token with the given ID",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.Atoi(args[0])
+		if err != nil || id <= 0 {
+			slog.Error("Invalid token ID", "id", args[0])
+			os.Exit(1)
+		}
+		admin.RevokeAPIToken(connectAdminDB(), id)
+	},
+}
+
+func init() {
+	adminTokenCreateCmd.Flags().StringVar(&tokenFlags.name, "name", "", "Name of the API token")
+	adminTokenCreateCmd.Flags().StringVar(&tokenFlags.domains, "domains", "", "Comma-separated domains the token is restricted to")
+	adminTokenCreateCmd.Flags().BoolVar(&tokenFlags.readOnly, "read-only", false, "Only allow read requests")
+	addListFlags(adminTokenListCmd)
+
+	adminTokenCmd.AddCommand(adminTokenCreateCmd, adminTokenListCmd, adminTokenRevokeCmd)
+	adminCmd.AddCommand(adminTokenCmd)
+}
@@ -3,7 +3,14 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 func generateConfig() {
@@ -17,6 +24,9 @@ url = "postfix:postfixPassword@tcp(localhost:3306)/postfix?charset=utf8mb4&parse
 # Server Port (default 8080)
 port = 8080
 clean_up_maildir = false # Clean up orphaned maildirs when deleting a mailbox
+# Proxies whose X-Forwarded-For header gives the client IP (addresses or CIDR ranges).
+# Leave empty when clients connect directly: the header is then ignored.
+trusted_proxies = []
 
 [ssl]
 #enabled = false
@@ -34,6 +44,15 @@ multiplier   = 1024000 # Bytes per MB: 1024000 or 1048576
 
 [vacation]
 enabled = true
+# Auto-responder run by "postfixadmin vacation" from a Postfix pipe transport
+# Autoreply domain routed to the vacation transport. When set, activating a vacation adds
+# user#domain@<domain> to the alias of the mailbox and deactivating it removes it again.
+domain              = "autoreply.example.org"
+recipient_delimiter = "+"
+noreply_pattern     = ""           # Extra senders never answered, e.g. "bounce|facebook|linkedin"
+no_vacation_pattern = ""           # To: headers never answered, e.g. "info@example\\.org"
+date_format         = "2006-01-02" # Go layout for <%From_Date> and <%Until_Date> in the body
+check_interval      = "1m"         # How often the server starts and ends scheduled vacations
 
 [alias]
 edit_alias          = true
@@ -50,6 +69,85 @@ default  = "virtual"
 [features]
 fetchmail = false
 
+[fetchmail]
+# Key that encrypts the stored source passwords (AES-256-GCM), e.g. "openssl rand -hex 32".
+# Source passwords cannot be saved without it; changing the key makes saved ones unreadable.
+encryption_key = ""
+# "postfixadmin fetchmail" hands the fetched messages to the local MTA (smtp) or an LMTP server (lmtp)
+delivery = "smtp"
+delivery_address = "127.0.0.1:25" # "host:port" or "unix:/path", e.g. "unix:/var/run/dovecot/lmtp"
+check_interval = "1m"             # How often the poll times of the entries are checked
+state_file = ""                   # Remembers the POP3 messages already fetched from accounts that keep them on the server
+
+[dkim]
+# Where the exported key files are installed, used for the paths in the exported tables
+opendkim_key_dir = "/etc/opendkim/keys"
+rspamd_key_dir   = "/var/lib/rspamd/dkim"
+
+[dns]
+# Hosts the MX records of every domain should point to, checked by the DNS status page
+mail_hosts  = [] # e.g. ["mail.example.com"]
+spf_include = "" # SPF record of the mail hosts, e.g. "_spf.example.com"
+timeout     = "10s"
+
+[totp]
+issuer = "Go-PostfixAdmin" # Name shown in authenticator apps
+
+[security]
+# The admin portal, the user portal and Dovecot logins count their failures separately
+enabled         = true
+max_failures    = 5     # Failed logins per username before it is locked
+max_failures_ip = 20    # Failed logins per client IP before it is locked
+failure_window  = "15m" # Failures older than this are forgotten
+lockout         = "1m"  # First lockout, doubled for every further failure
+max_lockout     = "1h"
+
+[password]
+# Scheme for new passwords: bcrypt | sha512-crypt | argon2i | argon2id |
+# dovecot:BLF-CRYPT | dovecot:SHA512-CRYPT | dovecot:ARGON2I | dovecot:ARGON2ID
+# Passwords stored with another scheme are rehashed at the next successful login.
+scheme          = "bcrypt"
+allow_plaintext = false # Accept unhashed passwords left in the database (not recommended)
+
+[password_policy]
+min_length        = 8
+require_lower     = false
+require_upper     = false
+require_digit     = false
+require_symbol    = false
+disallow_username = false # Reject passwords containing the local part or domain
+history           = 0     # Number of previous passwords that cannot be reused (0 = off)
+breached_file     = ""    # Local list of breached passwords, plain or SHA-1 hex per line
+
+[password_reset]
+enabled   = false
+base_url  = "https://mail.example.com" # Public URL used in reset links (required)
+from      = ""                         # Sender address (default: noreply@<base_url host>)
+token_ttl = "1h"                       # How long a reset link stays valid
+
+[dovecot]
+# HTTP passdb/userdb endpoints under /dovecot for Dovecot auth-lua
+# (see DOCUMENTS/setup/dovecot-auth.lua). Requests must send "Authorization: Bearer <secret>".
+enabled  = false
+secret   = ""           # Shared secret, required when enabled
+base_dir = "/var/vmail" # Mail home is base_dir/maildir
+uid      = 1001         # vmail user and group
+gid      = 1001
+
+[socketmap]
+# "postfixadmin socketmap": Postfix lookups for domains, mailboxes, aliases and transports
+listen         = "127.0.0.1:9998" # "host:port" or "unix:/path"
+cache_ttl      = "1m"             # How long a lookup result is reused
+stale_ttl      = "24h"            # How long cached results (not misses) are served while the database is down
+check_interval = "10s"            # How often the log table is checked for changes (expires the cache)
+
+[policyd]
+# "postfixadmin policyd": Postfix policy service for authenticated senders
+listen                 = "127.0.0.1:10040" # "host:port" or "unix:/path"
+reject_sender_mismatch = true              # Reject envelope senders the SASL login does not own
+state_file             = ""                # Keep the hourly send counters across restarts (empty = memory only)
+save_interval          = "1m"
+
 [smtp]
 server  = "localhost"
 port    = 25
@@ -67,3 +165,68 @@ type    = "plain" # type: plain | tls | starttls
 		fmt.Printf("Successfully generated %s in the current directory.\n", fileName)
 	}
 }
+
+// generateMaps writes the Postfix map files and dovecot-sql.conf.ext matching the configured
+// database to dir, and with check runs every query against the live database
+func generateMaps(dir string, check bool) {
+	dsn, driver := utils.ResolveDSN(dbUrl, dbDriver)
+	files, err := utils.GenerateMailMapFiles(dsn, driver)
+	if err != nil {
+		fmt.Printf("Error generating map files: %v\n", err)
+		os.Exit(1)
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			fmt.Printf("Error creating %s: %v\n", dir, err)
+			os.Exit(1)
+		}
+		for _, f := range files {
+			path := filepath.Join(dir, f.Name)
+			// The files contain the database password
+			if err := os.WriteFile(path, []byte(f.Content), 0640); err != nil {
+				fmt.Printf("Error writing %s: %v\n", path, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Generated %s\n", path)
+		}
+	}
+
+	if check {
+		checkMaps(dsn, driver, files)
+	}
+}
+
+// checkMaps runs the generated queries with the first active mailbox as sample key
+func checkMaps(dsn, driver string, files []utils.MailMapFile) {
+	db, err := utils.ConnectDB(dsn, driver)
+	if err != nil {
+		fmt.Printf("Database connection failed: %v\n", err)
+		os.Exit(1)
+	}
+	db = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+
+	sample := "postmaster@example.com"
+	var mailbox models.Mailbox
+	if err := db.Where("active = ?", true).Order("username").First(&mailbox).Error; err == nil {
+		sample = mailbox.Username
+	}
+	fmt.Printf("Checking queries with %s\n", sample)
+
+	failed := 0
+	for _, f := range files {
+		for _, q := range f.Queries {
+			rows, err := utils.CheckMailMapQuery(db, f, q, sample)
+			if err != nil {
+				failed++
+				fmt.Printf("FAIL %s: %v\n", f.Name, err)
+				continue
+			}
+			fmt.Printf("OK   %s (%d rows)\n", f.Name, rows)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d queries failed\n", failed)
+		os.Exit(1)
+	}
+}
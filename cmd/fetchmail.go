@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go-postfixadmin/internal/fetchmail"
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var fetchmailOnce bool
+
+var fetchmailCmd = &cobra.Command{
+	Use:   "fetchmail",
+	Short: "Fetch mail from the remote POP3/IMAP accounts of the fetchmail table",
+	Long: `Poll the active entries of the fetchmail table every poll_time minutes, like fetchmail.pl,
+and deliver the messages to their mailbox through the local MTA (SMTP) or an LMTP server,
+as set in [fetchmail] delivery and delivery_address. Messages are deleted from the remote
+server unless "keep" is set. The outcome of each poll is shown in the web interface.
+
+With --once every due entry is polled a single time, e.g. from cron.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		delivery := viper.GetString("fetchmail.delivery")
+		if delivery == "" {
+			delivery = "smtp"
+		}
+		if delivery != "smtp" && delivery != "lmtp" {
+			slog.Error(`fetchmail.delivery must be "smtp" or "lmtp"`, "delivery", delivery)
+			os.Exit(1)
+		}
+		address := viper.GetString("fetchmail.delivery_address")
+		if address == "" {
+			address = "127.0.0.1:25"
+		}
+
+		db, err := utils.ConnectDB(dbUrl, dbDriver)
+		if err != nil {
+			slog.Error("Database connection failed", "error", err)
+			os.Exit(1)
+		}
+		db = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+
+		hostname, _ := os.Hostname()
+		deliverer := &fetchmail.Deliverer{Address: address, LMTP: delivery == "lmtp", Hostname: hostname}
+
+		seen := fetchmail.NewSeen()
+		stateFile := viper.GetString("fetchmail.state_file")
+		if stateFile != "" {
+			if err := seen.Load(stateFile); err != nil {
+				slog.Warn("Failed to load fetched message IDs", "file", stateFile, "error", err)
+			}
+		}
+		saveSeen := func() {
+			if stateFile == "" {
+				return
+			}
+			if err := seen.Save(stateFile); err != nil {
+				slog.Warn("Failed to save fetched message IDs", "file", stateFile, "error", err)
+			}
+		}
+
+		poller := &fetchmail.Poller{
+			Password: utils.DecryptSecret,
+			Deliver:  deliverer.Deliver,
+			Seen:     seen,
+			Hostname: hostname,
+		}
+
+		if fetchmailOnce {
+			pollFetchmail(db, poller, time.Now())
+			saveSeen()
+			return
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		ticker := time.NewTicker(durationOr("fetchmail.check_interval", time.Minute))
+		defer ticker.Stop()
+
+		slog.Info("Polling fetchmail entries", "delivery", delivery, "address", address)
+		for {
+			pollFetchmail(db, poller, time.Now())
+			saveSeen()
+			select {
+			case <-ticker.C:
+			case <-signals:
+				return
+			}
+		}
+	},
+}
+
+// pollFetchmail polls the active entries whose poll time has elapsed and records the outcome
+// in returned_text and date
+func pollFetchmail(db *gorm.DB, poller *fetchmail.Poller, now time.Time) {
+	var entries []models.Fetchmail
+	if err := db.Where("active = ?", true).Order("id ASC").Find(&entries).Error; err != nil {
+		slog.Warn("Failed to load fetchmail entries", "error", err)
+		return
+	}
+
+	for _, f := range entries {
+		if !fetchmail.Due(f, now) {
+			continue
+		}
+		result := poller.Poll(f)
+		if result.Err != nil {
+			slog.Warn("Fetchmail poll failed", "id", f.ID, "mailbox", f.Mailbox, "server", f.SrcServer, "fetched", result.Fetched, "error", result.Err)
+		} else if result.Fetched > 0 {
+			slog.Info("Fetched messages", "id", f.ID, "mailbox", f.Mailbox, "server", f.SrcServer, "fetched", result.Fetched)
+		}
+
+		err := db.Model(&models.Fetchmail{}).Where("id = ?", f.ID).UpdateColumns(map[string]interface{}{
+			"returned_text": result.String(),
+			"date":          now,
+		}).Error
+		if err != nil {
+			slog.Warn("Failed to record fetchmail result", "id", f.ID, "error", err)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(fetchmailCmd)
+	fetchmailCmd.Flags().BoolVar(&fetchmailOnce, "once", false, "Poll the due entries once and exit")
+}
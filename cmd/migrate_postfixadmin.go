@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"go-postfixadmin/admin"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var fromPostfixAdminFlags struct {
+	sourceURL      string
+	sourceDriver   string
+	tablePrefix    string
+	onConflict     string
+	dryRun         bool
+	hashPlaintext  bool
+	skipLog        bool
+	vacationDomain string
+}
+
+var migrateFromPostfixAdminCmd = &cobra.Command{
+	Use:   "from-postfixadmin",
+	Short: "Import the database of a PHP PostfixAdmin installation",
+	Long: `Copy the domains, admins, domain admins, mailboxes, aliases, alias domains, vacations,
+fetchmail entries, app passwords, TOTP exceptions, DKIM keys, config and log of a PHP
+PostfixAdmin database into the configured database, in one transaction. The tables are
+created first like "migrate" does.
+
+Older schema versions are read column by column: missing columns get the values PostfixAdmin's
+upgrades gave them, e.g. superadmins from the domain ALL and vacations without an end date.
+Password hashes are rewritten to forms Dovecot and the login both verify; hashes that cannot
+be verified are listed. A table of the rows read, created, updated and skipped and of the rows
+in the target afterwards reconciles the import.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		f := fromPostfixAdminFlags
+		src, err := utils.ConnectDB(sourceDSN(f.sourceURL, f.sourceDriver), f.sourceDriver)
+		if err != nil {
+			slog.Error("Failed to connect to the PostfixAdmin database", "error", err)
+			os.Exit(1)
+		}
+		src = src.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+
+		db := connectAdminDB()
+		if err := utils.MigrateDB(db); err != nil {
+			slog.Error("Database migration failed", "error", err)
+			os.Exit(1)
+		}
+
+		err = admin.MigrateFromPostfixAdmin(src, db, utils.PostfixAdminImportOptions{
+			TablePrefix:    f.tablePrefix,
+			OnConflict:     f.onConflict,
+			DryRun:         f.dryRun,
+			HashPlaintext:  f.hashPlaintext,
+			SkipLog:        f.skipLog,
+			VacationDomain: f.vacationDomain,
+		})
+		if err != nil {
+			slog.Error("Migration failed", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// sourceDSN adds parseTime to a MySQL DSN, which the date columns need
+func sourceDSN(dsn, driver string) string {
+	if driver == "postgres" || strings.Contains(strings.ToLower(dsn), "parsetime=") {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&parseTime=True"
+	}
+	return dsn + "?parseTime=True"
+}
+
+func init() {
+	flags := migrateFromPostfixAdminCmd.Flags()
+	flags.StringVar(&fromPostfixAdminFlags.sourceURL, "source-url", "", "Connection string of the PostfixAdmin database")
+	flags.StringVar(&fromPostfixAdminFlags.sourceDriver, "source-driver", "mysql", "Driver of the PostfixAdmin database (mysql or postgres)")
+	flags.StringVar(&fromPostfixAdminFlags.tablePrefix, "table-prefix", "", "Table prefix of the PostfixAdmin database ($CONF['database_prefix'])")
+	flags.StringVar(&fromPostfixAdminFlags.onConflict, "on-conflict", "fail", "What to do with rows that already exist: skip, overwrite or fail")
+	flags.BoolVar(&fromPostfixAdminFlags.dryRun, "dry-run", false, "Only report what would be imported")
+	flags.BoolVar(&fromPostfixAdminFlags.hashPlaintext, "hash-plaintext", false, "Hash clear text passwords (encrypt = cleartext) with the configured scheme")
+	flags.BoolVar(&fromPostfixAdminFlags.skipLog, "skip-log", false, "Do not import the log")
+	flags.StringVar(&fromPostfixAdminFlags.vacationDomain, "vacation-domain", "", "Autoreply domain of PostfixAdmin ($CONF['vacation_domain']), moved to [vacation] domain")
+	migrateFromPostfixAdminCmd.MarkFlagRequired("source-url")
+	migrateCmd.AddCommand(migrateFromPostfixAdminCmd)
+}
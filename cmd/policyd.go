@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/policyd"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var policydListen string
+
+var policydCmd = &cobra.Command{
+	Use:   "policyd",
+	Short: "Run the Postfix policy service (SMTP flag, sender login, send limits)",
+	Long: `Run a Postfix policy delegation service for authenticated senders. It rejects mailboxes
+that are inactive or have SMTP disabled, sender addresses the login does not own, and
+applies the hourly send limits of mailboxes and domains. Example main.cf:
+
+  smtpd_recipient_restrictions = check_policy_service inet:127.0.0.1:10040, ...`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("listen") && viper.GetString("policyd.listen") != "" {
+			policydListen = viper.GetString("policyd.listen")
+		}
+
+		db, err := utils.ConnectDB(dbUrl, dbDriver)
+		if err != nil {
+			slog.Error("Database connection failed", "error", err)
+			os.Exit(1)
+		}
+		db = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+
+		counters := policyd.NewCounters()
+		stateFile := viper.GetString("policyd.state_file")
+		if stateFile != "" {
+			if err := counters.Load(stateFile); err != nil {
+				slog.Warn("Failed to load send counters", "file", stateFile, "error", err)
+			}
+		}
+
+		checkSender := true
+		if viper.IsSet("policyd.reject_sender_mismatch") {
+			checkSender = viper.GetBool("policyd.reject_sender_mismatch")
+		}
+
+		srv := &policyd.Server{
+			Mailbox: func(login string) (models.Mailbox, error) {
+				return utils.ResolveMailboxLogin(db, login)
+			},
+			SenderAllowed: func(mailbox models.Mailbox, sender string) (bool, error) {
+				return utils.SenderAllowed(db, mailbox, sender)
+			},
+			DomainLimit: func(domain string) (int, error) {
+				var d models.Domain
+				err := db.Select("send_limit").Where("domain = ?", domain).First(&d).Error
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return 0, nil
+				}
+				return d.SendLimit, err
+			},
+			Counters:    counters,
+			CheckSender: checkSender,
+			Timeout:     5 * time.Minute,
+		}
+
+		l, err := utils.Listen(policydListen)
+		if err != nil {
+			slog.Error("Failed to listen", "address", policydListen, "error", err)
+			os.Exit(1)
+		}
+
+		saveCounters := func() {
+			if stateFile == "" {
+				return
+			}
+			if err := counters.Save(stateFile); err != nil {
+				slog.Warn("Failed to save send counters", "file", stateFile, "error", err)
+			}
+		}
+		if stateFile != "" {
+			go func() {
+				for range time.Tick(durationOr("policyd.save_interval", time.Minute)) {
+					saveCounters()
+				}
+			}()
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-signals
+			l.Close()
+		}()
+
+		slog.Info("Serving Postfix policy requests", "address", policydListen)
+		if err := srv.Serve(l); err != nil {
+			slog.Error("policyd server failed", "error", err)
+			saveCounters()
+			os.Exit(1)
+		}
+		saveCounters()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(policydCmd)
+	policydCmd.Flags().StringVar(&policydListen, "listen", "127.0.0.1:10040", `Address to listen on ("host:port" or "unix:/path")`)
+}
@@ -17,6 +17,8 @@ var (
 		Run: func(cmd *cobra.Command, args []string) {
 			if generateConfigFlag {
 				generateConfig()
+			} else if generateMapsDir != "" || checkMapsFlag {
+				generateMaps(generateMapsDir, checkMapsFlag)
 			} else {
 				cmd.Help()
 			}
@@ -28,6 +30,8 @@ var (
 	dbUrl              string
 	dbDriver           string
 	generateConfigFlag bool
+	generateMapsDir    string
+	checkMapsFlag      bool
 
 	// Shared resources
 	EmbeddedFiles embed.FS
@@ -62,6 +66,8 @@ func initConfig() {
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.Flags().BoolVar(&generateConfigFlag, "generate-config", false, "Generate a default config.toml file in the current directory")
+	rootCmd.Flags().StringVar(&generateMapsDir, "generate-maps", "", "Write the Postfix SQL map files and dovecot-sql.conf.ext for the configured database to this directory")
+	rootCmd.Flags().BoolVar(&checkMapsFlag, "check", false, "Test the generated Postfix/Dovecot queries against the live database")
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ./config.toml)")
 	rootCmd.PersistentFlags().StringVar(&dbUrl, "db-url", "", "Database URL connection string")
 	rootCmd.PersistentFlags().StringVar(&dbDriver, "db-driver", "", "Database driver (mysql or postgres)")
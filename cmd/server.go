@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"log/slog"
+	"time"
 
 	"go-postfixadmin/internal/server"
 	"go-postfixadmin/internal/utils"
@@ -53,6 +54,10 @@ var serverCmd = &cobra.Command{
 			db = nil
 		}
 
+		if db != nil && utils.VacationDomain() != "" {
+			go runVacationScheduler(db, durationOr("vacation.check_interval", time.Minute))
+		}
+
 		slog.Info("Starting Go-Postfixadmin...")
 		server.AppVersion = Version
 		server.StartServer(EmbeddedFiles, port, db, ssl, certFile, keyFile)
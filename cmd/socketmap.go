@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"go-postfixadmin/internal/socketmap"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var socketmapListen string
+
+var socketmapCmd = &cobra.Command{
+	Use:   "socketmap",
+	Short: "Serve Postfix socketmap lookups",
+	Long: `Serve Postfix socketmap lookups for the virtual domains, mailboxes, aliases, transports and
+backup MX relay domains.
+
+Maps: ` + strings.Join(utils.PostfixMaps, ", ") + `. Example main.cf:
+
+  virtual_mailbox_domains = socketmap:inet:127.0.0.1:9998:domain
+  virtual_mailbox_maps    = socketmap:inet:127.0.0.1:9998:mailbox
+  virtual_alias_maps      = socketmap:inet:127.0.0.1:9998:alias
+  transport_maps          = socketmap:inet:127.0.0.1:9998:transport
+  relay_domains           = socketmap:inet:127.0.0.1:9998:relay`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("listen") && viper.GetString("socketmap.listen") != "" {
+			socketmapListen = viper.GetString("socketmap.listen")
+		}
+
+		db, err := utils.ConnectDB(dbUrl, dbDriver)
+		if err != nil {
+			slog.Error("Database connection failed", "error", err)
+			os.Exit(1)
+		}
+		// Lookups run for every message; keep them out of the SQL log
+		db = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+
+		cache := socketmap.NewCache(durationOr("socketmap.cache_ttl", time.Minute), durationOr("socketmap.stale_ttl", 24*time.Hour))
+		srv := &socketmap.Server{
+			Lookup: func(mapName, key string) (string, bool, error) {
+				return utils.PostfixMapLookup(db, mapName, key)
+			},
+			Cache:   cache,
+			Timeout: 5 * time.Minute,
+		}
+
+		l, err := utils.Listen(socketmapListen)
+		if err != nil {
+			slog.Error("Failed to listen", "address", socketmapListen, "error", err)
+			os.Exit(1)
+		}
+
+		go watchMapChanges(db, cache, durationOr("socketmap.check_interval", 10*time.Second))
+
+		// SIGHUP drops the cache, SIGINT/SIGTERM stop the server
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			for sig := range signals {
+				if sig == syscall.SIGHUP {
+					cache.Flush()
+					slog.Info("socketmap cache flushed")
+					continue
+				}
+				l.Close()
+				return
+			}
+		}()
+
+		slog.Info("Serving Postfix socketmap lookups", "address", socketmapListen)
+		if err := srv.Serve(l); err != nil {
+			slog.Error("socketmap server failed", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// watchMapChanges expires the cache whenever a new entry appears in the log table, which
+// every change made through the web interface, the API and the CLI writes
+func watchMapChanges(db *gorm.DB, cache *socketmap.Cache, interval time.Duration) {
+	lastID, _ := utils.LastLogID(db)
+	for range time.Tick(interval) {
+		id, err := utils.LastLogID(db)
+		if err != nil {
+			continue
+		}
+		if id != lastID {
+			lastID = id
+			cache.Invalidate()
+		}
+		cache.Prune()
+	}
+}
+
+// durationOr reads a duration from the config, falling back to def when unset or invalid
+func durationOr(key string, def time.Duration) time.Duration {
+	if d := viper.GetDuration(key); d > 0 {
+		return d
+	}
+	return def
+}
+
+func init() {
+	rootCmd.AddCommand(socketmapCmd)
+	socketmapCmd.Flags().StringVar(&socketmapListen, "listen", "127.0.0.1:9998", `Address to listen on ("host:port" or "unix:/path")`)
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"time"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+	"go-postfixadmin/internal/vacation"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// exTempFail makes Postfix keep the message queued and retry the delivery later
+const exTempFail = 75
+
+var (
+	vacationSender string
+	vacationTest   bool
+)
+
+var vacationCmd = &cobra.Command{
+	Use:   "vacation -f sender -- recipient",
+	Short: "Answer a message for a mailbox on vacation (Postfix pipe transport)",
+	Long: `Read a message on standard input and send the vacation reply of the recipient, applying
+the loop, mailing list and bulk mail rules of vacation.pl. Postfix runs it for the autoreply
+domain set in [vacation] domain. Example master.cf:
+
+  vacation  unix  -  n  n  -  -  pipe
+    flags=Rq user=vacation argv=/usr/local/bin/postfixadmin vacation -f ${sender} -- ${recipient}
+
+and in transport_maps:
+
+  autoreply.example.org  vacation:`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		recipient := args[0]
+
+		noReply, err := optionalPattern("vacation.noreply_pattern")
+		if err != nil {
+			slog.Error("Invalid vacation.noreply_pattern", "error", err)
+			os.Exit(1)
+		}
+		noVacation, err := optionalPattern("vacation.no_vacation_pattern")
+		if err != nil {
+			slog.Error("Invalid vacation.no_vacation_pattern", "error", err)
+			os.Exit(1)
+		}
+
+		db, err := utils.ConnectDB(dbUrl, dbDriver)
+		if err != nil {
+			slog.Error("Database connection failed", "error", err)
+			os.Exit(exTempFail)
+		}
+		db = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+
+		vacationDomain := viper.GetString("vacation.domain")
+		delimiter := "+"
+		if viper.IsSet("vacation.recipient_delimiter") {
+			delimiter = viper.GetString("vacation.recipient_delimiter")
+		}
+
+		r := &vacation.Responder{
+			Domain:     vacationDomain,
+			Delimiter:  delimiter,
+			NoReply:    noReply,
+			NoVacation: noVacation,
+			DateFormat: viper.GetString("vacation.date_format"),
+			Find: func(recipient string) (models.Vacation, bool, error) {
+				return utils.FindVacation(db, recipient, vacationDomain, time.Now())
+			},
+			Notify: func(v models.Vacation, sender string) (bool, error) {
+				if vacationTest {
+					return true, nil
+				}
+				return utils.VacationNotify(db, v, sender, time.Now())
+			},
+			AccountName: func(email string) (string, error) {
+				var mailbox models.Mailbox
+				err := db.Select("name").Where("username = ?", email).First(&mailbox).Error
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return "", nil
+				}
+				return mailbox.Name, err
+			},
+			Send: func(from, to string, msg []byte) error {
+				if vacationTest {
+					_, err := os.Stdout.Write(msg)
+					return err
+				}
+				return utils.SendMessage(from, to, msg)
+			},
+		}
+
+		reason, err := r.Handle(os.Stdin, vacationSender, recipient)
+		if err != nil {
+			slog.Error("Vacation reply failed", "sender", vacationSender, "recipient", recipient, "error", err)
+			os.Exit(exTempFail)
+		}
+		if reason != "" {
+			slog.Info("No vacation reply", "sender", vacationSender, "recipient", recipient, "reason", reason)
+			return
+		}
+		slog.Info("Vacation reply sent", "to", vacationSender, "recipient", recipient)
+	},
+}
+
+// runVacationScheduler starts and stops routing to the vacation responder as vacation
+// periods begin and end. Each change is logged, which also refreshes the socketmap cache.
+func runVacationScheduler(db *gorm.DB, interval time.Duration) {
+	db = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	for ; ; time.Sleep(interval) {
+		changes, err := utils.ApplyVacationSchedule(db, time.Now())
+		if err != nil {
+			slog.Warn("Vacation scheduler failed", "error", err)
+		}
+		for _, change := range changes {
+			action := "vacation_ended"
+			if change.Started {
+				action = "vacation_started"
+			}
+			slog.Info("Vacation schedule", "email", change.Email, "action", action)
+			if err := utils.LogAction(db, "scheduler", "127.0.0.1", change.Domain, action, change.Email); err != nil {
+				fmt.Printf("Failed to log %s: %v\n", action, err)
+			}
+		}
+	}
+}
+
+// optionalPattern compiles a case-insensitive regular expression from the config, nil when unset
+func optionalPattern(key string) (*regexp.Regexp, error) {
+	pattern := viper.GetString(key)
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
+
+func init() {
+	rootCmd.AddCommand(vacationCmd)
+	vacationCmd.Flags().StringVarP(&vacationSender, "sender", "f", "", "Envelope sender of the message")
+	vacationCmd.Flags().BoolVarP(&vacationTest, "test", "t", false, "Print the reply instead of sending it and recording the notification")
+	vacationCmd.MarkFlagRequired("sender")
+}
@@ -0,0 +1,177 @@
+// Package fetchmail talks to the remote POP3 and IMAP servers configured in the fetchmail
+// table: connection tests from the web interface and the poller of "postfixadmin fetchmail".
+package fetchmail
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+)
+
+// DefaultTimeout bounds connecting to a server and every command sent to it
+const DefaultTimeout = 30 * time.Second
+
+// Source is a remote mailbox to fetch from
+type Source struct {
+	Protocol    string // POP3 or IMAP
+	Server      string
+	Port        int // 0 selects the standard port of the protocol
+	User        string
+	Password    string
+	Folder      string // IMAP folder, INBOX when empty
+	SSL         bool   // implicit TLS (pop3s, imaps)
+	CertCheck   bool   // verify the server certificate
+	Fingerprint string // MD5 or SHA-256 fingerprint the certificate must have, hex with optional colons
+	Timeout     time.Duration
+}
+
+// SourceFrom builds the source of a fetchmail entry with its decrypted password
+func SourceFrom(f models.Fetchmail, password string) Source {
+	s := Source{
+		Server:    f.SrcServer,
+		Port:      f.SrcPort,
+		User:      f.SrcUser,
+		Password:  password,
+		Folder:    f.SrcFolder,
+		SSL:       f.UseSSL,
+		CertCheck: f.SSLCertCk,
+	}
+	if f.Protocol != nil {
+		s.Protocol = *f.Protocol
+	}
+	if f.SSLFingerprint != nil {
+		s.Fingerprint = *f.SSLFingerprint
+	}
+	return s
+}
+
+// Address returns host:port of the server, with the standard port when none is set
+func (s Source) Address() string {
+	port := s.Port
+	if port == 0 {
+		switch {
+		case s.isIMAP() && s.SSL:
+			port = 993
+		case s.isIMAP():
+			port = 143
+		case s.SSL:
+			port = 995
+		default:
+			port = 110
+		}
+	}
+	return net.JoinHostPort(s.Server, strconv.Itoa(port))
+}
+
+func (s Source) isIMAP() bool {
+	return strings.EqualFold(s.Protocol, "IMAP")
+}
+
+func (s Source) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultTimeout
+}
+
+// dial opens the connection, with TLS when SSL is set
+func (s Source) dial() (net.Conn, error) {
+	if s.Server == "" {
+		return nil, errors.New("no server configured")
+	}
+	dialer := &net.Dialer{Timeout: s.timeout()}
+	if !s.SSL {
+		return dialer.Dial("tcp", s.Address())
+	}
+	config := &tls.Config{
+		ServerName:         s.Server,
+		InsecureSkipVerify: !s.CertCheck,
+	}
+	if s.Fingerprint != "" {
+		want := strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(s.Fingerprint))
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 || !fingerprintMatches(cs.PeerCertificates[0], want) {
+				return errors.New("server certificate does not match the configured fingerprint")
+			}
+			return nil
+		}
+	}
+	return tls.DialWithDialer(dialer, "tcp", s.Address(), config)
+}
+
+// fingerprintMatches compares a certificate with a hex MD5 (as written by fetchmail) or
+// SHA-256 fingerprint
+func fingerprintMatches(cert *x509.Certificate, want string) bool {
+	md5Sum := md5.Sum(cert.Raw)
+	sha256Sum := sha256.Sum256(cert.Raw)
+	return want == hex.EncodeToString(md5Sum[:]) || want == hex.EncodeToString(sha256Sum[:])
+}
+
+// conn is a line based protocol connection with a deadline per command
+type conn struct {
+	*textproto.Conn
+	raw     net.Conn
+	timeout time.Duration
+}
+
+func (c *conn) deadline() {
+	c.raw.SetDeadline(time.Now().Add(c.timeout))
+}
+
+// Message identifies a message on the remote server
+type Message struct {
+	ID  string // POP3 message number or IMAP UID, valid for the session
+	UID string // identifier that stays the same across sessions, "" when the server has none
+}
+
+// Client is a logged in session with a remote mailbox
+type Client interface {
+	// List returns the messages to fetch. IMAP returns only unseen messages unless all is
+	// set; POP3 has no seen flag and always returns every message.
+	List(all bool) ([]Message, error)
+	// Retrieve returns a message. IMAP marks it seen.
+	Retrieve(m Message) ([]byte, error)
+	// Delete removes a message when the session is closed
+	Delete(m Message) error
+	// Close ends the session
+	Close() error
+}
+
+// Connect connects to the source and logs in; for IMAP the folder is selected
+func Connect(s Source) (Client, error) {
+	switch strings.ToUpper(s.Protocol) {
+	case "POP3":
+		c, err := connectPOP3(s)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	case "IMAP":
+		c, err := connectIMAP(s)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("protocol %q is not supported, use POP3 or IMAP", s.Protocol)
+}
+
+// Test connects to the source, logs in and disconnects again
+func Test(s Source) error {
+	client, err := Connect(s)
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
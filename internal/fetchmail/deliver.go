@@ -0,0 +1,79 @@
+package fetchmail
+
+import (
+	"bytes"
+	"fmt"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/utils"
+)
+
+// Deliverer hands fetched messages to the local MTA over SMTP, or straight to the mailbox
+// store over LMTP
+type Deliverer struct {
+	Address  string // "host:port" or "unix:/path"
+	LMTP     bool
+	Hostname string // name announced in EHLO/LHLO
+	Timeout  time.Duration
+}
+
+// Deliver sends msg from the envelope sender from ("" for the null sender) to one recipient
+func (d *Deliverer) Deliver(from, to string, msg []byte) error {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	raw, err := utils.Dial(d.Address, timeout)
+	if err != nil {
+		return err
+	}
+	defer raw.Close()
+	raw.SetDeadline(time.Now().Add(timeout))
+	c := textproto.NewConn(raw)
+
+	hostname := d.Hostname
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	greeting := "EHLO"
+	if d.LMTP {
+		greeting = "LHLO"
+	}
+
+	if _, _, err := c.ReadResponse(220); err != nil {
+		return fmt.Errorf("greeting: %w", err)
+	}
+	steps := []struct {
+		cmd  string
+		code int
+	}{
+		{greeting + " " + hostname, 250},
+		{"MAIL FROM:<" + from + ">", 250},
+		{"RCPT TO:<" + to + ">", 250},
+		{"DATA", 354},
+	}
+	for _, step := range steps {
+		if _, err := c.Cmd("%s", step.cmd); err != nil {
+			return err
+		}
+		if _, _, err := c.ReadResponse(step.code); err != nil {
+			return fmt.Errorf("%s: %w", strings.Fields(step.cmd)[0], err)
+		}
+	}
+
+	w := c.DotWriter()
+	if _, err := w.Write(bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\n"))); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	// LMTP answers the data once per recipient, SMTP once
+	if _, _, err := c.ReadResponse(250); err != nil {
+		return fmt.Errorf("DATA: %w", err)
+	}
+	c.Cmd("QUIT")
+	return nil
+}
@@ -0,0 +1,589 @@
+package fetchmail
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-postfixadmin/internal/models"
+)
+
+// fakeServer serves one connection at a time with handle and returns its port
+func fakeServer(t *testing.T, handle func(c *textproto.Conn)) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serve(t, l, handle)
+}
+
+// fakeTLSServer is fakeServer over implicit TLS with a self-signed certificate, which it
+// returns with the port
+func fakeTLSServer(t *testing.T, handle func(c *textproto.Conn)) (int, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serve(t, l, handle), cert
+}
+
+// serve accepts connections on l until the test ends
+func serve(t *testing.T, l net.Listener, handle func(c *textproto.Conn)) int {
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			raw, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c := textproto.NewConn(raw)
+			handle(c)
+			c.Close()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+type fakeMessage struct {
+	uid     string
+	data    string
+	seen    bool
+	deleted bool
+}
+
+// fakeMailbox is the remote mailbox of the fake servers, user "user" with password `se"cret`
+type fakeMailbox struct {
+	mu       sync.Mutex
+	messages []*fakeMessage
+	nextUID  int
+}
+
+func (mb *fakeMailbox) add(data string) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.nextUID++
+	mb.messages = append(mb.messages, &fakeMessage{uid: strconv.Itoa(mb.nextUID), data: data})
+}
+
+func (mb *fakeMailbox) count() int {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return len(mb.messages)
+}
+
+// expunge removes the deleted messages
+func (mb *fakeMailbox) expunge() {
+	kept := mb.messages[:0]
+	for _, m := range mb.messages {
+		if !m.deleted {
+			kept = append(kept, m)
+		}
+	}
+	mb.messages = kept
+}
+
+// pop3 serves a POP3 session on the mailbox
+func (mb *fakeMailbox) pop3(c *textproto.Conn) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	c.PrintfLine("+OK fake POP3 ready")
+	user := ""
+	message := func(arg string) *fakeMessage {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > len(mb.messages) || mb.messages[n-1].deleted {
+			return nil
+		}
+		return mb.messages[n-1]
+	}
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "USER":
+			user = arg
+			c.PrintfLine("+OK")
+		case "PASS":
+			if user != "user" || arg != `se"cret` {
+				c.PrintfLine("-ERR authentication failed")
+				continue
+			}
+			c.PrintfLine("+OK logged in")
+		case "UIDL", "LIST":
+			c.PrintfLine("+OK")
+			w := c.DotWriter()
+			for i, m := range mb.messages {
+				if !m.deleted {
+					fmt.Fprintf(w, "%d %s\n", i+1, m.uid)
+				}
+			}
+			w.Close()
+		case "RETR":
+			m := message(arg)
+			if m == nil {
+				c.PrintfLine("-ERR no such message")
+				continue
+			}
+			c.PrintfLine("+OK")
+			w := c.DotWriter()
+			w.Write([]byte(m.data))
+			w.Close()
+		case "DELE":
+			m := message(arg)
+			if m == nil {
+				c.PrintfLine("-ERR no such message")
+				continue
+			}
+			m.deleted = true
+			c.PrintfLine("+OK deleted")
+		case "QUIT":
+			mb.expunge()
+			c.PrintfLine("+OK bye")
+			return
+		default:
+			c.PrintfLine("-ERR unknown command")
+		}
+	}
+}
+
+// imap serves an IMAP session on the mailbox, which is the INBOX folder
+func (mb *fakeMailbox) imap(c *textproto.Conn) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	c.PrintfLine("* OK fake IMAP ready")
+	byUID := func(uid string) *fakeMessage {
+		for _, m := range mb.messages {
+			if m.uid == uid {
+				return m
+			}
+		}
+		return nil
+	}
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 {
+			c.PrintfLine("* BAD missing tag")
+			continue
+		}
+		tag, cmd, args := fields[0], strings.ToUpper(fields[1]), ""
+		if len(fields) == 3 {
+			args = fields[2]
+		}
+		if cmd == "UID" {
+			sub, rest, _ := strings.Cut(args, " ")
+			cmd, args = "UID "+strings.ToUpper(sub), rest
+		}
+		switch cmd {
+		case "LOGIN":
+			if args != `"user" "se\"cret"` {
+				c.PrintfLine("%s NO [AUTHENTICATIONFAILED] invalid credentials", tag)
+				continue
+			}
+			c.PrintfLine("%s OK logged in", tag)
+		case "SELECT":
+			if !strings.EqualFold(args, `"INBOX"`) {
+				c.PrintfLine("%s NO no such mailbox", tag)
+				continue
+			}
+			c.PrintfLine("* %d EXISTS", len(mb.messages))
+			c.PrintfLine("%s OK [READ-WRITE] selected", tag)
+		case "UID SEARCH":
+			var uids []string
+			for _, m := range mb.messages {
+				if strings.EqualFold(args, "ALL") || !m.seen {
+					uids = append(uids, m.uid)
+				}
+			}
+			c.PrintfLine("* SEARCH %s", strings.Join(uids, " "))
+			c.PrintfLine("%s OK search done", tag)
+		case "UID FETCH":
+			uid, _, _ := strings.Cut(args, " ")
+			if m := byUID(uid); m != nil {
+				m.seen = true
+				data := strings.ReplaceAll(m.data, "\n", "\r\n")
+				fmt.Fprintf(c.W, "* 1 FETCH (UID %s BODY[] {%d}\r\n%s)\r\n", uid, len(data), data)
+				c.W.Flush()
+			}
+			c.PrintfLine("%s OK fetch done", tag)
+		case "UID STORE":
+			uid, _, _ := strings.Cut(args, " ")
+			if m := byUID(uid); m != nil {
+				m.deleted = true
+			}
+			c.PrintfLine("%s OK store done", tag)
+		case "EXPUNGE":
+			mb.expunge()
+			c.PrintfLine("%s OK expunged", tag)
+		case "LOGOUT":
+			c.PrintfLine("* BYE")
+			c.PrintfLine("%s OK bye", tag)
+			return
+		default:
+			c.PrintfLine("%s BAD unknown command", tag)
+		}
+	}
+}
+
+type delivery struct {
+	from, to, data string
+}
+
+// fakeLMTP accepts messages for recipients other than reject and records them
+type fakeLMTP struct {
+	mu        sync.Mutex
+	delivered []delivery
+	reject    string
+}
+
+func (s *fakeLMTP) serve(c *textproto.Conn) {
+	c.PrintfLine("220 fake LMTP ready")
+	var d delivery
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		upper := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(upper, "LHLO"):
+			c.PrintfLine("250-fake")
+			c.PrintfLine("250 PIPELINING")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			d = delivery{from: strings.Trim(line[len("MAIL FROM:"):], "<>")}
+			c.PrintfLine("250 ok")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			d.to = strings.Trim(line[len("RCPT TO:"):], "<>")
+			if d.to == s.reject {
+				c.PrintfLine("550 5.1.1 unknown user")
+				continue
+			}
+			c.PrintfLine("250 ok")
+		case upper == "DATA":
+			c.PrintfLine("354 go ahead")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			d.data = string(data)
+			s.mu.Lock()
+			s.delivered = append(s.delivered, d)
+			s.mu.Unlock()
+			c.PrintfLine("250 2.0.0 <%s> saved", d.to)
+		case upper == "QUIT":
+			c.PrintfLine("221 bye")
+			return
+		default:
+			c.PrintfLine("500 unknown command")
+		}
+	}
+}
+
+func (s *fakeLMTP) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.delivered)
+}
+
+const (
+	message1 = "Return-Path: <alice@remote.example>\nFrom: Alice <alice@remote.example>\nSubject: one\n\nfirst\n.leading dot\n"
+	message2 = "From: bob@remote.example\nSubject: two\n\nsecond\n"
+)
+
+// testPoller delivers to a fake LMTP server
+func testPoller(t *testing.T, lmtp *fakeLMTP) *Poller {
+	port := fakeServer(t, lmtp.serve)
+	d := &Deliverer{Address: "127.0.0.1:" + strconv.Itoa(port), LMTP: true, Hostname: "mx.example.org", Timeout: 5 * time.Second}
+	return &Poller{
+		Deliver:  d.Deliver,
+		Seen:     NewSeen(),
+		Hostname: "mx.example.org",
+		Timeout:  5 * time.Second,
+	}
+}
+
+func testEntry(protocol string, port int) models.Fetchmail {
+	return models.Fetchmail{
+		ID:          1,
+		Mailbox:     "local@example.org",
+		SrcServer:   "127.0.0.1",
+		SrcPort:     port,
+		SrcUser:     "user",
+		SrcPassword: `se"cret`,
+		Protocol:    &protocol,
+	}
+}
+
+func TestTestConnection(t *testing.T) {
+	mb := &fakeMailbox{}
+	pop3 := Source{Protocol: "POP3", Server: "127.0.0.1", Port: fakeServer(t, mb.pop3), User: "user", Password: `se"cret`}
+	if err := Test(pop3); err != nil {
+		t.Errorf("Test(POP3) error = %v", err)
+	}
+	pop3.Password = "wrong"
+	if err := Test(pop3); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("Test(POP3) with a wrong password error = %v", err)
+	}
+
+	imap := Source{Protocol: "imap", Server: "127.0.0.1", Port: fakeServer(t, mb.imap), User: "user", Password: `se"cret`}
+	if err := Test(imap); err != nil {
+		t.Errorf("Test(IMAP) error = %v", err)
+	}
+	imap.Folder = "Archive"
+	if err := Test(imap); err == nil || !strings.Contains(err.Error(), "no such mailbox") {
+		t.Errorf("Test(IMAP) with a missing folder error = %v", err)
+	}
+	imap.Folder, imap.Password = "", "wrong"
+	if err := Test(imap); err == nil || !strings.Contains(err.Error(), "AUTHENTICATIONFAILED") {
+		t.Errorf("Test(IMAP) with a wrong password error = %v", err)
+	}
+
+	if err := Test(Source{Protocol: "ETRN", Server: "127.0.0.1"}); err == nil {
+		t.Error("Test() accepted ETRN")
+	}
+}
+
+func TestTLS(t *testing.T) {
+	mb := &fakeMailbox{}
+	port, cert := fakeTLSServer(t, mb.pop3)
+	s := Source{Protocol: "POP3", Server: "127.0.0.1", Port: port, User: "user", Password: `se"cret`, SSL: true}
+	if err := Test(s); err != nil {
+		t.Errorf("Test() without certificate check error = %v", err)
+	}
+
+	s.CertCheck = true
+	if err := Test(s); err == nil {
+		t.Error("Test() accepted a self-signed certificate with the check on")
+	}
+
+	sum := sha256.Sum256(cert.Raw)
+	s.CertCheck = false
+	s.Fingerprint = strings.ToUpper(hex.EncodeToString(sum[:2])) + ":" + hex.EncodeToString(sum[2:])
+	if err := Test(s); err != nil {
+		t.Errorf("Test() with the certificate fingerprint error = %v", err)
+	}
+	s.Fingerprint = strings.Repeat("00", 16)
+	if err := Test(s); err == nil || !strings.Contains(err.Error(), "fingerprint") {
+		t.Errorf("Test() with another fingerprint error = %v", err)
+	}
+}
+
+func TestPollDeletes(t *testing.T) {
+	for _, protocol := range []string{"POP3", "IMAP"} {
+		t.Run(protocol, func(t *testing.T) {
+			mb := &fakeMailbox{}
+			mb.add(message1)
+			mb.add(message2)
+			handle := mb.pop3
+			if protocol == "IMAP" {
+				handle = mb.imap
+			}
+			lmtp := &fakeLMTP{}
+			p := testPoller(t, lmtp)
+			f := testEntry(protocol, fakeServer(t, handle))
+
+			if r := p.Poll(f); r.Err != nil || r.Fetched != 2 {
+				t.Fatalf("Poll() = %v", r)
+			}
+			if mb.count() != 0 {
+				t.Errorf("%d messages left on the server", mb.count())
+			}
+
+			d := lmtp.delivered[0]
+			if d.from != "alice@remote.example" || d.to != "local@example.org" {
+				t.Errorf("envelope = %q -> %q", d.from, d.to)
+			}
+			if !strings.HasPrefix(d.data, "Received: from 127.0.0.1\n\tby mx.example.org with "+protocol) {
+				t.Errorf("message lacks the Received header:\n%s", d.data)
+			}
+			if !strings.HasSuffix(d.data, "first\n.leading dot\n") {
+				t.Errorf("message body changed:\n%s", d.data)
+			}
+			if lmtp.delivered[1].from != "bob@remote.example" {
+				t.Errorf("sender without Return-Path = %q", lmtp.delivered[1].from)
+			}
+		})
+	}
+}
+
+func TestPollKeep(t *testing.T) {
+	for _, protocol := range []string{"POP3", "IMAP"} {
+		t.Run(protocol, func(t *testing.T) {
+			mb := &fakeMailbox{}
+			mb.add(message1)
+			handle := mb.pop3
+			if protocol == "IMAP" {
+				handle = mb.imap
+			}
+			lmtp := &fakeLMTP{}
+			p := testPoller(t, lmtp)
+			f := testEntry(protocol, fakeServer(t, handle))
+			f.Keep = true
+
+			if r := p.Poll(f); r.Err != nil || r.Fetched != 1 {
+				t.Fatalf("first Poll() = %v", r)
+			}
+			if r := p.Poll(f); r.Err != nil || r.Fetched != 0 {
+				t.Errorf("second Poll() = %v, want nothing new", r)
+			}
+			mb.add(message2)
+			if r := p.Poll(f); r.Err != nil || r.Fetched != 1 {
+				t.Errorf("Poll() after a new message = %v", r)
+			}
+			if mb.count() != 2 {
+				t.Errorf("%d messages left on the server, want 2", mb.count())
+			}
+
+			f.Fetchall = true
+			if r := p.Poll(f); r.Err != nil || r.Fetched != 2 {
+				t.Errorf("Poll() with fetchall = %v", r)
+			}
+		})
+	}
+}
+
+func TestPollDeliveryFailure(t *testing.T) {
+	mb := &fakeMailbox{}
+	mb.add(message1)
+	lmtp := &fakeLMTP{reject: "local@example.org"}
+	p := testPoller(t, lmtp)
+	f := testEntry("POP3", fakeServer(t, mb.pop3))
+
+	r := p.Poll(f)
+	if r.Err == nil || !strings.Contains(r.Err.Error(), "550") {
+		t.Fatalf("Poll() = %v, want the LMTP rejection", r)
+	}
+	if !strings.Contains(r.String(), "0 message(s) fetched, error: deliver to local@example.org") {
+		t.Errorf("Result.String() = %q", r.String())
+	}
+	if mb.count() != 1 || lmtp.count() != 0 {
+		t.Errorf("message was lost: %d on the server, %d delivered", mb.count(), lmtp.count())
+	}
+}
+
+func TestPollPassword(t *testing.T) {
+	mb := &fakeMailbox{}
+	p := testPoller(t, &fakeLMTP{})
+	f := testEntry("IMAP", fakeServer(t, mb.imap))
+	f.SrcPassword = "{encrypted}"
+	p.Password = func(stored string) (string, error) {
+		if stored != "{encrypted}" {
+			t.Errorf("Password(%q)", stored)
+		}
+		return `se"cret`, nil
+	}
+	if r := p.Poll(f); r.Err != nil {
+		t.Errorf("Poll() = %v", r)
+	}
+}
+
+func TestDue(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	f := models.Fetchmail{PollTime: 5, Date: now.Add(-4 * time.Minute)}
+	if Due(f, now) {
+		t.Error("Due() before the poll time elapsed")
+	}
+	f.Date = now.Add(-5 * time.Minute)
+	if !Due(f, now) {
+		t.Error("Due() = false after the poll time")
+	}
+	f.PollTime, f.Date = 0, now.Add(-9*time.Minute)
+	if Due(f, now) {
+		t.Error("Due() with the default poll time of 10 minutes")
+	}
+}
+
+func TestEnvelopeSender(t *testing.T) {
+	tests := map[string]string{
+		"Return-Path: <a@example.org>\r\nFrom: b@example.org\r\n\r\nbody": "a@example.org",
+		"From: B <b@example.org>\r\n\r\nbody":                             "b@example.org",
+		"Return-Path: <>\r\nFrom: b@example.org\r\n\r\nbody":              "",
+		"Subject: no sender\r\n\r\nbody":                                  "",
+	}
+	for msg, want := range tests {
+		if got := envelopeSender([]byte(msg)); got != want {
+			t.Errorf("envelopeSender(%q) = %q, want %q", msg, got, want)
+		}
+	}
+}
+
+func TestSeenSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.json")
+	s := NewSeen()
+	s.Add(1, "a")
+	s.Add(1, "b")
+	s.Add(2, "c")
+	s.Retain(1, []string{"b", "x"})
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewSeen()
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Has(1, "a") || !loaded.Has(1, "b") || loaded.Has(1, "x") || !loaded.Has(2, "c") {
+		t.Errorf("loaded store = %v", loaded.uids)
+	}
+	if err := NewSeen().Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("Load() of a missing file error = %v", err)
+	}
+}
+
+func TestSourceAddress(t *testing.T) {
+	tests := []struct {
+		s    Source
+		want string
+	}{
+		{Source{Protocol: "POP3", Server: "mail.example.org"}, "mail.example.org:110"},
+		{Source{Protocol: "POP3", Server: "mail.example.org", SSL: true}, "mail.example.org:995"},
+		{Source{Protocol: "IMAP", Server: "mail.example.org"}, "mail.example.org:143"},
+		{Source{Protocol: "IMAP", Server: "mail.example.org", SSL: true}, "mail.example.org:993"},
+		{Source{Protocol: "IMAP", Server: "mail.example.org", Port: 1143}, "mail.example.org:1143"},
+	}
+	for _, tt := range tests {
+		if got := tt.s.Address(); got != tt.want {
+			t.Errorf("Address() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package fetchmail
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// maxLiteralSize bounds a message read from an IMAP server
+const maxLiteralSize = 256 << 20
+
+// imapClient is an IMAP4rev1 session (RFC 3501) with the folder selected
+type imapClient struct {
+	conn
+	tag     int
+	expunge bool // messages were flagged \Deleted
+}
+
+// imapResponse is an untagged response line with the literals it carried; the literal data is
+// left out of line, which keeps only their {size} markers
+type imapResponse struct {
+	line     string
+	literals [][]byte
+}
+
+func connectIMAP(s Source) (*imapClient, error) {
+	raw, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	c := &imapClient{conn: conn{Conn: textproto.NewConn(raw), raw: raw, timeout: s.timeout()}}
+	c.deadline()
+	greeting, err := c.ReadLine()
+	if err != nil {
+		c.Conn.Close()
+		return nil, fmt.Errorf("greeting: %w", err)
+	}
+	if !strings.HasPrefix(strings.ToUpper(greeting), "* OK") {
+		c.Conn.Close()
+		return nil, fmt.Errorf("greeting: unexpected response: %q", greeting)
+	}
+	if _, err := c.cmd("LOGIN %s %s", imapQuote(s.User), imapQuote(s.Password)); err != nil {
+		c.Conn.Close()
+		return nil, fmt.Errorf("login: %w", err)
+	}
+	folder := s.Folder
+	if folder == "" {
+		folder = "INBOX"
+	}
+	if _, err := c.cmd("SELECT %s", imapQuote(folder)); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("select %s: %w", folder, err)
+	}
+	return c, nil
+}
+
+// cmd sends a tagged command and returns the untagged responses before its OK completion
+func (c *imapClient) cmd(format string, args ...any) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	c.deadline()
+	if err := c.PrintfLine(tag+" "+format, args...); err != nil {
+		return nil, err
+	}
+
+	var untagged []imapResponse
+	for {
+		r, err := c.readResponse()
+		if err != nil {
+			return untagged, err
+		}
+		rest, ok := strings.CutPrefix(r.line, tag+" ")
+		if !ok {
+			untagged = append(untagged, r)
+			continue
+		}
+		status, text, _ := strings.Cut(rest, " ")
+		if strings.EqualFold(status, "OK") {
+			return untagged, nil
+		}
+		return untagged, fmt.Errorf("server error: %s %s", status, text)
+	}
+}
+
+// readResponse reads one response, following the lines that continue it after a literal
+func (c *imapClient) readResponse() (imapResponse, error) {
+	var r imapResponse
+	for {
+		c.deadline()
+		line, err := c.ReadLine()
+		if err != nil {
+			return r, err
+		}
+		r.line += line
+		size, ok := literalSize(line)
+		if !ok {
+			return r, nil
+		}
+		if size > maxLiteralSize {
+			return r, fmt.Errorf("literal of %d bytes is too large", size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(c.R, data); err != nil {
+			return r, err
+		}
+		r.literals = append(r.literals, data)
+	}
+}
+
+// literalSize returns n when line ends with a literal marker {n}
+func literalSize(line string) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	i := strings.LastIndex(line, "{")
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(line[i+1 : len(line)-1])
+	return n, err == nil && n >= 0
+}
+
+// List searches the selected folder for the unseen messages, or all of them
+func (c *imapClient) List(all bool) ([]Message, error) {
+	criteria := "UNSEEN"
+	if all {
+		criteria = "ALL"
+	}
+	responses, err := c.cmd("UID SEARCH %s", criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []Message
+	for _, r := range responses {
+		rest, ok := strings.CutPrefix(strings.ToUpper(r.line), "* SEARCH")
+		if !ok {
+			continue
+		}
+		for _, uid := range strings.Fields(rest) {
+			messages = append(messages, Message{ID: uid, UID: uid})
+		}
+	}
+	return messages, nil
+}
+
+// Retrieve fetches a message, which also sets its \Seen flag
+func (c *imapClient) Retrieve(m Message) ([]byte, error) {
+	responses, err := c.cmd("UID FETCH %s BODY[]", m.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range responses {
+		if strings.Contains(strings.ToUpper(r.line), "FETCH") && len(r.literals) > 0 {
+			return r.literals[0], nil
+		}
+	}
+	return nil, errors.New("message " + m.ID + " not returned by the server")
+}
+
+// Delete flags a message \Deleted; it is expunged when the session is closed
+func (c *imapClient) Delete(m Message) error {
+	if _, err := c.cmd(`UID STORE %s +FLAGS.SILENT (\Deleted)`, m.ID); err != nil {
+		return err
+	}
+	c.expunge = true
+	return nil
+}
+
+// Close expunges the deleted messages and logs out
+func (c *imapClient) Close() error {
+	var err error
+	if c.expunge {
+		_, err = c.cmd("EXPUNGE")
+	}
+	if _, logoutErr := c.cmd("LOGOUT"); err == nil {
+		err = logoutErr
+	}
+	c.Conn.Close()
+	return err
+}
+
+// imapQuote returns s as an IMAP quoted string
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
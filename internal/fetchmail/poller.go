@@ -0,0 +1,161 @@
+package fetchmail
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+)
+
+// defaultPollTime is the poll interval in minutes of entries without one, as in fetchmail.pl
+const defaultPollTime = 10
+
+// Poller fetches the messages of fetchmail entries and delivers them to their mailbox
+type Poller struct {
+	// Password decrypts the stored source password
+	Password func(stored string) (string, error)
+	// Deliver hands a message to the local mail system
+	Deliver func(from, to string, msg []byte) error
+	// Seen tracks the POP3 messages kept on the server; without it they are fetched again
+	// at every poll
+	Seen *Seen
+
+	Hostname string        // name used in the Received header
+	Timeout  time.Duration // per connection and command, DefaultTimeout when 0
+	Now      func() time.Time
+}
+
+// Result is the outcome of polling one entry
+type Result struct {
+	Fetched int
+	Err     error
+}
+
+// String is the text stored in the returned_text column
+func (r Result) String() string {
+	text := fmt.Sprintf("%d message(s) fetched", r.Fetched)
+	if r.Err != nil {
+		text += ", error: " + r.Err.Error()
+	}
+	return text
+}
+
+// Due reports whether an entry last polled at f.Date should be polled again at now
+func Due(f models.Fetchmail, now time.Time) bool {
+	pollTime := f.PollTime
+	if pollTime <= 0 {
+		pollTime = defaultPollTime
+	}
+	return !now.Before(f.Date.Add(time.Duration(pollTime) * time.Minute))
+}
+
+// Poll fetches the messages of an entry, delivers them to its mailbox and deletes them from
+// the server unless Keep is set. It stops at the first failure, leaving the message that
+// failed on the server.
+func (p *Poller) Poll(f models.Fetchmail) (result Result) {
+	password := f.SrcPassword
+	if p.Password != nil {
+		var err error
+		if password, err = p.Password(f.SrcPassword); err != nil {
+			return Result{Err: err}
+		}
+	}
+	source := SourceFrom(f, password)
+	source.Timeout = p.Timeout
+
+	client, err := Connect(source)
+	if err != nil {
+		return Result{Err: err}
+	}
+	defer func() {
+		if err := client.Close(); err != nil && result.Err == nil {
+			result.Err = err
+		}
+	}()
+
+	messages, err := client.List(f.Fetchall)
+	if err != nil {
+		return Result{Err: err}
+	}
+
+	// POP3 has no seen flag: kept messages are told apart by their UIDL
+	track := p.Seen != nil && !source.isIMAP() && f.Keep && !f.Fetchall
+	var present []string
+	for _, m := range messages {
+		if track && m.UID != "" {
+			present = append(present, m.UID)
+			if p.Seen.Has(f.ID, m.UID) {
+				continue
+			}
+		}
+
+		data, err := client.Retrieve(m)
+		if err != nil {
+			result.Err = fmt.Errorf("retrieve %s: %w", m.ID, err)
+			return result
+		}
+		if err := p.Deliver(envelopeSender(data), f.Mailbox, p.received(f, data)); err != nil {
+			result.Err = fmt.Errorf("deliver to %s: %w", f.Mailbox, err)
+			return result
+		}
+		result.Fetched++
+
+		if track && m.UID != "" {
+			p.Seen.Add(f.ID, m.UID)
+		}
+		if !f.Keep {
+			if err := client.Delete(m); err != nil {
+				result.Err = fmt.Errorf("delete %s: %w", m.ID, err)
+				return result
+			}
+		}
+	}
+	if track {
+		p.Seen.Retain(f.ID, present)
+	}
+	return result
+}
+
+// received prepends the Received header of the fetch to a message
+func (p *Poller) received(f models.Fetchmail, data []byte) []byte {
+	now := time.Now()
+	if p.Now != nil {
+		now = p.Now()
+	}
+	hostname := p.Hostname
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	protocol := "POP3"
+	if f.Protocol != nil {
+		protocol = strings.ToUpper(*f.Protocol)
+	}
+	header := fmt.Sprintf("Received: from %s\r\n\tby %s with %s (postfixadmin fetchmail)\r\n\tfor <%s>; %s\r\n",
+		f.SrcServer, hostname, protocol, f.Mailbox, now.Format(time.RFC1123Z))
+	return append([]byte(header), data...)
+}
+
+// envelopeSender returns the address of the Return-Path header, or of From when there is none,
+// "" when neither parses
+func envelopeSender(data []byte) string {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"Return-Path", "From"} {
+		value := strings.TrimSpace(msg.Header.Get(name))
+		if value == "<>" {
+			return ""
+		}
+		if value == "" {
+			continue
+		}
+		if address, err := mail.ParseAddress(value); err == nil {
+			return address.Address
+		}
+	}
+	return ""
+}
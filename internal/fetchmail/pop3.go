@@ -0,0 +1,120 @@
+package fetchmail
+
+import (
+	"bytes"
+	"fmt"
+	"net/textproto"
+	"strings"
+)
+
+// pop3Client is a POP3 session (RFC 1939)
+type pop3Client struct {
+	conn
+}
+
+func connectPOP3(s Source) (*pop3Client, error) {
+	raw, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	c := &pop3Client{conn{Conn: textproto.NewConn(raw), raw: raw, timeout: s.timeout()}}
+	if _, err := c.response(); err != nil {
+		c.Conn.Close()
+		return nil, fmt.Errorf("greeting: %w", err)
+	}
+	if _, err := c.cmd("USER %s", s.User); err != nil {
+		c.Conn.Close()
+		return nil, fmt.Errorf("login: %w", err)
+	}
+	if _, err := c.cmd("PASS %s", s.Password); err != nil {
+		c.Conn.Close()
+		return nil, fmt.Errorf("login: %w", err)
+	}
+	return c, nil
+}
+
+// cmd sends a command and returns the text of its +OK response
+func (c *pop3Client) cmd(format string, args ...any) (string, error) {
+	c.deadline()
+	if err := c.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+	return c.response()
+}
+
+// response reads a status line, an error for -ERR
+func (c *pop3Client) response() (string, error) {
+	c.deadline()
+	line, err := c.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if text, ok := strings.CutPrefix(line, "+OK"); ok {
+		return strings.TrimSpace(text), nil
+	}
+	if text, ok := strings.CutPrefix(line, "-ERR"); ok {
+		return "", fmt.Errorf("server error: %s", strings.TrimSpace(text))
+	}
+	return "", fmt.Errorf("unexpected response: %q", line)
+}
+
+// Close ends the session with QUIT, which also commits deletions
+func (c *pop3Client) Close() error {
+	_, err := c.cmd("QUIT")
+	c.Conn.Close()
+	return err
+}
+
+// List returns every message with its UIDL identifier, or only the message numbers when the
+// server does not support UIDL
+func (c *pop3Client) List(all bool) ([]Message, error) {
+	lines, err := c.multiline("UIDL")
+	withUID := err == nil
+	if !withUID {
+		if lines, err = c.multiline("LIST"); err != nil {
+			return nil, err
+		}
+	}
+
+	messages := make([]Message, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		m := Message{ID: fields[0]}
+		if withUID {
+			m.UID = fields[1]
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// Retrieve returns a message with CRLF line endings
+func (c *pop3Client) Retrieve(m Message) ([]byte, error) {
+	if _, err := c.cmd("RETR %s", m.ID); err != nil {
+		return nil, err
+	}
+	c.deadline()
+	data, err := c.ReadDotBytes()
+	if err != nil {
+		return nil, err
+	}
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n")), nil
+}
+
+// Delete marks a message for deletion at QUIT
+func (c *pop3Client) Delete(m Message) error {
+	_, err := c.cmd("DELE %s", m.ID)
+	return err
+}
+
+// multiline sends a command with a multi-line response and returns its lines
+func (c *pop3Client) multiline(cmd string) ([]string, error) {
+	if _, err := c.cmd("%s", cmd); err != nil {
+		return nil, err
+	}
+	c.deadline()
+	return c.ReadDotLines()
+}
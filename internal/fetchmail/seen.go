@@ -0,0 +1,107 @@
+package fetchmail
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Seen remembers the POP3 messages already fetched from accounts whose messages are kept on
+// the server, by fetchmail entry ID and UIDL
+type Seen struct {
+	mu   sync.Mutex
+	uids map[int]map[string]bool
+}
+
+// NewSeen creates an empty store
+func NewSeen() *Seen {
+	return &Seen{uids: make(map[int]map[string]bool)}
+}
+
+// Has reports whether the message was fetched before
+func (s *Seen) Has(id int, uid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uids[id][uid]
+}
+
+// Add records a fetched message
+func (s *Seen) Add(id int, uid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.uids[id] == nil {
+		s.uids[id] = make(map[string]bool)
+	}
+	s.uids[id][uid] = true
+}
+
+// Retain forgets the messages of an entry that are no longer on the server
+func (s *Seen) Retain(id int, present []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keep := make(map[string]bool, len(present))
+	for _, uid := range present {
+		if s.uids[id][uid] {
+			keep[uid] = true
+		}
+	}
+	s.uids[id] = keep
+}
+
+// Save writes the store to path, replacing the file atomically
+func (s *Seen) Save(path string) error {
+	s.mu.Lock()
+	state := make(map[int][]string, len(s.uids))
+	for id, uids := range s.uids {
+		for uid := range uids {
+			state[id] = append(state[id], uid)
+		}
+	}
+	s.mu.Unlock()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fetchmail-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads a store written by Save. A missing file is not an error.
+func (s *Seen) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state map[int][]string
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uids = make(map[int]map[string]bool, len(state))
+	for id, uids := range state {
+		s.uids[id] = make(map[string]bool, len(uids))
+		for _, uid := range uids {
+			s.uids[id][uid] = true
+		}
+	}
+	return nil
+}
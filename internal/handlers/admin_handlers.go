@@ -115,8 +115,8 @@ func (h *Handler) AddAdmin(c *echo.Context) error {
 	if username == "" {
 		return h.renderAddAdminError(c, "O nome de usuário é obrigatório", username)
 	}
-	if len(password) < 8 {
-		return h.renderAddAdminError(c, "A senha deve ter no mínimo 8 caracteres", username)
+	if err := utils.ValidatePassword(h.DB, utils.TOTPKindAdmin, username, password); err != nil {
+		return h.renderAddAdminError(c, err, username)
 	}
 	if password != passwordConfirm {
 		return h.renderAddAdminError(c, "As senhas não conferem", username)
@@ -153,33 +153,15 @@ func (h *Handler) AddAdmin(c *echo.Context) error {
 		return h.renderAddAdminError(c, "Falha ao criar administrador: "+err.Error(), username)
 	}
 
-	// Assign Domains
-	if superadmin {
-		// Superadmin gets "ALL" domain
-		da := models.DomainAdmin{
-			Username: username,
-			Domain:   "ALL",
-			Created:  time.Now(),
-			Active:   true,
-		}
-		if err := tx.Create(&da).Error; err != nil {
-			tx.Rollback()
-			return h.renderAddAdminError(c, "Falha ao atribuir domínio ALL: "+err.Error(), username)
-		}
-	} else if len(domains) > 0 {
-		// Normal admin gets selected domains
-		for _, d := range domains {
-			da := models.DomainAdmin{
-				Username: username,
-				Domain:   d,
-				Created:  time.Now(),
-				Active:   true,
-			}
-			if err := tx.Create(&da).Error; err != nil {
-				tx.Rollback()
-				return h.renderAddAdminError(c, "Falha ao atribuir domínio "+d+": "+err.Error(), username)
-			}
-		}
+	// Assign Domains: superadmins get "ALL"
+	if err := utils.SetAdminDomains(tx, username, superadmin, domains); err != nil {
+		tx.Rollback()
+		return h.renderAddAdminError(c, err.Error(), username)
+	}
+
+	if err := utils.RecordPasswordHistory(tx, utils.TOTPKindAdmin, username, crypted); err != nil {
+		tx.Rollback()
+		return h.renderAddAdminError(c, "Falha ao registrar histórico de senhas: "+err.Error(), username)
 	}
 
 	// Log Action
@@ -198,7 +180,7 @@ func (h *Handler) AddAdmin(c *echo.Context) error {
 }
 
 // renderAddAdminError helper to render the form with error message
-func (h *Handler) renderAddAdminError(c *echo.Context, errorMsg, username string) error {
+func (h *Handler) renderAddAdminError(c *echo.Context, errorMsg interface{}, username string) error {
 	var domains []models.Domain
 	if h.DB != nil {
 		h.DB.Where("domain != ? AND active = ?", "ALL", true).Order("domain ASC").Find(&domains)
@@ -250,6 +232,14 @@ func (h *Handler) DeleteAdmin(c *echo.Context) error {
 		})
 	}
 
+	if err := tx.Where("username = ?", username).Delete(&models.APIToken{}).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   "Failed to delete API tokens",
+		})
+	}
+
 	if err := tx.Where("username = ?", username).Delete(&models.Admin{}).Error; err != nil {
 		tx.Rollback()
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
@@ -354,6 +344,7 @@ func (h *Handler) EditAdmin(c *echo.Context) error {
 	password := c.FormValue("password")
 	active := c.FormValue("active") == "true"
 	superadmin := c.FormValue("superadmin") == "true"
+	emailOther := c.FormValue("email_other")
 	domains := c.Request().Form["domains"] // Helper to get multiple values for checkbox array
 
 	// Using a transaction
@@ -363,6 +354,7 @@ func (h *Handler) EditAdmin(c *echo.Context) error {
 	updates := map[string]interface{}{
 		"modified":       time.Now(),
 		"token_validity": time.Now().Add(3 * time.Hour),
+		"email_other":    emailOther,
 	}
 
 	// Only Superadmins can change Active status and Superadmin role
@@ -372,6 +364,14 @@ func (h *Handler) EditAdmin(c *echo.Context) error {
 	}
 
 	if password != "" {
+		if err := utils.ValidatePassword(h.DB, utils.TOTPKindAdmin, targetUsername, password); err != nil {
+			tx.Rollback()
+			return c.Render(http.StatusOK, "edit_admin.html", map[string]interface{}{
+				"Admin":        models.Admin{Username: targetUsername},
+				"Error":        err,
+				"IsSuperAdmin": isSuper,
+			})
+		}
 		crypted, err := utils.HashPassword(password)
 		if err != nil {
 			tx.Rollback()
@@ -382,6 +382,14 @@ func (h *Handler) EditAdmin(c *echo.Context) error {
 			})
 		}
 		updates["password"] = crypted
+		if err := utils.RecordPasswordHistory(tx, utils.TOTPKindAdmin, targetUsername, crypted); err != nil {
+			tx.Rollback()
+			return c.Render(http.StatusOK, "edit_admin.html", map[string]interface{}{
+				"Admin":        models.Admin{Username: targetUsername},
+				"Error":        "Failed to record password history",
+				"IsSuperAdmin": isSuper,
+			})
+		}
 	}
 
 	if err := tx.Model(&models.Admin{}).Where("username = ?", targetUsername).Updates(updates).Error; err != nil {
@@ -394,49 +402,13 @@ func (h *Handler) EditAdmin(c *echo.Context) error {
 
 	// 2. Update Domain Assignments - Only for Superadmins
 	if isSuper {
-		// First, remove all existing assignments
-		if err := tx.Where("username = ?", targetUsername).Delete(&models.DomainAdmin{}).Error; err != nil {
+		if err := utils.SetAdminDomains(tx, targetUsername, superadmin, domains); err != nil {
 			tx.Rollback()
 			return c.Render(http.StatusOK, "edit_admin.html", map[string]interface{}{
-				"Error":        "Failed to update domain permissions: " + err.Error(),
+				"Error":        err.Error(),
 				"IsSuperAdmin": isSuper,
 			})
 		}
-
-		// Assign Domains
-		if superadmin {
-			// Superadmin gets "ALL" domain
-			da := models.DomainAdmin{
-				Username: targetUsername,
-				Domain:   "ALL",
-				Created:  time.Now(),
-				Active:   true,
-			}
-			if err := tx.Create(&da).Error; err != nil {
-				tx.Rollback()
-				return c.Render(http.StatusOK, "edit_admin.html", map[string]interface{}{
-					"Error":        "Failed to assign domain ALL: " + err.Error(),
-					"IsSuperAdmin": isSuper,
-				})
-			}
-		} else if len(domains) > 0 {
-			// Normal admin gets selected domains
-			for _, d := range domains {
-				da := models.DomainAdmin{
-					Username: targetUsername,
-					Domain:   d,
-					Created:  time.Now(),
-					Active:   true,
-				}
-				if err := tx.Create(&da).Error; err != nil {
-					tx.Rollback()
-					return c.Render(http.StatusOK, "edit_admin.html", map[string]interface{}{
-						"Error":        "Failed to assign domain " + d + ": " + err.Error(),
-						"IsSuperAdmin": isSuper,
-					})
-				}
-			}
-		}
 	}
 
 	// Log Action
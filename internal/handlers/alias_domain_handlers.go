@@ -1,10 +1,8 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
 	"net/url"
-	"time"
 
 	"go-postfixadmin/internal/middleware"
 	"go-postfixadmin/internal/models"
@@ -124,46 +122,14 @@ func (h *Handler) AddAliasDomain(c *echo.Context) error {
 		query.Find(&domains)
 	}
 
-	if aliasDomain == "" {
-		return renderAddAliasDomainError(c, "Alias Domain is required", aliasDomain, targetDomain, domains, isSuperAdmin)
-	}
-	if targetDomain == "" {
-		return renderAddAliasDomainError(c, "Target Domain is required", aliasDomain, targetDomain, domains, isSuperAdmin)
-	}
-
-	// Validate: Alias Domain cannot be equal to Target Domain
-	if aliasDomain == targetDomain {
-		return renderAddAliasDomainError(c, "O domínio de origem e destino não podem ser iguais", aliasDomain, targetDomain, domains, isSuperAdmin)
-	}
-
-	// Check if already exists
-	var existing models.AliasDomain
-	if err := h.DB.Where("alias_domain = ?", aliasDomain).First(&existing).Error; err == nil {
-		return renderAddAliasDomainError(c, "Alias Domain already exists", aliasDomain, targetDomain, domains, isSuperAdmin)
-	}
-
-	// Check if target domain exists and is active
-	var target models.Domain
-	if err := h.DB.Where("domain = ?", targetDomain).First(&target).Error; err != nil {
-		return renderAddAliasDomainError(c, "Target Domain does not exist", aliasDomain, targetDomain, domains, isSuperAdmin)
-	}
-
-	now := time.Now()
 	newAliasDomain := models.AliasDomain{
 		AliasDomain:  aliasDomain,
 		TargetDomain: targetDomain,
-		Created:      now,
-		Modified:     now,
 		Active:       active,
 	}
-
-	if err := h.DB.Create(&newAliasDomain).Error; err != nil {
-		return renderAddAliasDomainError(c, "Failed to create alias domain: "+err.Error(), aliasDomain, targetDomain, domains, isSuperAdmin)
-	}
-
-	// Log Action
-	if err := utils.LogAction(h.DB, middleware.GetUsername(c, middleware.SessionName), c.RealIP(), targetDomain, "create_alias_domain", aliasDomain); err != nil {
-		fmt.Printf("Failed to log create_alias_domain: %v\n", err)
+	if err := utils.CreateAliasDomain(h.DB, &newAliasDomain, loggedInUser, c.RealIP()); err != nil {
+		_, msg := formError(err, "Failed to create alias domain")
+		return renderAddAliasDomainError(c, msg, aliasDomain, targetDomain, domains, isSuperAdmin)
 	}
 
 	return c.Redirect(http.StatusFound, "/alias-domains")
@@ -211,19 +177,14 @@ func (h *Handler) DeleteAliasDomain(c *echo.Context) error {
 		}
 	}
 
-	if err := h.DB.Delete(&aliasDomain).Error; err != nil {
+	if err := utils.DeleteAliasDomain(h.DB, aliasDomain, loggedInUser, c.RealIP()); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": "Failed to delete alias domain"})
 	}
 
-	// Log Action
-	if err := utils.LogAction(h.DB, middleware.GetUsername(c, middleware.SessionName), c.RealIP(), aliasDomain.TargetDomain, "delete_alias_domain", aliasDomainName); err != nil {
-		fmt.Printf("Failed to log delete_alias_domain: %v\n", err)
-	}
-
 	return c.JSON(http.StatusOK, map[string]interface{}{"success": true})
 }
 
-func renderAddAliasDomainError(c *echo.Context, errorMsg, aliasDomain, targetDomain string, domains []models.Domain, isSuperAdmin bool) error {
+func renderAddAliasDomainError(c *echo.Context, errorMsg interface{}, aliasDomain, targetDomain string, domains []models.Domain, isSuperAdmin bool) error {
 	return c.Render(http.StatusBadRequest, "add_alias_domain.html", map[string]interface{}{
 		"Error":        errorMsg,
 		"AliasDomain":  aliasDomain,
@@ -362,38 +323,17 @@ func (h *Handler) EditAliasDomain(c *echo.Context) error {
 		query.Find(&domains)
 	}
 
-	if targetDomain == "" {
-		return renderEditAliasDomainError(c, "Target Domain is required", aliasDomain, domains, isSuperAdmin)
-	}
-
-	if aliasDomainName == targetDomain {
-		return renderEditAliasDomainError(c, "O domínio de origem e destino não podem ser iguais", aliasDomain, domains, isSuperAdmin)
-	}
-
-	// Check if target domain exists
-	var target models.Domain
-	if err := h.DB.Where("domain = ?", targetDomain).First(&target).Error; err != nil {
-		return renderEditAliasDomainError(c, "Target Domain does not exist", aliasDomain, domains, isSuperAdmin)
-	}
-
-	// Update
 	aliasDomain.TargetDomain = targetDomain
 	aliasDomain.Active = active
-	aliasDomain.Modified = time.Now()
-
-	if err := h.DB.Save(&aliasDomain).Error; err != nil {
-		return renderEditAliasDomainError(c, "Failed to update alias domain: "+err.Error(), aliasDomain, domains, isSuperAdmin)
-	}
-
-	// Log Action
-	if err := utils.LogAction(h.DB, middleware.GetUsername(c, middleware.SessionName), c.RealIP(), targetDomain, "edit_alias_domain", aliasDomainName); err != nil {
-		fmt.Printf("Failed to log edit_alias_domain: %v\n", err)
+	if err := utils.UpdateAliasDomain(h.DB, &aliasDomain, loggedInUser, c.RealIP()); err != nil {
+		_, msg := formError(err, "Failed to update alias domain")
+		return renderEditAliasDomainError(c, msg, aliasDomain, domains, isSuperAdmin)
 	}
 
 	return c.Redirect(http.StatusFound, "/alias-domains")
 }
 
-func renderEditAliasDomainError(c *echo.Context, errorMsg string, aliasDomain models.AliasDomain, domains []models.Domain, isSuperAdmin bool) error {
+func renderEditAliasDomainError(c *echo.Context, errorMsg interface{}, aliasDomain models.AliasDomain, domains []models.Domain, isSuperAdmin bool) error {
 	return c.Render(http.StatusBadRequest, "edit_alias_domain.html", map[string]interface{}{
 		"Error":        errorMsg,
 		"AliasDomain":  aliasDomain,
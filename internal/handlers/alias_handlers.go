@@ -1,11 +1,10 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
 	"net/url"
 	"strings"
-	"time"
 
 	"go-postfixadmin/internal/middleware"
 	"go-postfixadmin/internal/models"
@@ -188,94 +187,17 @@ func (h *Handler) AddAlias(c *echo.Context) error {
 		query.Find(&domains)
 	}
 
-	// Basic Validation
-	if localPart == "" && domain != "" {
-		// Catch-all alias logic? "Para criar um alias global, use '*'" - checking models/handlers usually implies specific logic.
-		// User screenshot showed "Alias" input and "Domain" select.
-		// If localPart is empty but intended to be catch-all, usually it's explicitly "*"
-	}
-
-	if domain == "" {
-		return renderAddAliasError(c, "O domínio é obrigatório", localPart, domain, gotoRaw, domains, isSuperAdmin)
-	}
-
-	if gotoRaw == "" {
-		return renderAddAliasError(c, "O destino (Para) é obrigatório", localPart, domain, gotoRaw, domains, isSuperAdmin)
-	}
-
-	// Construct Address
-	var address string
-	if localPart == "" || localPart == "*" {
-		// Validating if * is allowed? Assuming yes based on standard PostfixAdmin
-		address = fmt.Sprintf("@%s", domain) // Or "*@domain"? PostfixAdmin usually uses "@domain.tld" for catch-all
-		// Wait, Postfix usually uses "@domain.tld" for catch-all in alias table?
-		// Actually typical catchall is `*@domain.tld` or just `@domain.tld`.
-		// Let's assume standard construction: local_part@domain
-		if localPart == "*" {
-			// Actually check if user typed *
-		}
-	}
-
-	// If localPart does not contain @, append domain.
-	// The form usually splits local_part and domain.
-	if localPart == "" {
-		// If empty, user might imply catch-all if allowed, or it's an error.
-		// "Para criar um alias global, use '*'" -> so user must type *
-		return renderAddAliasError(c, "O alias é obrigatório", localPart, domain, gotoRaw, domains, isSuperAdmin)
-	}
-
-	address = fmt.Sprintf("%s@%s", localPart, domain)
-
-	// Process "To" (Goto) field - split lines, trim, join with comma
-	var recipients []string
-	lines := strings.Split(gotoRaw, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		line = strings.Trim(line, ",") // Remove trailing commas if user added them
-		if line != "" {
-			recipients = append(recipients, line)
-		}
-	}
-
-	if len(recipients) == 0 {
-		return renderAddAliasError(c, "Pelo menos um destinatário válido é necessário", localPart, domain, gotoRaw, domains, isSuperAdmin)
-	}
-
-	gotoFinal := strings.Join(recipients, ",")
-
-	// Check if alias already exists
-	var existingAlias models.Alias
-	if err := h.DB.Where("address = ?", address).First(&existingAlias).Error; err == nil {
-		return renderAddAliasError(c, "O alias já existe", localPart, domain, gotoRaw, domains, isSuperAdmin)
-	}
-
-	// Check if it conflicts with a mailbox (if we want to enforce pure aliases vs mailboxes)
-	// PostfixAdmin usually prevents creating an alias if a mailbox exists with same email,
-	// UNLESS it's the mailbox alias itself (which is auto-created).
-	// If we create an alias clashing with mailbox, it might break mail delivery or be redundant.
-	var existingMailbox models.Mailbox
-	if err := h.DB.Where("username = ?", address).First(&existingMailbox).Error; err == nil {
-		return renderAddAliasError(c, "Já existe uma caixa de correio com este endereço", localPart, domain, gotoRaw, domains, isSuperAdmin)
-	}
-
-	// Create Alias
-	now := time.Now()
-	newAlias := models.Alias{
-		Address:  address,
-		Goto:     gotoFinal,
-		Domain:   domain,
-		Created:  now,
-		Modified: now,
-		Active:   active,
+	alias, err := utils.NewAlias(h.DB, localPart, domain)
+	if err == nil {
+		alias.Active = active
+		err = utils.SetAliasGoto(&alias, gotoRaw)
 	}
-
-	if err := h.DB.Create(&newAlias).Error; err != nil {
-		return renderAddAliasError(c, "Falha ao criar alias: "+err.Error(), localPart, domain, gotoRaw, domains, isSuperAdmin)
+	if err == nil {
+		err = utils.CreateAlias(h.DB, &alias, loggedInUser, c.RealIP())
 	}
-
-	// Log Action
-	if err := utils.LogAction(h.DB, middleware.GetUsername(c, middleware.SessionName), c.RealIP(), domain, "create_alias", address); err != nil {
-		fmt.Printf("Failed to log create_alias: %v\n", err)
+	if err != nil {
+		_, msg := formError(err, "Failed to create alias")
+		return renderAddAliasError(c, msg, localPart, domain, gotoRaw, domains, isSuperAdmin)
 	}
 
 	return c.Redirect(http.StatusFound, "/aliases")
@@ -355,57 +277,21 @@ func (h *Handler) EditAlias(c *echo.Context) error {
 	gotoRaw := c.FormValue("goto")
 	active := c.FormValue("active") == "true"
 
-	// Validate Goto
-	if gotoRaw == "" {
-		return c.Render(http.StatusBadRequest, "edit_alias.html", map[string]interface{}{
-			"Error":        "To (Recipients) is required",
-			"Alias":        alias,
-			"IsSuperAdmin": isSuperAdmin,
-			"SessionUser":  loggedInUser,
-		})
-	}
-
-	// Process "To" (Goto) field - split lines, trim, join with comma
-	var recipients []string
-	lines := strings.Split(gotoRaw, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		line = strings.Trim(line, ",") // Remove trailing commas
-		if line != "" {
-			recipients = append(recipients, line)
-		}
-	}
-
-	if len(recipients) == 0 {
-		return c.Render(http.StatusBadRequest, "edit_alias.html", map[string]interface{}{
-			"Error":        "At least one valid recipient is required",
-			"Alias":        alias,
-			"IsSuperAdmin": isSuperAdmin,
-			"SessionUser":  loggedInUser,
-		})
-	}
-
-	gotoFinal := strings.Join(recipients, ",")
-
-	// Update Alias
-	alias.Goto = gotoFinal
 	alias.Active = active
-	alias.Modified = time.Now()
-
-	if err := h.DB.Save(&alias).Error; err != nil {
-		return c.Render(http.StatusInternalServerError, "edit_alias.html", map[string]interface{}{
-			"Error":        "Failed to update alias: " + err.Error(),
+	err = utils.SetAliasGoto(&alias, gotoRaw)
+	if err == nil {
+		err = utils.UpdateAlias(h.DB, &alias, loggedInUser, c.RealIP())
+	}
+	if err != nil {
+		status, msg := formError(err, "Failed to update alias")
+		return c.Render(status, "edit_alias.html", map[string]interface{}{
+			"Error":        msg,
 			"Alias":        alias,
 			"IsSuperAdmin": isSuperAdmin,
 			"SessionUser":  loggedInUser,
 		})
 	}
 
-	// Log Action
-	if err := utils.LogAction(h.DB, middleware.GetUsername(c, middleware.SessionName), c.RealIP(), alias.Domain, "edit_alias", address); err != nil {
-		fmt.Printf("Failed to log edit_alias: %v\n", err)
-	}
-
 	return c.Redirect(http.StatusFound, "/aliases")
 }
 
@@ -436,7 +322,7 @@ func (h *Handler) DeleteAlias(c *echo.Context) error {
 
 	// Fetch alias first to check domain
 	var alias models.Alias
-	if err := h.DB.Select("domain").Where("address = ?", address).First(&alias).Error; err != nil {
+	if err := h.DB.Where("address = ?", address).First(&alias).Error; err != nil {
 		return c.JSON(http.StatusNotFound, map[string]interface{}{"error": "Alias not found"})
 	}
 
@@ -453,35 +339,18 @@ func (h *Handler) DeleteAlias(c *echo.Context) error {
 		}
 	}
 
-	// Prevent deleting mailbox aliases via this endpoint
-	// Use count instead of First to avoid "record not found" error log
-	var count int64
-	h.DB.Model(&models.Mailbox{}).Where("username = ?", address).Count(&count)
-	if count > 0 {
-		return c.JSON(http.StatusForbidden, map[string]interface{}{"error": "Cannot delete a mailbox alias via this interface. Delete the mailbox instead."})
-	}
-
-	// Delete
-	result := h.DB.Where("address = ?", address).Delete(&models.Alias{})
-	if result.Error != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": "Failed to delete alias: " + result.Error.Error()})
-	}
-
-	if result.RowsAffected == 0 {
-		return c.JSON(http.StatusNotFound, map[string]interface{}{"error": "Alias not found"})
-	}
-
-	// Log Action
-	// For delete, we need the domain. We fetched 'alias' earlier which has the domain.
-	if err := utils.LogAction(h.DB, middleware.GetUsername(c, middleware.SessionName), c.RealIP(), alias.Domain, "delete_alias", address); err != nil {
-		// Just log error
-		fmt.Printf("Failed to log delete_alias: %v\n", err)
+	// Mailbox aliases go with their mailbox
+	if err := utils.DeleteAlias(h.DB, alias, loggedInUser, c.RealIP()); err != nil {
+		if errors.Is(err, utils.ErrMailboxAlias) {
+			return c.JSON(http.StatusForbidden, map[string]interface{}{"error": "Cannot delete a mailbox alias via this interface. Delete the mailbox instead."})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": "Failed to delete alias: " + err.Error()})
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{"success": true})
 }
 
-func renderAddAliasError(c *echo.Context, errorMsg, localPart, domain, gotoRaw string, domains []models.Domain, isSuperAdmin bool) error {
+func renderAddAliasError(c *echo.Context, errorMsg interface{}, localPart, domain, gotoRaw string, domains []models.Domain, isSuperAdmin bool) error {
 	return c.Render(http.StatusBadRequest, "add_alias.html", map[string]interface{}{
 		"Error":        errorMsg,
 		"LocalPart":    localPart,
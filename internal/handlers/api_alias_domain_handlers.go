@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/middleware"
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+)
+
+// apiAliasDomain is the JSON representation of models.AliasDomain
+type apiAliasDomain struct {
+	AliasDomain  string    `json:"alias_domain"`
+	TargetDomain string    `json:"target_domain"`
+	Active       bool      `json:"active"`
+	Created      time.Time `json:"created"`
+	Modified     time.Time `json:"modified"`
+}
+
+func toAPIAliasDomain(ad models.AliasDomain) apiAliasDomain {
+	return apiAliasDomain{
+		AliasDomain:  ad.AliasDomain,
+		TargetDomain: ad.TargetDomain,
+		Active:       ad.Active,
+		Created:      ad.Created,
+		Modified:     ad.Modified,
+	}
+}
+
+// apiAliasDomainRequest is the body accepted by create and update. Nil fields are left unchanged on update.
+type apiAliasDomainRequest struct {
+	AliasDomain  string  `json:"alias_domain"`
+	TargetDomain *string `json:"target_domain"`
+	Active       *bool   `json:"active"`
+}
+
+// APIListAliasDomains returns the alias domains pointing to domains the caller may manage
+func (h *Handler) APIListAliasDomains(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	allowedDomains, isSuper, err := h.apiAllowedDomains(c)
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, "Permission check failed", nil)
+	}
+
+	query := h.DB.Order("alias_domain ASC")
+	if !isSuper {
+		if len(allowedDomains) == 0 {
+			query = query.Where("1 = 0")
+		} else {
+			query = query.Where("target_domain IN ?", allowedDomains)
+		}
+	}
+
+	var aliasDomains []models.AliasDomain
+	if err := query.Find(&aliasDomains).Error; err != nil {
+		return apiError(c, http.StatusInternalServerError, "Failed to fetch alias domains: "+err.Error(), nil)
+	}
+
+	data := make([]apiAliasDomain, 0, len(aliasDomains))
+	for _, ad := range aliasDomains {
+		data = append(data, toAPIAliasDomain(ad))
+	}
+	return apiList(c, data, len(data))
+}
+
+// APIGetAliasDomain returns a single alias domain
+func (h *Handler) APIGetAliasDomain(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	var aliasDomain models.AliasDomain
+	if err := h.DB.Where("alias_domain = ?", apiParam(c, "alias_domain")).First(&aliasDomain).Error; err != nil {
+		return apiNotFoundOr(c, err, "Alias Domain")
+	}
+	if !h.apiAllowed(c, aliasDomain.TargetDomain) {
+		return nil
+	}
+	return apiData(c, http.StatusOK, toAPIAliasDomain(aliasDomain))
+}
+
+// APICreateAliasDomain creates an alias domain
+func (h *Handler) APICreateAliasDomain(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	sessionUser, _ := middleware.GetAPIUser(c)
+
+	var req apiAliasDomainRequest
+	if err := apiBind(c, &req); err != nil {
+		return err
+	}
+
+	target := ""
+	if req.TargetDomain != nil {
+		target = strings.ToLower(strings.TrimSpace(*req.TargetDomain))
+	}
+	if target != "" && !h.apiAllowed(c, target) {
+		return nil
+	}
+
+	aliasDomain := models.AliasDomain{
+		AliasDomain:  req.AliasDomain,
+		TargetDomain: target,
+		Active:       req.Active == nil || *req.Active,
+	}
+	if err := utils.CreateAliasDomain(h.DB, &aliasDomain, sessionUser, c.RealIP()); err != nil {
+		return apiSaveError(c, err, "Failed to create alias domain")
+	}
+
+	return apiData(c, http.StatusCreated, toAPIAliasDomain(aliasDomain))
+}
+
+// APIUpdateAliasDomain changes the target or active flag of an alias domain
+func (h *Handler) APIUpdateAliasDomain(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	sessionUser, _ := middleware.GetAPIUser(c)
+
+	var aliasDomain models.AliasDomain
+	if err := h.DB.Where("alias_domain = ?", apiParam(c, "alias_domain")).First(&aliasDomain).Error; err != nil {
+		return apiNotFoundOr(c, err, "Alias Domain")
+	}
+	if !h.apiAllowed(c, aliasDomain.TargetDomain) {
+		return nil
+	}
+
+	var req apiAliasDomainRequest
+	if err := apiBind(c, &req); err != nil {
+		return err
+	}
+
+	if req.TargetDomain != nil {
+		target := strings.ToLower(strings.TrimSpace(*req.TargetDomain))
+		if target != "" && !h.apiAllowed(c, target) {
+			return nil
+		}
+		aliasDomain.TargetDomain = target
+	}
+	if req.Active != nil {
+		aliasDomain.Active = *req.Active
+	}
+	if err := utils.UpdateAliasDomain(h.DB, &aliasDomain, sessionUser, c.RealIP()); err != nil {
+		return apiSaveError(c, err, "Failed to update alias domain")
+	}
+
+	return apiData(c, http.StatusOK, toAPIAliasDomain(aliasDomain))
+}
+
+// APIDeleteAliasDomain removes an alias domain
+func (h *Handler) APIDeleteAliasDomain(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	sessionUser, _ := middleware.GetAPIUser(c)
+
+	var aliasDomain models.AliasDomain
+	if err := h.DB.Where("alias_domain = ?", apiParam(c, "alias_domain")).First(&aliasDomain).Error; err != nil {
+		return apiNotFoundOr(c, err, "Alias Domain")
+	}
+	if !h.apiAllowed(c, aliasDomain.TargetDomain) {
+		return nil
+	}
+
+	if err := utils.DeleteAliasDomain(h.DB, aliasDomain, sessionUser, c.RealIP()); err != nil {
+		return apiError(c, http.StatusInternalServerError, "Failed to delete alias domain: "+err.Error(), nil)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
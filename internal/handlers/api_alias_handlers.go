@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/middleware"
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+)
+
+// apiAlias is the JSON representation of models.Alias with goto split into a list
+type apiAlias struct {
+	Address  string    `json:"address"`
+	Goto     []string  `json:"goto"`
+	Domain   string    `json:"domain"`
+	Active   bool      `json:"active"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+}
+
+func toAPIAlias(a models.Alias) apiAlias {
+	recipients := utils.ParseRecipients(a.Goto)
+	if recipients == nil {
+		recipients = []string{}
+	}
+	return apiAlias{
+		Address:  a.Address,
+		Goto:     recipients,
+		Domain:   a.Domain,
+		Active:   a.Active,
+		Created:  a.Created,
+		Modified: a.Modified,
+	}
+}
+
+// apiAliasRequest is the body accepted by create and update. Nil fields are left unchanged on update.
+type apiAliasRequest struct {
+	LocalPart string    `json:"local_part"`
+	Domain    string    `json:"domain"`
+	Goto      *[]string `json:"goto"`
+	Active    *bool     `json:"active"`
+}
+
+// apply copies the provided fields onto the alias
+func (r apiAliasRequest) apply(a *models.Alias, fields apiFieldErrors) {
+	if r.Goto != nil {
+		if err := utils.SetAliasGoto(a, strings.Join(*r.Goto, ",")); err != nil {
+			fields["goto"] = err.Error()
+		}
+	}
+	if r.Active != nil {
+		a.Active = *r.Active
+	}
+}
+
+// APIListAliases returns the pure aliases (not mailbox aliases) the caller may manage, optionally filtered by ?domain=
+func (h *Handler) APIListAliases(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	allowedDomains, isSuper, err := h.apiAllowedDomains(c)
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, "Permission check failed", nil)
+	}
+
+	query := h.DB.Table("alias").Select("alias.*").
+		Where("address NOT IN (?)", h.DB.Table("mailbox").Select("username")).
+		Order("alias.address ASC")
+	if !isSuper {
+		if len(allowedDomains) == 0 {
+			query = query.Where("1 = 0")
+		} else {
+			query = query.Where("alias.domain IN ?", allowedDomains)
+		}
+	}
+	if domainFilter := c.QueryParam("domain"); domainFilter != "" {
+		if !h.apiAllowed(c, domainFilter) {
+			return nil
+		}
+		query = query.Where("alias.domain = ?", domainFilter)
+	}
+
+	var aliases []models.Alias
+	if err := query.Find(&aliases).Error; err != nil {
+		return apiError(c, http.StatusInternalServerError, "Failed to fetch aliases: "+err.Error(), nil)
+	}
+
+	data := make([]apiAlias, 0, len(aliases))
+	for _, a := range aliases {
+		data = append(data, toAPIAlias(a))
+	}
+	return apiList(c, data, len(data))
+}
+
+// APIGetAlias returns a single alias
+func (h *Handler) APIGetAlias(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	var alias models.Alias
+	if err := h.DB.Where("address = ?", apiParam(c, "address")).First(&alias).Error; err != nil {
+		return apiNotFoundOr(c, err, "Alias")
+	}
+	if !h.apiAllowed(c, alias.Domain) {
+		return nil
+	}
+	return apiData(c, http.StatusOK, toAPIAlias(alias))
+}
+
+// APICreateAlias creates a forwarding alias
+func (h *Handler) APICreateAlias(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	sessionUser, _ := middleware.GetAPIUser(c)
+
+	var req apiAliasRequest
+	if err := apiBind(c, &req); err != nil {
+		return err
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(req.Domain))
+	if domain != "" && !h.apiAllowed(c, domain) {
+		return nil
+	}
+	alias, err := utils.NewAlias(h.DB, req.LocalPart, domain)
+	if err != nil {
+		return apiSaveError(c, err, "Failed to create alias")
+	}
+	if req.Goto == nil {
+		return apiValidationError(c, apiFieldErrors{"goto": "At least one valid recipient is required"})
+	}
+
+	fields := apiFieldErrors{}
+	req.apply(&alias, fields)
+	if len(fields) > 0 {
+		return apiValidationError(c, fields)
+	}
+	if err := utils.CreateAlias(h.DB, &alias, sessionUser, c.RealIP()); err != nil {
+		return apiSaveError(c, err, "Failed to create alias")
+	}
+
+	return apiData(c, http.StatusCreated, toAPIAlias(alias))
+}
+
+// APIUpdateAlias updates the recipients or active flag of an alias
+func (h *Handler) APIUpdateAlias(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	sessionUser, _ := middleware.GetAPIUser(c)
+
+	var alias models.Alias
+	if err := h.DB.Where("address = ?", apiParam(c, "address")).First(&alias).Error; err != nil {
+		return apiNotFoundOr(c, err, "Alias")
+	}
+	if !h.apiAllowed(c, alias.Domain) {
+		return nil
+	}
+
+	var req apiAliasRequest
+	if err := apiBind(c, &req); err != nil {
+		return err
+	}
+
+	fields := apiFieldErrors{}
+	req.apply(&alias, fields)
+	if len(fields) > 0 {
+		return apiValidationError(c, fields)
+	}
+	if err := utils.UpdateAlias(h.DB, &alias, sessionUser, c.RealIP()); err != nil {
+		return apiSaveError(c, err, "Failed to update alias")
+	}
+
+	return apiData(c, http.StatusOK, toAPIAlias(alias))
+}
+
+// APIDeleteAlias removes an alias. Mailbox aliases must be removed by deleting the mailbox.
+func (h *Handler) APIDeleteAlias(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	sessionUser, _ := middleware.GetAPIUser(c)
+
+	var alias models.Alias
+	if err := h.DB.Where("address = ?", apiParam(c, "address")).First(&alias).Error; err != nil {
+		return apiNotFoundOr(c, err, "Alias")
+	}
+	if !h.apiAllowed(c, alias.Domain) {
+		return nil
+	}
+
+	if err := utils.DeleteAlias(h.DB, alias, sessionUser, c.RealIP()); err != nil {
+		if errors.Is(err, utils.ErrMailboxAlias) {
+			return apiError(c, http.StatusConflict, "Cannot delete a mailbox alias. Delete the mailbox instead.", nil)
+		}
+		return apiError(c, http.StatusInternalServerError, "Failed to delete alias: "+err.Error(), nil)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,147 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-postfixadmin/internal/handlers"
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/routes"
+	"go-postfixadmin/internal/testdb"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+	"gorm.io/gorm"
+)
+
+// newAPIServer returns the application routes on a test database with the superadmin
+// root@example.com and the domains example.com and other.org
+func newAPIServer(t *testing.T) (*echo.Echo, *gorm.DB) {
+	t.Helper()
+	db := testdb.Open(t)
+	now := time.Now()
+	rows := []interface{}{
+		&models.Admin{Username: "root@example.com", Password: "x", Active: true, Superadmin: true, Created: now, Modified: now},
+		&models.Domain{Domain: "example.com", Active: true, Created: now, Modified: now},
+		&models.Domain{Domain: "other.org", Active: true, Created: now, Modified: now},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("create %T: %v", row, err)
+		}
+	}
+
+	e := echo.New()
+	routes.RegisterRoutes(e, &handlers.Handler{DB: db})
+	return e, db
+}
+
+func newToken(t *testing.T, db *gorm.DB, domains []string, readOnly bool) (string, *models.APIToken) {
+	t.Helper()
+	token, record, err := utils.CreateAPIToken(db, "root@example.com", "test", domains, readOnly, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("CreateAPIToken() error = %v", err)
+	}
+	return token, record
+}
+
+func apiRequest(e *echo.Echo, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPITokenReadOnly(t *testing.T) {
+	e, db := newAPIServer(t)
+	token, _ := newToken(t, db, nil, true)
+
+	if rec := apiRequest(e, http.MethodGet, "/api/v1/domains/example.com", token, ""); rec.Code != http.StatusOK {
+		t.Errorf("GET with read-only token = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	rec := apiRequest(e, http.MethodPost, "/api/v1/domains", token, `{"domain":"new.net"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("POST with read-only token = %d, want 403: %s", rec.Code, rec.Body)
+	}
+	var count int64
+	db.Model(&models.Domain{}).Where("domain = ?", "new.net").Count(&count)
+	if count != 0 {
+		t.Error("POST with read-only token created the domain")
+	}
+}
+
+func TestAPITokenScope(t *testing.T) {
+	e, db := newAPIServer(t)
+	token, _ := newToken(t, db, []string{"example.com"}, false)
+
+	if rec := apiRequest(e, http.MethodGet, "/api/v1/domains/example.com", token, ""); rec.Code != http.StatusOK {
+		t.Errorf("GET inside the scope = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if rec := apiRequest(e, http.MethodGet, "/api/v1/domains/other.org", token, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("GET outside the scope = %d, want 403: %s", rec.Code, rec.Body)
+	}
+	// A scoped token of a superadmin does not act as superadmin
+	if rec := apiRequest(e, http.MethodPost, "/api/v1/domains", token, `{"domain":"new.net"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("POST domain with scoped token = %d, want 403: %s", rec.Code, rec.Body)
+	}
+
+	rec := apiRequest(e, http.MethodGet, "/api/v1/domains", token, "")
+	var list struct {
+		Data []struct {
+			Domain string `json:"domain"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("list domains: %v: %s", err, rec.Body)
+	}
+	if len(list.Data) != 1 || list.Data[0].Domain != "example.com" {
+		t.Errorf("list domains with scoped token = %s, want only example.com", rec.Body)
+	}
+}
+
+func TestAPITokenRejected(t *testing.T) {
+	e, db := newAPIServer(t)
+
+	revoked, record := newToken(t, db, nil, false)
+	if err := utils.RevokeAPIToken(db, record.ID, "root@example.com", true, "127.0.0.1"); err != nil {
+		t.Fatalf("RevokeAPIToken() error = %v", err)
+	}
+	inactive, _ := newToken(t, db, nil, false)
+	// The token of an admin that was deactivated after issuing it
+	db.Model(&models.Admin{}).Where("username = ?", "root@example.com").Update("active", false)
+
+	for name, token := range map[string]string{
+		"revoked":        revoked,
+		"inactive admin": inactive,
+		"unknown":        "pfa_0000000000000000000000000000000000000000",
+		"malformed":      "secret",
+	} {
+		if rec := apiRequest(e, http.MethodGet, "/api/v1/domains", token, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s token = %d, want 401: %s", name, rec.Code, rec.Body)
+		}
+	}
+	if rec := apiRequest(e, http.MethodGet, "/api/v1/domains", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no token = %d, want 401: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAPIDomainLimits(t *testing.T) {
+	e, db := newAPIServer(t)
+	token, _ := newToken(t, db, nil, false)
+
+	rec := apiRequest(e, http.MethodPost, "/api/v1/domains", token, `{"domain":"new.net","aliases":-5}`)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), `"aliases"`) {
+		t.Errorf("POST with invalid limit = %d, want 422 on aliases: %s", rec.Code, rec.Body)
+	}
+	if rec := apiRequest(e, http.MethodPost, "/api/v1/domains", token, `{"domain":"new.net","aliases":-1}`); rec.Code != http.StatusCreated {
+		t.Errorf("POST with disabled aliases = %d, want 201: %s", rec.Code, rec.Body)
+	}
+}
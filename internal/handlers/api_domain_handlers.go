@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/middleware"
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+)
+
+// apiDomain is the JSON representation of models.Domain
+type apiDomain struct {
+	Domain         string    `json:"domain"`
+	Description    string    `json:"description"`
+	Aliases        int       `json:"aliases"`
+	Mailboxes      int       `json:"mailboxes"`
+	MaxQuota       int64     `json:"maxquota"`
+	Quota          int64     `json:"quota"`
+	Transport      string    `json:"transport"`
+	BackupMX       bool      `json:"backupmx"`
+	Active         bool      `json:"active"`
+	PasswordExpiry *int      `json:"password_expiry"`
+	SendLimit      int       `json:"send_limit"`
+	Created        time.Time `json:"created"`
+	Modified       time.Time `json:"modified"`
+}
+
+func toAPIDomain(d models.Domain) apiDomain {
+	return apiDomain{
+		Domain:         d.Domain,
+		Description:    d.Description,
+		Aliases:        d.Aliases,
+		Mailboxes:      d.Mailboxes,
+		MaxQuota:       d.MaxQuota,
+		Quota:          d.Quota,
+		Transport:      d.Transport,
+		BackupMX:       d.BackupMX,
+		Active:         d.Active,
+		PasswordExpiry: d.PasswordExpiry,
+		SendLimit:      d.SendLimit,
+		Created:        d.Created,
+		Modified:       d.Modified,
+	}
+}
+
+// apiDomainRequest is the body accepted by create and update. Nil fields are left unchanged on update.
+type apiDomainRequest struct {
+	Domain         string  `json:"domain"`
+	Description    *string `json:"description"`
+	Aliases        *int    `json:"aliases"`
+	Mailboxes      *int    `json:"mailboxes"`
+	MaxQuota       *int64  `json:"maxquota"`
+	Quota          *int64  `json:"quota"`
+	Transport      *string `json:"transport"`
+	BackupMX       *bool   `json:"backupmx"`
+	Active         *bool   `json:"active"`
+	PasswordExpiry *int    `json:"password_expiry"`
+	SendLimit      *int    `json:"send_limit"`
+}
+
+// apply copies the provided fields onto the domain and validates the result with the limit
+// checks shared with the other ways of editing a domain
+func (r apiDomainRequest) apply(d *models.Domain) apiFieldErrors {
+	fields := apiFieldErrors{}
+	if r.Description != nil {
+		d.Description = *r.Description
+	}
+	if r.Aliases != nil {
+		d.Aliases = *r.Aliases
+	}
+	if r.Mailboxes != nil {
+		d.Mailboxes = *r.Mailboxes
+	}
+	if r.MaxQuota != nil {
+		d.MaxQuota = *r.MaxQuota
+	}
+	if r.Quota != nil {
+		d.Quota = *r.Quota
+	}
+	if r.Transport != nil {
+		d.Transport = *r.Transport
+	}
+	if r.BackupMX != nil {
+		d.BackupMX = *r.BackupMX
+	}
+	if r.Active != nil {
+		d.Active = *r.Active
+	}
+	if r.PasswordExpiry != nil {
+		d.PasswordExpiry = r.PasswordExpiry
+	}
+	if r.SendLimit != nil {
+		d.SendLimit = *r.SendLimit
+	}
+
+	var fieldErr *utils.FieldError
+	if err := utils.ValidateDomainLimits(*d); errors.As(err, &fieldErr) {
+		fields[fieldErr.Field] = fieldErr.Message
+	}
+	return fields
+}
+
+// APIListDomains returns the domains the caller may manage
+func (h *Handler) APIListDomains(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	allowedDomains, isSuper, err := h.apiAllowedDomains(c)
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, "Permission check failed", nil)
+	}
+
+	query := h.DB.Where("domain != ?", "ALL").Order("domain ASC")
+	if !isSuper {
+		if len(allowedDomains) == 0 {
+			query = query.Where("1 = 0")
+		} else {
+			query = query.Where("domain IN ?", allowedDomains)
+		}
+	}
+
+	var domains []models.Domain
+	if err := query.Find(&domains).Error; err != nil {
+		return apiError(c, http.StatusInternalServerError, "Failed to fetch domains: "+err.Error(), nil)
+	}
+
+	data := make([]apiDomain, 0, len(domains))
+	for _, d := range domains {
+		data = append(data, toAPIDomain(d))
+	}
+	return apiList(c, data, len(data))
+}
+
+// APIGetDomain returns a single domain
+func (h *Handler) APIGetDomain(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	domainName := apiParam(c, "domain")
+	if !h.apiAllowed(c, domainName) {
+		return nil
+	}
+
+	var domain models.Domain
+	if err := h.DB.Where("domain = ?", domainName).First(&domain).Error; err != nil {
+		return apiNotFoundOr(c, err, "Domain")
+	}
+	return apiData(c, http.StatusOK, toAPIDomain(domain))
+}
+
+// APICreateDomain creates a domain (superadmins only)
+func (h *Handler) APICreateDomain(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	username, isSuperAdmin := middleware.GetAPIUser(c)
+	if !isSuperAdmin {
+		return apiError(c, http.StatusForbidden, "Access denied: Only Superadmins can create domains", nil)
+	}
+
+	var req apiDomainRequest
+	if err := apiBind(c, &req); err != nil {
+		return err
+	}
+
+	// Same defaults as the HTML form
+	domain := models.Domain{
+		Domain:    strings.ToLower(strings.TrimSpace(req.Domain)),
+		Aliases:   10,
+		Mailboxes: 10,
+		Quota:     2048,
+		Active:    true,
+	}
+	if fields := req.apply(&domain); len(fields) > 0 {
+		return apiValidationError(c, fields)
+	}
+	if err := utils.CreateDomain(h.DB, &domain, username, c.RealIP()); err != nil {
+		return apiSaveError(c, err, "Failed to create domain")
+	}
+
+	return apiData(c, http.StatusCreated, toAPIDomain(domain))
+}
+
+// APIUpdateDomain updates a domain (superadmins only)
+func (h *Handler) APIUpdateDomain(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	username, isSuperAdmin := middleware.GetAPIUser(c)
+	if !isSuperAdmin {
+		return apiError(c, http.StatusForbidden, "Access denied: Only Superadmins can edit domains", nil)
+	}
+
+	domainName := apiParam(c, "domain")
+	var domain models.Domain
+	if err := h.DB.Where("domain = ?", domainName).First(&domain).Error; err != nil {
+		return apiNotFoundOr(c, err, "Domain")
+	}
+
+	var req apiDomainRequest
+	if err := apiBind(c, &req); err != nil {
+		return err
+	}
+
+	wasActive := domain.Active
+	if fields := req.apply(&domain); len(fields) > 0 {
+		return apiValidationError(c, fields)
+	}
+	if err := utils.UpdateDomain(h.DB, &domain, wasActive, username, c.RealIP()); err != nil {
+		return apiSaveError(c, err, "Failed to update domain")
+	}
+
+	return apiData(c, http.StatusOK, toAPIDomain(domain))
+}
+
+// APIDeleteDomain removes a domain and all associated data (superadmins only)
+func (h *Handler) APIDeleteDomain(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	username, isSuperAdmin := middleware.GetAPIUser(c)
+	if !isSuperAdmin {
+		return apiError(c, http.StatusForbidden, "Access denied: Only Superadmins can delete domains", nil)
+	}
+
+	domainName := apiParam(c, "domain")
+	var domain models.Domain
+	if err := h.DB.Where("domain = ?", domainName).First(&domain).Error; err != nil {
+		return apiNotFoundOr(c, err, "Domain")
+	}
+
+	if err := utils.DeleteDomain(h.DB, domainName, username, c.RealIP()); err != nil {
+		return apiError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete domain: %v", err), nil)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
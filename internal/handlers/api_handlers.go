@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"go-postfixadmin/internal/middleware"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+	"gorm.io/gorm"
+)
+
+// apiFieldErrors maps a request field name to its validation message
+type apiFieldErrors map[string]string
+
+// apiError writes a structured JSON error. fields may be nil.
+func apiError(c *echo.Context, status int, message string, fields apiFieldErrors) error {
+	body := map[string]interface{}{"error": message}
+	if len(fields) > 0 {
+		body["fields"] = fields
+	}
+	return c.JSON(status, body)
+}
+
+// apiValidationError writes a 422 with the collected field errors
+func apiValidationError(c *echo.Context, fields apiFieldErrors) error {
+	return apiError(c, http.StatusUnprocessableEntity, "Validation failed", fields)
+}
+
+// apiData wraps a single resource in the standard response envelope
+func apiData(c *echo.Context, status int, data interface{}) error {
+	return c.JSON(status, map[string]interface{}{"data": data})
+}
+
+// apiList wraps a collection in the standard response envelope
+func apiList(c *echo.Context, data interface{}, total int) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{"data": data, "total": total})
+}
+
+// apiBind decodes the JSON body, answering 400 on malformed input
+func apiBind(c *echo.Context, dest interface{}) error {
+	if err := c.Bind(dest); err != nil {
+		return apiError(c, http.StatusBadRequest, "Invalid request body: "+err.Error(), nil)
+	}
+	return nil
+}
+
+// apiParam returns an unescaped path parameter
+func apiParam(c *echo.Context, name string) string {
+	value := c.Param(name)
+	if decoded, err := url.PathUnescape(value); err == nil {
+		return decoded
+	}
+	return value
+}
+
+// apiAllowedDomains is GetAllowedDomains for the API caller, narrowed to the
+// token scope when the request was authenticated with a restricted API token.
+func (h *Handler) apiAllowedDomains(c *echo.Context) ([]string, bool, error) {
+	username, isSuperAdmin := middleware.GetAPIUser(c)
+	allowedDomains, isSuper, err := utils.GetAllowedDomains(h.DB, username, isSuperAdmin)
+	if err != nil {
+		return nil, false, err
+	}
+
+	scope := middleware.GetAPITokenScope(c)
+	if len(scope) == 0 {
+		return allowedDomains, isSuper, nil
+	}
+	if isSuper {
+		return scope, false, nil
+	}
+	var domains []string
+	for _, d := range scope {
+		if slices.Contains(allowedDomains, d) {
+			domains = append(domains, d)
+		}
+	}
+	return domains, false, nil
+}
+
+// apiAllowed verifies the API caller may manage the domain. When access is
+// refused the error response has already been written and false is returned.
+func (h *Handler) apiAllowed(c *echo.Context, domain string) bool {
+	allowedDomains, isSuper, err := h.apiAllowedDomains(c)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "Permission check failed", nil)
+		return false
+	}
+	if !isSuper && !slices.Contains(allowedDomains, domain) {
+		apiError(c, http.StatusForbidden, "Access denied to this domain", nil)
+		return false
+	}
+	return true
+}
+
+// apiSaveError answers 422 for the validation errors of a utils create, update or delete
+// function and 500 with failure for other errors
+func apiSaveError(c *echo.Context, err error, failure string) error {
+	var fieldErr *utils.FieldError
+	var policyErr *utils.PasswordPolicyError
+	switch {
+	case errors.As(err, &fieldErr):
+		return apiValidationError(c, apiFieldErrors{fieldErr.Field: fieldErr.Message})
+	case errors.As(err, &policyErr):
+		return apiValidationError(c, apiFieldErrors{"password": policyErr.Error()})
+	}
+	return apiError(c, http.StatusInternalServerError, failure+": "+err.Error(), nil)
+}
+
+// apiNotFoundOr returns 404 for missing records and 500 for other errors
+func apiNotFoundOr(c *echo.Context, err error, what string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return apiError(c, http.StatusNotFound, what+" not found", nil)
+	}
+	return apiError(c, http.StatusInternalServerError, "Failed to fetch "+what+": "+err.Error(), nil)
+}
+
+// apiRequireDB answers 503 when the database is unavailable
+func (h *Handler) apiRequireDB(c *echo.Context) bool {
+	if h.DB == nil {
+		apiError(c, http.StatusServiceUnavailable, "Database unavailable", nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/middleware"
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+	"gorm.io/gorm"
+)
+
+// apiMailbox is the JSON representation of models.Mailbox. Quota is expressed in MB like in the UI.
+type apiMailbox struct {
+	Username   string    `json:"username"`
+	Name       string    `json:"name"`
+	LocalPart  string    `json:"local_part"`
+	Domain     string    `json:"domain"`
+	Maildir    string    `json:"maildir"`
+	Quota      int64     `json:"quota"`
+	Active     bool      `json:"active"`
+	SMTPActive bool      `json:"smtp_active"`
+	SendLimit  int       `json:"send_limit"`
+	EmailOther string    `json:"email_other"`
+	Created    time.Time `json:"created"`
+	Modified   time.Time `json:"modified"`
+	// PasswordExpiry is null when the domain has no password_expiry policy
+	PasswordExpiry *time.Time `json:"password_expiry"`
+}
+
+func toAPIMailbox(m models.Mailbox) apiMailbox {
+	out := apiMailbox{
+		Username:   m.Username,
+		Name:       m.Name,
+		LocalPart:  m.LocalPart,
+		Domain:     m.Domain,
+		Maildir:    m.Maildir,
+		Quota:      m.Quota / utils.GetQuotaMultiplier(),
+		Active:     m.Active,
+		SMTPActive: m.SMTPActive,
+		SendLimit:  m.SendLimit,
+		EmailOther: m.EmailOther,
+		Created:    m.Created,
+		Modified:   m.Modified,
+	}
+	if utils.HasPasswordExpiry(m.PasswordExpiry) {
+		out.PasswordExpiry = &m.PasswordExpiry
+	}
+	return out
+}
+
+// apiMailboxRequest is the body accepted by create and update. Nil fields are left unchanged on update.
+type apiMailboxRequest struct {
+	LocalPart  string  `json:"local_part"`
+	Domain     string  `json:"domain"`
+	Password   *string `json:"password"`
+	Name       *string `json:"name"`
+	Quota      *int64  `json:"quota"`
+	Active     *bool   `json:"active"`
+	SMTPActive *bool   `json:"smtp_active"`
+	SendLimit  *int    `json:"send_limit"`
+	EmailOther *string `json:"email_other"`
+}
+
+// apply copies the provided fields onto the mailbox, checking the password policy and
+// hashing the password if one was given
+func (r apiMailboxRequest) apply(db *gorm.DB, m *models.Mailbox, fields apiFieldErrors) {
+	if r.Name != nil {
+		m.Name = strings.TrimSpace(*r.Name)
+	}
+	if r.Quota != nil {
+		if *r.Quota < 0 {
+			fields["quota"] = "Quota cannot be negative"
+		} else {
+			m.Quota = *r.Quota * utils.GetQuotaMultiplier()
+		}
+	}
+	if r.Active != nil {
+		m.Active = *r.Active
+	}
+	if r.SMTPActive != nil {
+		m.SMTPActive = *r.SMTPActive
+	}
+	if r.SendLimit != nil {
+		if *r.SendLimit < 0 {
+			fields["send_limit"] = "Send limit cannot be negative"
+		} else {
+			m.SendLimit = *r.SendLimit
+		}
+	}
+	if r.EmailOther != nil {
+		m.EmailOther = strings.TrimSpace(*r.EmailOther)
+	}
+	if r.Password != nil {
+		if err := utils.SetMailboxPassword(db, m, *r.Password); err != nil {
+			fields["password"] = err.Error()
+		}
+	}
+}
+
+// APIListMailboxes returns the mailboxes the caller may manage, optionally filtered by ?domain=
+func (h *Handler) APIListMailboxes(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	domainFilter := c.QueryParam("domain")
+	if domainFilter != "" && !h.apiAllowed(c, domainFilter) {
+		return nil
+	}
+	allowedDomains, isSuper, err := h.apiAllowedDomains(c)
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, "Permission check failed", nil)
+	}
+
+	username, isSuperAdmin := middleware.GetAPIUser(c)
+	mailboxes, _, err := utils.GetAllMailboxes(h.DB, username, isSuperAdmin, domainFilter)
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, "Failed to fetch mailboxes: "+err.Error(), nil)
+	}
+
+	data := make([]apiMailbox, 0, len(mailboxes))
+	for _, m := range mailboxes {
+		// Narrow to the token scope, if any
+		if !isSuper && !slices.Contains(allowedDomains, m.Domain) {
+			continue
+		}
+		data = append(data, toAPIMailbox(m))
+	}
+	return apiList(c, data, len(data))
+}
+
+// APIGetMailbox returns a single mailbox
+func (h *Handler) APIGetMailbox(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	var mailbox models.Mailbox
+	if err := h.DB.Where("username = ?", apiParam(c, "username")).First(&mailbox).Error; err != nil {
+		return apiNotFoundOr(c, err, "Mailbox")
+	}
+	if !h.apiAllowed(c, mailbox.Domain) {
+		return nil
+	}
+	return apiData(c, http.StatusOK, toAPIMailbox(mailbox))
+}
+
+// APICreateMailbox creates a mailbox together with its self-referencing alias
+func (h *Handler) APICreateMailbox(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	sessionUser, _ := middleware.GetAPIUser(c)
+
+	var req apiMailboxRequest
+	if err := apiBind(c, &req); err != nil {
+		return err
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(req.Domain))
+	if domain != "" && !h.apiAllowed(c, domain) {
+		return nil
+	}
+	mailbox, err := utils.NewMailbox(h.DB, req.LocalPart, domain)
+	if err != nil {
+		return apiSaveError(c, err, "Failed to create mailbox")
+	}
+	if req.Password == nil {
+		return apiValidationError(c, apiFieldErrors{"password": "Password is required"})
+	}
+
+	fields := apiFieldErrors{}
+	req.apply(h.DB, &mailbox, fields)
+	if len(fields) > 0 {
+		return apiValidationError(c, fields)
+	}
+	if err := utils.CreateMailbox(h.DB, &mailbox, sessionUser, c.RealIP()); err != nil {
+		return apiSaveError(c, err, "Failed to create mailbox")
+	}
+
+	return apiData(c, http.StatusCreated, toAPIMailbox(mailbox))
+}
+
+// APIUpdateMailbox updates an existing mailbox
+func (h *Handler) APIUpdateMailbox(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	sessionUser, _ := middleware.GetAPIUser(c)
+
+	var mailbox models.Mailbox
+	if err := h.DB.Where("username = ?", apiParam(c, "username")).First(&mailbox).Error; err != nil {
+		return apiNotFoundOr(c, err, "Mailbox")
+	}
+	if !h.apiAllowed(c, mailbox.Domain) {
+		return nil
+	}
+
+	var req apiMailboxRequest
+	if err := apiBind(c, &req); err != nil {
+		return err
+	}
+
+	fields := apiFieldErrors{}
+	req.apply(h.DB, &mailbox, fields)
+	if len(fields) > 0 {
+		return apiValidationError(c, fields)
+	}
+	if err := utils.UpdateMailbox(h.DB, &mailbox, req.Password != nil, sessionUser, c.RealIP()); err != nil {
+		return apiSaveError(c, err, "Failed to update mailbox")
+	}
+
+	return apiData(c, http.StatusOK, toAPIMailbox(mailbox))
+}
+
+// APIDeleteMailbox removes a mailbox, its alias and vacation settings
+func (h *Handler) APIDeleteMailbox(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	sessionUser, _ := middleware.GetAPIUser(c)
+
+	var mailbox models.Mailbox
+	if err := h.DB.Where("username = ?", apiParam(c, "username")).First(&mailbox).Error; err != nil {
+		return apiNotFoundOr(c, err, "Mailbox")
+	}
+	if !h.apiAllowed(c, mailbox.Domain) {
+		return nil
+	}
+
+	if err := utils.DeleteMailbox(h.DB, mailbox, sessionUser, c.RealIP()); err != nil {
+		return apiError(c, http.StatusInternalServerError, "Failed to delete mailbox: "+err.Error(), nil)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-postfixadmin/internal/middleware"
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+)
+
+// APITokenData is an API token row with its parsed domain scope
+type APITokenData struct {
+	models.APIToken
+	DomainList []string
+}
+
+// ListAPITokens displays the API tokens. Superadmins see all, admins see only their own.
+func (h *Handler) ListAPITokens(c *echo.Context) error {
+	return h.renderAPITokens(c, http.StatusOK, "", "")
+}
+
+// renderAPITokens renders the token list, optionally showing a freshly created token once
+func (h *Handler) renderAPITokens(c *echo.Context, status int, newToken, errorMsg string) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+
+	if h.DB == nil {
+		return c.Render(http.StatusInternalServerError, "api_tokens.html", map[string]interface{}{
+			"Error": "Database connection unavailable",
+		})
+	}
+
+	isSuper, err := utils.IsSuperAdmin(h.DB, username)
+	if err != nil {
+		return c.Render(http.StatusInternalServerError, "dashboard.html", map[string]interface{}{"Error": "Permission check failed"})
+	}
+
+	tokens, err := utils.ListAPITokens(h.DB, username, isSuper)
+	if err != nil {
+		errorMsg = "Failed to fetch API tokens"
+	}
+
+	var tokenList []APITokenData
+	for _, t := range tokens {
+		tokenList = append(tokenList, APITokenData{APIToken: t, DomainList: utils.APITokenDomains(t)})
+	}
+
+	return c.Render(status, "api_tokens.html", map[string]interface{}{
+		"Tokens":       tokenList,
+		"NewToken":     newToken,
+		"Error":        errorMsg,
+		"IsSuperAdmin": isSuper,
+		"SessionUser":  username,
+	})
+}
+
+// AddAPITokenForm displays the form to create an API token
+func (h *Handler) AddAPITokenForm(c *echo.Context) error {
+	return h.renderAddAPITokenForm(c, http.StatusOK, "", "")
+}
+
+// renderAddAPITokenForm renders the token form with the admins and domains the session user may pick
+func (h *Handler) renderAddAPITokenForm(c *echo.Context, status int, errorMsg, name string) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+
+	if h.DB == nil {
+		return c.Render(http.StatusInternalServerError, "add_api_token.html", map[string]interface{}{
+			"Error": "Database connection unavailable",
+		})
+	}
+
+	isSuper, err := utils.IsSuperAdmin(h.DB, username)
+	if err != nil {
+		return c.Render(http.StatusInternalServerError, "dashboard.html", map[string]interface{}{"Error": "Permission check failed"})
+	}
+
+	domains, _, _ := utils.GetActiveDomains(h.DB, username, isSuper)
+
+	var admins []models.Admin
+	if isSuper {
+		h.DB.Where("active = ?", true).Order("username ASC").Find(&admins)
+	}
+
+	return c.Render(status, "add_api_token.html", map[string]interface{}{
+		"Error":        errorMsg,
+		"Name":         name,
+		"Domains":      domains,
+		"Admins":       admins,
+		"IsSuperAdmin": isSuper,
+		"SessionUser":  username,
+	})
+}
+
+// AddAPIToken creates an API token and shows its plaintext value once
+func (h *Handler) AddAPIToken(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+	isSuper, err := utils.IsSuperAdmin(h.DB, username)
+	if err != nil {
+		return c.Render(http.StatusForbidden, "api_tokens.html", map[string]interface{}{"Error": "Permission check failed"})
+	}
+
+	name := c.FormValue("name")
+	readOnly := c.FormValue("read_only") == "true"
+	domains := c.Request().Form["domains"]
+
+	// Only superadmins may issue tokens on behalf of other admins
+	owner := username
+	if isSuper && c.FormValue("owner") != "" {
+		owner = c.FormValue("owner")
+	}
+
+	if name == "" {
+		return h.renderAddAPITokenForm(c, http.StatusBadRequest, "Token name is required", name)
+	}
+
+	token, _, err := utils.CreateAPIToken(h.DB, owner, name, domains, readOnly, username, c.RealIP())
+	if err != nil {
+		return h.renderAddAPITokenForm(c, http.StatusBadRequest, "Failed to create API token: "+err.Error(), name)
+	}
+
+	return h.renderAPITokens(c, http.StatusOK, token, "")
+}
+
+// DeleteAPIToken revokes an API token
+func (h *Handler) DeleteAPIToken(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+
+	if h.DB == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"success": false,
+			"error":   "Database connection unavailable",
+		})
+	}
+
+	isSuper, err := utils.IsSuperAdmin(h.DB, username)
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]interface{}{"error": "Permission check failed"})
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "Invalid token ID",
+		})
+	}
+
+	if err := utils.RevokeAPIToken(h.DB, id, username, isSuper, c.RealIP()); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
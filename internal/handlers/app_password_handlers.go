@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-postfixadmin/internal/middleware"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+)
+
+// UserAddAppPassword generates a new app password and shows it once on the dashboard
+func (h *Handler) UserAddAppPassword(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.UserSessionName)
+	if username == "" {
+		return c.Redirect(http.StatusFound, "/users/login")
+	}
+
+	plain, record, err := utils.CreateAppPassword(h.DB, username, c.FormValue("description"), c.RealIP())
+	if err != nil {
+		middleware.SetFlash(c, "error", "Failed to create app password: "+err.Error())
+		return c.Redirect(http.StatusFound, "/users/dashboard")
+	}
+
+	return h.renderUserDashboard(c, username, http.StatusOK, map[string]interface{}{
+		"NewAppPassword":     plain,
+		"NewAppPasswordDesc": *record.Description,
+	})
+}
+
+// UserDeleteAppPassword revokes one of the user's app passwords
+func (h *Handler) UserDeleteAppPassword(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.UserSessionName)
+	if username == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "Invalid app password ID",
+		})
+	}
+
+	if err := utils.RevokeAppPassword(h.DB, id, username, c.RealIP()); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, utils.ErrAppPasswordNotFound) {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "App password revoked successfully",
+	})
+}
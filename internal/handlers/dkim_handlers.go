@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/middleware"
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+	"github.com/spf13/viper"
+)
+
+// dkimDefaultOverlap is how many days a rotated key stays published when the form leaves it blank
+const dkimDefaultOverlap = 7
+
+// ListDKIM lists the DKIM keys and signing table entries of the domains the admin manages
+func (h *Handler) ListDKIM(c *echo.Context) error {
+	return h.renderDKIM(c, http.StatusOK, nil, "", "")
+}
+
+// renderDKIM renders the key list. newKey and privateKey are set right after a key was created
+// or rotated: the private key is shown this one time only.
+func (h *Handler) renderDKIM(c *echo.Context, status int, newKey *models.DKIM, privateKey, errorMsg string) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+	allowedDomains, isSuperAdmin, err := utils.GetAllowedDomains(h.DB, username, middleware.GetIsSuperAdmin(c))
+	if err != nil {
+		return c.Render(http.StatusInternalServerError, "dkim.html", map[string]interface{}{
+			"Error": "Failed to check permissions: " + err.Error(),
+		})
+	}
+
+	keyQuery := h.DB.Order("domain_name ASC, selector ASC")
+	if !isSuperAdmin {
+		if len(allowedDomains) == 0 {
+			keyQuery = keyQuery.Where("1 = 0")
+		} else {
+			keyQuery = keyQuery.Where("domain_name IN ?", allowedDomains)
+		}
+	}
+	var keys []models.DKIM
+	if err := keyQuery.Find(&keys).Error; err != nil {
+		slog.Error("Failed to list DKIM keys", "error", err)
+	}
+
+	now := time.Now()
+	keyRows := make([]map[string]interface{}, 0, len(keys))
+	keyNames := make(map[int]string, len(keys))
+	var ids []int
+	var signingKeys []map[string]interface{}
+	for _, k := range keys {
+		keyRows = append(keyRows, dkimKeyData(k, now))
+		keyNames[k.ID] = utils.DKIMRecordName(k)
+		ids = append(ids, k.ID)
+		if utils.DKIMKeyStatus(k, now) == utils.DKIMStatusActive {
+			signingKeys = append(signingKeys, map[string]interface{}{"ID": k.ID, "Name": utils.DKIMRecordName(k)})
+		}
+	}
+
+	var signings []models.DKIMSigning
+	if len(ids) > 0 {
+		if err := h.DB.Where("dkim_id IN ?", ids).Order("author ASC").Find(&signings).Error; err != nil {
+			slog.Error("Failed to list DKIM signing entries", "error", err)
+		}
+	}
+	signingRows := make([]map[string]interface{}, 0, len(signings))
+	for _, s := range signings {
+		signingRows = append(signingRows, map[string]interface{}{
+			"ID":     s.ID,
+			"Author": s.Author,
+			"Key":    keyNames[s.DKIMID],
+		})
+	}
+
+	renderData := map[string]interface{}{
+		"Keys":         keyRows,
+		"Signings":     signingRows,
+		"SigningKeys":  signingKeys,
+		"Error":        errorMsg,
+		"IsSuperAdmin": isSuperAdmin,
+		"SessionUser":  username,
+	}
+	if newKey != nil {
+		renderData["NewKey"] = dkimKeyData(*newKey, now)
+		renderData["NewPrivateKey"] = privateKey
+	}
+	return c.Render(status, "dkim.html", renderData)
+}
+
+// AddDKIMForm renders the form to generate a key
+func (h *Handler) AddDKIMForm(c *echo.Context) error {
+	return h.renderAddDKIM(c, http.StatusOK, "")
+}
+
+// renderAddDKIM renders the key form with the domains the admin may pick
+func (h *Handler) renderAddDKIM(c *echo.Context, status int, errorMsg string) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+	domains, isSuper, err := utils.GetActiveDomains(h.DB, username, middleware.GetIsSuperAdmin(c))
+	if err != nil {
+		slog.Error("Failed to fetch domains", "error", err)
+	}
+
+	selector := c.FormValue("selector")
+	if selector == "" {
+		selector = "default"
+	}
+	keyType := c.FormValue("key_type")
+	if keyType == "" {
+		keyType = utils.DKIMKeyRSA
+	}
+
+	return c.Render(status, "add_dkim.html", map[string]interface{}{
+		"Error":        errorMsg,
+		"Domains":      domains,
+		"Domain":       c.FormValue("domain"),
+		"Selector":     selector,
+		"KeyType":      keyType,
+		"Description":  c.FormValue("description"),
+		"IsSuperAdmin": isSuper,
+		"SessionUser":  username,
+	})
+}
+
+// AddDKIM generates a key for a domain and shows its private key once
+func (h *Handler) AddDKIM(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+	domain := strings.ToLower(strings.TrimSpace(c.FormValue("domain")))
+	selector := strings.ToLower(strings.TrimSpace(c.FormValue("selector")))
+	keyType := c.FormValue("key_type")
+	description := strings.TrimSpace(c.FormValue("description"))
+
+	if domain == "" {
+		return h.renderAddDKIM(c, http.StatusBadRequest, "Domain is required")
+	}
+	allowed, err := utils.CanManageDomain(h.DB, username, middleware.GetIsSuperAdmin(c), domain)
+	if err != nil {
+		return h.renderAddDKIM(c, http.StatusInternalServerError, "Permission check failed")
+	}
+	if !allowed {
+		return h.renderAddDKIM(c, http.StatusForbidden, "Access denied to this domain")
+	}
+
+	key, privateKey, err := utils.CreateDKIMKey(h.DB, domain, selector, description, keyType)
+	if err != nil {
+		slog.Error("Failed to create DKIM key", "error", err, "domain", domain)
+		return h.renderAddDKIM(c, http.StatusBadRequest, "Failed to create DKIM key: "+err.Error())
+	}
+
+	if err := utils.LogAction(h.DB, username, c.RealIP(), domain, "create_dkim", utils.DKIMRecordName(*key)); err != nil {
+		fmt.Printf("Failed to log create_dkim: %v\n", err)
+	}
+
+	return h.renderDKIM(c, http.StatusOK, key, privateKey, "")
+}
+
+// EditDKIMForm shows a key with its DNS record, description and rotation form
+func (h *Handler) EditDKIMForm(c *echo.Context) error {
+	k, status, err := h.adminDKIM(c)
+	if err != nil {
+		return c.Render(status, "edit_dkim.html", map[string]interface{}{"Error": err.Error()})
+	}
+	return h.renderEditDKIM(c, http.StatusOK, k, "")
+}
+
+// EditDKIM saves the description of a key
+func (h *Handler) EditDKIM(c *echo.Context) error {
+	k, status, err := h.adminDKIM(c)
+	if err != nil {
+		return c.Render(status, "edit_dkim.html", map[string]interface{}{"Error": err.Error()})
+	}
+
+	description := strings.TrimSpace(c.FormValue("description"))
+	err = h.DB.Model(&k).Updates(map[string]interface{}{
+		"description": optionalString(description),
+		"modified":    time.Now(),
+	}).Error
+	if err != nil {
+		slog.Error("Failed to update DKIM key", "error", err, "id", k.ID)
+		return h.renderEditDKIM(c, http.StatusInternalServerError, k, "Failed to update DKIM key")
+	}
+
+	if err := utils.LogAction(h.DB, middleware.GetUsername(c, middleware.SessionName), c.RealIP(), k.DomainName, "edit_dkim", utils.DKIMRecordName(k)); err != nil {
+		fmt.Printf("Failed to log edit_dkim: %v\n", err)
+	}
+
+	return c.Redirect(http.StatusFound, "/dkim")
+}
+
+// RotateDKIM replaces a key with a new one under another selector. The old key stays
+// published for the overlap period and its signing entries move to the new key.
+func (h *Handler) RotateDKIM(c *echo.Context) error {
+	k, status, err := h.adminDKIM(c)
+	if err != nil {
+		return c.Render(status, "edit_dkim.html", map[string]interface{}{"Error": err.Error()})
+	}
+	if k.Expires != nil {
+		return h.renderEditDKIM(c, http.StatusBadRequest, k, "This key was already rotated")
+	}
+
+	selector := strings.ToLower(strings.TrimSpace(c.FormValue("selector")))
+	keyType := c.FormValue("key_type")
+	overlap := dkimDefaultOverlap
+	if days := c.FormValue("overlap_days"); days != "" {
+		if overlap, err = strconv.Atoi(days); err != nil || overlap < 0 {
+			return h.renderEditDKIM(c, http.StatusBadRequest, k, "Invalid overlap period")
+		}
+	}
+
+	key, privateKey, err := utils.RotateDKIMKey(h.DB, k, selector, keyType, time.Duration(overlap)*24*time.Hour)
+	if err != nil {
+		slog.Error("Failed to rotate DKIM key", "error", err, "id", k.ID)
+		return h.renderEditDKIM(c, http.StatusBadRequest, k, "Failed to rotate DKIM key: "+err.Error())
+	}
+
+	if err := utils.LogAction(h.DB, middleware.GetUsername(c, middleware.SessionName), c.RealIP(), k.DomainName, "rotate_dkim", utils.DKIMRecordName(k)+" -> "+utils.DKIMRecordName(*key)); err != nil {
+		fmt.Printf("Failed to log rotate_dkim: %v\n", err)
+	}
+
+	return h.renderDKIM(c, http.StatusOK, key, privateKey, "")
+}
+
+// DeleteDKIM removes a key and its signing table entries
+func (h *Handler) DeleteDKIM(c *echo.Context) error {
+	k, status, err := h.adminDKIM(c)
+	if err != nil {
+		return c.JSON(status, map[string]interface{}{"error": err.Error()})
+	}
+
+	if err := utils.DeleteDKIMKey(h.DB, k.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": "Failed to delete DKIM key"})
+	}
+
+	if err := utils.LogAction(h.DB, middleware.GetUsername(c, middleware.SessionName), c.RealIP(), k.DomainName, "delete_dkim", utils.DKIMRecordName(k)); err != nil {
+		fmt.Printf("Failed to log delete_dkim: %v\n", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// AddDKIMSigning maps an author address or a whole domain to a key
+func (h *Handler) AddDKIMSigning(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+	author := strings.ToLower(strings.TrimSpace(c.FormValue("author")))
+	keyID, _ := strconv.Atoi(c.FormValue("dkim_id"))
+
+	domain := utils.DKIMSigningDomain(author)
+	if author == "" || !utils.IsValidDomainName(domain) {
+		return h.renderDKIM(c, http.StatusBadRequest, nil, "", "Author must be an email address or a domain")
+	}
+
+	var k models.DKIM
+	if err := h.DB.First(&k, keyID).Error; err != nil {
+		return h.renderDKIM(c, http.StatusBadRequest, nil, "", "DKIM key not found")
+	}
+	if k.Expires != nil {
+		return h.renderDKIM(c, http.StatusBadRequest, nil, "", "This key was rotated and no longer signs")
+	}
+
+	// The admin must manage both the domain of the author and the domain of the key
+	isSuper := middleware.GetIsSuperAdmin(c)
+	for _, d := range []string{domain, k.DomainName} {
+		allowed, err := utils.CanManageDomain(h.DB, username, isSuper, d)
+		if err != nil {
+			return h.renderDKIM(c, http.StatusInternalServerError, nil, "", "Permission check failed")
+		}
+		if !allowed {
+			return h.renderDKIM(c, http.StatusForbidden, nil, "", "Access denied to domain "+d)
+		}
+	}
+
+	var count int64
+	h.DB.Model(&models.DKIMSigning{}).Where("author = ?", author).Count(&count)
+	if count > 0 {
+		return h.renderDKIM(c, http.StatusBadRequest, nil, "", "Author "+author+" is already in the signing table")
+	}
+
+	now := time.Now()
+	signing := models.DKIMSigning{Author: author, DKIMID: k.ID, Created: now, Modified: now}
+	if err := h.DB.Create(&signing).Error; err != nil {
+		slog.Error("Failed to create DKIM signing entry", "error", err, "author", author)
+		return h.renderDKIM(c, http.StatusInternalServerError, nil, "", "Failed to save signing table entry")
+	}
+
+	if err := utils.LogAction(h.DB, username, c.RealIP(), domain, "create_dkim_signing", author+" "+utils.DKIMRecordName(k)); err != nil {
+		fmt.Printf("Failed to log create_dkim_signing: %v\n", err)
+	}
+
+	return c.Redirect(http.StatusFound, "/dkim")
+}
+
+// DeleteDKIMSigning removes a signing table entry
+func (h *Handler) DeleteDKIMSigning(c *echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{"error": "Invalid signing entry ID"})
+	}
+	var s models.DKIMSigning
+	if err := h.DB.First(&s, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]interface{}{"error": "Signing entry not found"})
+	}
+
+	domain := utils.DKIMSigningDomain(s.Author)
+	allowed, err := utils.CanManageDomain(h.DB, middleware.GetUsername(c, middleware.SessionName), middleware.GetIsSuperAdmin(c), domain)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": "Permission check failed"})
+	}
+	if !allowed {
+		return c.JSON(http.StatusForbidden, map[string]interface{}{"error": "Access denied"})
+	}
+
+	if err := h.DB.Delete(&s).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": "Failed to delete signing entry"})
+	}
+
+	if err := utils.LogAction(h.DB, middleware.GetUsername(c, middleware.SessionName), c.RealIP(), domain, "delete_dkim_signing", s.Author); err != nil {
+		fmt.Printf("Failed to log delete_dkim_signing: %v\n", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// ExportDKIM downloads the keys and signing table for OpenDKIM or rspamd. The archive holds
+// every private key, so only superadmins may export.
+func (h *Handler) ExportDKIM(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+	isSuper, err := utils.IsSuperAdmin(h.DB, username)
+	if err != nil || !isSuper {
+		return c.String(http.StatusForbidden, "Access denied")
+	}
+
+	format := c.Param("format")
+	keyDir := viper.GetString("dkim.opendkim_key_dir")
+	if keyDir == "" {
+		keyDir = "/etc/opendkim/keys"
+	}
+	if format == utils.DKIMExportRspamd {
+		if keyDir = viper.GetString("dkim.rspamd_key_dir"); keyDir == "" {
+			keyDir = "/var/lib/rspamd/dkim"
+		}
+	}
+
+	var keys []models.DKIM
+	var signings []models.DKIMSigning
+	if err := h.DB.Order("domain_name ASC, selector ASC").Find(&keys).Error; err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load DKIM keys")
+	}
+	if err := h.DB.Order("author ASC").Find(&signings).Error; err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load DKIM signing table")
+	}
+
+	var buf bytes.Buffer
+	if err := utils.ExportDKIM(&buf, format, keys, signings, keyDir, time.Now()); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if err := utils.LogAction(h.DB, username, c.RealIP(), "", "export_dkim", format); err != nil {
+		fmt.Printf("Failed to log export_dkim: %v\n", err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="dkim-%s.tar.gz"`, format))
+	return c.Blob(http.StatusOK, "application/gzip", buf.Bytes())
+}
+
+// adminDKIM loads the key of the :id parameter and checks the admin manages its domain
+func (h *Handler) adminDKIM(c *echo.Context) (models.DKIM, int, error) {
+	var k models.DKIM
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return k, http.StatusBadRequest, errors.New("Invalid DKIM key ID")
+	}
+	if err := h.DB.First(&k, id).Error; err != nil {
+		return k, http.StatusNotFound, errors.New("DKIM key not found")
+	}
+
+	allowed, err := utils.CanManageDomain(h.DB, middleware.GetUsername(c, middleware.SessionName), middleware.GetIsSuperAdmin(c), k.DomainName)
+	if err != nil {
+		return k, http.StatusInternalServerError, errors.New("Permission check failed")
+	}
+	if !allowed {
+		return k, http.StatusForbidden, errors.New("Access denied")
+	}
+	return k, http.StatusOK, nil
+}
+
+func (h *Handler) renderEditDKIM(c *echo.Context, status int, k models.DKIM, errorMsg string) error {
+	renderData := dkimKeyData(k, time.Now())
+	renderData["Error"] = errorMsg
+	renderData["NewSelector"] = "s" + time.Now().Format("200601")
+	renderData["OverlapDays"] = dkimDefaultOverlap
+	renderData["SessionUser"] = middleware.GetUsername(c, middleware.SessionName)
+	renderData["IsSuperAdmin"] = middleware.GetIsSuperAdmin(c)
+	return c.Render(status, "edit_dkim.html", renderData)
+}
+
+// dkimKeyData formats a key for the list and the edit page. The private key is never
+// included.
+func dkimKeyData(k models.DKIM, now time.Time) map[string]interface{} {
+	data := map[string]interface{}{
+		"ID":          k.ID,
+		"DomainName":  k.DomainName,
+		"Selector":    k.Selector,
+		"KeyType":     utils.DKIMKeyType(k),
+		"Description": stringValue(k.Description),
+		"Status":      utils.DKIMKeyStatus(k, now),
+		"Expires":     "",
+		"Created":     k.Created.Format("2006-01-02 15:04"),
+		"RecordName":  utils.DKIMRecordName(k),
+		"Record":      utils.DKIMRecord(k),
+		"ZoneRecord":  utils.DKIMZoneRecord(k),
+	}
+	if k.Expires != nil {
+		data["Expires"] = k.Expires.Format("2006-01-02 15:04")
+	}
+	return data
+}
@@ -1,19 +1,15 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
-	"regexp"
 	"strconv"
 	"strings"
-	"time"
 
 	"go-postfixadmin/internal/middleware"
 	"go-postfixadmin/internal/models"
 	"go-postfixadmin/internal/utils"
 
 	"github.com/labstack/echo/v5"
-	"gorm.io/gorm"
 )
 
 // DomainDisplay representa um domínio com contadores de aliases e mailboxes
@@ -135,71 +131,28 @@ func (h *Handler) AddDomain(c *echo.Context) error {
 		}
 	}
 
-	// Validation: domain is required
-	if domainName == "" {
-		return c.Render(http.StatusBadRequest, "add_domain.html", map[string]interface{}{
-			"Error":       "Domain name is required",
-			"Domain":      domainName,
-			"Description": description,
-			"Active":      active,
-			"BackupMX":    backupMX,
-			"Aliases":     aliases,
-			"Mailboxes":   mailboxes,
-			"SessionUser": username,
-		})
-	}
-
-	// Validation: basic DNS format (simplified)
-	domainRegex := regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]{0,61}[a-zA-Z0-9]?(\.[a-zA-Z0-9][a-zA-Z0-9-]{0,61}[a-zA-Z0-9]?)+$`)
-	if !domainRegex.MatchString(domainName) {
-		return c.Render(http.StatusBadRequest, "add_domain.html", map[string]interface{}{
-			"Error":       "Invalid domain format. Please enter a valid domain name (e.g., example.com)",
-			"Domain":      domainName,
-			"Description": description,
-			"Active":      active,
-			"BackupMX":    backupMX,
-			"Aliases":     aliases,
-			"Mailboxes":   mailboxes,
-			"SessionUser": username,
-		})
-	}
-
-	// Check if domain already exists
-	var existingDomain models.Domain
-	result := h.DB.Where("domain = ?", domainName).First(&existingDomain)
-	if result.Error == nil {
-		return c.Render(http.StatusBadRequest, "add_domain.html", map[string]interface{}{
-			"Error":       "Domain already exists",
-			"Domain":      domainName,
-			"Description": description,
-			"Active":      active,
-			"BackupMX":    backupMX,
-			"Aliases":     aliases,
-			"Mailboxes":   mailboxes,
-			"SessionUser": username,
-		})
+	sendLimit := 0
+	if val := c.FormValue("send_limit"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			sendLimit = parsed
+		}
 	}
 
-	// Create new domain
-	now := time.Now()
 	newDomain := models.Domain{
 		Domain:         domainName,
 		Description:    description,
 		Aliases:        aliases,
 		Mailboxes:      mailboxes,
-		MaxQuota:       0,     // Not used in this form yet? Or is Quota the max quota for the domain?
-		Quota:          quota, // Domain quota
-		Transport:      "",
+		Quota:          quota,
 		BackupMX:       backupMX,
-		Created:        now,
-		Modified:       now,
 		Active:         active,
 		PasswordExpiry: passwordExpiry,
+		SendLimit:      sendLimit,
 	}
-
-	if err := h.DB.Create(&newDomain).Error; err != nil {
-		return c.Render(http.StatusInternalServerError, "add_domain.html", map[string]interface{}{
-			"Error":       "Failed to create domain: " + err.Error(),
+	if err := utils.CreateDomain(h.DB, &newDomain, username, c.RealIP()); err != nil {
+		status, msg := formError(err, "Failed to create domain")
+		return c.Render(status, "add_domain.html", map[string]interface{}{
+			"Error":       msg,
 			"Domain":      domainName,
 			"Description": description,
 			"Active":      active,
@@ -210,11 +163,6 @@ func (h *Handler) AddDomain(c *echo.Context) error {
 		})
 	}
 
-	// Log Action
-	if err := utils.LogAction(h.DB, username, c.RealIP(), domainName, "create_domain", domainName); err != nil {
-		fmt.Printf("Failed to log create_domain: %v\n", err)
-	}
-
 	// Redirect to domains list on success
 	return c.Redirect(http.StatusFound, "/domains")
 }
@@ -300,8 +248,14 @@ func (h *Handler) EditDomain(c *echo.Context) error {
 		}
 	}
 
-	// Check if active state is changing
-	activeChanged := domain.Active != active
+	sendLimit := 0
+	if val := c.FormValue("send_limit"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			sendLimit = parsed
+		}
+	}
+
+	wasActive := domain.Active
 
 	// Update domain fields
 	domain.Description = description
@@ -309,38 +263,14 @@ func (h *Handler) EditDomain(c *echo.Context) error {
 	domain.Mailboxes = mailboxes
 	domain.Quota = quota
 	domain.BackupMX = backupMX
-	domain.Modified = time.Now()
 	domain.Active = active
 	domain.PasswordExpiry = passwordExpiry
+	domain.SendLimit = sendLimit
 
-	// Use transaction to ensure atomicity (especially for cascading updates)
-	err := h.DB.Transaction(func(tx *gorm.DB) error {
-		if activeChanged {
-			// Update all mailboxes for this domain to match the new domain active state
-			if err := tx.Model(&models.Mailbox{}).Where("domain = ?", domain.Domain).Update("active", active).Error; err != nil {
-				return err
-			}
-			// Update all aliases for this domain to match the new domain active state
-			if err := tx.Model(&models.Alias{}).Where("domain = ?", domain.Domain).Update("active", active).Error; err != nil {
-				return err
-			}
-		}
-
-		if err := tx.Save(&domain).Error; err != nil {
-			return err
-		}
-
-		// Log Action
-		if err := utils.LogAction(tx, username, c.RealIP(), domainName, "edit_domain", domainName); err != nil {
-			fmt.Printf("Failed to log edit_domain: %v\n", err)
-			return nil
-		}
-		return nil
-	})
-
-	if err != nil {
-		return c.Render(http.StatusInternalServerError, "edit_domain.html", map[string]interface{}{
-			"Error":       "Failed to update domain: " + err.Error(),
+	if err := utils.UpdateDomain(h.DB, &domain, wasActive, username, c.RealIP()); err != nil {
+		status, msg := formError(err, "Failed to update domain")
+		return c.Render(status, "edit_domain.html", map[string]interface{}{
+			"Error":       msg,
 			"Domain":      domain,
 			"SessionUser": username,
 		})
@@ -383,3 +313,32 @@ func (h *Handler) DeleteDomain(c *echo.Context) error {
 		"message": "Domain deleted successfully",
 	})
 }
+
+// DomainDNS checks the MX, SPF, DKIM, DMARC, MTA-STS and TLS-RPT records of a domain
+func (h *Handler) DomainDNS(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+	isSuperAdmin := middleware.GetIsSuperAdmin(c)
+	domainName := strings.ToLower(c.Param("domain"))
+
+	allowed, err := utils.CanManageDomain(h.DB, username, isSuperAdmin, domainName)
+	if err != nil || !allowed {
+		return c.Render(http.StatusForbidden, "dns_status.html", map[string]interface{}{"Error": "Access denied to this domain"})
+	}
+	if err := h.DB.Where("domain = ?", domainName).First(&models.Domain{}).Error; err != nil {
+		return c.Render(http.StatusNotFound, "dns_status.html", map[string]interface{}{"Error": "Domain not found"})
+	}
+
+	var keys []models.DKIM
+	h.DB.Where("domain_name = ?", domainName).Order("selector ASC").Find(&keys)
+
+	checker := utils.NewDNSChecker()
+	report := checker.Check(c.Request().Context(), domainName, keys)
+
+	return c.Render(http.StatusOK, "dns_status.html", map[string]interface{}{
+		"Report":       report,
+		"Status":       report.Status(),
+		"MailHosts":    checker.MailHosts,
+		"IsSuperAdmin": isSuperAdmin,
+		"SessionUser":  username,
+	})
+}
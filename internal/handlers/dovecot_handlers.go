@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+)
+
+// dovecotAuthRequest is the body of POST /dovecot/auth
+type dovecotAuthRequest struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Service  string `json:"service"`   // imap, pop3, smtp, submission, ...
+	RemoteIP string `json:"remote_ip"` // client IP, used for the login lockout
+}
+
+// DovecotAuth verifies a login on behalf of Dovecot and returns the userdb data of the
+// resolved mailbox. Failed logins count towards a login lockout of their own, apart from the web portals.
+func (h *Handler) DovecotAuth(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	var req dovecotAuthRequest
+	if err := apiBind(c, &req); err != nil {
+		return err
+	}
+	login := strings.ToLower(strings.TrimSpace(req.User))
+	if login == "" || req.Password == "" {
+		return apiError(c, http.StatusBadRequest, "user and password are required", nil)
+	}
+	_, logDomain := utils.SplitEmail(login)
+
+	if utils.CheckLoginLock(h.DB, utils.LoginPortalDovecot, login, req.RemoteIP, logDomain) {
+		return apiError(c, http.StatusForbidden, "Too many failed logins", nil)
+	}
+
+	mailbox, ok, err := utils.DovecotAuthenticate(h.DB, login, req.Password, strings.ToLower(req.Service))
+	if err != nil && !errors.Is(err, utils.ErrUnknownMailbox) {
+		return apiError(c, http.StatusInternalServerError, "Authentication failed: "+err.Error(), nil)
+	}
+	if !ok {
+		utils.RegisterLoginFailure(h.DB, utils.LoginPortalDovecot, login, req.RemoteIP, logDomain)
+		return apiError(c, http.StatusUnauthorized, "Authentication failed", nil)
+	}
+
+	utils.ClearLoginFailures(h.DB, utils.LoginPortalDovecot, login, req.RemoteIP)
+	return apiData(c, http.StatusOK, utils.NewDovecotUser(h.DB, mailbox).UserDB())
+}
+
+// DovecotPassDB returns the passdb data of a mailbox, including the password and app
+// password hashes, for setups where Dovecot verifies the password itself
+func (h *Handler) DovecotPassDB(c *echo.Context) error {
+	return h.dovecotLookup(c, true)
+}
+
+// DovecotUserDB returns the userdb data of a mailbox (home, uid, gid, quota rule)
+func (h *Handler) DovecotUserDB(c *echo.Context) error {
+	return h.dovecotLookup(c, false)
+}
+
+func (h *Handler) dovecotLookup(c *echo.Context, passdb bool) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	mailbox, err := utils.ResolveMailboxLogin(h.DB, apiParam(c, "user"))
+	if errors.Is(err, utils.ErrUnknownMailbox) {
+		return apiError(c, http.StatusNotFound, "Mailbox not found", nil)
+	}
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, "Failed to fetch mailbox: "+err.Error(), nil)
+	}
+
+	user := utils.NewDovecotUser(h.DB, mailbox)
+	if !passdb {
+		user = user.UserDB()
+	}
+	return apiData(c, http.StatusOK, user)
+}
+
+// DovecotListUsers returns the active mailboxes for Dovecot user iteration
+func (h *Handler) DovecotListUsers(c *echo.Context) error {
+	if !h.apiRequireDB(c) {
+		return nil
+	}
+	users, err := utils.ListDovecotUsers(h.DB)
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, "Failed to fetch mailboxes: "+err.Error(), nil)
+	}
+	return apiList(c, users, len(users))
+}
@@ -1,18 +1,74 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"go-postfixadmin/internal/fetchmail"
 	"go-postfixadmin/internal/middleware"
 	"go-postfixadmin/internal/models"
 	"go-postfixadmin/internal/utils"
 
 	"github.com/labstack/echo/v5"
+	"github.com/spf13/viper"
 )
 
+// fetchmailNeverRun is the date of entries that were never polled, the column default
+var fetchmailNeverRun = time.Date(2000, 1, 1, 0, 0, 0, 0, time.Local)
+
+// fetchmailTestTimeout bounds a connection test started from the web interface
+const fetchmailTestTimeout = 15 * time.Second
+
+// Errors of the fetchmail form
+var (
+	errFetchmailServer   = errors.New("Server is required")
+	errFetchmailUser     = errors.New("Username is required")
+	errFetchmailPassword = errors.New("Password is required")
+	errFetchmailSecret   = errors.New("Failed to encrypt the password")
+	errFetchmailNoKey    = errors.New("Passwords cannot be saved until [fetchmail] encryption_key is set")
+)
+
+// ListFetchmail lists the fetchmail entries of the domains the admin manages
+func (h *Handler) ListFetchmail(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+	allowedDomains, isSuperAdmin, err := utils.GetAllowedDomains(h.DB, username, middleware.GetIsSuperAdmin(c))
+	if err != nil {
+		return c.Render(http.StatusInternalServerError, "fetchmail.html", map[string]interface{}{
+			"Error": "Failed to check permissions: " + err.Error(),
+		})
+	}
+
+	query := h.DB.Order("mailbox ASC, src_server ASC")
+	if !isSuperAdmin {
+		if len(allowedDomains) == 0 {
+			query = query.Where("1 = 0")
+		} else {
+			query = query.Where("domain IN ?", allowedDomains)
+		}
+	}
+
+	var entries []models.Fetchmail
+	if err := query.Find(&entries).Error; err != nil {
+		slog.Error("Failed to list fetchmail entries", "error", err)
+	}
+
+	rows := make([]map[string]interface{}, 0, len(entries))
+	for _, f := range entries {
+		rows = append(rows, fetchmailFormData(f))
+	}
+
+	return c.Render(http.StatusOK, "fetchmail.html", map[string]interface{}{
+		"Entries":      rows,
+		"IsSuperAdmin": isSuperAdmin,
+		"SessionUser":  username,
+	})
+}
+
 // AddFetchmailGET renders the form to create a new fetchmail entry
 func (h *Handler) AddFetchmailGET(c *echo.Context) error {
 	username := middleware.GetUsername(c, middleware.SessionName)
@@ -23,6 +79,7 @@ func (h *Handler) AddFetchmailGET(c *echo.Context) error {
 
 	renderData := map[string]interface{}{
 		"Mailboxes":    mailboxes,
+		"Mailbox":      c.QueryParam("mailbox"),
 		"Active":       true,
 		"PollTime":     10,
 		"SessionUser":  username,
@@ -34,76 +91,36 @@ func (h *Handler) AddFetchmailGET(c *echo.Context) error {
 
 // AddFetchmailPOST processes the form submission to create a new fetchmail entry
 func (h *Handler) AddFetchmailPOST(c *echo.Context) error {
-	mailbox := c.FormValue("mailbox")
-	srcServer := c.FormValue("src_server")
-	srcAuth := c.FormValue("src_auth")
-	srcUser := c.FormValue("src_user")
-	srcPassword := c.FormValue("src_password")
-	srcFolder := c.FormValue("src_folder")
-	protocol := c.FormValue("protocol")
-
-	// Parse Ints
-	pollTime, _ := strconv.Atoi(c.FormValue("poll_time"))
-	if pollTime == 0 {
-		pollTime = 10
-	}
-	srcPort, _ := strconv.Atoi(c.FormValue("src_port"))
-
-	// Parse Bools
-	fetchall := c.FormValue("fetchall") == "true"
-	keep := c.FormValue("keep") == "true"
-	usessl := c.FormValue("usessl") == "true"
-	sslcertck := c.FormValue("sslcertck") == "true"
-	active := c.FormValue("active") == "true"
+	mailbox := strings.ToLower(strings.TrimSpace(c.FormValue("mailbox")))
+	username := middleware.GetUsername(c, middleware.SessionName) // Admin username
 
 	// Basic validation
 	if mailbox == "" {
 		return renderFetchmailFormWithError(c, h, "O campo 'Conta' é obrigatório.")
 	}
 
-	// For domain, we extract it from the mailbox (assuming mailbox is an email address user@domain.com)
-	var domainStr *string
-	username := middleware.GetUsername(c, middleware.SessionName) // Admin username
+	// Security: the mailbox must belong to a domain the admin manages
+	allowed, err := h.fetchmailDomainAllowed(c, mailbox)
+	if err != nil {
+		return renderFetchmailFormWithError(c, h, "Permission check failed")
+	}
+	if !allowed {
+		return renderFetchmailFormWithError(c, h, "Access denied to this domain")
+	}
+	if err := h.DB.Where("username = ?", mailbox).First(&models.Mailbox{}).Error; err != nil {
+		return renderFetchmailFormWithError(c, h, "Mailbox does not exist")
+	}
 
-	// Create Fetchmail object
+	_, domain := utils.SplitEmail(mailbox)
+	now := time.Now()
 	newFetchmail := models.Fetchmail{
-		Mailbox:     mailbox,
-		SrcServer:   srcServer,
-		SrcUser:     srcUser,
-		SrcPassword: srcPassword,
-		SrcFolder:   srcFolder,
-		PollTime:    pollTime,
-		Fetchall:    fetchall,
-		Keep:        keep,
-		UseSSL:      usessl,
-		SSLCertCk:   sslcertck,
-		Active:      active,
-		SrcPort:     srcPort,
-		Date:        time.Now(),
-		Created:     time.Now(),
-		Modified:    time.Now(),
-	}
-
-	if srcAuth != "" {
-		newFetchmail.SrcAuth = &srcAuth
-	}
-	if protocol != "" {
-		newFetchmail.Protocol = &protocol
-	}
-
-	// Try extracting domain from mailbox
-	if mailbox != "" {
-		// basic extraction
-		for i, char := range mailbox {
-			if char == '@' {
-				domain := mailbox[i+1:]
-				domainStr = &domain
-				break
-			}
-		}
+		Mailbox: mailbox,
+		Domain:  &domain,
+		Date:    fetchmailNeverRun,
+		Created: now,
 	}
-	if domainStr != nil {
-		newFetchmail.Domain = domainStr
+	if err := fetchmailFromForm(c, &newFetchmail); err != nil {
+		return renderFetchmailFormWithError(c, h, err.Error())
 	}
 
 	// Save to database
@@ -112,10 +129,363 @@ func (h *Handler) AddFetchmailPOST(c *echo.Context) error {
 		return renderFetchmailFormWithError(c, h, "Falha ao salvar registro no banco de dados. Tente novamente.")
 	}
 
-	// Redirect or render success. Redirecting to same page for now (form reset) or list
-	// Assuming there might be a list page in future, redirecting back to form with success message is also fine.
-	// For simple implementation, redirect to dashboard or mailboxes, taking user back to form for now.
-	return c.Redirect(http.StatusFound, "/fetchmail/add")
+	if err := utils.LogAction(h.DB, username, c.RealIP(), domain, "create_fetchmail", mailbox+" "+newFetchmail.SrcServer); err != nil {
+		fmt.Printf("Failed to log create_fetchmail: %v\n", err)
+	}
+
+	return c.Redirect(http.StatusFound, "/fetchmail")
+}
+
+// EditFetchmailForm renders the form to edit a fetchmail entry
+func (h *Handler) EditFetchmailForm(c *echo.Context) error {
+	f, status, err := h.adminFetchmail(c)
+	if err != nil {
+		return c.Render(status, "edit_fetchmail.html", map[string]interface{}{"Error": err.Error()})
+	}
+	return h.renderEditFetchmail(c, http.StatusOK, f, "")
+}
+
+// EditFetchmail saves a fetchmail entry. The source password is kept when left blank.
+func (h *Handler) EditFetchmail(c *echo.Context) error {
+	f, status, err := h.adminFetchmail(c)
+	if err != nil {
+		return c.Render(status, "edit_fetchmail.html", map[string]interface{}{"Error": err.Error()})
+	}
+
+	if err := fetchmailFromForm(c, &f); err != nil {
+		return h.renderEditFetchmail(c, http.StatusBadRequest, f, err.Error())
+	}
+	// date and returned_text are written by "postfixadmin fetchmail" while it polls
+	if err := h.DB.Omit("date", "returned_text").Save(&f).Error; err != nil {
+		slog.Error("Failed to update fetchmail entry", "error", err, "id", f.ID)
+		return h.renderEditFetchmail(c, http.StatusInternalServerError, f, "Failed to update fetchmail entry")
+	}
+
+	if err := utils.LogAction(h.DB, middleware.GetUsername(c, middleware.SessionName), c.RealIP(), fetchmailDomain(f), "edit_fetchmail", f.Mailbox+" "+f.SrcServer); err != nil {
+		fmt.Printf("Failed to log edit_fetchmail: %v\n", err)
+	}
+
+	return c.Redirect(http.StatusFound, "/fetchmail")
+}
+
+// DeleteFetchmail removes a fetchmail entry
+func (h *Handler) DeleteFetchmail(c *echo.Context) error {
+	f, status, err := h.adminFetchmail(c)
+	if err != nil {
+		return c.JSON(status, map[string]interface{}{"error": err.Error()})
+	}
+
+	if err := h.DB.Delete(&f).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": "Failed to delete fetchmail entry"})
+	}
+
+	if err := utils.LogAction(h.DB, middleware.GetUsername(c, middleware.SessionName), c.RealIP(), fetchmailDomain(f), "delete_fetchmail", f.Mailbox+" "+f.SrcServer); err != nil {
+		fmt.Printf("Failed to log delete_fetchmail: %v\n", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// TestFetchmail connects and logs in to the remote server of a fetchmail entry
+func (h *Handler) TestFetchmail(c *echo.Context) error {
+	f, status, err := h.adminFetchmail(c)
+	if err != nil {
+		return c.JSON(status, map[string]interface{}{"success": false, "error": err.Error()})
+	}
+	return fetchmailTestResponse(c, f)
+}
+
+// UserFetchmail lists the fetchmail entries of the logged in mailbox, with the form to add
+// one or to edit the entry given by ?edit=
+func (h *Handler) UserFetchmail(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.UserSessionName)
+	if username == "" {
+		return c.Redirect(http.StatusFound, "/users/login")
+	}
+	if !viper.GetBool("features.fetchmail") {
+		return c.Redirect(http.StatusFound, "/users/dashboard")
+	}
+
+	var entries []models.Fetchmail
+	if err := h.DB.Where("mailbox = ?", username).Order("src_server ASC").Find(&entries).Error; err != nil {
+		slog.Error("Failed to list fetchmail entries", "error", err, "username", username)
+	}
+	rows := make([]map[string]interface{}, 0, len(entries))
+	for _, f := range entries {
+		rows = append(rows, fetchmailFormData(f))
+	}
+
+	form := fetchmailFormData(models.Fetchmail{PollTime: 10, Active: true})
+	if id, err := strconv.Atoi(c.QueryParam("edit")); err == nil {
+		for _, f := range entries {
+			if f.ID == id {
+				form = fetchmailFormData(f)
+			}
+		}
+	}
+
+	return c.Render(http.StatusOK, "users/fetchmail.html", map[string]interface{}{
+		"SessionUser": username,
+		"Entries":     rows,
+		"Form":        form,
+		"Message":     middleware.GetFlash(c, "message"),
+		"Error":       middleware.GetFlash(c, "error"),
+	})
+}
+
+// UserSaveFetchmail creates a fetchmail entry for the logged in mailbox, or updates one of
+// its entries when the form has an id
+func (h *Handler) UserSaveFetchmail(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.UserSessionName)
+	if username == "" {
+		return c.Redirect(http.StatusFound, "/users/login")
+	}
+	if !viper.GetBool("features.fetchmail") {
+		return c.Redirect(http.StatusFound, "/users/dashboard")
+	}
+
+	_, domain := utils.SplitEmail(username)
+	f := models.Fetchmail{Mailbox: username, Domain: &domain, Date: fetchmailNeverRun, Created: time.Now()}
+	action := "USER_CREATE_FETCHMAIL"
+	if id, _ := strconv.Atoi(c.FormValue("id")); id > 0 {
+		if err := h.DB.Where("id = ? AND mailbox = ?", id, username).First(&f).Error; err != nil {
+			middleware.SetFlash(c, "error", "Busca de e-mails não encontrada")
+			return c.Redirect(http.StatusFound, "/users/fetchmail")
+		}
+		action = "USER_EDIT_FETCHMAIL"
+	}
+
+	if err := fetchmailFromForm(c, &f); err != nil {
+		middleware.SetFlash(c, "error", userFetchmailError(err))
+		if f.ID > 0 {
+			return c.Redirect(http.StatusFound, "/users/fetchmail?edit="+strconv.Itoa(f.ID))
+		}
+		return c.Redirect(http.StatusFound, "/users/fetchmail")
+	}
+	if err := h.DB.Omit("date", "returned_text").Save(&f).Error; err != nil {
+		slog.Error("Failed to save fetchmail entry", "error", err, "username", username)
+		middleware.SetFlash(c, "error", "Falha ao salvar a busca de e-mails")
+		return c.Redirect(http.StatusFound, "/users/fetchmail")
+	}
+
+	utils.LogAction(h.DB, username, c.RealIP(), domain, action, username+" "+f.SrcServer)
+
+	middleware.SetFlash(c, "message", "Busca de e-mails salva com sucesso")
+	return c.Redirect(http.StatusFound, "/users/fetchmail")
+}
+
+// UserDeleteFetchmail removes a fetchmail entry of the logged in mailbox
+func (h *Handler) UserDeleteFetchmail(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.UserSessionName)
+	if username == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": "Unauthorized"})
+	}
+
+	var f models.Fetchmail
+	if err := h.DB.Where("id = ? AND mailbox = ?", c.Param("id"), username).First(&f).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]interface{}{"success": false, "error": "Fetchmail entry not found"})
+	}
+	if err := h.DB.Delete(&f).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{"success": false, "error": "Failed to delete fetchmail entry"})
+	}
+
+	utils.LogAction(h.DB, username, c.RealIP(), fetchmailDomain(f), "USER_DELETE_FETCHMAIL", username+" "+f.SrcServer)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// UserTestFetchmail connects and logs in to the remote server of an entry of the logged in mailbox
+func (h *Handler) UserTestFetchmail(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.UserSessionName)
+	if username == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": "Unauthorized"})
+	}
+
+	var f models.Fetchmail
+	if err := h.DB.Where("id = ? AND mailbox = ?", c.Param("id"), username).First(&f).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]interface{}{"success": false, "error": "Fetchmail entry not found"})
+	}
+	return fetchmailTestResponse(c, f)
+}
+
+// userFetchmailError translates a fetchmail form error for the user portal
+func userFetchmailError(err error) string {
+	switch {
+	case errors.Is(err, errFetchmailServer):
+		return "Informe o servidor de origem"
+	case errors.Is(err, errFetchmailUser):
+		return "Informe o usuário de origem"
+	case errors.Is(err, errFetchmailPassword):
+		return "Informe a senha de origem"
+	case errors.Is(err, errFetchmailNoKey):
+		return "As senhas só podem ser salvas depois que a chave de criptografia for configurada"
+	}
+	return "Falha ao salvar a busca de e-mails"
+}
+
+// adminFetchmail loads the fetchmail entry of the :id parameter when the admin manages its
+// domain, or returns the HTTP status and error to report
+func (h *Handler) adminFetchmail(c *echo.Context) (models.Fetchmail, int, error) {
+	var f models.Fetchmail
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return f, http.StatusBadRequest, errors.New("Invalid fetchmail ID")
+	}
+	if err := h.DB.First(&f, id).Error; err != nil {
+		return f, http.StatusNotFound, errors.New("Fetchmail entry not found")
+	}
+
+	allowed, err := h.fetchmailDomainAllowed(c, f.Mailbox)
+	if err != nil {
+		return f, http.StatusInternalServerError, errors.New("Permission check failed")
+	}
+	if !allowed {
+		return f, http.StatusForbidden, errors.New("Access denied")
+	}
+	return f, http.StatusOK, nil
+}
+
+// fetchmailDomainAllowed reports whether the logged in admin manages the domain of mailbox
+func (h *Handler) fetchmailDomainAllowed(c *echo.Context, mailbox string) (bool, error) {
+	username := middleware.GetUsername(c, middleware.SessionName)
+	allowedDomains, isSuperAdmin, err := utils.GetAllowedDomains(h.DB, username, middleware.GetIsSuperAdmin(c))
+	if err != nil {
+		return false, err
+	}
+	if isSuperAdmin {
+		return true, nil
+	}
+	_, domain := utils.SplitEmail(strings.ToLower(mailbox))
+	for _, d := range allowedDomains {
+		if d == domain {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (h *Handler) renderEditFetchmail(c *echo.Context, status int, f models.Fetchmail, errorMsg string) error {
+	renderData := fetchmailFormData(f)
+	renderData["Error"] = errorMsg
+	renderData["SessionUser"] = middleware.GetUsername(c, middleware.SessionName)
+	renderData["IsSuperAdmin"] = middleware.GetIsSuperAdmin(c)
+	return c.Render(status, "edit_fetchmail.html", renderData)
+}
+
+// fetchmailFromForm applies the fields of the fetchmail form to f. The source password is
+// encrypted and only replaced when one was entered.
+func fetchmailFromForm(c *echo.Context, f *models.Fetchmail) error {
+	f.SrcServer = strings.TrimSpace(c.FormValue("src_server"))
+	f.SrcUser = strings.TrimSpace(c.FormValue("src_user"))
+	f.SrcFolder = strings.TrimSpace(c.FormValue("src_folder"))
+	f.SrcAuth = optionalString(c.FormValue("src_auth"))
+	f.Protocol = optionalString(c.FormValue("protocol"))
+
+	f.PollTime, _ = strconv.Atoi(c.FormValue("poll_time"))
+	if f.PollTime <= 0 {
+		f.PollTime = 10
+	}
+	f.SrcPort, _ = strconv.Atoi(c.FormValue("src_port"))
+
+	f.Fetchall = c.FormValue("fetchall") == "true"
+	f.Keep = c.FormValue("keep") == "true"
+	f.UseSSL = c.FormValue("usessl") == "true"
+	f.SSLCertCk = c.FormValue("sslcertck") == "true"
+	f.Active = c.FormValue("active") == "true"
+	f.Modified = time.Now()
+
+	if f.SrcServer == "" {
+		return errFetchmailServer
+	}
+	if f.SrcUser == "" {
+		return errFetchmailUser
+	}
+	// A password saved before the encryption key was set is encrypted now
+	password := c.FormValue("src_password")
+	if password == "" && !utils.IsEncryptedSecret(f.SrcPassword) {
+		password = f.SrcPassword
+	}
+	if password != "" {
+		stored, err := utils.EncryptSecret(password)
+		if errors.Is(err, utils.ErrNoSecretKey) {
+			return errFetchmailNoKey
+		}
+		if err != nil {
+			slog.Error("Failed to encrypt fetchmail password", "error", err)
+			return errFetchmailSecret
+		}
+		f.SrcPassword = stored
+	}
+	if f.SrcPassword == "" {
+		return errFetchmailPassword
+	}
+	return nil
+}
+
+// fetchmailFormData formats a fetchmail entry for the list and the edit forms. The source
+// password is never sent back to the browser.
+func fetchmailFormData(f models.Fetchmail) map[string]interface{} {
+	data := map[string]interface{}{
+		"ID":           f.ID,
+		"Mailbox":      f.Mailbox,
+		"SrcServer":    f.SrcServer,
+		"SrcAuth":      stringValue(f.SrcAuth),
+		"SrcUser":      f.SrcUser,
+		"SrcFolder":    f.SrcFolder,
+		"PollTime":     f.PollTime,
+		"Fetchall":     f.Fetchall,
+		"Keep":         f.Keep,
+		"Protocol":     stringValue(f.Protocol),
+		"UseSSL":       f.UseSSL,
+		"SSLCertCk":    f.SSLCertCk,
+		"Active":       f.Active,
+		"SrcPort":      f.SrcPort,
+		"ReturnedText": strings.TrimSpace(stringValue(f.ReturnedText)),
+		"LastRun":      "",
+	}
+	if f.Date.After(fetchmailNeverRun) {
+		data["LastRun"] = f.Date.Format("2006-01-02 15:04")
+	}
+	return data
+}
+
+// fetchmailTestResponse tests the connection of f and reports the result as JSON
+func fetchmailTestResponse(c *echo.Context, f models.Fetchmail) error {
+	password, err := utils.DecryptSecret(f.SrcPassword)
+	if err != nil {
+		return c.JSON(http.StatusOK, map[string]interface{}{"success": false, "error": err.Error()})
+	}
+	source := fetchmail.SourceFrom(f, password)
+	source.Timeout = fetchmailTestTimeout
+	if err := fetchmail.Test(source); err != nil {
+		return c.JSON(http.StatusOK, map[string]interface{}{"success": false, "error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"success": true, "message": "Connection and login succeeded"})
+}
+
+// fetchmailDomain returns the domain of a fetchmail entry, from its mailbox when not stored
+func fetchmailDomain(f models.Fetchmail) string {
+	if f.Domain != nil && *f.Domain != "" {
+		return *f.Domain
+	}
+	_, domain := utils.SplitEmail(f.Mailbox)
+	return domain
+}
+
+// optionalString returns nil for an empty form value
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// stringValue dereferences an optional column
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
 }
 
 // Helper to re-render form with error state
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"go-postfixadmin/internal/middleware"
@@ -30,21 +31,27 @@ func (h *Handler) Login(c *echo.Context) error {
 			return c.Render(http.StatusServiceUnavailable, "login.html", map[string]interface{}{"errorKey": "Login_ErrDbUnavailable"})
 		}
 
+		if utils.CheckLoginLock(h.DB, utils.LoginPortalAdmin, username, c.RealIP(), "ALL") {
+			return c.Render(http.StatusTooManyRequests, "login.html", map[string]interface{}{"errorKey": "Login_ErrLocked"})
+		}
+
 		if err := h.DB.Where("username = ? AND active = ?", username, true).First(&admin).Error; err != nil {
+			utils.RegisterLoginFailure(h.DB, utils.LoginPortalAdmin, username, c.RealIP(), "ALL")
 			return c.Render(http.StatusUnauthorized, "login.html", map[string]interface{}{"errorKey": "Login_ErrInvalidCredentials"})
 		}
 
 		match, err := utils.CheckPassword(password, admin.Password)
 		if err != nil || !match {
+			utils.RegisterLoginFailure(h.DB, utils.LoginPortalAdmin, username, c.RealIP(), "ALL")
 			return c.Render(http.StatusUnauthorized, "login.html", map[string]interface{}{"errorKey": "Login_ErrInvalidCredentials"})
 		}
+		utils.RehashPassword(h.DB, utils.TOTPKindAdmin, admin.Username, password, admin.Password)
 
-		// Set session
-		if err := middleware.SetSession(c, middleware.SessionName, admin.Username, admin.Superadmin); err != nil {
+		// Set session (or continue to the TOTP step)
+		if err := h.startLogin(c, adminTOTPPortal, admin.Username, admin.Superadmin, admin.TOTPSecret); err != nil {
 			return c.Render(http.StatusInternalServerError, "login.html", map[string]interface{}{"errorKey": "Login_ErrSession"})
 		}
-
-		return c.Redirect(http.StatusFound, "/dashboard")
+		return nil
 	}
 	return c.Render(http.StatusOK, "login.html", nil)
 }
@@ -78,3 +85,17 @@ func (h *Handler) SetLanguage(c *echo.Context) error {
 	}
 	return c.Redirect(http.StatusFound, referer)
 }
+
+// formError returns the status and error to render when a utils create, update or delete
+// function fails: its validation message, or failure followed by the error
+func formError(err error, failure string) (int, interface{}) {
+	var fieldErr *utils.FieldError
+	var policyErr *utils.PasswordPolicyError
+	switch {
+	case errors.As(err, &fieldErr):
+		return http.StatusBadRequest, fieldErr.Message
+	case errors.As(err, &policyErr):
+		return http.StatusBadRequest, policyErr
+	}
+	return http.StatusInternalServerError, failure + ": " + err.Error()
+}
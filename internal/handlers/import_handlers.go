@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"go-postfixadmin/internal/middleware"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+)
+
+// maxImportSize limits the size of an uploaded import file
+const maxImportSize = 5 << 20
+
+// ImportAccountsForm shows the bulk import form
+func (h *Handler) ImportAccountsForm(c *echo.Context) error {
+	return c.Render(http.StatusOK, "import.html", map[string]interface{}{
+		"IsSuperAdmin": middleware.GetIsSuperAdmin(c),
+		"SessionUser":  middleware.GetUsername(c, middleware.SessionName),
+	})
+}
+
+// ImportAccounts imports mailboxes and aliases from an uploaded CSV or JSON file. A dry run
+// shows the validation result of every row and keeps the content for the actual import.
+// Generated passwords are shown once, as CSV, after the import.
+func (h *Handler) ImportAccounts(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+	isSuperAdmin := middleware.GetIsSuperAdmin(c)
+	dryRun := c.FormValue("dry_run") == "true"
+	generate := c.FormValue("generate_passwords") == "true"
+
+	render := func(status int, data map[string]interface{}) error {
+		data["DryRun"] = dryRun
+		data["GeneratePasswords"] = generate
+		data["IsSuperAdmin"] = isSuperAdmin
+		data["SessionUser"] = username
+		return c.Render(status, "import.html", data)
+	}
+
+	// The file of the form, or the content kept by a dry run
+	content := c.FormValue("content")
+	format := c.FormValue("format")
+	if file, err := c.FormFile("file"); err == nil {
+		if file.Size > maxImportSize {
+			return render(http.StatusBadRequest, map[string]interface{}{"Error": "The file is too large"})
+		}
+		f, err := file.Open()
+		if err != nil {
+			return render(http.StatusBadRequest, map[string]interface{}{"Error": "Failed to read the file"})
+		}
+		data, err := io.ReadAll(io.LimitReader(f, maxImportSize))
+		f.Close()
+		if err != nil {
+			return render(http.StatusBadRequest, map[string]interface{}{"Error": "Failed to read the file"})
+		}
+		content = string(data)
+		format = "csv"
+		if strings.EqualFold(filepath.Ext(file.Filename), ".json") {
+			format = "json"
+		}
+	}
+	if strings.TrimSpace(content) == "" {
+		return render(http.StatusBadRequest, map[string]interface{}{"Error": "Please choose a CSV or JSON file"})
+	}
+
+	var rows []utils.ImportRow
+	var err error
+	if format == "json" {
+		rows, err = utils.ParseImportJSON(strings.NewReader(content))
+	} else {
+		rows, err = utils.ParseImportCSV(strings.NewReader(content))
+	}
+	if err != nil {
+		return render(http.StatusBadRequest, map[string]interface{}{"Error": "Failed to read the file: " + err.Error()})
+	}
+
+	opts := utils.ImportOptions{DryRun: dryRun, GeneratePasswords: generate}
+	if !isSuperAdmin {
+		allowedDomains, _, err := utils.GetAllowedDomains(h.DB, username, isSuperAdmin)
+		if err != nil {
+			return render(http.StatusInternalServerError, map[string]interface{}{"Error": "Permission check failed"})
+		}
+		opts.Domains = append([]string{}, allowedDomains...)
+	}
+
+	report, err := utils.ImportAccounts(h.DB, rows, opts, username, c.RealIP())
+	data := map[string]interface{}{
+		"Report":  report,
+		"Content": content,
+		"Format":  format,
+	}
+	// Batches imported before a failure stay, so their passwords are shown either way
+	if report.GeneratedPasswords() {
+		var credentials bytes.Buffer
+		if err := report.WriteCredentials(&credentials); err == nil {
+			data["Credentials"] = credentials.String()
+		}
+	}
+	if err != nil {
+		data["Error"] = err.Error()
+		return render(http.StatusBadRequest, data)
+	}
+	return render(http.StatusOK, data)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-postfixadmin/internal/middleware"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+)
+
+// ListLoginLocks shows the failed login counters and the usernames and IPs currently locked out
+func (h *Handler) ListLoginLocks(c *echo.Context) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+	isSuper, err := utils.IsSuperAdmin(h.DB, username)
+	if err != nil || !isSuper {
+		return c.Render(http.StatusForbidden, "dashboard.html", map[string]interface{}{"Error": "Access denied"})
+	}
+
+	errorMsg := ""
+	failures, err := utils.ListLoginFailures(h.DB)
+	if err != nil {
+		errorMsg = "Failed to fetch login failures"
+	}
+
+	return c.Render(http.StatusOK, "login_locks.html", map[string]interface{}{
+		"Failures":     failures,
+		"Now":          time.Now(),
+		"GuardEnabled": utils.LoginGuardEnabled(),
+		"Error":        errorMsg,
+		"IsSuperAdmin": true,
+		"SessionUser":  username,
+	})
+}
+
+// DeleteLoginLock clears a failure counter, unlocking its username or IP
+func (h *Handler) DeleteLoginLock(c *echo.Context) error {
+	loggedInUser := middleware.GetUsername(c, middleware.SessionName)
+	isSuper, err := utils.IsSuperAdmin(h.DB, loggedInUser)
+	if err != nil || !isSuper {
+		return c.JSON(http.StatusForbidden, map[string]interface{}{"error": "Access denied"})
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "Invalid ID",
+		})
+	}
+
+	failure, err := utils.DeleteLoginFailure(h.DB, id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   "Login lock not found",
+		})
+	}
+
+	if err := utils.LogAction(h.DB, loggedInUser, c.RealIP(), "ALL", "clear_login_lock", failure.Scope+" "+failure.Subject); err != nil {
+		fmt.Printf("Failed to log clear_login_lock: %v\n", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
@@ -0,0 +1,93 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go-postfixadmin/internal/handlers"
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/routes"
+	"go-postfixadmin/internal/server"
+	"go-postfixadmin/internal/testdb"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v5"
+	"gorm.io/gorm"
+)
+
+// newLoginServer returns the application routes with sessions and the client IP extractor
+// of the server, on a test database with the superadmin root@example.com (password
+// "password") who enrolled TOTP
+func newLoginServer(t *testing.T, trustedProxies []string) (*echo.Echo, *gorm.DB) {
+	t.Helper()
+	db := testdb.Open(t)
+	hashed, err := utils.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := "JBSWY3DPEHPK3PXP"
+	now := time.Now()
+	admin := &models.Admin{Username: "root@example.com", Password: hashed, Active: true, Superadmin: true, TOTPSecret: &secret, Created: now, Modified: now}
+	if err := db.Create(admin).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	if e.IPExtractor, err = server.ClientIPExtractor(trustedProxies); err != nil {
+		t.Fatal(err)
+	}
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	routes.RegisterRoutes(e, &handlers.Handler{DB: db})
+	return e, db
+}
+
+// postLogin posts the admin login form from remoteAddr and returns the response
+func postLogin(e *echo.Echo, remoteAddr, xff, password string) *httptest.ResponseRecorder {
+	form := url.Values{"username": {"root@example.com"}, "password": {password}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = remoteAddr
+	if xff != "" {
+		req.Header.Set("X-Forwarded-For", xff)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLoginTOTPExemptionIgnoresForgedXFF(t *testing.T) {
+	e, db := newLoginServer(t, nil)
+	db.Create(&models.TOTPExceptionAddress{IP: "203.0.113.7"})
+
+	rec := postLogin(e, "198.51.100.20:4000", "203.0.113.7", "password")
+	if loc := rec.Header().Get("Location"); rec.Code != http.StatusFound || loc != "/login/totp" {
+		t.Errorf("login with a forged X-Forwarded-For = %d %q, want the TOTP step", rec.Code, loc)
+	}
+
+	rec = postLogin(e, "203.0.113.7:4000", "", "password")
+	if loc := rec.Header().Get("Location"); rec.Code != http.StatusFound || loc != "/dashboard" {
+		t.Errorf("login from the exempt IP = %d %q, want the dashboard", rec.Code, loc)
+	}
+}
+
+func TestLoginTOTPExemptionBehindTrustedProxy(t *testing.T) {
+	e, db := newLoginServer(t, []string{"192.0.2.10"})
+	db.Create(&models.TOTPExceptionAddress{IP: "203.0.113.7"})
+
+	rec := postLogin(e, "192.0.2.10:4000", "203.0.113.7", "password")
+	if loc := rec.Header().Get("Location"); rec.Code != http.StatusFound || loc != "/dashboard" {
+		t.Errorf("login through the trusted proxy = %d %q, want the dashboard", rec.Code, loc)
+	}
+
+	// A client that prepends the exempt IP is still seen with its own address
+	rec = postLogin(e, "192.0.2.10:4000", "203.0.113.7, 198.51.100.20", "password")
+	if loc := rec.Header().Get("Location"); rec.Code != http.StatusFound || loc != "/login/totp" {
+		t.Errorf("login with a prepended X-Forwarded-For = %d %q, want the TOTP step", rec.Code, loc)
+	}
+}
@@ -1,20 +1,18 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strconv"
 	"strings"
-	"time"
 
 	"go-postfixadmin/internal/middleware"
 	"go-postfixadmin/internal/models"
 	"go-postfixadmin/internal/utils"
 
 	"github.com/labstack/echo/v5"
-	"github.com/spf13/viper"
 	"gorm.io/gorm"
 )
 
@@ -130,10 +128,13 @@ func (h *Handler) AddMailbox(c *echo.Context) error {
 		domains, _, _ = utils.GetActiveDomains(h.DB, SessionUser, isSuperAdmin)
 	}
 
-	// Validation: required fields
-	if localPart == "" || domain == "" {
-		return c.Render(http.StatusBadRequest, "add_mailbox.html", map[string]interface{}{
-			"Error":        "Local part and domain are required",
+	renderError := func(err interface{}) error {
+		status := http.StatusBadRequest
+		if e, ok := err.(error); ok {
+			status, err = formError(e, "Failed to create mailbox")
+		}
+		return c.Render(status, "add_mailbox.html", map[string]interface{}{
+			"Error":        err,
 			"Domains":      domains,
 			"LocalPart":    localPart,
 			"Domain":       domain,
@@ -147,165 +148,27 @@ func (h *Handler) AddMailbox(c *echo.Context) error {
 		})
 	}
 
-	// Validation: local part minimum 4 characters
-	if len(localPart) < 4 {
-		return c.Render(http.StatusBadRequest, "add_mailbox.html", map[string]interface{}{
-			"Error":        "Username must be at least 4 characters",
-			"Domains":      domains,
-			"LocalPart":    localPart,
-			"Domain":       domain,
-			"Name":         name,
-			"Active":       active,
-			"SMTPActive":   smtpActive,
-			"EmailOther":   emailOther,
-			"Quota":        quota / quotaMultiplier,
-			"IsSuperAdmin": isSuperAdmin,
-		})
-	}
-
-	// Validation: password minimum 8 characters
-	if len(password) < 8 {
-		return c.Render(http.StatusBadRequest, "add_mailbox.html", map[string]interface{}{
-			"Error":        "Password must be at least 8 characters",
-			"Domains":      domains,
-			"LocalPart":    localPart,
-			"Domain":       domain,
-			"Name":         name,
-			"Active":       active,
-			"SMTPActive":   smtpActive,
-			"EmailOther":   emailOther,
-			"Quota":        quota / quotaMultiplier,
-			"IsSuperAdmin": isSuperAdmin,
-		})
-	}
-
 	// Validation: password confirmation match
 	if password != passwordConfirm {
-		return c.Render(http.StatusBadRequest, "add_mailbox.html", map[string]interface{}{
-			"Error":        "Password and confirmation do not match",
-			"Domains":      domains,
-			"LocalPart":    localPart,
-			"Domain":       domain,
-			"Name":         name,
-			"Active":       active,
-			"SMTPActive":   smtpActive,
-			"EmailOther":   emailOther,
-			"Quota":        quota / quotaMultiplier,
-			"IsSuperAdmin": isSuperAdmin,
-		})
-	}
-
-	// Validation: local part format (basic email local part validation)
-	localPartRegex := regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
-	if !localPartRegex.MatchString(localPart) {
-		return c.Render(http.StatusBadRequest, "add_mailbox.html", map[string]interface{}{
-			"Error":        "Invalid local part format. Use only letters, numbers, dots, hyphens, and underscores",
-			"Domains":      domains,
-			"LocalPart":    localPart,
-			"Domain":       domain,
-			"Name":         name,
-			"Active":       active,
-			"SMTPActive":   smtpActive,
-			"EmailOther":   emailOther,
-			"Quota":        quota / quotaMultiplier,
-			"IsSuperAdmin": isSuperAdmin,
-		})
-	}
-
-	// Construct full email address
-	username := fmt.Sprintf("%s@%s", localPart, domain)
-
-	// Check if mailbox already exists
-	var existingMailbox models.Mailbox
-	if err := h.DB.Where("username = ?", username).First(&existingMailbox).Error; err == nil {
-		return c.Render(http.StatusBadRequest, "add_mailbox.html", map[string]interface{}{
-			"Error":        "Mailbox already exists",
-			"Domains":      domains,
-			"LocalPart":    localPart,
-			"Domain":       domain,
-			"Name":         name,
-			"Active":       active,
-			"SMTPActive":   smtpActive,
-			"EmailOther":   emailOther,
-			"Quota":        quota / quotaMultiplier,
-			"IsSuperAdmin": isSuperAdmin,
-		})
+		return renderError("Password and confirmation do not match")
 	}
 
-	// Hash password
-	hashedPassword, err := utils.HashPassword(password)
+	mailbox, err := utils.NewMailbox(h.DB, localPart, domain)
 	if err != nil {
-		return c.Render(http.StatusInternalServerError, "add_mailbox.html", map[string]interface{}{
-			"Error":        "Failed to hash password: " + err.Error(),
-			"Domains":      domains,
-			"LocalPart":    localPart,
-			"Domain":       domain,
-			"Name":         name,
-			"Active":       active,
-			"SMTPActive":   smtpActive,
-			"EmailOther":   emailOther,
-			"Quota":        quota / quotaMultiplier,
-			"IsSuperAdmin": isSuperAdmin,
-		})
+		return renderError(err)
 	}
-
-	// Generate maildir
-	maildir := generateMaildir(domain, localPart)
-
-	// Create mailbox and alias in a transaction
-	now := time.Now()
-	defaultDate := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
-	err = h.DB.Transaction(func(tx *gorm.DB) error {
-		// Create mailbox
-		newMailbox := models.Mailbox{
-			Username:       username,
-			Password:       hashedPassword,
-			Name:           name,
-			Maildir:        maildir,
-			Quota:          quota,
-			LocalPart:      localPart,
-			Domain:         domain,
-			Created:        now,
-			Modified:       now,
-			Active:         active,
-			EmailOther:     emailOther,
-			SMTPActive:     smtpActive,
-			TokenValidity:  time.Now().Add(3 * time.Hour),
-			PasswordExpiry: defaultDate,
-		}
-
-		if err := tx.Create(&newMailbox).Error; err != nil {
-			return err
-		}
-
-		// Create corresponding alias
-		if err := createMailboxAlias(tx, username, domain); err != nil {
-			return err
-		}
-
-		// Log Action inside transaction
-		if err := utils.LogAction(tx, SessionUser, c.RealIP(), domain, "create_mailbox", username); err != nil {
-			return err
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		return c.Render(http.StatusInternalServerError, "add_mailbox.html", map[string]interface{}{
-			"Error":        "Failed to create mailbox: " + err.Error(),
-			"Domains":      domains,
-			"LocalPart":    localPart,
-			"Domain":       domain,
-			"Name":         name,
-			"Active":       active,
-			"SMTPActive":   smtpActive,
-			"EmailOther":   emailOther,
-			"Quota":        quota / quotaMultiplier,
-			"IsSuperAdmin": isSuperAdmin,
-			"SessionUser":  SessionUser,
-		})
+	mailbox.Name = name
+	mailbox.Quota = quota
+	mailbox.Active = active
+	mailbox.SMTPActive = smtpActive
+	mailbox.EmailOther = emailOther
+	if err := utils.SetMailboxPassword(h.DB, &mailbox, password); err != nil {
+		return renderError(err)
+	}
+	if err := utils.CreateMailbox(h.DB, &mailbox, SessionUser, c.RealIP()); err != nil {
+		return renderError(err)
 	}
+	username := mailbox.Username
 
 	// Send Welcome Mail if requested
 	if sendWelcomeMail {
@@ -356,9 +219,19 @@ func (h *Handler) EditMailboxForm(c *echo.Context) error {
 		"QuotaMB":      mailbox.Quota / quotaMultiplier,
 		"IsSuperAdmin": isSuperAdmin,
 		"SessionUser":  SessionUser,
+		"Vacation":     h.mailboxVacationData(mailbox.Username),
 	})
 }
 
+// mailboxVacationData returns the vacation form data of a mailbox, nil when it has none
+func (h *Handler) mailboxVacationData(username string) map[string]interface{} {
+	var vacation models.Vacation
+	if err := h.DB.First(&vacation, "email = ?", username).Error; err != nil {
+		return nil
+	}
+	return vacationFormData(vacation)
+}
+
 // EditMailbox processa a edição de um mailbox existente
 func (h *Handler) EditMailbox(c *echo.Context) error {
 	username, _ := url.PathUnescape(c.Param("username"))
@@ -409,43 +282,53 @@ func (h *Handler) EditMailbox(c *echo.Context) error {
 		}
 	}
 
-	// Handle optional password change
-	if changePassword {
-		password := c.FormValue("password")
-		passwordConfirm := c.FormValue("password_confirm")
-
-		// Validation: password minimum 8 characters
-		if len(password) < 8 {
-			return c.Render(http.StatusBadRequest, "edit_mailbox.html", map[string]interface{}{
-				"Error":        "Password must be at least 8 characters",
-				"Mailbox":      mailbox,
-				"IsSuperAdmin": isSuperAdmin,
-				"SessionUser":  SessionUser,
-			})
+	sendLimit := 0
+	if val := c.FormValue("send_limit"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			sendLimit = parsed
 		}
+	}
 
-		// Validation: password confirmation match
-		if password != passwordConfirm {
-			return c.Render(http.StatusBadRequest, "edit_mailbox.html", map[string]interface{}{
-				"Error":        "Password and confirmation do not match",
-				"Mailbox":      mailbox,
-				"IsSuperAdmin": isSuperAdmin,
-				"SessionUser":  SessionUser,
-			})
-		}
+	// The vacation is saved when it is being enabled or already exists
+	vacation, vacationErr := vacationFromForm(c, "vacation_", mailbox.Username, mailbox.Domain)
+	deleteVacationForm := c.FormValue("vacation_delete") == "true"
+	saveVacationForm := !deleteVacationForm && (vacation.Active || h.mailboxVacationData(mailbox.Username) != nil)
+	if saveVacationForm && vacationErr == nil && vacation.Active && strings.TrimSpace(vacation.Subject) == "" {
+		vacationErr = errors.New("vacation subject is required")
+	}
+	if saveVacationForm && vacationErr != nil {
+		return c.Render(http.StatusBadRequest, "edit_mailbox.html", map[string]interface{}{
+			"Error":        "Vacation: " + vacationErr.Error(),
+			"Mailbox":      mailbox,
+			"IsSuperAdmin": isSuperAdmin,
+			"SessionUser":  SessionUser,
+			"Vacation":     h.mailboxVacationData(mailbox.Username),
+		})
+	}
 
-		// Hash new password
-		hashedPassword, err := utils.HashPassword(password)
-		if err != nil {
-			return c.Render(http.StatusInternalServerError, "edit_mailbox.html", map[string]interface{}{
-				"Error":        "Failed to hash password: " + err.Error(),
-				"Mailbox":      mailbox,
-				"IsSuperAdmin": isSuperAdmin,
-				"SessionUser":  SessionUser,
-			})
+	renderError := func(err interface{}) error {
+		status := http.StatusBadRequest
+		if e, ok := err.(error); ok {
+			status, err = formError(e, "Failed to update mailbox")
 		}
+		return c.Render(status, "edit_mailbox.html", map[string]interface{}{
+			"Error":        err,
+			"Mailbox":      mailbox,
+			"IsSuperAdmin": isSuperAdmin,
+			"SessionUser":  SessionUser,
+			"Vacation":     h.mailboxVacationData(mailbox.Username),
+		})
+	}
 
-		mailbox.Password = hashedPassword
+	// Handle optional password change
+	if changePassword {
+		password := c.FormValue("password")
+		if password != c.FormValue("password_confirm") {
+			return renderError("Password and confirmation do not match")
+		}
+		if err := utils.SetMailboxPassword(h.DB, &mailbox, password); err != nil {
+			return renderError(err)
+		}
 	}
 
 	// Update mailbox fields
@@ -453,22 +336,31 @@ func (h *Handler) EditMailbox(c *echo.Context) error {
 	mailbox.Quota = quota
 	mailbox.Active = active
 	mailbox.SMTPActive = smtpActive
+	mailbox.SendLimit = sendLimit
 	mailbox.EmailOther = emailOther
-	mailbox.Modified = time.Now()
-	mailbox.TokenValidity = time.Now().Add(3 * time.Hour)
 
-	if err := h.DB.Save(&mailbox).Error; err != nil {
-		return c.Render(http.StatusInternalServerError, "edit_mailbox.html", map[string]interface{}{
-			"Error":        "Failed to update mailbox: " + err.Error(),
-			"Mailbox":      mailbox,
-			"IsSuperAdmin": isSuperAdmin,
-			"SessionUser":  SessionUser,
-		})
-	}
-
-	// Log Action
-	if err := utils.LogAction(h.DB, SessionUser, c.RealIP(), mailbox.Domain, "edit_mailbox", username); err != nil {
-		fmt.Printf("Failed to log edit_mailbox: %v\n", err)
+	// The mailbox and its vacation are saved together, so a failing vacation leaves both unchanged
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := utils.UpdateMailbox(tx, &mailbox, changePassword, SessionUser, c.RealIP()); err != nil {
+			return err
+		}
+		// Vacation: set, disable or remove the auto-reply of the mailbox
+		switch {
+		case deleteVacationForm:
+			if err := deleteVacation(tx, mailbox.Username); err != nil {
+				return fmt.Errorf("failed to remove vacation: %w", err)
+			}
+			return utils.LogAction(tx, SessionUser, c.RealIP(), mailbox.Domain, "delete_vacation", username)
+		case saveVacationForm:
+			if err := saveVacation(tx, vacation); err != nil {
+				return fmt.Errorf("failed to save vacation: %w", err)
+			}
+			return utils.LogAction(tx, SessionUser, c.RealIP(), mailbox.Domain, "edit_vacation", username)
+		}
+		return nil
+	})
+	if err != nil {
+		return renderError(err)
 	}
 
 	// Redirect to mailboxes list filtered by domain
@@ -508,47 +400,13 @@ func (h *Handler) DeleteMailbox(c *echo.Context) error {
 		}
 	}
 
-	// Use transaction to ensure atomicity
-	err = h.DB.Transaction(func(tx *gorm.DB) error {
-		// Delete corresponding alias
-		if err := tx.Where("address = ?", username).Delete(&models.Alias{}).Error; err != nil {
-			return err
-		}
-
-		// Delete Vacation
-		if err := tx.Where("email = ?", username).Delete(&models.Vacation{}).Error; err != nil {
-			return err
-		}
-
-		// Delete the mailbox
-		if err := tx.Where("username = ?", username).Delete(&models.Mailbox{}).Error; err != nil {
-			return err
-		}
-
-		// Log Action inside transaction
-		if err := utils.LogAction(tx, SessionUser, c.RealIP(), mailbox.Domain, "delete_mailbox", username); err != nil {
-			return err
-		}
-
-		return nil
-	})
-
-	if err != nil {
+	if err := utils.DeleteMailbox(h.DB, mailbox, SessionUser, c.RealIP()); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"error":   "Failed to delete mailbox: " + err.Error(),
 		})
 	}
 
-	// Attempt to clean up the physical mailbox directory without failing the request on error,
-	// since the actual intention (deleting the record) was successful.
-	if viper.GetBool("server.clean_up_maildir") {
-		baseDir := "/var/vmail" // TODO: This should probably come from config
-		if cleanupErr := utils.CleanupOrphanedMaildir(h.DB, baseDir, mailbox.Domain, mailbox.LocalPart); cleanupErr != nil {
-			fmt.Printf("Warning: Failed to clean up orphaned directory for %s: %v\n", username, cleanupErr)
-		}
-	}
-
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"success": true,
 		"message": "Mailbox deleted successfully",
@@ -562,24 +420,3 @@ func (h *Handler) GeneratePassword(c *echo.Context) error {
 		"password": password,
 	})
 }
-
-// Helper Functions
-
-// generateMaildir gera o caminho do maildir no formato domain/localpart/
-func generateMaildir(domain, localPart string) string {
-	return fmt.Sprintf("%s/%s/", domain, localPart)
-}
-
-// createMailboxAlias cria um alias automático para o mailbox
-func createMailboxAlias(tx *gorm.DB, username, domain string) error {
-	now := time.Now()
-	alias := models.Alias{
-		Address:  username,
-		Goto:     username,
-		Domain:   domain,
-		Created:  now,
-		Modified: now,
-		Active:   true,
-	}
-	return tx.Create(&alias).Error
-}
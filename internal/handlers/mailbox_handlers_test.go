@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"gorm.io/gorm"
+)
+
+func TestEditMailboxRollsBackWhenTheVacationFails(t *testing.T) {
+	e, db := newLoginServer(t, nil)
+	db.Create(&models.TOTPExceptionAddress{IP: "203.0.113.7"})
+	now := time.Now()
+	db.Create(&models.Domain{Domain: "example.com", Active: true, Created: now, Modified: now})
+	mailbox := models.Mailbox{Username: "john@example.com", LocalPart: "john", Domain: "example.com", Name: "John", Maildir: "example.com/john/", Active: true, Created: now, Modified: now}
+	if err := db.Create(&mailbox).Error; err != nil {
+		t.Fatal(err)
+	}
+	err := db.Callback().Create().Before("gorm:create").Register("test:fail_vacation", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Dest.(*models.Vacation); ok {
+			tx.AddError(errors.New("disk full"))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := postLogin(e, "203.0.113.7:4000", "", "password")
+	if login.Code != http.StatusFound || login.Header().Get("Location") != "/dashboard" {
+		t.Fatalf("login = %d %q", login.Code, login.Header().Get("Location"))
+	}
+
+	form := url.Values{
+		"name":                 {"John Doe"},
+		"active":               {"true"},
+		"vacation_active":      {"true"},
+		"vacation_subject":     {"Away"},
+		"vacation_body":        {"Back soon"},
+		"vacation_activefrom":  {now.Format("2006-01-02T15:04")},
+		"vacation_activeuntil": {now.Add(48 * time.Hour).Format("2006-01-02T15:04")},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/mailboxes/edit/john@example.com", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = "203.0.113.7:4000"
+	for _, cookie := range login.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	var got models.Mailbox
+	if err := db.First(&got, "username = ?", "john@example.com").Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "John" {
+		t.Errorf("mailbox name = %q, want the edit rolled back with the failed vacation", got.Name)
+	}
+	var logs int64
+	db.Model(&models.Log{}).Where("action = ?", "edit_mailbox").Count(&logs)
+	if logs != 0 {
+		t.Errorf("%d edit_mailbox log entries, want none", logs)
+	}
+}
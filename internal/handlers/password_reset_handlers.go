@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+)
+
+// resetPortal describes where the password reset pages live for admins and for mailbox users
+type resetPortal struct {
+	kind       string
+	userPortal bool
+	loginPath  string
+	forgotPath string
+	resetPath  string
+}
+
+var (
+	adminResetPortal = resetPortal{utils.TOTPKindAdmin, false, "/login", "/login/forgot", "/login/reset"}
+	userResetPortal  = resetPortal{utils.TOTPKindMailbox, true, "/users/login", "/users/login/forgot", "/users/login/reset"}
+)
+
+// renderPasswordReset renders password_reset.html. mode is "request", "reset" or "done".
+func renderPasswordReset(c *echo.Context, p resetPortal, status int, mode string, data map[string]interface{}) error {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["Mode"] = mode
+	data["UserPortal"] = p.userPortal
+	data["LoginPath"] = p.loginPath
+	data["ForgotPath"] = p.forgotPath
+	data["ResetPath"] = p.resetPath
+	return c.Render(status, "password_reset.html", data)
+}
+
+// ForgotPassword asks for an admin username and emails a reset link
+func (h *Handler) ForgotPassword(c *echo.Context) error {
+	return h.forgotPassword(c, adminResetPortal)
+}
+
+// UserForgotPassword asks for a mailbox address and emails a reset link
+func (h *Handler) UserForgotPassword(c *echo.Context) error {
+	return h.forgotPassword(c, userResetPortal)
+}
+
+func (h *Handler) forgotPassword(c *echo.Context, p resetPortal) error {
+	if !utils.PasswordResetEnabled() {
+		return c.Redirect(http.StatusFound, p.loginPath)
+	}
+	if c.Request().Method != http.MethodPost {
+		return renderPasswordReset(c, p, http.StatusOK, "request", nil)
+	}
+
+	err := utils.RequestPasswordReset(h.DB, p.kind, c.FormValue("username"), p.resetPath, c.RealIP())
+	if errors.Is(err, utils.ErrResetRateLimited) {
+		return renderPasswordReset(c, p, http.StatusTooManyRequests, "request", map[string]interface{}{"errorKey": "Reset_ErrRateLimited"})
+	}
+	if err != nil {
+		// Same answer as for a successful request, so the form does not reveal which accounts exist
+		fmt.Printf("Failed to request password reset: %v\n", err)
+	}
+
+	return renderPasswordReset(c, p, http.StatusOK, "done", map[string]interface{}{"messageKey": "Reset_MsgSent"})
+}
+
+// ResetPassword lets an admin choose a new password from an emailed link
+func (h *Handler) ResetPassword(c *echo.Context) error {
+	return h.resetPassword(c, adminResetPortal)
+}
+
+// UserResetPassword lets a mailbox user choose a new password from an emailed link
+func (h *Handler) UserResetPassword(c *echo.Context) error {
+	return h.resetPassword(c, userResetPortal)
+}
+
+func (h *Handler) resetPassword(c *echo.Context, p resetPortal) error {
+	if !utils.PasswordResetEnabled() {
+		return c.Redirect(http.StatusFound, p.loginPath)
+	}
+
+	token := c.FormValue("token")
+	invalid := map[string]interface{}{"errorKey": "Reset_ErrInvalidToken"}
+
+	if c.Request().Method != http.MethodPost {
+		if _, err := utils.CheckResetToken(h.DB, p.kind, token); err != nil {
+			return renderPasswordReset(c, p, http.StatusBadRequest, "request", invalid)
+		}
+		return renderPasswordReset(c, p, http.StatusOK, "reset", map[string]interface{}{"Token": token})
+	}
+
+	password := c.FormValue("password")
+	if password != c.FormValue("password_confirm") {
+		return renderPasswordReset(c, p, http.StatusBadRequest, "reset", map[string]interface{}{"Token": token, "errorKey": "Reset_ErrMismatch"})
+	}
+
+	if _, err := utils.ResetPassword(h.DB, p.kind, token, password, c.RealIP()); err != nil {
+		if errors.Is(err, utils.ErrInvalidResetToken) {
+			return renderPasswordReset(c, p, http.StatusBadRequest, "request", invalid)
+		}
+		var policyErr *utils.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return renderPasswordReset(c, p, http.StatusBadRequest, "reset", map[string]interface{}{"Token": token, "errorKey": policyErr.Key, "errorData": policyErr.Data})
+		}
+		fmt.Printf("Failed to reset password: %v\n", err)
+		return renderPasswordReset(c, p, http.StatusInternalServerError, "reset", map[string]interface{}{"Token": token, "errorKey": "Reset_ErrSave"})
+	}
+
+	return renderPasswordReset(c, p, http.StatusOK, "done", map[string]interface{}{"messageKey": "Reset_MsgDone"})
+}
@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go-postfixadmin/internal/middleware"
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+
+	"github.com/labstack/echo/v5"
+)
+
+// totpPortal describes where the TOTP pages live for admins and for mailbox users
+type totpPortal struct {
+	kind         string
+	loginPortal  string // counters of the login lockout
+	sessionName  string
+	loginPath    string
+	homePath     string
+	settingsPath string
+	settingsTpl  string
+}
+
+var (
+	adminTOTPPortal = totpPortal{utils.TOTPKindAdmin, utils.LoginPortalAdmin, middleware.SessionName, "/login", "/dashboard", "/totp", "totp.html"}
+	userTOTPPortal  = totpPortal{utils.TOTPKindMailbox, utils.LoginPortalUser, middleware.UserSessionName, "/users/login", "/users/dashboard", "/users/totp", "users/totp.html"}
+)
+
+// totpEnabled reports whether a TOTP secret has been enrolled
+func totpEnabled(secret *string) bool {
+	return secret != nil && *secret != ""
+}
+
+// totpLogDomain returns the log domain for TOTP events: "ALL" for admins, the mailbox domain otherwise
+func totpLogDomain(kind, username string) string {
+	if kind == utils.TOTPKindMailbox {
+		_, domain := utils.SplitEmail(username)
+		return domain
+	}
+	return "ALL"
+}
+
+// totpSecretFor loads the TOTP secret of an active admin or mailbox
+func (h *Handler) totpSecretFor(kind, username string) (*string, error) {
+	if kind == utils.TOTPKindMailbox {
+		var mailbox models.Mailbox
+		if err := h.DB.Select("totp_secret").Where("username = ? AND active = ?", username, true).First(&mailbox).Error; err != nil {
+			return nil, err
+		}
+		return mailbox.TOTPSecret, nil
+	}
+	var admin models.Admin
+	if err := h.DB.Select("totp_secret").Where("username = ? AND active = ?", username, true).First(&admin).Error; err != nil {
+		return nil, err
+	}
+	return admin.TOTPSecret, nil
+}
+
+// verifyTOTPCode accepts either a current TOTP code or an unused recovery code, which is consumed
+func (h *Handler) verifyTOTPCode(kind, username string, secret *string, code string) (ok bool, usedRecovery bool) {
+	if totpEnabled(secret) && utils.ValidateTOTP(*secret, code) {
+		return true, false
+	}
+	used, err := utils.UseRecoveryCode(h.DB, kind, username, code)
+	if err != nil {
+		fmt.Printf("Failed to check recovery code: %v\n", err)
+		return false, false
+	}
+	return used, used
+}
+
+// startLogin completes the password step. When TOTP is enrolled and the client IP
+// is not listed in totp_exception_address, the user is sent to the TOTP step instead.
+func (h *Handler) startLogin(c *echo.Context, p totpPortal, username string, isSuperAdmin bool, secret *string) error {
+	if totpEnabled(secret) && !utils.IsTOTPExempt(h.DB, username, c.RealIP()) {
+		if err := middleware.SetPendingLogin(c, p.sessionName, username, isSuperAdmin); err != nil {
+			return err
+		}
+		return c.Redirect(http.StatusFound, p.loginPath+"/totp")
+	}
+
+	if err := middleware.SetSession(c, p.sessionName, username, isSuperAdmin); err != nil {
+		return err
+	}
+	utils.ClearLoginFailures(h.DB, p.loginPortal, username, c.RealIP())
+	h.flagExpiredPassword(c, p, username)
+	return c.Redirect(http.StatusFound, p.homePath)
+}
+
+// LoginTOTP processes the second login step of administrators
+func (h *Handler) LoginTOTP(c *echo.Context) error {
+	return h.loginTOTP(c, adminTOTPPortal)
+}
+
+// UserLoginTOTP processes the second login step of mailbox users
+func (h *Handler) UserLoginTOTP(c *echo.Context) error {
+	return h.loginTOTP(c, userTOTPPortal)
+}
+
+func (h *Handler) loginTOTP(c *echo.Context, p totpPortal) error {
+	username, isSuperAdmin, ok := middleware.GetPendingLogin(c, p.sessionName)
+	if !ok || h.DB == nil {
+		return c.Redirect(http.StatusFound, p.loginPath+"?expired=true")
+	}
+
+	data := map[string]interface{}{
+		"Action":     p.loginPath + "/totp",
+		"LoginPath":  p.loginPath,
+		"UserPortal": p.kind == utils.TOTPKindMailbox,
+		"Username":   username,
+	}
+	if c.Request().Method != http.MethodPost {
+		return c.Render(http.StatusOK, "login_totp.html", data)
+	}
+
+	if utils.CheckLoginLock(h.DB, p.loginPortal, username, c.RealIP(), totpLogDomain(p.kind, username)) {
+		data["errorKey"] = "Login_ErrLocked"
+		return c.Render(http.StatusTooManyRequests, "login_totp.html", data)
+	}
+
+	secret, err := h.totpSecretFor(p.kind, username)
+	if err != nil {
+		return c.Redirect(http.StatusFound, p.loginPath)
+	}
+
+	// TOTP may have been reset by a superadmin while the user was at the second step
+	if totpEnabled(secret) {
+		verified, usedRecovery := h.verifyTOTPCode(p.kind, username, secret, c.FormValue("code"))
+		if !verified {
+			if err := utils.LogAction(h.DB, username, c.RealIP(), totpLogDomain(p.kind, username), "totp_failed", username); err != nil {
+				fmt.Printf("Failed to log TOTP failure: %v\n", err)
+			}
+			utils.RegisterLoginFailure(h.DB, p.loginPortal, username, c.RealIP(), totpLogDomain(p.kind, username))
+			data["errorKey"] = "TOTP_ErrInvalidCode"
+			return c.Render(http.StatusUnauthorized, "login_totp.html", data)
+		}
+		if usedRecovery {
+			if err := utils.LogAction(h.DB, username, c.RealIP(), totpLogDomain(p.kind, username), "totp_recovery_code_used", username); err != nil {
+				fmt.Printf("Failed to log recovery code use: %v\n", err)
+			}
+		}
+	}
+
+	if err := middleware.SetSession(c, p.sessionName, username, isSuperAdmin); err != nil {
+		data["errorKey"] = "Login_ErrSession"
+		return c.Render(http.StatusInternalServerError, "login_totp.html", data)
+	}
+	utils.ClearLoginFailures(h.DB, p.loginPortal, username, c.RealIP())
+	h.flagExpiredPassword(c, p, username)
+	return c.Redirect(http.StatusFound, p.homePath)
+}
+
+// renderTOTPSettings shows the TOTP status, or a new QR code when TOTP is not enrolled yet
+func (h *Handler) renderTOTPSettings(c *echo.Context, p totpPortal, status int, data map[string]interface{}) error {
+	username := middleware.GetUsername(c, p.sessionName)
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["SessionUser"] = username
+	data["IsSuperAdmin"] = p.kind == utils.TOTPKindAdmin && middleware.GetIsSuperAdmin(c)
+	data["BasePath"] = p.settingsPath
+
+	secret, err := h.totpSecretFor(p.kind, username)
+	if err != nil {
+		return c.Redirect(http.StatusFound, p.loginPath)
+	}
+
+	if totpEnabled(secret) {
+		data["Enabled"] = true
+		data["RemainingCodes"] = utils.CountRecoveryCodes(h.DB, p.kind, username)
+		return c.Render(status, p.settingsTpl, data)
+	}
+
+	// Keep the same secret across re-renders until enrollment is confirmed
+	var enrollment *utils.TOTPEnrollment
+	if pending := middleware.GetSessionString(c, p.sessionName, middleware.TOTPEnrollSecretKey); pending != "" {
+		enrollment, _ = utils.TOTPEnrollmentFromURL(pending)
+	}
+	if enrollment == nil {
+		enrollment, err = utils.NewTOTPEnrollment(username)
+		if err != nil {
+			data["ErrorKey"] = "TOTP_ErrGenerate"
+			return c.Render(http.StatusInternalServerError, p.settingsTpl, data)
+		}
+		middleware.SetSessionValue(c, p.sessionName, middleware.TOTPEnrollSecretKey, enrollment.URL)
+	}
+	data["Enrollment"] = enrollment
+	data["QRCode"] = template.URL(enrollment.QRCode)
+	return c.Render(status, p.settingsTpl, data)
+}
+
+// TOTPSettings displays the TOTP page of the logged-in administrator
+func (h *Handler) TOTPSettings(c *echo.Context) error {
+	return h.renderTOTPSettings(c, adminTOTPPortal, http.StatusOK, nil)
+}
+
+// UserTOTPSettings displays the TOTP page of the logged-in mailbox user
+func (h *Handler) UserTOTPSettings(c *echo.Context) error {
+	return h.renderTOTPSettings(c, userTOTPPortal, http.StatusOK, nil)
+}
+
+// EnableTOTP confirms the enrollment of an administrator
+func (h *Handler) EnableTOTP(c *echo.Context) error {
+	return h.enableTOTP(c, adminTOTPPortal)
+}
+
+// UserEnableTOTP confirms the enrollment of a mailbox user
+func (h *Handler) UserEnableTOTP(c *echo.Context) error {
+	return h.enableTOTP(c, userTOTPPortal)
+}
+
+func (h *Handler) enableTOTP(c *echo.Context, p totpPortal) error {
+	username := middleware.GetUsername(c, p.sessionName)
+
+	pending := middleware.GetSessionString(c, p.sessionName, middleware.TOTPEnrollSecretKey)
+	enrollment, err := utils.TOTPEnrollmentFromURL(pending)
+	if pending == "" || err != nil {
+		return c.Redirect(http.StatusFound, p.settingsPath)
+	}
+
+	if !utils.ValidateTOTP(enrollment.Secret, c.FormValue("code")) {
+		return h.renderTOTPSettings(c, p, http.StatusBadRequest, map[string]interface{}{"ErrorKey": "TOTP_ErrInvalidCode"})
+	}
+
+	if err := utils.SetTOTPSecret(h.DB, p.kind, username, &enrollment.Secret); err != nil {
+		return h.renderTOTPSettings(c, p, http.StatusInternalServerError, map[string]interface{}{"ErrorKey": "TOTP_ErrSave"})
+	}
+	middleware.SetSessionValue(c, p.sessionName, middleware.TOTPEnrollSecretKey, nil)
+
+	codes, err := utils.GenerateRecoveryCodes(h.DB, p.kind, username)
+	if err != nil {
+		fmt.Printf("Failed to generate recovery codes: %v\n", err)
+	}
+
+	if err := utils.LogAction(h.DB, username, c.RealIP(), totpLogDomain(p.kind, username), "enable_totp", username); err != nil {
+		fmt.Printf("Failed to log enable_totp: %v\n", err)
+	}
+
+	return h.renderTOTPSettings(c, p, http.StatusOK, map[string]interface{}{
+		"MessageKey":    "TOTP_MsgEnabled",
+		"RecoveryCodes": codes,
+	})
+}
+
+// DisableTOTP removes TOTP from the logged-in administrator
+func (h *Handler) DisableTOTP(c *echo.Context) error {
+	return h.disableTOTP(c, adminTOTPPortal)
+}
+
+// UserDisableTOTP removes TOTP from the logged-in mailbox user
+func (h *Handler) UserDisableTOTP(c *echo.Context) error {
+	return h.disableTOTP(c, userTOTPPortal)
+}
+
+func (h *Handler) disableTOTP(c *echo.Context, p totpPortal) error {
+	username := middleware.GetUsername(c, p.sessionName)
+
+	secret, err := h.totpSecretFor(p.kind, username)
+	if err != nil {
+		return c.Redirect(http.StatusFound, p.loginPath)
+	}
+	if ok, _ := h.verifyTOTPCode(p.kind, username, secret, c.FormValue("code")); !ok {
+		return h.renderTOTPSettings(c, p, http.StatusBadRequest, map[string]interface{}{"ErrorKey": "TOTP_ErrInvalidCode"})
+	}
+
+	if err := utils.SetTOTPSecret(h.DB, p.kind, username, nil); err != nil {
+		return h.renderTOTPSettings(c, p, http.StatusInternalServerError, map[string]interface{}{"ErrorKey": "TOTP_ErrSave"})
+	}
+
+	if err := utils.LogAction(h.DB, username, c.RealIP(), totpLogDomain(p.kind, username), "disable_totp", username); err != nil {
+		fmt.Printf("Failed to log disable_totp: %v\n", err)
+	}
+
+	return h.renderTOTPSettings(c, p, http.StatusOK, map[string]interface{}{"MessageKey": "TOTP_MsgDisabled"})
+}
+
+// RegenerateRecoveryCodes issues new recovery codes for the logged-in administrator
+func (h *Handler) RegenerateRecoveryCodes(c *echo.Context) error {
+	return h.regenerateRecoveryCodes(c, adminTOTPPortal)
+}
+
+// UserRegenerateRecoveryCodes issues new recovery codes for the logged-in mailbox user
+func (h *Handler) UserRegenerateRecoveryCodes(c *echo.Context) error {
+	return h.regenerateRecoveryCodes(c, userTOTPPortal)
+}
+
+func (h *Handler) regenerateRecoveryCodes(c *echo.Context, p totpPortal) error {
+	username := middleware.GetUsername(c, p.sessionName)
+
+	secret, err := h.totpSecretFor(p.kind, username)
+	if err != nil {
+		return c.Redirect(http.StatusFound, p.loginPath)
+	}
+	if !totpEnabled(secret) || !utils.ValidateTOTP(*secret, c.FormValue("code")) {
+		return h.renderTOTPSettings(c, p, http.StatusBadRequest, map[string]interface{}{"ErrorKey": "TOTP_ErrInvalidCode"})
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(h.DB, p.kind, username)
+	if err != nil {
+		return h.renderTOTPSettings(c, p, http.StatusInternalServerError, map[string]interface{}{"ErrorKey": "TOTP_ErrSave"})
+	}
+
+	if err := utils.LogAction(h.DB, username, c.RealIP(), totpLogDomain(p.kind, username), "regenerate_recovery_codes", username); err != nil {
+		fmt.Printf("Failed to log regenerate_recovery_codes: %v\n", err)
+	}
+
+	return h.renderTOTPSettings(c, p, http.StatusOK, map[string]interface{}{
+		"MessageKey":    "TOTP_MsgCodesRegenerated",
+		"RecoveryCodes": codes,
+	})
+}
+
+// ResetAdminTOTP clears the TOTP enrollment of an administrator (superadmins only)
+func (h *Handler) ResetAdminTOTP(c *echo.Context) error {
+	return h.resetTOTP(c, utils.TOTPKindAdmin)
+}
+
+// ResetMailboxTOTP clears the TOTP enrollment of a mailbox (superadmins only)
+func (h *Handler) ResetMailboxTOTP(c *echo.Context) error {
+	return h.resetTOTP(c, utils.TOTPKindMailbox)
+}
+
+func (h *Handler) resetTOTP(c *echo.Context, kind string) error {
+	loggedInUser := middleware.GetUsername(c, middleware.SessionName)
+	isSuper, err := utils.IsSuperAdmin(h.DB, loggedInUser)
+	if err != nil || !isSuper {
+		return c.JSON(http.StatusForbidden, map[string]interface{}{"error": "Access denied"})
+	}
+
+	username, _ := url.PathUnescape(c.Param("username"))
+	if username == "" {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "Username is required",
+		})
+	}
+
+	if err := utils.SetTOTPSecret(h.DB, kind, username, nil); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   "Failed to reset TOTP: " + err.Error(),
+		})
+	}
+
+	if err := utils.LogAction(h.DB, loggedInUser, c.RealIP(), totpLogDomain(kind, username), "reset_totp", username); err != nil {
+		fmt.Printf("Failed to log reset_totp: %v\n", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// ListTOTPExceptions displays the IP addresses allowed to skip the TOTP step (superadmins only)
+func (h *Handler) ListTOTPExceptions(c *echo.Context) error {
+	return h.renderTOTPExceptions(c, http.StatusOK, "")
+}
+
+func (h *Handler) renderTOTPExceptions(c *echo.Context, status int, errorMsg string) error {
+	username := middleware.GetUsername(c, middleware.SessionName)
+	isSuper, err := utils.IsSuperAdmin(h.DB, username)
+	if err != nil || !isSuper {
+		return c.Render(http.StatusForbidden, "dashboard.html", map[string]interface{}{"Error": "Access denied"})
+	}
+
+	var exceptions []models.TOTPExceptionAddress
+	if err := h.DB.Order("ip ASC").Find(&exceptions).Error; err != nil {
+		errorMsg = "Failed to fetch TOTP exceptions"
+	}
+
+	return c.Render(status, "totp_exceptions.html", map[string]interface{}{
+		"Exceptions":   exceptions,
+		"Error":        errorMsg,
+		"IsSuperAdmin": true,
+		"SessionUser":  username,
+	})
+}
+
+// AddTOTPException adds an IP address or CIDR that may skip the TOTP step
+func (h *Handler) AddTOTPException(c *echo.Context) error {
+	loggedInUser := middleware.GetUsername(c, middleware.SessionName)
+	isSuper, err := utils.IsSuperAdmin(h.DB, loggedInUser)
+	if err != nil || !isSuper {
+		return c.Render(http.StatusForbidden, "dashboard.html", map[string]interface{}{"Error": "Access denied"})
+	}
+
+	ip := strings.TrimSpace(c.FormValue("ip"))
+	username := strings.TrimSpace(c.FormValue("username"))
+	description := strings.TrimSpace(c.FormValue("description"))
+
+	if _, _, cidrErr := net.ParseCIDR(ip); cidrErr != nil && net.ParseIP(ip) == nil {
+		return h.renderTOTPExceptions(c, http.StatusBadRequest, "Invalid IP address or CIDR: "+ip)
+	}
+
+	exception := models.TOTPExceptionAddress{IP: ip}
+	if username != "" {
+		exception.Username = &username
+	}
+	if description != "" {
+		exception.Description = &description
+	}
+
+	if err := h.DB.Create(&exception).Error; err != nil {
+		return h.renderTOTPExceptions(c, http.StatusInternalServerError, "Failed to add TOTP exception: "+err.Error())
+	}
+
+	if err := utils.LogAction(h.DB, loggedInUser, c.RealIP(), "ALL", "create_totp_exception", strings.TrimSpace(ip+" "+username)); err != nil {
+		fmt.Printf("Failed to log create_totp_exception: %v\n", err)
+	}
+
+	return c.Redirect(http.StatusFound, "/totp-exceptions")
+}
+
+// DeleteTOTPException removes a TOTP exception address
+func (h *Handler) DeleteTOTPException(c *echo.Context) error {
+	loggedInUser := middleware.GetUsername(c, middleware.SessionName)
+	isSuper, err := utils.IsSuperAdmin(h.DB, loggedInUser)
+	if err != nil || !isSuper {
+		return c.JSON(http.StatusForbidden, map[string]interface{}{"error": "Access denied"})
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "Invalid ID",
+		})
+	}
+
+	var exception models.TOTPExceptionAddress
+	if err := h.DB.First(&exception, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   "TOTP exception not found",
+		})
+	}
+
+	if err := h.DB.Delete(&exception).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   "Failed to delete TOTP exception",
+		})
+	}
+
+	if err := utils.LogAction(h.DB, loggedInUser, c.RealIP(), "ALL", "delete_totp_exception", exception.IP); err != nil {
+		fmt.Printf("Failed to log delete_totp_exception: %v\n", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
@@ -1,13 +1,20 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"go-postfixadmin/internal/utils"
+
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v5"
 	"github.com/spf13/viper"
+	"gorm.io/gorm"
 )
 
 const (
@@ -18,6 +25,21 @@ const (
 	IsSuperAdminKey   = "is_superadmin"
 	LastActivityKey   = "last_activity"
 	InactivityTimeout = 30 * time.Minute
+
+	// Second login step: set after a valid password when TOTP is still required
+	PendingUserKey      = "pending_username"
+	PendingSuperKey     = "pending_superadmin"
+	PendingAtKey        = "pending_at"
+	PendingTimeout      = 5 * time.Minute
+	TOTPEnrollSecretKey = "totp_enroll_secret"
+
+	// Set on mailbox logins whose password has expired, until a new password is chosen
+	PasswordExpiredKey = "password_expired"
+
+	// Context keys set by APIAuthMiddleware for the authenticated API caller
+	APIUserKey       = "api_user"
+	APISuperAdminKey = "api_superadmin"
+	APITokenScopeKey = "api_token_scope"
 )
 
 // baseAuthMiddleware provides a generic authentication middleware generator
@@ -74,7 +96,122 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 
 // UserAuthMiddleware checks for user session validity and inactivity
 func UserAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
-	return baseAuthMiddleware(UserSessionName, "/users/login")(next)
+	return baseAuthMiddleware(UserSessionName, "/users/login")(passwordExpiredGuard(next))
+}
+
+// passwordExpiredGuard keeps users with an expired password on the dashboard, where the
+// only thing they can do is choose a new password
+func passwordExpiredGuard(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		if c.Path() == "/users/dashboard" || c.Path() == "/users/password" {
+			return next(c)
+		}
+		if sess, _ := session.Get(UserSessionName, c); sess != nil {
+			if expired, _ := sess.Values[PasswordExpiredKey].(bool); expired {
+				return c.Redirect(http.StatusFound, "/users/dashboard")
+			}
+		}
+		return next(c)
+	}
+}
+
+// APIAuthMiddleware authenticates requests to the JSON API, either with an
+// "Authorization: Bearer" API token or with the admin session. Unlike the HTML
+// middlewares it never redirects: unauthenticated calls get a JSON 401.
+func APIAuthMiddleware(db *gorm.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			c.Response().Header().Set("Cache-Control", "no-store")
+
+			if header := c.Request().Header.Get("Authorization"); header != "" {
+				return apiTokenAuth(db, c, header, next)
+			}
+
+			sess, _ := session.Get(SessionName, c)
+			if sess != nil {
+				if auth, ok := sess.Values[AuthKey].(bool); ok && auth {
+					lastActivity, ok := sess.Values[LastActivityKey].(int64)
+					if !ok || time.Since(time.Unix(lastActivity, 0)) <= InactivityTimeout {
+						username, _ := sess.Values[UsernameKey].(string)
+						isSuper, _ := sess.Values[IsSuperAdminKey].(bool)
+						c.Set(APIUserKey, username)
+						c.Set(APISuperAdminKey, isSuper)
+						return next(c)
+					}
+				}
+			}
+
+			return c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": "Authentication required"})
+		}
+	}
+}
+
+// apiTokenAuth validates a bearer token, applies its scope and records its use in the log table
+func apiTokenAuth(db *gorm.DB, c *echo.Context, header string, next echo.HandlerFunc) error {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || db == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": "Invalid API token"})
+	}
+
+	record, admin, err := utils.AuthenticateAPIToken(db, strings.TrimSpace(token))
+	if err != nil {
+		if !errors.Is(err, utils.ErrInvalidAPIToken) {
+			return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": "Authentication failed"})
+		}
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": "Invalid API token"})
+	}
+
+	method := c.Request().Method
+	if record.ReadOnly && method != http.MethodGet && method != http.MethodHead {
+		return c.JSON(http.StatusForbidden, map[string]interface{}{"error": "This API token is read-only"})
+	}
+
+	// A token restricted to some domains never acts as superadmin
+	scope := utils.APITokenDomains(*record)
+	c.Set(APIUserKey, admin.Username)
+	c.Set(APISuperAdminKey, admin.Superadmin && len(scope) == 0)
+	c.Set(APITokenScopeKey, scope)
+
+	if err := utils.LogAction(db, admin.Username, c.RealIP(), "ALL", "api_token_use", fmt.Sprintf("%s %s [%s]", method, c.Request().URL.Path, record.Prefix)); err != nil {
+		fmt.Printf("Failed to log API token use: %v\n", err)
+	}
+	db.Model(record).Update("last_used", time.Now())
+
+	return next(c)
+}
+
+// GetAPIUser returns the admin username and superadmin flag of the API caller
+func GetAPIUser(c *echo.Context) (string, bool) {
+	username, _ := c.Get(APIUserKey).(string)
+	isSuper, _ := c.Get(APISuperAdminKey).(bool)
+	return username, isSuper
+}
+
+// GetAPITokenScope returns the domains an API token is restricted to; nil means no restriction
+func GetAPITokenScope(c *echo.Context) []string {
+	scope, _ := c.Get(APITokenScopeKey).([]string)
+	return scope
+}
+
+// DovecotAuthMiddleware protects the Dovecot auth endpoints with the shared secret of
+// [dovecot] secret, sent as "Authorization: Bearer <secret>". The endpoints answer 404
+// while [dovecot] is disabled.
+func DovecotAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		c.Response().Header().Set("Cache-Control", "no-store")
+
+		if !utils.DovecotEnabled() {
+			return c.JSON(http.StatusNotFound, map[string]interface{}{"error": "Not found"})
+		}
+
+		scheme, secret, found := strings.Cut(c.Request().Header.Get("Authorization"), " ")
+		expected := viper.GetString("dovecot.secret")
+		if !found || !strings.EqualFold(scheme, "Bearer") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimSpace(secret)), []byte(expected)) != 1 {
+			return c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": "Invalid secret"})
+		}
+		return next(c)
+	}
 }
 
 // SetSession authenticates and sets initial session values
@@ -87,6 +224,10 @@ func SetSession(c *echo.Context, sessionName string, username string, isSuperAdm
 		Secure:   viper.GetBool("server.ssl"),
 		SameSite: http.SameSiteLaxMode,
 	}
+	delete(sess.Values, PendingUserKey)
+	delete(sess.Values, PendingSuperKey)
+	delete(sess.Values, PendingAtKey)
+	delete(sess.Values, PasswordExpiredKey)
 	sess.Values[AuthKey] = true
 	sess.Values[UsernameKey] = username
 	if sessionName == SessionName {
@@ -96,6 +237,72 @@ func SetSession(c *echo.Context, sessionName string, username string, isSuperAdm
 	return sess.Save(c.Request(), c.Response())
 }
 
+// SetPendingLogin records a user whose password was accepted but who still has to pass the TOTP step
+func SetPendingLogin(c *echo.Context, sessionName string, username string, isSuperAdmin bool) error {
+	sess, _ := session.Get(sessionName, c)
+	sess.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   int(PendingTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   viper.GetBool("server.ssl"),
+		SameSite: http.SameSiteLaxMode,
+	}
+	sess.Values[AuthKey] = false
+	sess.Values[PendingUserKey] = username
+	sess.Values[PendingSuperKey] = isSuperAdmin
+	sess.Values[PendingAtKey] = time.Now().Unix()
+	return sess.Save(c.Request(), c.Response())
+}
+
+// GetPendingLogin returns the user waiting for the TOTP step, if any and not expired
+func GetPendingLogin(c *echo.Context, sessionName string) (string, bool, bool) {
+	sess, _ := session.Get(sessionName, c)
+	if sess == nil {
+		return "", false, false
+	}
+	username, _ := sess.Values[PendingUserKey].(string)
+	at, _ := sess.Values[PendingAtKey].(int64)
+	if username == "" || time.Since(time.Unix(at, 0)) > PendingTimeout {
+		return "", false, false
+	}
+	isSuper, _ := sess.Values[PendingSuperKey].(bool)
+	return username, isSuper, true
+}
+
+// SetSessionValue stores an arbitrary value in the named session
+func SetSessionValue(c *echo.Context, sessionName, key string, value interface{}) {
+	sess, _ := session.Get(sessionName, c)
+	if sess == nil {
+		return
+	}
+	if value == nil {
+		delete(sess.Values, key)
+	} else {
+		sess.Values[key] = value
+	}
+	sess.Save(c.Request(), c.Response())
+}
+
+// GetSessionString retrieves a string value from the named session
+func GetSessionString(c *echo.Context, sessionName, key string) string {
+	sess, _ := session.Get(sessionName, c)
+	if sess == nil {
+		return ""
+	}
+	value, _ := sess.Values[key].(string)
+	return value
+}
+
+// GetSessionBool retrieves a boolean value from the named session
+func GetSessionBool(c *echo.Context, sessionName, key string) bool {
+	sess, _ := session.Get(sessionName, c)
+	if sess == nil {
+		return false
+	}
+	value, _ := sess.Values[key].(bool)
+	return value
+}
+
 // GetUsername retrieves the username from the specified session
 func GetUsername(c *echo.Context, sessionName string) string {
 	sess, _ := session.Get(sessionName, c)
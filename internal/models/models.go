@@ -18,6 +18,7 @@ type Domain struct {
 	Modified       time.Time `gorm:"column:modified;default:'2000-01-01 00:00:00'"`
 	Active         bool      `gorm:"column:active"`
 	PasswordExpiry *int      `gorm:"column:password_expiry"`
+	SendLimit      int       `gorm:"column:send_limit;default:0;not null"` // Messages per hour for all mailboxes (0 = unlimited)
 }
 
 func (Domain) TableName() string {
@@ -43,6 +44,7 @@ type Mailbox struct {
 	PasswordExpiry time.Time `gorm:"column:password_expiry;default:'2000-01-01 00:00:00'"`
 	TOTPSecret     *string   `gorm:"column:totp_secret;default:null"`
 	SMTPActive     bool      `gorm:"column:smtp_active;default:true"`
+	SendLimit      int       `gorm:"column:send_limit;default:0;not null"` // Messages per hour (0 = unlimited)
 }
 
 func (Mailbox) TableName() string {
@@ -167,10 +169,12 @@ func (Config) TableName() string {
 
 // MailboxAppPassword represents the 'mailbox_app_password' table
 type MailboxAppPassword struct {
-	ID           int     `gorm:"primaryKey;column:id;autoIncrement"`
-	Username     *string `gorm:"column:username"`
-	Description  *string `gorm:"column:description"`
-	PasswordHash *string `gorm:"column:password_hash"`
+	ID           int        `gorm:"primaryKey;column:id;autoIncrement"`
+	Username     *string    `gorm:"column:username;index"`
+	Description  *string    `gorm:"column:description"`
+	PasswordHash *string    `gorm:"column:password_hash"`
+	Created      time.Time  `gorm:"column:created;default:'2000-01-01 00:00:00'"`
+	LastUsed     *time.Time `gorm:"column:last_used"`
 }
 
 func (MailboxAppPassword) TableName() string {
@@ -243,14 +247,16 @@ func (VacationNotification) TableName() string {
 
 // DKIM represents the 'dkim' table
 type DKIM struct {
-	ID          int       `gorm:"primaryKey;column:id;autoIncrement"`
-	DomainName  string    `gorm:"column:domain_name;index"`
-	Description *string   `gorm:"column:description"`
-	Selector    string    `gorm:"column:selector;default:default"`
-	PrivateKey  *string   `gorm:"column:private_key;type:text"`
-	PublicKey   *string   `gorm:"column:public_key;type:text"`
-	Created     time.Time `gorm:"column:created"`
-	Modified    time.Time `gorm:"column:modified"`
+	ID          int        `gorm:"primaryKey;column:id;autoIncrement"`
+	DomainName  string     `gorm:"column:domain_name;index"`
+	Description *string    `gorm:"column:description"`
+	Selector    string     `gorm:"column:selector;default:default"`
+	PrivateKey  *string    `gorm:"column:private_key;type:text"`
+	PublicKey   *string    `gorm:"column:public_key;type:text"`
+	KeyType     string     `gorm:"column:key_type;size:16;default:rsa;not null"` // rsa or ed25519
+	Expires     *time.Time `gorm:"column:expires"`                               // Set when the key was rotated out: kept published until then
+	Created     time.Time  `gorm:"column:created"`
+	Modified    time.Time  `gorm:"column:modified"`
 }
 
 func (DKIM) TableName() string {
@@ -269,3 +275,65 @@ type DKIMSigning struct {
 func (DKIMSigning) TableName() string {
 	return "dkim_signing"
 }
+
+// APIToken represents the 'api_token' table. Only the SHA-256 of the token is stored.
+type APIToken struct {
+	ID        int        `gorm:"primaryKey;column:id;autoIncrement"`
+	Username  string     `gorm:"column:username;index;not null"`
+	Name      string     `gorm:"column:name"`
+	TokenHash string     `gorm:"column:token_hash;size:64;uniqueIndex;not null"`
+	Prefix    string     `gorm:"column:prefix;size:16"`
+	Domains   string     `gorm:"column:domains;type:text"` // Comma-separated; empty means every domain of the admin
+	ReadOnly  bool       `gorm:"column:read_only;default:false"`
+	Created   time.Time  `gorm:"column:created;default:'2000-01-01 00:00:00'"`
+	LastUsed  *time.Time `gorm:"column:last_used"`
+}
+
+func (APIToken) TableName() string {
+	return "api_token"
+}
+
+// TOTPRecoveryCode represents the 'totp_recovery_code' table. Kind is "admin" or "mailbox"
+// since an admin and a mailbox may share the same address.
+type TOTPRecoveryCode struct {
+	ID       int        `gorm:"primaryKey;column:id;autoIncrement"`
+	Kind     string     `gorm:"column:kind;size:16;index:idx_totp_recovery_user"`
+	Username string     `gorm:"column:username;index:idx_totp_recovery_user"`
+	CodeHash string     `gorm:"column:code_hash;size:64"`
+	Created  time.Time  `gorm:"column:created;default:'2000-01-01 00:00:00'"`
+	UsedAt   *time.Time `gorm:"column:used_at"`
+}
+
+func (TOTPRecoveryCode) TableName() string {
+	return "totp_recovery_code"
+}
+
+// LoginFailure represents the 'login_failure' table: failed login counters per username
+// or client IP of each login portal (Scope is e.g. "admin:username" or "dovecot:ip"), used
+// to lock out brute-force attempts.
+type LoginFailure struct {
+	ID          int        `gorm:"primaryKey;column:id;autoIncrement"`
+	Scope       string     `gorm:"column:scope;size:16;uniqueIndex:idx_login_failure_subject;not null"`
+	Subject     string     `gorm:"column:subject;size:255;uniqueIndex:idx_login_failure_subject;not null"`
+	Failures    int        `gorm:"column:failures;default:0;not null"`
+	LastFailure time.Time  `gorm:"column:last_failure;default:'2000-01-01 00:00:00'"`
+	LockedUntil *time.Time `gorm:"column:locked_until"`
+}
+
+func (LoginFailure) TableName() string {
+	return "login_failure"
+}
+
+// PasswordHistory represents the 'password_history' table: previous password hashes of an
+// admin or mailbox (Kind is "admin" or "mailbox"), used to prevent password reuse.
+type PasswordHistory struct {
+	ID           int       `gorm:"primaryKey;column:id;autoIncrement"`
+	Kind         string    `gorm:"column:kind;size:16;index:idx_password_history_user"`
+	Username     string    `gorm:"column:username;index:idx_password_history_user"`
+	PasswordHash string    `gorm:"column:password_hash"`
+	Created      time.Time `gorm:"column:created;default:'2000-01-01 00:00:00'"`
+}
+
+func (PasswordHistory) TableName() string {
+	return "password_history"
+}
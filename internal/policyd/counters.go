@@ -0,0 +1,129 @@
+package policyd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Window is the period the send limits apply to
+const Window = time.Hour
+
+// Limit is a send limit for one counter key, e.g. "mailbox:user@example.com"
+type Limit struct {
+	Key string
+	Max int // 0 = unlimited
+}
+
+// window counts the messages sent since Start
+type window struct {
+	Count int       `json:"count"`
+	Start time.Time `json:"start"`
+}
+
+// Counters holds the hourly send counters in memory. They can be saved to a file so the
+// limits survive restarts.
+type Counters struct {
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+// NewCounters creates empty counters
+func NewCounters() *Counters {
+	return &Counters{windows: make(map[string]*window)}
+}
+
+// current returns the window of a key, starting a new one when the previous is over
+func (c *Counters) current(key string, now time.Time) *window {
+	w, ok := c.windows[key]
+	if !ok || now.Sub(w.Start) >= Window {
+		w = &window{Start: now}
+		c.windows[key] = w
+	}
+	return w
+}
+
+// Take counts one message against all limits. When any limit is already reached nothing is
+// counted and the key of that limit is returned with false.
+func (c *Counters) Take(now time.Time, limits ...Limit) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, l := range limits {
+		if l.Max > 0 && c.current(l.Key, now).Count >= l.Max {
+			return l.Key, false
+		}
+	}
+	for _, l := range limits {
+		c.current(l.Key, now).Count++
+	}
+	return "", true
+}
+
+// Count returns the messages counted for a key in the current window
+func (c *Counters) Count(key string, now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if w, ok := c.windows[key]; ok && now.Sub(w.Start) < Window {
+		return w.Count
+	}
+	return 0
+}
+
+// prune drops finished windows; the caller holds the lock
+func (c *Counters) prune(now time.Time) {
+	for k, w := range c.windows {
+		if now.Sub(w.Start) >= Window {
+			delete(c.windows, k)
+		}
+	}
+}
+
+// Save writes the counters of the current windows to a JSON file, atomically
+func (c *Counters) Save(path string) error {
+	c.mu.Lock()
+	c.prune(time.Now())
+	data, err := json.Marshal(c.windows)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".policyd-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads counters written by Save. A missing file is not an error.
+func (c *Counters) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	windows := make(map[string]*window)
+	if err := json.Unmarshal(data, &windows); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.windows = windows
+	c.prune(time.Now())
+	return nil
+}
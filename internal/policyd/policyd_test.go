@@ -0,0 +1,109 @@
+package policyd
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+)
+
+func TestReadRequest(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("request=smtpd_access_policy\nsasl_username=user@example.com\nsender=user@example.com\n\n"))
+	req, err := ReadRequest(r)
+	if err != nil {
+		t.Fatalf("ReadRequest() error = %v", err)
+	}
+	if req["sasl_username"] != "user@example.com" || req["request"] != "smtpd_access_policy" {
+		t.Errorf("ReadRequest() = %v", req)
+	}
+
+	if _, err := ReadRequest(bufio.NewReader(strings.NewReader("garbage\n\n"))); err == nil {
+		t.Error("ReadRequest() expected an error for a malformed attribute")
+	}
+}
+
+func TestCountersTake(t *testing.T) {
+	c := NewCounters()
+	now := time.Now()
+	limits := []Limit{{Key: "mailbox:a@example.com", Max: 2}, {Key: "domain:example.com", Max: 0}}
+
+	for i := 0; i < 2; i++ {
+		if _, ok := c.Take(now, limits...); !ok {
+			t.Fatalf("Take() #%d refused", i+1)
+		}
+	}
+	if key, ok := c.Take(now, limits...); ok || key != "mailbox:a@example.com" {
+		t.Errorf("Take() over limit = %q, %v", key, ok)
+	}
+	if got := c.Count("domain:example.com", now); got != 2 {
+		t.Errorf("refused message was counted: domain count = %d, want 2", got)
+	}
+	if _, ok := c.Take(now.Add(Window), limits...); !ok {
+		t.Error("Take() refused after the window ended")
+	}
+}
+
+func TestCountersPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.json")
+	c := NewCounters()
+	c.Take(time.Now(), Limit{Key: "mailbox:a@example.com", Max: 10})
+	if err := c.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded := NewCounters()
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := loaded.Count("mailbox:a@example.com", time.Now()); got != 1 {
+		t.Errorf("loaded count = %d, want 1", got)
+	}
+	if err := NewCounters().Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("Load() of a missing file = %v, want nil", err)
+	}
+}
+
+func TestDecide(t *testing.T) {
+	mailboxes := map[string]models.Mailbox{
+		"user@example.com":    {Username: "user@example.com", Domain: "example.com", SMTPActive: true, SendLimit: 1},
+		"nosmtp@example.com":  {Username: "nosmtp@example.com", Domain: "example.com", SMTPActive: false},
+		"limited@example.org": {Username: "limited@example.org", Domain: "example.org", SMTPActive: true},
+	}
+	s := &Server{
+		Mailbox: func(login string) (models.Mailbox, error) {
+			if m, ok := mailboxes[login]; ok {
+				return m, nil
+			}
+			return models.Mailbox{}, utils.ErrUnknownMailbox
+		},
+		SenderAllowed: func(m models.Mailbox, sender string) (bool, error) {
+			return sender == "" || sender == m.Username, nil
+		},
+		DomainLimit: func(domain string) (int, error) { return 0, nil },
+		Counters:    NewCounters(),
+		CheckSender: true,
+	}
+
+	tests := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{"unauthenticated", Request{"sender": "x@example.net"}, "DUNNO"},
+		{"unknown login", Request{"sasl_username": "gone@example.com", "instance": "1"}, "REJECT"},
+		{"smtp disabled", Request{"sasl_username": "nosmtp@example.com", "instance": "2"}, "REJECT"},
+		{"sender mismatch", Request{"sasl_username": "user@example.com", "sender": "ceo@example.com", "instance": "3"}, "REJECT"},
+		{"allowed", Request{"sasl_username": "user@example.com", "sender": "user@example.com", "instance": "4"}, "DUNNO"},
+		{"same message, next recipient", Request{"sasl_username": "user@example.com", "sender": "user@example.com", "instance": "4"}, "DUNNO"},
+		{"over the hourly limit", Request{"sasl_username": "user@example.com", "sender": "user@example.com", "instance": "5"}, "DEFER"},
+	}
+	for _, tt := range tests {
+		if got := s.Decide(tt.req); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: Decide() = %q, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Package policyd implements a Postfix policy delegation server (SMTPD_POLICY_README) that
+// enforces the SMTP flag of mailboxes, sender-login matching and hourly send limits.
+package policyd
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+)
+
+// maxAttributes bounds the size of one request
+const maxAttributes = 100
+
+// Request holds the "name=value" attributes of one policy request
+type Request map[string]string
+
+// ReadRequest reads attributes up to the empty line ending a request
+func ReadRequest(r *bufio.Reader) (Request, error) {
+	req := Request{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return req, nil
+		}
+		if len(req) >= maxAttributes {
+			return nil, errors.New("too many attributes")
+		}
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, errors.New("malformed attribute " + line)
+		}
+		req[name] = value
+	}
+}
+
+// FormatAction encodes a response
+func FormatAction(action string) string {
+	return "action=" + action + "\n\n"
+}
@@ -0,0 +1,170 @@
+package policyd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/utils"
+)
+
+// Server answers policy requests. The lookup functions are normally backed by the database.
+type Server struct {
+	// Mailbox resolves a SASL login; utils.ErrUnknownMailbox means unknown or inactive
+	Mailbox func(login string) (models.Mailbox, error)
+	// SenderAllowed reports whether the mailbox may use the envelope sender
+	SenderAllowed func(mailbox models.Mailbox, sender string) (bool, error)
+	// DomainLimit returns the hourly send limit of a domain (0 = unlimited)
+	DomainLimit func(domain string) (int, error)
+
+	Counters    *Counters
+	CheckSender bool          // reject sender-login mismatches
+	Timeout     time.Duration // idle time after which a client connection is closed
+
+	// Postfix asks once per recipient; a message is counted once per instance
+	mu        sync.Mutex
+	instances map[string]instanceResult
+	lastPrune time.Time
+}
+
+type instanceResult struct {
+	action string
+	at     time.Time
+}
+
+const deferLookup = "DEFER_IF_PERMIT 4.3.0 Temporary lookup failure"
+
+// Decide returns the action for one request. Unauthenticated mail is left to the other
+// restrictions (DUNNO).
+func (s *Server) Decide(req Request) string {
+	login := strings.ToLower(req["sasl_username"])
+	if login == "" {
+		return "DUNNO"
+	}
+
+	instance := req["instance"]
+	if action, ok := s.instanceAction(instance); ok {
+		return action
+	}
+	action := s.decide(login, req["sender"])
+	if !strings.HasPrefix(action, "DEFER_IF_PERMIT") {
+		s.rememberInstance(instance, action)
+	}
+	if action != "DUNNO" {
+		slog.Info("policyd", "login", login, "sender", req["sender"], "client", req["client_address"], "action", action)
+	}
+	return action
+}
+
+func (s *Server) decide(login, sender string) string {
+	mailbox, err := s.Mailbox(login)
+	if errors.Is(err, utils.ErrUnknownMailbox) {
+		return "REJECT 5.7.1 Sender account is disabled"
+	}
+	if err != nil {
+		return deferLookup
+	}
+	if !mailbox.SMTPActive {
+		return "REJECT 5.7.1 Sending is disabled for this account"
+	}
+
+	if s.CheckSender {
+		allowed, err := s.SenderAllowed(mailbox, sender)
+		if err != nil {
+			return deferLookup
+		}
+		if !allowed {
+			return fmt.Sprintf("REJECT 5.7.1 Sender address <%s> not owned by user %s", sender, login)
+		}
+	}
+
+	domainLimit, err := s.DomainLimit(mailbox.Domain)
+	if err != nil {
+		return deferLookup
+	}
+	key, ok := s.Counters.Take(time.Now(),
+		Limit{Key: "mailbox:" + mailbox.Username, Max: mailbox.SendLimit},
+		Limit{Key: "domain:" + mailbox.Domain, Max: domainLimit},
+	)
+	if !ok {
+		what, _, _ := strings.Cut(key, ":")
+		return "DEFER 4.7.1 Hourly send limit reached for this " + what
+	}
+	return "DUNNO"
+}
+
+func (s *Server) instanceAction(instance string) (string, bool) {
+	if instance == "" {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.instances[instance]
+	return r.action, ok
+}
+
+func (s *Server) rememberInstance(instance, action string) {
+	if instance == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.instances == nil {
+		s.instances = make(map[string]instanceResult)
+	}
+	if now.Sub(s.lastPrune) > time.Minute {
+		for k, r := range s.instances {
+			if now.Sub(r.at) > Window {
+				delete(s.instances, k)
+			}
+		}
+		s.lastPrune = now
+	}
+	s.instances[instance] = instanceResult{action: action, at: now}
+}
+
+// Serve accepts connections until the listener is closed
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle answers the requests of one connection; Postfix reuses connections
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		if s.Timeout > 0 {
+			conn.SetDeadline(time.Now().Add(s.Timeout))
+		}
+		req, err := ReadRequest(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				var netErr net.Error
+				if !errors.As(err, &netErr) || !netErr.Timeout() {
+					slog.Warn("policyd: bad request", "remote", conn.RemoteAddr(), "error", err)
+				}
+			}
+			return
+		}
+		if _, err := io.WriteString(conn, FormatAction(s.Decide(req))); err != nil {
+			return
+		}
+	}
+}
@@ -14,6 +14,12 @@ func RegisterRoutes(e *echo.Echo, h *handlers.Handler) {
 	// Public Auth Routes (no middleware needed)
 	e.GET("/login", h.Login)
 	e.POST("/login", h.Login)
+	e.GET("/login/totp", h.LoginTOTP)
+	e.POST("/login/totp", h.LoginTOTP)
+	e.GET("/login/forgot", h.ForgotPassword)
+	e.POST("/login/forgot", h.ForgotPassword)
+	e.GET("/login/reset", h.ResetPassword)
+	e.POST("/login/reset", h.ResetPassword)
 	e.GET("/logout", h.Logout)
 
 	// Static files and utils (public)
@@ -40,14 +46,18 @@ func RegisterRoutes(e *echo.Echo, h *handlers.Handler) {
 	adminGroup.GET("/domains/edit/:domain", h.EditDomainForm)
 	adminGroup.POST("/domains/edit/:domain", h.EditDomain)
 	adminGroup.DELETE("/domains/delete/:domain", h.DeleteDomain)
+	adminGroup.GET("/domains/dns/:domain", h.DomainDNS)
 
 	// Mailboxes
 	adminGroup.GET("/mailboxes", h.ListMailboxes)
 	adminGroup.GET("/mailboxes/add", h.AddMailboxForm)
 	adminGroup.POST("/mailboxes/add", h.AddMailbox)
+	adminGroup.GET("/mailboxes/import", h.ImportAccountsForm)
+	adminGroup.POST("/mailboxes/import", h.ImportAccounts)
 	adminGroup.GET("/mailboxes/edit/:username", h.EditMailboxForm)
 	adminGroup.POST("/mailboxes/edit/:username", h.EditMailbox)
 	adminGroup.DELETE("/mailboxes/delete/:username", h.DeleteMailbox)
+	adminGroup.DELETE("/mailboxes/totp/:username", h.ResetMailboxTOTP)
 
 	// Admins
 	adminGroup.GET("/admins", h.ListAdmins)
@@ -56,6 +66,24 @@ func RegisterRoutes(e *echo.Echo, h *handlers.Handler) {
 	adminGroup.GET("/admins/edit/:username", h.EditAdminForm)
 	adminGroup.POST("/admins/edit/:username", h.EditAdmin)
 	adminGroup.DELETE("/admins/delete/:username", h.DeleteAdmin)
+	adminGroup.DELETE("/admins/totp/:username", h.ResetAdminTOTP)
+
+	// Two-factor authentication
+	adminGroup.GET("/totp", h.TOTPSettings)
+	adminGroup.POST("/totp/enable", h.EnableTOTP)
+	adminGroup.POST("/totp/disable", h.DisableTOTP)
+	adminGroup.POST("/totp/recovery-codes", h.RegenerateRecoveryCodes)
+	adminGroup.GET("/totp-exceptions", h.ListTOTPExceptions)
+	adminGroup.POST("/totp-exceptions/add", h.AddTOTPException)
+	adminGroup.DELETE("/totp-exceptions/delete/:id", h.DeleteTOTPException)
+	adminGroup.GET("/login-locks", h.ListLoginLocks)
+	adminGroup.DELETE("/login-locks/delete/:id", h.DeleteLoginLock)
+
+	// API Tokens
+	adminGroup.GET("/api-tokens", h.ListAPITokens)
+	adminGroup.GET("/api-tokens/add", h.AddAPITokenForm)
+	adminGroup.POST("/api-tokens/add", h.AddAPIToken)
+	adminGroup.DELETE("/api-tokens/delete/:id", h.DeleteAPIToken)
 
 	// Aliases
 	adminGroup.GET("/aliases", h.ListAliases)
@@ -74,12 +102,71 @@ func RegisterRoutes(e *echo.Echo, h *handlers.Handler) {
 	adminGroup.DELETE("/alias-domains/delete/:alias_domain", h.DeleteAliasDomain)
 
 	// Fetchmail
+	adminGroup.GET("/fetchmail", h.ListFetchmail)
 	adminGroup.GET("/fetchmail/add", h.AddFetchmailGET)
 	adminGroup.POST("/fetchmail/add", h.AddFetchmailPOST)
+	adminGroup.GET("/fetchmail/edit/:id", h.EditFetchmailForm)
+	adminGroup.POST("/fetchmail/edit/:id", h.EditFetchmail)
+	adminGroup.DELETE("/fetchmail/delete/:id", h.DeleteFetchmail)
+	adminGroup.POST("/fetchmail/test/:id", h.TestFetchmail)
+
+	// DKIM
+	adminGroup.GET("/dkim", h.ListDKIM)
+	adminGroup.GET("/dkim/add", h.AddDKIMForm)
+	adminGroup.POST("/dkim/add", h.AddDKIM)
+	adminGroup.GET("/dkim/edit/:id", h.EditDKIMForm)
+	adminGroup.POST("/dkim/edit/:id", h.EditDKIM)
+	adminGroup.POST("/dkim/rotate/:id", h.RotateDKIM)
+	adminGroup.DELETE("/dkim/delete/:id", h.DeleteDKIM)
+	adminGroup.POST("/dkim/signing/add", h.AddDKIMSigning)
+	adminGroup.DELETE("/dkim/signing/delete/:id", h.DeleteDKIMSigning)
+	adminGroup.GET("/dkim/export/:format", h.ExportDKIM)
+
+	// JSON REST API (v1)
+	apiGroup := e.Group("/api/v1")
+	apiGroup.Use(middleware.APIAuthMiddleware(h.DB))
+
+	apiGroup.GET("/domains", h.APIListDomains)
+	apiGroup.POST("/domains", h.APICreateDomain)
+	apiGroup.GET("/domains/:domain", h.APIGetDomain)
+	apiGroup.PUT("/domains/:domain", h.APIUpdateDomain)
+	apiGroup.DELETE("/domains/:domain", h.APIDeleteDomain)
+
+	apiGroup.GET("/mailboxes", h.APIListMailboxes)
+	apiGroup.POST("/mailboxes", h.APICreateMailbox)
+	apiGroup.GET("/mailboxes/:username", h.APIGetMailbox)
+	apiGroup.PUT("/mailboxes/:username", h.APIUpdateMailbox)
+	apiGroup.DELETE("/mailboxes/:username", h.APIDeleteMailbox)
+
+	apiGroup.GET("/aliases", h.APIListAliases)
+	apiGroup.POST("/aliases", h.APICreateAlias)
+	apiGroup.GET("/aliases/:address", h.APIGetAlias)
+	apiGroup.PUT("/aliases/:address", h.APIUpdateAlias)
+	apiGroup.DELETE("/aliases/:address", h.APIDeleteAlias)
+
+	apiGroup.GET("/alias-domains", h.APIListAliasDomains)
+	apiGroup.POST("/alias-domains", h.APICreateAliasDomain)
+	apiGroup.GET("/alias-domains/:alias_domain", h.APIGetAliasDomain)
+	apiGroup.PUT("/alias-domains/:alias_domain", h.APIUpdateAliasDomain)
+	apiGroup.DELETE("/alias-domains/:alias_domain", h.APIDeleteAliasDomain)
+
+	// Dovecot passdb/userdb endpoints (shared secret, see [dovecot])
+	dovecotGroup := e.Group("/dovecot")
+	dovecotGroup.Use(middleware.DovecotAuthMiddleware)
+	dovecotGroup.POST("/auth", h.DovecotAuth)
+	dovecotGroup.GET("/passdb/:user", h.DovecotPassDB)
+	dovecotGroup.GET("/userdb/:user", h.DovecotUserDB)
+	dovecotGroup.GET("/users", h.DovecotListUsers)
 
 	// User Portal Routes (public)
 	e.GET("/users/login", h.UserLogin)
 	e.POST("/users/login", h.UserLogin)
+	e.GET("/users/login/totp", h.UserLoginTOTP)
+	e.POST("/users/login/totp", h.UserLoginTOTP)
+	e.GET("/users/login/forgot", h.UserForgotPassword)
+	e.POST("/users/login/forgot", h.UserForgotPassword)
+	e.GET("/users/login/reset", h.UserResetPassword)
+	e.POST("/users/login/reset", h.UserResetPassword)
 	e.GET("/users/logout", h.UserLogout)
 
 	// Protected User Portal Routes
@@ -91,6 +178,16 @@ func RegisterRoutes(e *echo.Echo, h *handlers.Handler) {
 	userGroup.GET("/vacation", h.UserVacation)
 	userGroup.POST("/vacation", h.UpdateUserVacation)
 	userGroup.POST("/vacation/delete", h.DeleteUserVacation)
+	userGroup.GET("/fetchmail", h.UserFetchmail)
+	userGroup.POST("/fetchmail", h.UserSaveFetchmail)
+	userGroup.DELETE("/fetchmail/delete/:id", h.UserDeleteFetchmail)
+	userGroup.POST("/fetchmail/test/:id", h.UserTestFetchmail)
+	userGroup.GET("/totp", h.UserTOTPSettings)
+	userGroup.POST("/totp/enable", h.UserEnableTOTP)
+	userGroup.POST("/totp/disable", h.UserDisableTOTP)
+	userGroup.POST("/totp/recovery-codes", h.UserRegenerateRecoveryCodes)
+	userGroup.POST("/app-passwords/add", h.UserAddAppPassword)
+	userGroup.DELETE("/app-passwords/delete/:id", h.UserDeleteAppPassword)
 
 	// Root Redirect
 	e.GET("/", func(c *echo.Context) error {
@@ -10,10 +10,20 @@ import (
 	"path"
 	"strings"
 
+	"go-postfixadmin/internal/i18n"
+	"go-postfixadmin/internal/utils"
+
 	"github.com/labstack/echo/v5"
 	"github.com/spf13/viper"
 )
 
+// localizedError is implemented by errors that carry a locale message ID, such as utils.PasswordPolicyError
+type localizedError interface {
+	error
+	MessageID() string
+	MessageData() map[string]interface{}
+}
+
 // Template stores pre-parsed templates for each route.
 type Template struct {
 	templates map[string]*template.Template
@@ -41,23 +51,27 @@ func (t *Template) Render(c *echo.Context, w io.Writer, name string, data any) e
 	}
 
 	fetchmailEnabled := viper.GetBool("features.fetchmail")
+	passwordResetEnabled := utils.PasswordResetEnabled()
+	passwordMinLength := utils.PasswordMinLength()
 
 	var viewData any = data
 	if data == nil {
-		viewData = map[string]any{"Lang": lang, "FetchmailEnabled": fetchmailEnabled}
+		viewData = map[string]any{"Lang": lang, "FetchmailEnabled": fetchmailEnabled, "PasswordResetEnabled": passwordResetEnabled, "PasswordMinLength": passwordMinLength}
 	} else if m, ok := data.(map[string]any); ok {
 		m["Lang"] = lang
 		m["FetchmailEnabled"] = fetchmailEnabled
-		viewData = m
-	} else if m, ok := data.(map[string]interface{}); ok {
-		m["Lang"] = lang
-		m["FetchmailEnabled"] = fetchmailEnabled
+		m["PasswordResetEnabled"] = passwordResetEnabled
+		m["PasswordMinLength"] = passwordMinLength
+		// Errors carrying a message ID (e.g. password policy errors) are shown translated
+		if e, ok := m["Error"].(localizedError); ok {
+			m["Error"] = i18n.Translate(lang, e.MessageID(), e.MessageData())
+		}
 		viewData = m
 	}
 
 	// Determine layout
 	layout := "base"
-	if name == "login.html" || name == "users/login.html" {
+	if name == "login.html" || name == "users/login.html" || name == "login_totp.html" || name == "password_reset.html" {
 		layout = name
 	} else if len(name) > 6 && name[:6] == "users/" {
 		layout = "user_base"
@@ -103,7 +117,7 @@ func loadTemplates(embeddedFiles embed.FS) (*Template, error) {
 			}
 		} else {
 			tmplKey = name
-			if name == "login.html" {
+			if name == "login.html" || name == "login_totp.html" || name == "password_reset.html" {
 				tmpl, parseErr = template.New(tmplKey).Funcs(funcMap).ParseFS(embeddedFiles, filePath)
 			} else {
 				tmpl, parseErr = template.New(tmplKey).Funcs(funcMap).ParseFS(embeddedFiles, layout, filePath)
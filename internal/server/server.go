@@ -27,6 +27,14 @@ var AppVersion string = "1.0.0"
 func StartServer(embeddedFiles embed.FS, port int, db *gorm.DB, ssl bool, certFile, keyFile string) {
 	e := echo.New()
 
+	// Login lockouts and TOTP exceptions trust the client IP: only take it from known proxies
+	ipExtractor, err := ClientIPExtractor(viper.GetStringSlice("server.trusted_proxies"))
+	if err != nil {
+		slog.Error("Invalid [server] trusted_proxies", "error", err)
+		os.Exit(1)
+	}
+	e.IPExtractor = ipExtractor
+
 	// Middleware
 	e.Use(echoMiddleware.RequestLogger())
 	e.Use(echoMiddleware.Recover())
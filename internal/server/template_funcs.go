@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"go-postfixadmin/internal/i18n"
+	"go-postfixadmin/internal/utils"
 )
 
 // templateFuncMap returns the custom template functions used across all templates.
@@ -18,8 +19,11 @@ func templateFuncMap() template.FuncMap {
 			return i18n.Translate(lang, messageID, templateData)
 		},
 		"version": func() string { return AppVersion },
-		"mul":     func(a, b float64) float64 { return a * b },
-		"div":     func(a, b float64) float64 { return a / b },
+		// Login lockout counters: kind ("username" or "ip") and portal of a login_failure scope
+		"loginScopeKind":   utils.LoginScopeKind,
+		"loginScopePortal": utils.LoginScopePortal,
+		"mul":              func(a, b float64) float64 { return a * b },
+		"div":              func(a, b float64) float64 { return a / b },
 		"float64": func(i any) float64 {
 			switch v := i.(type) {
 			case int:
@@ -0,0 +1,95 @@
+package socketmap
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache remembers lookup results. Entries younger than TTL are answered from memory; older
+// entries are looked up again, but still served for up to StaleTTL when the lookup fails,
+// so a database hiccup does not bounce mail. Misses are only kept for TTL: any address can be
+// looked up, so keeping them longer would let the cache grow without bound.
+type Cache struct {
+	TTL      time.Duration
+	StaleTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   string
+	found   bool
+	fetched time.Time
+	expired bool // set by Invalidate
+}
+
+// NewCache creates an empty cache
+func NewCache(ttl, staleTTL time.Duration) *Cache {
+	return &Cache{TTL: ttl, StaleTTL: staleTTL, entries: make(map[string]cacheEntry)}
+}
+
+// Get answers a lookup from the cache or through lookup
+func (c *Cache) Get(mapName, key string, lookup LookupFunc) (string, bool, error) {
+	cacheKey := mapName + " " + key
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, cached := c.entries[cacheKey]
+	c.mu.Unlock()
+	if cached && !entry.expired && now.Sub(entry.fetched) < c.TTL {
+		return entry.value, entry.found, nil
+	}
+
+	value, found, err := lookup(mapName, key)
+	if err != nil {
+		if cached && now.Sub(entry.fetched) < c.maxAge(entry) {
+			return entry.value, entry.found, nil
+		}
+		return "", false, err
+	}
+
+	if c.TTL > 0 {
+		c.mu.Lock()
+		c.entries[cacheKey] = cacheEntry{value: value, found: found, fetched: now}
+		c.mu.Unlock()
+	}
+	return value, found, nil
+}
+
+// maxAge returns how long an entry may be served while lookups fail
+func (c *Cache) maxAge(e cacheEntry) time.Duration {
+	if e.found {
+		return c.StaleTTL
+	}
+	return c.TTL
+}
+
+// Invalidate marks every entry as expired. Expired entries are still used as a fallback
+// while the database is unavailable.
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		e.expired = true
+		c.entries[k] = e
+	}
+}
+
+// Flush drops all entries
+func (c *Cache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cacheEntry)
+}
+
+// Prune drops entries too old to be served even as a fallback
+func (c *Cache) Prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if time.Since(e.fetched) >= c.maxAge(e) {
+			delete(c.entries, k)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Package socketmap implements the Postfix socketmap protocol (socketmap_table(5)) on top of
+// the lookups in utils.PostfixMapLookup, with a cache that keeps mail flowing while the
+// database is unavailable.
+package socketmap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/utils"
+)
+
+// maxRequestSize is the largest netstring accepted, as in Postfix
+const maxRequestSize = 100000
+
+// LookupFunc answers one lookup: the result, whether the key was found and a database error
+type LookupFunc func(mapName, key string) (string, bool, error)
+
+// Server answers socketmap requests
+type Server struct {
+	Lookup  LookupFunc
+	Cache   *Cache
+	Timeout time.Duration // idle time after which a client connection is closed
+}
+
+// ReadNetstring reads one "<length>:<data>," netstring
+func ReadNetstring(r *bufio.Reader) (string, error) {
+	lenStr, err := r.ReadString(':')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(lenStr, ":"))
+	if err != nil || n < 0 || n > maxRequestSize {
+		return "", fmt.Errorf("invalid netstring length %q", lenStr)
+	}
+	buf := make([]byte, n+1)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	if buf[n] != ',' {
+		return "", errors.New("netstring not terminated by ','")
+	}
+	return string(buf[:n]), nil
+}
+
+// FormatNetstring encodes data as a netstring
+func FormatNetstring(data string) string {
+	return strconv.Itoa(len(data)) + ":" + data + ","
+}
+
+// Answer builds the reply to a "<name> <key>" request
+func (s *Server) Answer(request string) string {
+	mapName, key, found := strings.Cut(request, " ")
+	if !found || mapName == "" || key == "" {
+		return "PERM invalid request"
+	}
+
+	value, ok, err := s.Cache.Get(mapName, strings.ToLower(key), s.Lookup)
+	switch {
+	case errors.Is(err, utils.ErrUnknownPostfixMap):
+		return "PERM " + err.Error()
+	case err != nil:
+		return "TEMP " + err.Error()
+	case !ok:
+		return "NOTFOUND "
+	}
+	return "OK " + value
+}
+
+// Serve accepts connections until the listener is closed
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle answers the requests of one connection; Postfix keeps connections open and
+// sends one request at a time
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		if s.Timeout > 0 {
+			conn.SetDeadline(time.Now().Add(s.Timeout))
+		}
+		request, err := ReadNetstring(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !isTimeout(err) {
+				slog.Warn("socketmap: bad request", "remote", conn.RemoteAddr(), "error", err)
+			}
+			return
+		}
+		if _, err := io.WriteString(conn, FormatNetstring(s.Answer(request))); err != nil {
+			return
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,92 @@
+package socketmap
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetstring(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader(FormatNetstring("alias user@example.com") + "3:abc,"))
+	for _, want := range []string{"alias user@example.com", "abc"} {
+		got, err := ReadNetstring(r)
+		if err != nil {
+			t.Fatalf("ReadNetstring() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("ReadNetstring() = %q, want %q", got, want)
+		}
+	}
+
+	for _, bad := range []string{"3:abcd", "x:abc,", "-1:,", "999999:abc,"} {
+		if _, err := ReadNetstring(bufio.NewReader(strings.NewReader(bad))); err == nil {
+			t.Errorf("ReadNetstring(%q) expected an error", bad)
+		}
+	}
+}
+
+func TestAnswer(t *testing.T) {
+	db := map[string]string{"alias info@example.com": "a@example.com,b@example.com"}
+	var dbDown bool
+	calls := 0
+	s := &Server{
+		Cache: NewCache(time.Minute, time.Hour),
+		Lookup: func(mapName, key string) (string, bool, error) {
+			calls++
+			if dbDown {
+				return "", false, errors.New("database is down")
+			}
+			v, ok := db[mapName+" "+key]
+			return v, ok, nil
+		},
+	}
+
+	if got := s.Answer("alias INFO@example.com"); got != "OK a@example.com,b@example.com" {
+		t.Errorf("Answer() = %q", got)
+	}
+	if got := s.Answer("alias nobody@example.com"); got != "NOTFOUND " {
+		t.Errorf("Answer() = %q, want NOTFOUND", got)
+	}
+	if got := s.Answer("garbage"); !strings.HasPrefix(got, "PERM") {
+		t.Errorf("Answer() = %q, want PERM", got)
+	}
+
+	// Cached: no new lookup
+	s.Answer("alias info@example.com")
+	if calls != 2 {
+		t.Errorf("lookups = %d, want 2", calls)
+	}
+
+	// Invalidated entries are looked up again but still served while the database is down
+	dbDown = true
+	s.Cache.Invalidate()
+	if got := s.Answer("alias info@example.com"); got != "OK a@example.com,b@example.com" {
+		t.Errorf("Answer() with database down = %q, want stale result", got)
+	}
+	if got := s.Answer("alias new@example.com"); !strings.HasPrefix(got, "TEMP") {
+		t.Errorf("Answer() uncached with database down = %q, want TEMP", got)
+	}
+}
+
+func TestCachePrunesMisses(t *testing.T) {
+	c := NewCache(time.Minute, time.Hour)
+	old := time.Now().Add(-2 * time.Minute)
+	c.entries["alias info@example.com"] = cacheEntry{value: "a@example.com", found: true, fetched: old}
+	c.entries["alias nobody@example.com"] = cacheEntry{fetched: old}
+
+	c.Prune()
+	if _, ok := c.entries["alias nobody@example.com"]; ok {
+		t.Error("a miss older than TTL must be pruned")
+	}
+	if _, ok := c.entries["alias info@example.com"]; !ok {
+		t.Error("a hit younger than StaleTTL must be kept as a fallback")
+	}
+
+	failing := func(string, string) (string, bool, error) { return "", false, errors.New("database is down") }
+	c.entries["alias nobody@example.com"] = cacheEntry{fetched: old}
+	if _, _, err := c.Get("alias", "nobody@example.com", failing); err == nil {
+		t.Error("an expired miss must not be served while the database is down")
+	}
+}
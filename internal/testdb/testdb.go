@@ -0,0 +1,71 @@
+// Package testdb opens an in-memory SQLite database with the application schema for tests
+package testdb
+
+import (
+	"testing"
+
+	"go-postfixadmin/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open returns a new empty database with every table of the models
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	db := Empty(t)
+
+	// Index names are global in SQLite: the "domain" indexes of mailbox and domain_admins
+	// would clash with the domain table, so they are dropped once created
+	for _, m := range []interface{}{&models.Mailbox{}, &models.DomainAdmin{}} {
+		if err := db.AutoMigrate(m); err != nil {
+			t.Fatalf("migrate test database: %v", err)
+		}
+		if err := db.Exec("DROP INDEX IF EXISTS domain").Error; err != nil {
+			t.Fatalf("migrate test database: %v", err)
+		}
+	}
+	err := db.AutoMigrate(
+		&models.Admin{},
+		&models.Alias{},
+		&models.AliasDomain{},
+		&models.APIToken{},
+		&models.Config{},
+		&models.DKIM{},
+		&models.DKIMSigning{},
+		&models.Domain{},
+		&models.Fetchmail{},
+		&models.Log{},
+		&models.LoginFailure{},
+		&models.MailboxAppPassword{},
+		&models.PasswordHistory{},
+		&models.Quota{},
+		&models.Quota2{},
+		&models.TOTPExceptionAddress{},
+		&models.TOTPRecoveryCode{},
+		&models.Vacation{},
+		&models.VacationNotification{},
+	)
+	if err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	return db
+}
+
+// Empty returns a new database without tables. It uses a single connection: each connection
+// to an in-memory SQLite database sees a database of its own.
+func Empty(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrMailboxAlias is returned when deleting the alias of a mailbox, which goes with the mailbox
+var ErrMailboxAlias = errors.New("cannot delete a mailbox alias, delete the mailbox instead")
+
+// NewAlias validates the address of a new alias against the domain and its alias limit, and
+// returns it active and without recipients. Set them with SetAliasGoto before CreateAlias.
+func NewAlias(db *gorm.DB, localPart, domain string) (models.Alias, error) {
+	localPart = strings.ToLower(strings.TrimSpace(localPart))
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	switch {
+	case domain == "":
+		return models.Alias{}, fieldError("domain", "Domain is required")
+	case localPart == "":
+		return models.Alias{}, fieldError("local_part", "Alias is required")
+	}
+
+	usage, err := loadDomainUsage(db, domain)
+	if err != nil {
+		return models.Alias{}, err
+	}
+	var count int64
+	address := localPart + "@" + domain
+	db.Model(&models.Alias{}).Where("address = ?", address).Count(&count)
+	if count > 0 {
+		return models.Alias{}, fieldError("local_part", "Alias already exists")
+	}
+	db.Model(&models.Mailbox{}).Where("username = ?", address).Count(&count)
+	if count > 0 {
+		return models.Alias{}, fieldError("local_part", "A mailbox with this address already exists")
+	}
+	if err := usage.take(false); err != nil {
+		return models.Alias{}, err
+	}
+
+	now := time.Now()
+	return models.Alias{
+		Address:  address,
+		Domain:   domain,
+		Created:  now,
+		Modified: now,
+		Active:   true,
+	}, nil
+}
+
+// SetAliasGoto sets the recipients of an alias from a list separated by newlines or commas
+func SetAliasGoto(a *models.Alias, recipients string) error {
+	list := ParseRecipients(recipients)
+	if len(list) == 0 {
+		return fieldError("goto", "At least one valid recipient is required")
+	}
+	a.Goto = strings.Join(list, ",")
+	return nil
+}
+
+// CreateAlias creates an alias returned by NewAlias, logging create_alias as username
+func CreateAlias(db *gorm.DB, a *models.Alias, username, ip string) error {
+	if a.Goto == "" {
+		return fieldError("goto", "At least one valid recipient is required")
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(a).Error; err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, a.Domain, "create_alias", a.Address)
+	})
+}
+
+// UpdateAlias saves the recipients and active flag of an alias, logging edit_alias as username
+func UpdateAlias(db *gorm.DB, a *models.Alias, username, ip string) error {
+	if a.Goto == "" {
+		return fieldError("goto", "At least one valid recipient is required")
+	}
+	a.Modified = time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(a).Error; err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, a.Domain, "edit_alias", a.Address)
+	})
+}
+
+// DeleteAlias removes an alias, logging delete_alias as username. The alias of a mailbox is
+// refused with ErrMailboxAlias.
+func DeleteAlias(db *gorm.DB, a models.Alias, username, ip string) error {
+	var count int64
+	db.Model(&models.Mailbox{}).Where("username = ?", a.Address).Count(&count)
+	if count > 0 {
+		return ErrMailboxAlias
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("address = ?", a.Address).Delete(&models.Alias{}).Error; err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, a.Domain, "delete_alias", a.Address)
+	})
+}
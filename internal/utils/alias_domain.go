@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ValidateAliasDomainTarget checks that the target of an alias domain exists and is not the
+// alias domain itself
+func ValidateAliasDomainTarget(db *gorm.DB, aliasDomain, target string) error {
+	switch {
+	case target == "":
+		return fieldError("target_domain", "Target Domain is required")
+	case target == aliasDomain:
+		return fieldError("target_domain", "Alias domain and target domain cannot be the same")
+	}
+	var count int64
+	db.Model(&models.Domain{}).Where("domain = ?", target).Count(&count)
+	if count == 0 {
+		return fieldError("target_domain", "Target Domain does not exist")
+	}
+	return nil
+}
+
+// CreateAliasDomain validates and creates an alias domain, logging create_alias_domain as
+// username under the target domain
+func CreateAliasDomain(db *gorm.DB, ad *models.AliasDomain, username, ip string) error {
+	ad.AliasDomain = strings.ToLower(strings.TrimSpace(ad.AliasDomain))
+	ad.TargetDomain = strings.ToLower(strings.TrimSpace(ad.TargetDomain))
+	switch {
+	case ad.AliasDomain == "":
+		return fieldError("alias_domain", "Alias Domain is required")
+	case !IsValidDomainName(ad.AliasDomain):
+		return fieldError("alias_domain", "Invalid domain format")
+	}
+	var count int64
+	db.Model(&models.AliasDomain{}).Where("alias_domain = ?", ad.AliasDomain).Count(&count)
+	if count > 0 {
+		return fieldError("alias_domain", "Alias Domain already exists")
+	}
+	if err := ValidateAliasDomainTarget(db, ad.AliasDomain, ad.TargetDomain); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ad.Created = now
+	ad.Modified = now
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(ad).Error; err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, ad.TargetDomain, "create_alias_domain", ad.AliasDomain)
+	})
+}
+
+// UpdateAliasDomain saves the target and active flag of an alias domain, logging
+// edit_alias_domain as username under the target domain
+func UpdateAliasDomain(db *gorm.DB, ad *models.AliasDomain, username, ip string) error {
+	ad.TargetDomain = strings.ToLower(strings.TrimSpace(ad.TargetDomain))
+	if err := ValidateAliasDomainTarget(db, ad.AliasDomain, ad.TargetDomain); err != nil {
+		return err
+	}
+	ad.Modified = time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(ad).Error; err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, ad.TargetDomain, "edit_alias_domain", ad.AliasDomain)
+	})
+}
+
+// DeleteAliasDomain removes an alias domain, logging delete_alias_domain as username under
+// the target domain
+func DeleteAliasDomain(db *gorm.DB, ad models.AliasDomain, username, ip string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("alias_domain = ?", ad.AliasDomain).Delete(&models.AliasDomain{}).Error; err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, ad.TargetDomain, "delete_alias_domain", ad.AliasDomain)
+	})
+}
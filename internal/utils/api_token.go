@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// APITokenPrefix marks tokens issued by this application so they are easy to spot in configs and logs
+const APITokenPrefix = "pfa_"
+
+// ErrInvalidAPIToken is returned when a bearer token is unknown or its admin is inactive
+var ErrInvalidAPIToken = errors.New("invalid API token")
+
+// GenerateAPIToken returns a new random token. The plaintext is shown to the user only once.
+func GenerateAPIToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return APITokenPrefix + hex.EncodeToString(buf), nil
+}
+
+// HashAPIToken returns the hex SHA-256 of a token, which is what the database stores
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APITokenDomains returns the domain scope of a token; nil means every domain of the owner
+func APITokenDomains(t models.APIToken) []string {
+	var domains []string
+	for _, d := range strings.Split(t.Domains, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// CreateAPIToken issues a token for the admin owner. domains must be a subset of the
+// owner's domains (empty for all of them). actor and ip identify who issued it in the log.
+func CreateAPIToken(db *gorm.DB, owner, name string, domains []string, readOnly bool, actor, ip string) (string, *models.APIToken, error) {
+	var admin models.Admin
+	if err := db.Where("username = ?", owner).First(&admin).Error; err != nil {
+		return "", nil, fmt.Errorf("admin %s not found", owner)
+	}
+	if !admin.Active {
+		return "", nil, fmt.Errorf("admin %s is not active", owner)
+	}
+
+	var scope []string
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" {
+			continue
+		}
+		allowed, err := CanManageDomain(db, owner, admin.Superadmin, d)
+		if err != nil {
+			return "", nil, err
+		}
+		if !allowed {
+			return "", nil, fmt.Errorf("admin %s cannot manage domain %s", owner, d)
+		}
+		scope = append(scope, d)
+	}
+
+	token, err := GenerateAPIToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	record := models.APIToken{
+		Username:  owner,
+		Name:      strings.TrimSpace(name),
+		TokenHash: HashAPIToken(token),
+		Prefix:    token[:len(APITokenPrefix)+8],
+		Domains:   strings.Join(scope, ","),
+		ReadOnly:  readOnly,
+		Created:   time.Now(),
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		return LogAction(tx, actor, ip, "ALL", "create_api_token", fmt.Sprintf("%s (%s)", record.Prefix, owner))
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &record, nil
+}
+
+// AuthenticateAPIToken resolves a bearer token to its record and active owner
+func AuthenticateAPIToken(db *gorm.DB, token string) (*models.APIToken, *models.Admin, error) {
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+
+	var record models.APIToken
+	if err := db.Where("token_hash = ?", HashAPIToken(token)).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIToken
+		}
+		return nil, nil, err
+	}
+
+	var admin models.Admin
+	if err := db.Where("username = ? AND active = ?", record.Username, true).First(&admin).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIToken
+		}
+		return nil, nil, err
+	}
+
+	return &record, &admin, nil
+}
+
+// ListAPITokens returns the tokens visible to the user: all of them for superadmins, otherwise their own
+func ListAPITokens(db *gorm.DB, username string, isSuperAdmin bool) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	query := db.Order("username ASC, created DESC")
+	if !isSuperAdmin {
+		query = query.Where("username = ?", username)
+	}
+	if err := query.Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken deletes a token. Non-superadmins may only revoke their own tokens.
+func RevokeAPIToken(db *gorm.DB, id int, username string, isSuperAdmin bool, ip string) error {
+	var record models.APIToken
+	if err := db.First(&record, id).Error; err != nil {
+		return fmt.Errorf("token %d not found", id)
+	}
+	if !isSuperAdmin && record.Username != username {
+		return fmt.Errorf("access denied")
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&record).Error; err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, "ALL", "revoke_api_token", fmt.Sprintf("%s (%s)", record.Prefix, record.Username))
+	})
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-postfixadmin/internal/models"
+)
+
+func TestGenerateAPIToken(t *testing.T) {
+	a, err := GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("GenerateAPIToken() error = %v", err)
+	}
+	b, _ := GenerateAPIToken()
+
+	if !strings.HasPrefix(a, APITokenPrefix) {
+		t.Errorf("GenerateAPIToken() = %q, want prefix %q", a, APITokenPrefix)
+	}
+	if len(a) != len(APITokenPrefix)+64 {
+		t.Errorf("GenerateAPIToken() length = %d, want %d", len(a), len(APITokenPrefix)+64)
+	}
+	if a == b {
+		t.Error("GenerateAPIToken() returned the same token twice")
+	}
+	if HashAPIToken(a) == HashAPIToken(b) || len(HashAPIToken(a)) != 64 {
+		t.Error("HashAPIToken() should return distinct 64-char hex digests")
+	}
+}
+
+func TestAPITokenDomains(t *testing.T) {
+	tests := []struct {
+		name    string
+		domains string
+		want    []string
+	}{
+		{name: "Unscoped", domains: "", want: nil},
+		{name: "Single", domains: "example.com", want: []string{"example.com"}},
+		{name: "Spaces and empty entries", domains: " a.com, ,b.com,", want: []string{"a.com", "b.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := APITokenDomains(models.APIToken{Domains: tt.domains})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("APITokenDomains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MaxAppPasswords limits how many app passwords a single mailbox may hold
+const MaxAppPasswords = 20
+
+// ErrAppPasswordNotFound is returned when an app password does not exist or belongs to another mailbox
+var ErrAppPasswordNotFound = errors.New("app password not found")
+
+// GenerateAppPassword returns a random password in four groups of four letters (e.g. "abcd-efgh-jkmn-pqrs"),
+// easy to type into a mail client on a phone
+func GenerateAppPassword() string {
+	const charset = "abcdefghjkmnpqrstuvwxyz"
+
+	groups := make([]string, 4)
+	for i := range groups {
+		b := make([]byte, 4)
+		for j := range b {
+			b[j] = charset[RandomInt(len(charset))]
+		}
+		groups[i] = string(b)
+	}
+	return strings.Join(groups, "-")
+}
+
+// CreateAppPassword generates an app password for the mailbox, stores its hash and returns the
+// plaintext, which is shown to the user only once
+func CreateAppPassword(db *gorm.DB, username, description, ip string) (string, *models.MailboxAppPassword, error) {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return "", nil, fmt.Errorf("description is required")
+	}
+
+	var count int64
+	if err := db.Model(&models.MailboxAppPassword{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		return "", nil, err
+	}
+	if count >= MaxAppPasswords {
+		return "", nil, fmt.Errorf("a mailbox can have at most %d app passwords", MaxAppPasswords)
+	}
+
+	plain := GenerateAppPassword()
+	hash, err := HashPassword(plain)
+	if err != nil {
+		return "", nil, err
+	}
+
+	record := models.MailboxAppPassword{
+		Username:     &username,
+		Description:  &description,
+		PasswordHash: &hash,
+		Created:      time.Now(),
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		_, domain := SplitEmail(username)
+		return LogAction(tx, username, ip, domain, "create_app_password", description)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return plain, &record, nil
+}
+
+// ListAppPasswords returns the app passwords of a mailbox, newest first
+func ListAppPasswords(db *gorm.DB, username string) ([]models.MailboxAppPassword, error) {
+	var passwords []models.MailboxAppPassword
+	err := db.Where("username = ?", username).Order("id DESC").Find(&passwords).Error
+	return passwords, err
+}
+
+// RevokeAppPassword deletes one of the mailbox's app passwords
+func RevokeAppPassword(db *gorm.DB, id int, username, ip string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var record models.MailboxAppPassword
+		if err := tx.Where("id = ? AND username = ?", id, username).First(&record).Error; err != nil {
+			return ErrAppPasswordNotFound
+		}
+		if err := tx.Delete(&record).Error; err != nil {
+			return err
+		}
+		description := ""
+		if record.Description != nil {
+			description = *record.Description
+		}
+		_, domain := SplitEmail(username)
+		return LogAction(tx, username, ip, domain, "revoke_app_password", description)
+	})
+}
+
+// CheckAppPassword reports whether plain matches one of the mailbox's app passwords and
+// records the time it was used
+func CheckAppPassword(db *gorm.DB, username, plain string) (bool, error) {
+	passwords, err := ListAppPasswords(db, username)
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range passwords {
+		if p.PasswordHash == nil {
+			continue
+		}
+		if match, _ := CheckPassword(plain, *p.PasswordHash); match {
+			now := time.Now()
+			db.Model(&models.MailboxAppPassword{}).Where("id = ?", p.ID).Update("last_used", &now)
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGenerateAppPassword(t *testing.T) {
+	re := regexp.MustCompile(`^[a-z]{4}-[a-z]{4}-[a-z]{4}-[a-z]{4}$`)
+
+	a := GenerateAppPassword()
+	if !re.MatchString(a) {
+		t.Errorf("GenerateAppPassword() = %q, want four dash-separated groups of four letters", a)
+	}
+	if a == GenerateAppPassword() {
+		t.Error("GenerateAppPassword() returned the same password twice")
+	}
+
+	hash, err := HashPassword(a)
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if ok, _ := CheckPassword(a, hash); !ok {
+		t.Error("CheckPassword() should accept a freshly hashed app password")
+	}
+}
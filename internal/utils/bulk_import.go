@@ -0,0 +1,373 @@
+package utils
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go-postfixadmin/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ImportRow is one record of a bulk import: a mailbox, optionally forwarding a copy of its
+// mail to Goto, or an alias forwarding to Goto
+type ImportRow struct {
+	Line     int        `json:"-"`
+	Type     string     `json:"type"` // "mailbox" (default) or "alias"
+	Address  string     `json:"address"`
+	Name     string     `json:"name"`
+	Password string     `json:"password"`
+	Quota    int64      `json:"quota"` // MB
+	Goto     recipients `json:"goto"`
+	Active   *bool      `json:"active"`
+}
+
+// recipients is a goto list, given in JSON as a string or an array of addresses
+type recipients string
+
+func (r *recipients) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*r = recipients(strings.Join(list, ","))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("goto must be a string or an array of addresses")
+	}
+	*r = recipients(s)
+	return nil
+}
+
+// importColumns are the columns a CSV import may have, in any order. Only address is required.
+var importColumns = []string{"type", "address", "name", "password", "quota", "goto", "active"}
+
+// ParseImportCSV reads import rows from CSV with a header line naming the columns
+func ParseImportCSV(r io.Reader) ([]ImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		known := false
+		for _, c := range importColumns {
+			known = known || c == h
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column %q, use %s", h, strings.Join(importColumns, ", "))
+		}
+		index[h] = i
+	}
+	if _, ok := index["address"]; !ok {
+		return nil, errors.New("the address column is required")
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := index[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := ImportRow{
+			Line:     line,
+			Type:     field("type"),
+			Address:  field("address"),
+			Name:     field("name"),
+			Password: field("password"),
+			Goto:     recipients(field("goto")),
+		}
+		if q := field("quota"); q != "" {
+			if row.Quota, err = strconv.ParseInt(q, 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid quota %q", line, q)
+			}
+		}
+		if a := field("active"); a != "" {
+			active, err := parseImportBool(a)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			row.Active = &active
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ParseImportJSON reads import rows from a JSON array of objects with the CSV column names
+func ParseImportJSON(r io.Reader) ([]ImportRow, error) {
+	var rows []ImportRow
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	for i := range rows {
+		rows[i].Line = i + 1
+	}
+	return rows, nil
+}
+
+func parseImportBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "1", "true", "yes", "y":
+		return true, nil
+	case "0", "false", "no", "n":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid active value %q, use true or false", s)
+}
+
+// ImportOptions controls a bulk import
+type ImportOptions struct {
+	DryRun            bool     // validate only, nothing is written
+	GeneratePasswords bool     // generate the password of mailboxes without one
+	BatchSize         int      // rows per transaction, 100 when zero
+	Domains           []string // domains the rows may belong to, nil for every domain
+}
+
+// ImportResult is the outcome of one import row
+type ImportResult struct {
+	Line     int
+	Type     string
+	Address  string
+	Error    string
+	Password string // generated password, empty when it was given
+	Imported bool
+}
+
+// ImportReport is the outcome of a bulk import
+type ImportReport struct {
+	Results   []ImportResult
+	Mailboxes int // valid mailbox rows
+	Aliases   int // valid alias rows
+	Failed    int // invalid rows
+	DryRun    bool
+}
+
+// WriteCredentials writes the generated passwords as CSV. They are not stored anywhere else.
+func (r *ImportReport) WriteCredentials(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"username", "password"}); err != nil {
+		return err
+	}
+	for _, res := range r.Results {
+		if res.Password != "" && res.Imported {
+			if err := cw.Write([]string{res.Address, res.Password}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// GeneratedPasswords reports whether the import generated any password
+func (r *ImportReport) GeneratedPasswords() bool {
+	for _, res := range r.Results {
+		if res.Password != "" && res.Imported {
+			return true
+		}
+	}
+	return false
+}
+
+// importEntry is a validated row ready to be created
+type importEntry struct {
+	result   *ImportResult
+	mailbox  *models.Mailbox
+	password string
+	forwards []string
+	alias    *models.Alias
+}
+
+// ImportAccounts validates import rows and creates their mailboxes and aliases through
+// CreateMailbox and CreateAlias, one transaction per batch, logging each as username. Nothing
+// is created when a row is invalid or with DryRun; the report lists the error of every row.
+func ImportAccounts(db *gorm.DB, rows []ImportRow, opts ImportOptions, username, ip string) (*ImportReport, error) {
+	report := &ImportReport{DryRun: opts.DryRun, Results: make([]ImportResult, len(rows))}
+	domains := map[string]*domainUsage{}
+	seen := map[string]bool{}
+	var entries []importEntry
+
+	for i, row := range rows {
+		res := &report.Results[i]
+		res.Line = row.Line
+		res.Type = strings.ToLower(strings.TrimSpace(row.Type))
+		if res.Type == "" {
+			res.Type = "mailbox"
+		}
+		res.Address = strings.ToLower(strings.TrimSpace(row.Address))
+
+		entry, err := prepareImportRow(db, row, res, opts, domains, seen)
+		if err != nil {
+			res.Error = err.Error()
+			report.Failed++
+			continue
+		}
+		if entry.mailbox != nil {
+			report.Mailboxes++
+		} else {
+			report.Aliases++
+		}
+		entries = append(entries, entry)
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+	if report.Failed > 0 {
+		return report, fmt.Errorf("%d of %d rows are invalid, nothing was imported", report.Failed, len(rows))
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	for start := 0; start < len(entries); start += batchSize {
+		batch := entries[start:min(start+batchSize, len(entries))]
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, e := range batch {
+				if err := createImportEntry(tx, e, username, ip); err != nil {
+					e.result.Error = err.Error()
+					return fmt.Errorf("line %d: %w", e.result.Line, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			report.Failed++
+			return report, fmt.Errorf("import stopped, rows from line %d on were not imported: %w", batch[0].result.Line, err)
+		}
+		for _, e := range batch {
+			e.result.Imported = true
+		}
+	}
+	return report, nil
+}
+
+// prepareImportRow validates a row against the database, the rows before it and the domain
+// limits, and returns what to create
+func prepareImportRow(db *gorm.DB, row ImportRow, res *ImportResult, opts ImportOptions, domains map[string]*domainUsage, seen map[string]bool) (importEntry, error) {
+	if res.Type != "mailbox" && res.Type != "alias" {
+		return importEntry{}, fieldError("type", fmt.Sprintf("Unknown type %q, use mailbox or alias", row.Type))
+	}
+	if res.Address == "" {
+		return importEntry{}, fieldError("address", "Address is required")
+	}
+	localPart, domain := SplitEmail(res.Address)
+	if opts.Domains != nil && !slices.Contains(opts.Domains, domain) {
+		return importEntry{}, fieldError("address", "Access denied to this domain")
+	}
+	if seen[res.Address] {
+		return importEntry{}, fieldError("address", "The address appears more than once in the import")
+	}
+
+	entry := importEntry{result: res}
+	if res.Type == "mailbox" {
+		m, err := NewMailbox(db, localPart, domain)
+		if err != nil {
+			return importEntry{}, err
+		}
+		m.Name = strings.TrimSpace(row.Name)
+		m.Quota = row.Quota * GetQuotaMultiplier()
+		if row.Active != nil {
+			m.Active = *row.Active
+		}
+		if err := ValidateMailbox(m); err != nil {
+			return importEntry{}, err
+		}
+
+		password := row.Password
+		if password == "" {
+			if !opts.GeneratePasswords {
+				return importEntry{}, fieldError("password", "Password is required")
+			}
+			password = GenerateComplexPassword()
+			res.Password = password
+		}
+		if err := ValidatePassword(db, TOTPKindMailbox, m.Username, password); err != nil {
+			return importEntry{}, err
+		}
+		entry.mailbox = &m
+		entry.password = password
+		entry.forwards = ParseRecipients(string(row.Goto))
+	} else {
+		a, err := NewAlias(db, localPart, domain)
+		if err != nil {
+			return importEntry{}, err
+		}
+		if err := SetAliasGoto(&a, string(row.Goto)); err != nil {
+			return importEntry{}, err
+		}
+		if row.Active != nil {
+			a.Active = *row.Active
+		}
+		entry.alias = &a
+	}
+
+	// NewMailbox and NewAlias check the limits against the database; the rows before this one
+	// count as well
+	d, ok := domains[domain]
+	if !ok {
+		var err error
+		if d, err = loadDomainUsage(db, domain); err != nil {
+			return importEntry{}, err
+		}
+		domains[domain] = d
+	}
+	if err := d.take(entry.mailbox != nil); err != nil {
+		return importEntry{}, err
+	}
+	seen[res.Address] = true
+	return entry, nil
+}
+
+// createImportEntry creates a validated row in tx
+func createImportEntry(tx *gorm.DB, e importEntry, username, ip string) error {
+	if e.alias != nil {
+		return CreateAlias(tx, e.alias, username, ip)
+	}
+	m := e.mailbox
+	if err := SetMailboxPassword(tx, m, e.password); err != nil {
+		return err
+	}
+	if err := CreateMailbox(tx, m, username, ip); err != nil {
+		return err
+	}
+	if len(e.forwards) == 0 {
+		return nil
+	}
+	// Forward a copy, keeping the mail in the mailbox as well
+	var alias models.Alias
+	if err := tx.Where("address = ?", m.Username).First(&alias).Error; err != nil {
+		return err
+	}
+	if err := SetAliasGoto(&alias, strings.Join(append([]string{m.Username}, e.forwards...), ",")); err != nil {
+		return err
+	}
+	return UpdateAlias(tx, &alias, username, ip)
+}
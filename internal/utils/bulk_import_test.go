@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseImportCSV(t *testing.T) {
+	input := "\ufeffAddress,Type,Name,Quota,Goto,Active\n" +
+		"john@example.com,,John Doe,1024,,\n" +
+		"sales@example.com,alias,,,\"john@example.com,jane@example.com\",false\n"
+	rows, err := ParseImportCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	if rows[0].Line != 2 || rows[0].Address != "john@example.com" || rows[0].Name != "John Doe" || rows[0].Quota != 1024 || rows[0].Active != nil {
+		t.Errorf("unexpected first row %+v", rows[0])
+	}
+	if rows[1].Type != "alias" || rows[1].Goto != "john@example.com,jane@example.com" || rows[1].Active == nil || *rows[1].Active {
+		t.Errorf("unexpected second row %+v", rows[1])
+	}
+
+	for _, bad := range []string{
+		"",
+		"name,password\nJohn,secret\n",
+		"address,mailbox\njohn@example.com,x\n",
+		"address,quota\njohn@example.com,lots\n",
+		"address,active\njohn@example.com,maybe\n",
+	} {
+		if _, err := ParseImportCSV(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestParseImportJSON(t *testing.T) {
+	input := `[
+		{"address": "john@example.com", "password": "secret", "goto": ["john@example.net"]},
+		{"type": "alias", "address": "sales@example.com", "goto": "john@example.com", "active": true}
+	]`
+	rows, err := ParseImportJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Line != 1 || rows[1].Line != 2 {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+	if rows[0].Goto != "john@example.net" || rows[1].Goto != "john@example.com" {
+		t.Errorf("unexpected goto %q and %q", rows[0].Goto, rows[1].Goto)
+	}
+	if _, err := ParseImportJSON(strings.NewReader(`[{"address": "a@example.com", "goto": 5}]`)); err == nil {
+		t.Error("expected an error for a numeric goto")
+	}
+}
+
+func TestImportReportCredentials(t *testing.T) {
+	r := ImportReport{Results: []ImportResult{
+		{Address: "john@example.com", Password: "Gen3rated!", Imported: true},
+		{Address: "jane@example.com", Imported: true},
+		{Address: "dry@example.com", Password: "N0tCreated!"},
+	}}
+	if !r.GeneratedPasswords() {
+		t.Error("expected generated passwords")
+	}
+	var buf bytes.Buffer
+	if err := r.WriteCredentials(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := "username,password\njohn@example.com,Gen3rated!\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
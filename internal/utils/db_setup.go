@@ -16,6 +16,19 @@ func ConnectDB(dsn string, driver string) (*gorm.DB, error) {
 	var db *gorm.DB
 	var err error
 
+	dsn, driver = ResolveDSN(dsn, driver)
+
+	if driver == "postgres" {
+		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	} else {
+		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	}
+
+	return db, err
+}
+
+// ResolveDSN fills an empty DSN and driver from the config, then DB_URL/DB_DRIVER, then the defaults
+func ResolveDSN(dsn string, driver string) (string, string) {
 	if dsn == "" {
 		dsn = viper.GetString("database.url")
 		if dsn == "" {
@@ -33,14 +46,11 @@ func ConnectDB(dsn string, driver string) (*gorm.DB, error) {
 			driver = os.Getenv("DB_DRIVER")
 		}
 	}
-
-	if driver == "postgres" {
-		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	} else {
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if driver != "postgres" {
+		driver = "mysql"
 	}
 
-	return db, err
+	return dsn, driver
 }
 
 // MigrateDB migrates the database schema using GORM AutoMigrate
@@ -49,6 +59,7 @@ func MigrateDB(db *gorm.DB) error {
 		&models.Admin{},
 		&models.Alias{},
 		&models.AliasDomain{},
+		&models.APIToken{},
 		&models.Config{},
 		&models.DKIM{},
 		&models.DKIMSigning{},
@@ -56,11 +67,14 @@ func MigrateDB(db *gorm.DB) error {
 		&models.DomainAdmin{},
 		&models.Fetchmail{},
 		&models.Log{},
+		&models.LoginFailure{},
 		&models.Mailbox{},
 		&models.MailboxAppPassword{},
+		&models.PasswordHistory{},
 		&models.Quota{},
 		&models.Quota2{},
 		&models.TOTPExceptionAddress{},
+		&models.TOTPRecoveryCode{},
 		&models.Vacation{},
 		&models.VacationNotification{},
 	)
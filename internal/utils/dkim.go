@@ -0,0 +1,342 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// DKIM key types
+const (
+	DKIMKeyRSA     = "rsa"
+	DKIMKeyEd25519 = "ed25519"
+)
+
+// dkimRSABits is the size of generated RSA keys
+const dkimRSABits = 2048
+
+// DKIM key states, see DKIMKeyStatus
+const (
+	DKIMStatusActive   = "active"
+	DKIMStatusRetiring = "retiring"
+	DKIMStatusExpired  = "expired"
+)
+
+// Export formats of ExportDKIM
+const (
+	DKIMExportOpenDKIM = "opendkim"
+	DKIMExportRspamd   = "rspamd"
+)
+
+var selectorRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// ErrDKIMKeyType is returned for a key type other than rsa or ed25519
+var ErrDKIMKeyType = errors.New("key type must be rsa or ed25519")
+
+// IsValidDKIMSelector checks that a selector is a single DNS label
+func IsValidDKIMSelector(selector string) bool {
+	return selectorRegex.MatchString(selector)
+}
+
+// GenerateDKIMKey creates a key pair. The private key is PEM encoded (PKCS#1 for RSA, PKCS#8
+// for Ed25519); the public key is the base64 p= value of the DNS record.
+func GenerateDKIMKey(keyType string) (privateKey, publicKey string, err error) {
+	var block *pem.Block
+	switch keyType {
+	case DKIMKeyRSA:
+		key, err := rsa.GenerateKey(rand.Reader, dkimRSABits)
+		if err != nil {
+			return "", "", err
+		}
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return "", "", err
+		}
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		publicKey = base64.StdEncoding.EncodeToString(der)
+	case DKIMKeyEd25519:
+		// RFC 8463: the record carries the raw 32-byte key, not a SubjectPublicKeyInfo
+		public, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", "", err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return "", "", err
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		publicKey = base64.StdEncoding.EncodeToString(public)
+	default:
+		return "", "", ErrDKIMKeyType
+	}
+	return string(pem.EncodeToMemory(block)), publicKey, nil
+}
+
+// DKIMKeyType returns the key type of a key; rows created before the column existed are RSA
+func DKIMKeyType(k models.DKIM) string {
+	if k.KeyType == DKIMKeyEd25519 {
+		return DKIMKeyEd25519
+	}
+	return DKIMKeyRSA
+}
+
+// DKIMKeyStatus reports whether a key is in use, retiring after a rotation (still published so
+// signed messages in transit verify) or past its overlap period
+func DKIMKeyStatus(k models.DKIM, now time.Time) string {
+	switch {
+	case k.Expires == nil:
+		return DKIMStatusActive
+	case now.Before(*k.Expires):
+		return DKIMStatusRetiring
+	default:
+		return DKIMStatusExpired
+	}
+}
+
+// DKIMRecordName returns the DNS name the public key is published under
+func DKIMRecordName(k models.DKIM) string {
+	return k.Selector + "._domainkey." + k.DomainName
+}
+
+// DKIMRecord returns the TXT record value of a key
+func DKIMRecord(k models.DKIM) string {
+	var public string
+	if k.PublicKey != nil {
+		public = strings.Join(strings.Fields(*k.PublicKey), "")
+	}
+	return "v=DKIM1; k=" + DKIMKeyType(k) + "; p=" + public
+}
+
+// DKIMZoneRecord returns the record as a zone file line, the value split into strings of at
+// most 255 characters as required for TXT records
+func DKIMZoneRecord(k models.DKIM) string {
+	record := DKIMRecord(k)
+	var parts []string
+	for len(record) > 255 {
+		parts = append(parts, `"`+record[:255]+`"`)
+		record = record[255:]
+	}
+	parts = append(parts, `"`+record+`"`)
+	return DKIMRecordName(k) + ". IN TXT ( " + strings.Join(parts, " ") + " )"
+}
+
+// CreateDKIMKey generates a key for domain and stores it. The private key is returned so it
+// can be shown once.
+func CreateDKIMKey(db *gorm.DB, domain, selector, description, keyType string) (*models.DKIM, string, error) {
+	if !IsValidDKIMSelector(selector) {
+		return nil, "", fmt.Errorf("invalid selector %q", selector)
+	}
+	var count int64
+	if err := db.Model(&models.DKIM{}).Where("domain_name = ? AND selector = ?", domain, selector).Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if count > 0 {
+		return nil, "", fmt.Errorf("selector %s already exists for %s", selector, domain)
+	}
+
+	private, public, err := GenerateDKIMKey(keyType)
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	key := &models.DKIM{
+		DomainName: domain,
+		Selector:   selector,
+		KeyType:    keyType,
+		PrivateKey: &private,
+		PublicKey:  &public,
+		Created:    now,
+		Modified:   now,
+	}
+	if description != "" {
+		key.Description = &description
+	}
+	if err := db.Create(key).Error; err != nil {
+		return nil, "", err
+	}
+	return key, private, nil
+}
+
+// RotateDKIMKey replaces old with a new key under another selector. The signing table entries
+// move to the new key, and the old key is kept until the overlap has passed so its DNS record
+// can stay published meanwhile.
+func RotateDKIMKey(db *gorm.DB, old models.DKIM, selector, keyType string, overlap time.Duration) (*models.DKIM, string, error) {
+	var key *models.DKIM
+	var private string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		key, private, err = CreateDKIMKey(tx, old.DomainName, selector, stringOrEmpty(old.Description), keyType)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&models.DKIMSigning{}).Where("dkim_id = ?", old.ID).
+			Updates(map[string]interface{}{"dkim_id": key.ID, "modified": now}).Error; err != nil {
+			return err
+		}
+		expires := now.Add(overlap)
+		return tx.Model(&models.DKIM{}).Where("id = ?", old.ID).
+			Updates(map[string]interface{}{"expires": expires, "modified": now}).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return key, private, nil
+}
+
+// DeleteDKIMKey removes a key and its signing table entries
+func DeleteDKIMKey(db *gorm.DB, id int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("dkim_id = ?", id).Delete(&models.DKIMSigning{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.DKIM{}, id).Error
+	})
+}
+
+// DKIMSigningDomain returns the domain of a signing table author, which is an address or a
+// whole domain
+func DKIMSigningDomain(author string) string {
+	if _, domain := SplitEmail(author); domain != "" {
+		return domain
+	}
+	return author
+}
+
+// ExportDKIM writes the keys that are not expired and their signing table as a .tar.gz for
+// OpenDKIM (KeyTable, SigningTable and keys/<domain>/<selector>.private) or rspamd
+// (dkim_signing.conf and <domain>.<selector>.key). keyDir is where the key files are
+// installed, used for the paths in the tables.
+func ExportDKIM(w io.Writer, format string, keys []models.DKIM, signings []models.DKIMSigning, keyDir string, now time.Time) error {
+	byID := make(map[int]models.DKIM)
+	for _, k := range keys {
+		if DKIMKeyStatus(k, now) != DKIMStatusExpired && k.PrivateKey != nil {
+			byID[k.ID] = k
+		}
+	}
+	ids := make([]int, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	files := map[string]string{}
+	var names []string
+	addFile := func(name, content string) {
+		files[name] = content
+		names = append(names, name)
+	}
+
+	switch format {
+	case DKIMExportOpenDKIM:
+		var keyTable, signingTable strings.Builder
+		for _, id := range ids {
+			k := byID[id]
+			file := path.Join("keys", k.DomainName, k.Selector+".private")
+			fmt.Fprintf(&keyTable, "%s %s:%s:%s\n", DKIMRecordName(k), k.DomainName, k.Selector, path.Join(keyDir, k.DomainName, k.Selector+".private"))
+			addFile(file, *k.PrivateKey)
+		}
+		for _, s := range signings {
+			k, ok := byID[s.DKIMID]
+			if !ok {
+				continue
+			}
+			// refile patterns: a domain entry signs every author of the domain
+			pattern := s.Author
+			if !strings.Contains(pattern, "@") {
+				pattern = "*@" + pattern
+			}
+			fmt.Fprintf(&signingTable, "%s %s\n", pattern, DKIMRecordName(k))
+		}
+		addFile("KeyTable", keyTable.String())
+		addFile("SigningTable", signingTable.String())
+	case DKIMExportRspamd:
+		// rspamd signs with the keys of the author's domain, so single authors and keys of
+		// another domain cannot be mapped
+		selectors := map[string][]models.DKIM{}
+		var domains, skipped []string
+		for _, s := range signings {
+			k, ok := byID[s.DKIMID]
+			if !ok {
+				continue
+			}
+			if s.Author != k.DomainName {
+				skipped = append(skipped, s.Author+" "+DKIMRecordName(k))
+				continue
+			}
+			if _, ok := selectors[s.Author]; !ok {
+				domains = append(domains, s.Author)
+			}
+			selectors[s.Author] = append(selectors[s.Author], k)
+		}
+		sort.Strings(domains)
+
+		var conf strings.Builder
+		conf.WriteString("# Generated by Go-PostfixAdmin\n")
+		for _, author := range skipped {
+			fmt.Fprintf(&conf, "# not exported, rspamd only signs a domain with its own keys: %s\n", author)
+		}
+		conf.WriteString("domain {\n")
+		for _, domain := range domains {
+			fmt.Fprintf(&conf, "  %q {\n    selectors [\n", domain)
+			for _, k := range selectors[domain] {
+				fmt.Fprintf(&conf, "      { selector = %q; path = %q; }\n", k.Selector, path.Join(keyDir, k.DomainName+"."+k.Selector+".key"))
+			}
+			conf.WriteString("    ]\n  }\n")
+		}
+		conf.WriteString("}\n")
+		for _, id := range ids {
+			k := byID[id]
+			addFile(k.DomainName+"."+k.Selector+".key", *k.PrivateKey)
+		}
+		addFile("dkim_signing.conf", conf.String())
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		content := files[name]
+		mode := int64(0644)
+		if strings.HasSuffix(name, ".private") || strings.HasSuffix(name, ".key") {
+			mode = 0600
+		}
+		header := &tar.Header{Name: name, Mode: mode, Size: int64(len(content)), ModTime: now}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tw, content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// stringOrEmpty dereferences an optional column
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,324 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"github.com/spf13/viper"
+)
+
+// DNS check results, from best to worst
+const (
+	DNSStatusOK      = "ok"
+	DNSStatusWarning = "warning"
+	DNSStatusError   = "error"
+)
+
+// defaultDNSTimeout bounds the lookups of one domain
+const defaultDNSTimeout = 10 * time.Second
+
+// Resolver looks up the records of a DNS check. *net.Resolver implements it; tests point one
+// at a fake DNS server.
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DNSCheck is the outcome of checking one record
+type DNSCheck struct {
+	Name    string   // MX, SPF, DMARC, DKIM <selector>, MTA-STS or TLS-RPT
+	Record  string   // DNS name looked up
+	Status  string   // DNSStatusOK, DNSStatusWarning or DNSStatusError
+	Found   []string // records found
+	Message string   // what is missing or wrong, empty when OK
+}
+
+// DNSReport holds the checks of a domain
+type DNSReport struct {
+	Domain string
+	Checks []DNSCheck
+}
+
+// Status returns the worst status of the checks
+func (r DNSReport) Status() string {
+	status := DNSStatusOK
+	for _, c := range r.Checks {
+		if c.Status == DNSStatusError {
+			return DNSStatusError
+		}
+		if c.Status == DNSStatusWarning {
+			status = DNSStatusWarning
+		}
+	}
+	return status
+}
+
+// DNSChecker checks the mail records of domains against the configured mail hosts
+type DNSChecker struct {
+	Resolver   Resolver
+	MailHosts  []string // hosts the MX records should point to; not checked when empty
+	SPFInclude string   // SPF record of the mail hosts to include, e.g. "_spf.example.org"
+	Timeout    time.Duration
+}
+
+// NewDNSChecker returns a checker using the system resolver and the [dns] settings
+func NewDNSChecker() *DNSChecker {
+	timeout := viper.GetDuration("dns.timeout")
+	if timeout <= 0 {
+		timeout = defaultDNSTimeout
+	}
+	return &DNSChecker{
+		Resolver:   net.DefaultResolver,
+		MailHosts:  viper.GetStringSlice("dns.mail_hosts"),
+		SPFInclude: viper.GetString("dns.spf_include"),
+		Timeout:    timeout,
+	}
+}
+
+// Check resolves the MX, SPF, DMARC, MTA-STS and TLS-RPT records of domain and the DKIM
+// records of its keys that are not expired
+func (c *DNSChecker) Check(ctx context.Context, domain string, keys []models.DKIM) DNSReport {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultDNSTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	report := DNSReport{Domain: domain}
+	mx := c.checkMX(ctx, domain)
+	report.Checks = append(report.Checks, mx, c.checkSPF(ctx, domain, mx), c.checkDMARC(ctx, domain))
+	report.Checks = append(report.Checks, c.checkDKIM(ctx, domain, keys)...)
+	report.Checks = append(report.Checks,
+		c.checkTagged(ctx, "MTA-STS", "_mta-sts."+domain, "v=STSv1", "id"),
+		c.checkTagged(ctx, "TLS-RPT", "_smtp._tls."+domain, "v=TLSRPTv1", "rua"))
+	return report
+}
+
+func (c *DNSChecker) checkMX(ctx context.Context, domain string) DNSCheck {
+	check := DNSCheck{Name: "MX", Record: domain}
+	records, err := c.Resolver.LookupMX(ctx, domain+".")
+	if err != nil && !isNotFound(err) {
+		return lookupFailed(check, err)
+	}
+	if len(records) == 0 {
+		return failed(check, DNSStatusError, "no MX record")
+	}
+
+	var matched, other []string
+	for _, r := range records {
+		host := normalizeHost(r.Host)
+		check.Found = append(check.Found, fmt.Sprintf("%d %s", r.Pref, host))
+		if c.isMailHost(host) {
+			matched = append(matched, host)
+		} else {
+			other = append(other, host)
+		}
+	}
+	switch {
+	case len(c.MailHosts) == 0 || len(other) == 0:
+		check.Status = DNSStatusOK
+	case len(matched) == 0:
+		check.Status = DNSStatusError
+		check.Message = "MX does not point to the mail hosts " + strings.Join(c.MailHosts, ", ")
+	default:
+		check.Status = DNSStatusWarning
+		check.Message = "MX also points to " + strings.Join(other, ", ")
+	}
+	return check
+}
+
+func (c *DNSChecker) checkSPF(ctx context.Context, domain string, mx DNSCheck) DNSCheck {
+	check := DNSCheck{Name: "SPF", Record: domain}
+	records, err := c.lookupTagged(ctx, domain, "v=spf1")
+	if err != nil {
+		return lookupFailed(check, err)
+	}
+	check.Found = records
+	switch len(records) {
+	case 0:
+		return failed(check, DNSStatusError, "no SPF record")
+	case 1:
+	default:
+		return failed(check, DNSStatusError, "more than one SPF record")
+	}
+
+	terms := strings.Fields(strings.ToLower(records[0]))[1:]
+	var all string
+	authorized := false
+	for _, term := range terms {
+		switch {
+		case term == "all" || term == "+all" || term == "-all" || term == "~all" || term == "?all":
+			all = term
+		case strings.HasPrefix(term, "redirect="):
+			all = term
+			authorized = authorized || strings.TrimPrefix(term, "redirect=") == c.SPFInclude
+		case strings.HasPrefix(term, "include:"):
+			authorized = authorized || strings.TrimPrefix(term, "include:") == c.SPFInclude
+		case strings.HasPrefix(term, "a:"):
+			authorized = authorized || c.isMailHost(strings.TrimPrefix(term, "a:"))
+		case term == "mx" || term == "+mx":
+			// mx authorizes the mail hosts when the MX records point to them
+			authorized = authorized || mx.Status == DNSStatusOK || mx.Status == DNSStatusWarning
+		}
+	}
+
+	switch {
+	case all == "all" || all == "+all":
+		return failed(check, DNSStatusError, "SPF allows any sender ("+all+")")
+	case all == "":
+		return failed(check, DNSStatusWarning, "SPF does not end with -all or ~all")
+	case (len(c.MailHosts) > 0 || c.SPFInclude != "") && !authorized:
+		return failed(check, DNSStatusWarning, "SPF does not authorize the mail hosts")
+	case all == "?all":
+		return failed(check, DNSStatusWarning, "SPF is neutral (?all)")
+	}
+	check.Status = DNSStatusOK
+	return check
+}
+
+func (c *DNSChecker) checkDMARC(ctx context.Context, domain string) DNSCheck {
+	check := DNSCheck{Name: "DMARC", Record: "_dmarc." + domain}
+	records, err := c.lookupTagged(ctx, check.Record, "v=DMARC1")
+	if err != nil {
+		return lookupFailed(check, err)
+	}
+	check.Found = records
+	switch len(records) {
+	case 0:
+		return failed(check, DNSStatusError, "no DMARC record")
+	case 1:
+	default:
+		return failed(check, DNSStatusError, "more than one DMARC record")
+	}
+
+	policy, ok := recordTags(records[0])["p"]
+	switch {
+	case !ok:
+		return failed(check, DNSStatusError, "DMARC record has no policy (p=)")
+	case strings.EqualFold(policy, "none"):
+		return failed(check, DNSStatusWarning, "DMARC policy is none: failing mail is only reported")
+	}
+	check.Status = DNSStatusOK
+	return check
+}
+
+// checkDKIM checks that the public key of every key in use or retiring is published
+func (c *DNSChecker) checkDKIM(ctx context.Context, domain string, keys []models.DKIM) []DNSCheck {
+	var checks []DNSCheck
+	now := time.Now()
+	for _, k := range keys {
+		if k.DomainName != domain || DKIMKeyStatus(k, now) == DKIMStatusExpired {
+			continue
+		}
+		check := DNSCheck{Name: "DKIM " + k.Selector, Record: DKIMRecordName(k)}
+		records, err := c.Resolver.LookupTXT(ctx, check.Record+".")
+		if err != nil && !isNotFound(err) {
+			checks = append(checks, lookupFailed(check, err))
+			continue
+		}
+		check.Found = records
+
+		want := recordTags(DKIMRecord(k))["p"]
+		check.Status = DNSStatusError
+		check.Message = "no DKIM record"
+		for _, r := range records {
+			if p, ok := recordTags(r)["p"]; ok {
+				check.Message = "published key does not match the key of the selector"
+				if strings.Join(strings.Fields(p), "") == want {
+					check.Status, check.Message = DNSStatusOK, ""
+					break
+				}
+			}
+		}
+		checks = append(checks, check)
+	}
+	if len(checks) == 0 {
+		checks = append(checks, DNSCheck{Name: "DKIM", Record: "_domainkey." + domain, Status: DNSStatusWarning, Message: "no DKIM key for this domain"})
+	}
+	return checks
+}
+
+// checkTagged checks an optional policy record: a missing one is a warning
+func (c *DNSChecker) checkTagged(ctx context.Context, name, record, version, tag string) DNSCheck {
+	check := DNSCheck{Name: name, Record: record}
+	records, err := c.lookupTagged(ctx, record, version)
+	if err != nil {
+		return lookupFailed(check, err)
+	}
+	check.Found = records
+	switch {
+	case len(records) == 0:
+		return failed(check, DNSStatusWarning, "no "+name+" record")
+	case len(records) > 1:
+		return failed(check, DNSStatusError, "more than one "+name+" record")
+	}
+	if _, ok := recordTags(records[0])[tag]; !ok {
+		return failed(check, DNSStatusError, name+" record has no "+tag+"=")
+	}
+	check.Status = DNSStatusOK
+	return check
+}
+
+// lookupTagged returns the TXT records of name that start with the version tag
+func (c *DNSChecker) lookupTagged(ctx context.Context, name, version string) ([]string, error) {
+	records, err := c.Resolver.LookupTXT(ctx, name+".")
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	var matching []string
+	for _, r := range records {
+		fields := strings.FieldsFunc(r, func(c rune) bool { return c == ' ' || c == ';' })
+		if len(fields) > 0 && strings.EqualFold(fields[0], version) {
+			matching = append(matching, r)
+		}
+	}
+	return matching, nil
+}
+
+func (c *DNSChecker) isMailHost(host string) bool {
+	host = normalizeHost(host)
+	for _, h := range c.MailHosts {
+		if normalizeHost(h) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// recordTags parses the tag=value list of a DKIM, DMARC, MTA-STS or TLS-RPT record
+func recordTags(record string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(record, ";") {
+		if name, value, ok := strings.Cut(part, "="); ok {
+			tags[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+	}
+	return tags
+}
+
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+func lookupFailed(check DNSCheck, err error) DNSCheck {
+	return failed(check, DNSStatusError, "lookup failed: "+err.Error())
+}
+
+func failed(check DNSCheck, status, message string) DNSCheck {
+	check.Status = status
+	check.Message = message
+	return check
+}
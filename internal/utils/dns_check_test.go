@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"go-postfixadmin/internal/models"
+)
+
+const (
+	dnsTypeMX  = 15
+	dnsTypeTXT = 16
+)
+
+// fakeDNS answers MX and TXT queries over UDP from a zone keyed by lower-case name. Names
+// absent from the zone get NXDOMAIN.
+type fakeDNS struct {
+	mx  map[string][]net.MX
+	txt map[string][]string
+}
+
+// resolver returns a Go resolver that sends every query to a fake server for zone
+func (z *fakeDNS) resolver(t *testing.T) *net.Resolver {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if reply := z.answer(buf[:n]); reply != nil {
+				conn.WriteTo(reply, addr)
+			}
+		}
+	}()
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+}
+
+// answer builds the response to a query with a single question
+func (z *fakeDNS) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	var labels []string
+	i := 12
+	for i < len(query) && query[i] != 0 {
+		n := int(query[i])
+		labels = append(labels, string(query[i+1:i+1+n]))
+		i += 1 + n
+	}
+	qtype := binary.BigEndian.Uint16(query[i+1:])
+	question := query[12 : i+5]
+	name := strings.ToLower(strings.Join(labels, "."))
+
+	var answers [][]byte
+	_, hasMX := z.mx[name]
+	_, hasTXT := z.txt[name]
+	switch qtype {
+	case dnsTypeMX:
+		for _, mx := range z.mx[name] {
+			data := binary.BigEndian.AppendUint16(nil, mx.Pref)
+			answers = append(answers, dnsRR(dnsTypeMX, append(data, dnsName(mx.Host)...)))
+		}
+	case dnsTypeTXT:
+		for _, txt := range z.txt[name] {
+			// Long records are sent as several strings, which the resolver joins
+			var data []byte
+			for len(txt) > 255 {
+				data = append(append(data, 255), txt[:255]...)
+				txt = txt[255:]
+			}
+			answers = append(answers, dnsRR(dnsTypeTXT, append(append(data, byte(len(txt))), txt...)))
+		}
+	}
+
+	flags := uint16(0x8180) // response, recursion desired and available
+	if !hasMX && !hasTXT {
+		flags |= 3 // NXDOMAIN
+	}
+	reply := binary.BigEndian.AppendUint16(nil, binary.BigEndian.Uint16(query))
+	reply = binary.BigEndian.AppendUint16(reply, flags)
+	reply = binary.BigEndian.AppendUint16(reply, 1)
+	reply = binary.BigEndian.AppendUint16(reply, uint16(len(answers)))
+	reply = append(reply, 0, 0, 0, 0)
+	reply = append(reply, question...)
+	for _, rr := range answers {
+		reply = append(reply, rr...)
+	}
+	return reply
+}
+
+// dnsRR encodes a resource record for the name of the question
+func dnsRR(rrType uint16, data []byte) []byte {
+	rr := []byte{0xc0, 12} // pointer to the question name
+	rr = binary.BigEndian.AppendUint16(rr, rrType)
+	rr = binary.BigEndian.AppendUint16(rr, 1) // IN
+	rr = binary.BigEndian.AppendUint32(rr, 300)
+	rr = binary.BigEndian.AppendUint16(rr, uint16(len(data)))
+	return append(rr, data...)
+}
+
+func dnsName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(append(b, byte(len(label))), label...)
+	}
+	return append(b, 0)
+}
+
+// checkStatuses returns the status and message of every check by name
+func checkStatuses(report DNSReport) map[string]DNSCheck {
+	checks := make(map[string]DNSCheck)
+	for _, c := range report.Checks {
+		checks[c.Name] = c
+	}
+	return checks
+}
+
+func TestDNSCheckHealthyDomain(t *testing.T) {
+	public := strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA", 9)
+	zone := &fakeDNS{
+		mx: map[string][]net.MX{"example.com": {{Host: "mail.example.org.", Pref: 10}}},
+		txt: map[string][]string{
+			"example.com":                      {"v=spf1 mx include:_spf.example.org -all", "google-site-verification=abc"},
+			"_dmarc.example.com":               {"v=DMARC1; p=reject; rua=mailto:dmarc@example.com"},
+			"s1._domainkey.example.com":        {"v=DKIM1; k=rsa; p=" + public},
+			"_mta-sts.example.com":             {"v=STSv1; id=20260101"},
+			"_smtp._tls.example.com":           {"v=TLSRPTv1; rua=mailto:tls@example.com"},
+			"unrelated._domainkey.example.com": {"v=DKIM1; p="},
+		},
+	}
+	checker := &DNSChecker{Resolver: zone.resolver(t), MailHosts: []string{"mail.example.org"}, SPFInclude: "_spf.example.org"}
+
+	keys := []models.DKIM{{DomainName: "example.com", Selector: "s1", PublicKey: &public}}
+	report := checker.Check(context.Background(), "example.com", keys)
+	for _, c := range report.Checks {
+		if c.Status != DNSStatusOK {
+			t.Errorf("%s = %s (%s), found %v", c.Name, c.Status, c.Message, c.Found)
+		}
+	}
+	if len(report.Checks) != 6 {
+		t.Errorf("got %d checks, want 6", len(report.Checks))
+	}
+	if report.Status() != DNSStatusOK {
+		t.Errorf("Status() = %s, want ok", report.Status())
+	}
+}
+
+func TestDNSCheckProblems(t *testing.T) {
+	public := "AAAA"
+	other := "BBBB"
+	zone := &fakeDNS{
+		mx: map[string][]net.MX{"example.net": {{Host: "mx.other-provider.net.", Pref: 10}}},
+		txt: map[string][]string{
+			"example.net":                {"v=spf1 +all"},
+			"_dmarc.example.net":         {"v=DMARC1; p=none"},
+			"new._domainkey.example.net": {"v=DKIM1; k=rsa; p=" + other},
+			"_mta-sts.example.net":       {"v=STSv1;"},
+		},
+	}
+	checker := &DNSChecker{Resolver: zone.resolver(t), MailHosts: []string{"mail.example.org"}}
+
+	keys := []models.DKIM{
+		{DomainName: "example.net", Selector: "new", PublicKey: &public},
+		{DomainName: "example.net", Selector: "missing", PublicKey: &public},
+	}
+	checks := checkStatuses(checker.Check(context.Background(), "example.net", keys))
+
+	want := map[string]string{
+		"MX":           DNSStatusError,
+		"SPF":          DNSStatusError,
+		"DMARC":        DNSStatusWarning,
+		"DKIM new":     DNSStatusError,
+		"DKIM missing": DNSStatusError,
+		"MTA-STS":      DNSStatusError,
+		"TLS-RPT":      DNSStatusWarning,
+	}
+	for name, status := range want {
+		if checks[name].Status != status {
+			t.Errorf("%s = %s (%s), want %s", name, checks[name].Status, checks[name].Message, status)
+		}
+	}
+	if msg := checks["DKIM new"].Message; !strings.Contains(msg, "does not match") {
+		t.Errorf("DKIM new message = %q", msg)
+	}
+}
+
+func TestDNSCheckMissingDomain(t *testing.T) {
+	checker := &DNSChecker{Resolver: (&fakeDNS{}).resolver(t)}
+	report := checker.Check(context.Background(), "nowhere.example", nil)
+
+	checks := checkStatuses(report)
+	for _, name := range []string{"MX", "SPF", "DMARC"} {
+		if checks[name].Status != DNSStatusError {
+			t.Errorf("%s = %s, want error", name, checks[name].Status)
+		}
+		if strings.Contains(checks[name].Message, "lookup failed") {
+			t.Errorf("%s: NXDOMAIN reported as a lookup failure: %s", name, checks[name].Message)
+		}
+	}
+	if checks["DKIM"].Status != DNSStatusWarning {
+		t.Errorf("DKIM without keys = %s, want warning", checks["DKIM"].Status)
+	}
+	if report.Status() != DNSStatusError {
+		t.Errorf("Status() = %s, want error", report.Status())
+	}
+}
+
+func TestDNSCheckSPF(t *testing.T) {
+	tests := []struct {
+		name   string
+		record []string
+		want   string
+	}{
+		{"Include", []string{"v=spf1 include:_spf.example.org ~all"}, DNSStatusOK},
+		{"Host", []string{"v=spf1 a:mail.example.org -all"}, DNSStatusOK},
+		{"Redirect", []string{"v=spf1 redirect=_spf.example.org"}, DNSStatusOK},
+		{"Other hosts", []string{"v=spf1 include:_spf.google.com -all"}, DNSStatusWarning},
+		{"No all", []string{"v=spf1 include:_spf.example.org"}, DNSStatusWarning},
+		{"Neutral", []string{"v=spf1 include:_spf.example.org ?all"}, DNSStatusWarning},
+		{"Two records", []string{"v=spf1 -all", "v=spf1 mx -all"}, DNSStatusError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone := &fakeDNS{txt: map[string][]string{"example.com": tt.record}}
+			checker := &DNSChecker{Resolver: zone.resolver(t), MailHosts: []string{"mail.example.org"}, SPFInclude: "_spf.example.org"}
+			spf := checkStatuses(checker.Check(context.Background(), "example.com", nil))["SPF"]
+			if spf.Status != tt.want {
+				t.Errorf("SPF %v = %s (%s), want %s", tt.record, spf.Status, spf.Message, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,131 @@
 package utils
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"go-postfixadmin/internal/models"
 
 	"gorm.io/gorm"
 )
 
+// ValidateDomainLimits checks the limits of a domain: -1 disables, 0 is unlimited
+func ValidateDomainLimits(d models.Domain) error {
+	switch {
+	case d.Aliases < -1:
+		return fieldError("aliases", "Aliases must be -1 (disabled), 0 (unlimited) or a positive limit")
+	case d.Mailboxes < -1:
+		return fieldError("mailboxes", "Mailboxes must be -1 (disabled), 0 (unlimited) or a positive limit")
+	case d.Quota < -1:
+		return fieldError("quota", "Quota must be -1 (disabled), 0 (unlimited) or a positive value")
+	case d.PasswordExpiry != nil && *d.PasswordExpiry < 0:
+		return fieldError("password_expiry", "Password expiry must be zero or a positive number of days")
+	case d.SendLimit < 0:
+		return fieldError("send_limit", "Send limit must be 0 (unlimited) or a positive number of messages per hour")
+	}
+	return nil
+}
+
+// domainUsage is the mailbox and alias limits of a domain with its current counts
+type domainUsage struct {
+	maxMailboxes, maxAliases int
+	mailboxes, aliases       int64
+}
+
+// loadDomainUsage returns the limits and counts of a domain. The alias of a mailbox does not
+// count as an alias.
+func loadDomainUsage(db *gorm.DB, name string) (*domainUsage, error) {
+	var domain models.Domain
+	if err := db.Where("domain = ?", name).First(&domain).Error; err != nil {
+		return nil, fieldError("domain", "Domain does not exist")
+	}
+	d := &domainUsage{maxMailboxes: domain.Mailboxes, maxAliases: domain.Aliases}
+	if err := db.Model(&models.Mailbox{}).Where("domain = ?", name).Count(&d.mailboxes).Error; err != nil {
+		return nil, err
+	}
+	err := db.Model(&models.Alias{}).
+		Where("domain = ? AND address NOT IN (?)", name, db.Model(&models.Mailbox{}).Select("username").Where("domain = ?", name)).
+		Count(&d.aliases).Error
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// take counts one more mailbox or alias against the domain limit (-1 disabled, 0 unlimited)
+func (d *domainUsage) take(mailbox bool) error {
+	limit, count, what := d.maxAliases, &d.aliases, "aliases"
+	if mailbox {
+		limit, count, what = d.maxMailboxes, &d.mailboxes, "mailboxes"
+	}
+	switch {
+	case limit == -1:
+		return fieldError(what, fmt.Sprintf("The domain does not allow %s", what))
+	case limit > 0 && *count >= int64(limit):
+		return fieldError(what, fmt.Sprintf("The domain limit of %d %s is reached", limit, what))
+	}
+	*count++
+	return nil
+}
+
+// CreateDomain validates and creates a domain, logging create_domain as username
+func CreateDomain(db *gorm.DB, d *models.Domain, username, ip string) error {
+	d.Domain = strings.ToLower(strings.TrimSpace(d.Domain))
+	if d.Domain == "" {
+		return fieldError("domain", "Domain name is required")
+	}
+	if !IsValidDomainName(d.Domain) {
+		return fieldError("domain", "Invalid domain format. Please enter a valid domain name (e.g., example.com)")
+	}
+	if err := ValidateDomainLimits(*d); err != nil {
+		return err
+	}
+	var count int64
+	db.Model(&models.Domain{}).Where("domain = ?", d.Domain).Count(&count)
+	if count > 0 {
+		return fieldError("domain", "Domain already exists")
+	}
+
+	now := time.Now()
+	d.Created = now
+	d.Modified = now
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(d).Error; err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, d.Domain, "create_domain", d.Domain)
+	})
+}
+
+// UpdateDomain saves a domain, logging edit_domain as username. When the active flag changed
+// from wasActive, the mailboxes and aliases of the domain follow it.
+func UpdateDomain(db *gorm.DB, d *models.Domain, wasActive bool, username, ip string) error {
+	if err := ValidateDomainLimits(*d); err != nil {
+		return err
+	}
+	d.Modified = time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if d.Active != wasActive {
+			if err := tx.Model(&models.Mailbox{}).Where("domain = ?", d.Domain).Update("active", d.Active).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Alias{}).Where("domain = ?", d.Domain).Update("active", d.Active).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(d).Error; err != nil {
+			return err
+		}
+		if err := StartDomainPasswordExpiry(tx, d.Domain); err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, d.Domain, "edit_domain", d.Domain)
+	})
+}
+
 // DeleteDomain removes a domain and all associated data in a single transaction.
-// Deletes: alias_domains, aliases, mailboxes, domain_admins, fetchmail, vacation, and the domain itself.
+// Deletes: alias_domains, aliases, mailboxes, domain_admins, fetchmail, vacation, DKIM keys, and the domain itself.
 func DeleteDomain(db *gorm.DB, domainName, username, ip string) error {
 	return db.Transaction(func(tx *gorm.DB) error {
 		// Delete alias_domain records (source)
@@ -25,6 +143,11 @@ func DeleteDomain(db *gorm.DB, domainName, username, ip string) error {
 			return err
 		}
 
+		// Delete app passwords of the domain's mailboxes
+		if err := tx.Where("username LIKE ?", "%@"+domainName).Delete(&models.MailboxAppPassword{}).Error; err != nil {
+			return err
+		}
+
 		// Delete mailboxes
 		if err := tx.Where("domain = ?", domainName).Delete(&models.Mailbox{}).Error; err != nil {
 			return err
@@ -45,6 +168,15 @@ func DeleteDomain(db *gorm.DB, domainName, username, ip string) error {
 			return err
 		}
 
+		// Delete DKIM keys and their signing table entries
+		keys := tx.Model(&models.DKIM{}).Select("id").Where("domain_name = ?", domainName)
+		if err := tx.Where("dkim_id IN (?)", keys).Delete(&models.DKIMSigning{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("domain_name = ?", domainName).Delete(&models.DKIM{}).Error; err != nil {
+			return err
+		}
+
 		// Delete the domain itself
 		if err := tx.Where("domain = ?", domainName).Delete(&models.Domain{}).Error; err != nil {
 			return err
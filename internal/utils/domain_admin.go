@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// SetAdminDomains replaces the domains an admin manages: "ALL" for a superadmin, otherwise
+// the given domains
+func SetAdminDomains(tx *gorm.DB, admin string, superadmin bool, domains []string) error {
+	if err := tx.Where("username = ?", admin).Delete(&models.DomainAdmin{}).Error; err != nil {
+		return fmt.Errorf("failed to update domain permissions: %w", err)
+	}
+	if superadmin {
+		domains = []string{"ALL"}
+	}
+	for _, d := range domains {
+		da := models.DomainAdmin{
+			Username: admin,
+			Domain:   d,
+			Created:  time.Now(),
+			Active:   true,
+		}
+		if err := tx.Create(&da).Error; err != nil {
+			return fmt.Errorf("failed to assign domain %s: %w", d, err)
+		}
+	}
+	return nil
+}
+
+// GrantDomainAdmin lets an admin manage one more domain, logging edit_admin as username
+func GrantDomainAdmin(db *gorm.DB, admin, domain, username, ip string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	var a models.Admin
+	if err := db.Where("username = ?", admin).First(&a).Error; err != nil {
+		return fieldError("username", "Administrator not found")
+	}
+	if a.Superadmin {
+		return fieldError("username", "Superadmins already manage every domain")
+	}
+	var count int64
+	db.Model(&models.Domain{}).Where("domain = ? AND domain != ?", domain, "ALL").Count(&count)
+	if count == 0 {
+		return fieldError("domain", "Domain does not exist")
+	}
+	db.Model(&models.DomainAdmin{}).Where("username = ? AND domain = ?", admin, domain).Count(&count)
+	if count > 0 {
+		return fieldError("domain", "Administrator already manages this domain")
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		da := models.DomainAdmin{
+			Username: admin,
+			Domain:   domain,
+			Created:  time.Now(),
+			Active:   true,
+		}
+		if err := tx.Create(&da).Error; err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, "ALL", "edit_admin", admin)
+	})
+}
+
+// RevokeDomainAdmin stops an admin from managing a domain, logging edit_admin as username
+func RevokeDomainAdmin(db *gorm.DB, admin, domain, username, ip string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "ALL" {
+		return fieldError("domain", "Remove the superadmin flag of the administrator instead")
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("username = ? AND domain = ?", admin, domain).Delete(&models.DomainAdmin{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fieldError("domain", "Administrator does not manage this domain")
+		}
+		return LogAction(tx, username, ip, "ALL", "edit_admin", admin)
+	})
+}
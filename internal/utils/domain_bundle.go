@@ -0,0 +1,463 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"go.yaml.in/yaml/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// DomainBundleVersion is the format version of exported domain bundles
+const DomainBundleVersion = 1
+
+// DomainBundle holds a domain with every row that belongs to it, to move the domain to another
+// instance. Rows keep the field names of the models. It contains password hashes, TOTP
+// secrets, encrypted fetchmail passwords and DKIM private keys.
+type DomainBundle struct {
+	Version      int
+	Exported     time.Time
+	Domain       models.Domain
+	Mailboxes    []models.Mailbox
+	Aliases      []models.Alias
+	AliasDomains []models.AliasDomain
+	DomainAdmins []models.DomainAdmin
+	Vacations    []models.Vacation
+	Fetchmail    []models.Fetchmail
+	DKIM         []models.DKIM
+	DKIMSigning  []models.DKIMSigning
+}
+
+// ExportDomainBundle collects a domain and its mailboxes, aliases, alias domains (pointing to
+// or from it), domain admins, vacations, fetchmail entries and DKIM keys with their signing
+// entries
+func ExportDomainBundle(db *gorm.DB, domain string) (*DomainBundle, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	b := &DomainBundle{Version: DomainBundleVersion, Exported: time.Now().UTC()}
+	if err := db.Where("domain = ? AND domain != ?", domain, "ALL").First(&b.Domain).Error; err != nil {
+		return nil, fmt.Errorf("domain %s not found", domain)
+	}
+
+	queries := []struct {
+		dest  interface{}
+		where string
+		args  []interface{}
+		order string
+	}{
+		{&b.Mailboxes, "domain = ?", []interface{}{domain}, "username"},
+		{&b.Aliases, "domain = ?", []interface{}{domain}, "address"},
+		{&b.AliasDomains, "alias_domain = ? OR target_domain = ?", []interface{}{domain, domain}, "alias_domain"},
+		{&b.DomainAdmins, "domain = ?", []interface{}{domain}, "username"},
+		{&b.Vacations, "domain = ?", []interface{}{domain}, "email"},
+		{&b.Fetchmail, "mailbox LIKE ?", []interface{}{"%@" + domain}, "id"},
+		{&b.DKIM, "domain_name = ?", []interface{}{domain}, "id"},
+	}
+	for _, q := range queries {
+		if err := db.Where(q.where, q.args...).Order(q.order).Find(q.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if len(b.DKIM) > 0 {
+		ids := make([]int, len(b.DKIM))
+		for i, k := range b.DKIM {
+			ids[i] = k.ID
+		}
+		if err := db.Where("dkim_id IN ?", ids).Order("id").Find(&b.DKIMSigning).Error; err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Write encodes the bundle as JSON or YAML
+func (b *DomainBundle) Write(w io.Writer, format string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "", "json":
+		data = append(data, '\n')
+		_, err = w.Write(data)
+		return err
+	case "yaml":
+		// JSON is YAML: convert the document so that both formats share the field names
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		blockStyle(&doc)
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(&doc); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	return fmt.Errorf("unknown bundle format %q, use json or yaml", format)
+}
+
+// blockStyle drops the flow and quoting styles of a node parsed from JSON. Strings that would
+// read as another type are still quoted by the encoder.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// ReadDomainBundle decodes a bundle written by Write
+func ReadDomainBundle(r io.Reader, format string) (*DomainBundle, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "", "json":
+	case "yaml":
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown bundle format %q, use json or yaml", format)
+	}
+
+	var b DomainBundle
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&b); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if b.Version < 1 || b.Version > DomainBundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	return &b, nil
+}
+
+// Validate checks that every row of the bundle belongs to its domain, so that importing it
+// cannot change other domains
+func (b *DomainBundle) Validate() error {
+	d := b.Domain.Domain
+	if !IsValidDomainName(d) {
+		return fmt.Errorf("invalid domain %q", d)
+	}
+	for _, m := range b.Mailboxes {
+		if m.Domain != d || !strings.HasSuffix(m.Username, "@"+d) {
+			return fmt.Errorf("mailbox %s does not belong to %s", m.Username, d)
+		}
+	}
+	for _, a := range b.Aliases {
+		if a.Domain != d || !strings.HasSuffix(a.Address, "@"+d) {
+			return fmt.Errorf("alias %s does not belong to %s", a.Address, d)
+		}
+	}
+	for _, ad := range b.AliasDomains {
+		if ad.AliasDomain != d && ad.TargetDomain != d {
+			return fmt.Errorf("alias domain %s does not belong to %s", ad.AliasDomain, d)
+		}
+	}
+	for _, da := range b.DomainAdmins {
+		if da.Domain != d {
+			return fmt.Errorf("domain admin %s of %s does not belong to %s", da.Username, da.Domain, d)
+		}
+	}
+	for _, v := range b.Vacations {
+		if v.Domain != d || !strings.HasSuffix(v.Email, "@"+d) {
+			return fmt.Errorf("vacation of %s does not belong to %s", v.Email, d)
+		}
+	}
+	for _, f := range b.Fetchmail {
+		if !strings.HasSuffix(f.Mailbox, "@"+d) {
+			return fmt.Errorf("fetchmail entry of %s does not belong to %s", f.Mailbox, d)
+		}
+	}
+	dkimIDs := map[int]bool{}
+	for _, k := range b.DKIM {
+		if k.DomainName != d {
+			return fmt.Errorf("DKIM key %s of %s does not belong to %s", k.Selector, k.DomainName, d)
+		}
+		dkimIDs[k.ID] = true
+	}
+	for _, s := range b.DKIMSigning {
+		if !dkimIDs[s.DKIMID] {
+			return fmt.Errorf("DKIM signing entry %s refers to a key that is not in the bundle", s.Author)
+		}
+	}
+	return nil
+}
+
+// How ImportDomainBundle handles rows that already exist
+const (
+	ConflictSkip      = "skip"      // keep the existing row
+	ConflictOverwrite = "overwrite" // replace the existing row
+	ConflictFail      = "fail"      // import nothing
+)
+
+// BundleTableReport counts what an import did with the rows of one table
+type BundleTableReport struct {
+	Table   string
+	Created int
+	Updated int
+	Skipped int
+}
+
+// BundleImportReport is the outcome of ImportDomainBundle
+type BundleImportReport struct {
+	Tables    []*BundleTableReport
+	Conflicts []string // rows that already existed
+	Warnings  []string // rows that could not be imported
+	DryRun    bool
+}
+
+func (r *BundleImportReport) table(name string) *BundleTableReport {
+	for _, t := range r.Tables {
+		if t.Table == name {
+			return t
+		}
+	}
+	t := &BundleTableReport{Table: name}
+	r.Tables = append(r.Tables, t)
+	return t
+}
+
+func (r *BundleImportReport) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// createRow creates row keeping its false flags. Create replaces zero values by the column
+// default, which would e.g. turn an inactive mailbox into an active one.
+func createRow[T any](tx *gorm.DB, row *T) error {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(row); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	rv := reflect.ValueOf(row).Elem()
+	var zero []*schema.Field
+	for _, f := range stmt.Schema.Fields {
+		if _, isZero := f.ValueOf(ctx, rv); isZero && f.DBName != "" && f.FieldType.Kind() == reflect.Bool && f.DefaultValueInterface != nil {
+			zero = append(zero, f)
+		}
+	}
+
+	if err := tx.Create(row).Error; err != nil {
+		return err
+	}
+	if len(zero) == 0 {
+		return nil
+	}
+	columns := make([]string, len(zero))
+	for i, f := range zero {
+		if err := f.Set(ctx, rv, reflect.Zero(f.FieldType).Interface()); err != nil {
+			return err
+		}
+		columns[i] = f.DBName
+	}
+	return tx.Model(row).Select(columns).UpdateColumns(row).Error
+}
+
+// errBundleDryRun rolls back the transaction of a dry run
+var errBundleDryRun = errors.New("dry run")
+
+// bundleImport imports the rows of a bundle in one transaction
+type bundleImport struct {
+	tx         *gorm.DB
+	onConflict string
+	report     *BundleImportReport
+}
+
+// put creates row unless a row matching where exists, in which case the conflict policy
+// decides. keep copies the generated ID of the existing row before it is overwritten.
+func put[T any](im *bundleImport, table, key string, row *T, keep func(existing *T), where string, args ...interface{}) (*T, error) {
+	stats := im.report.table(table)
+	var existing T
+	err := im.tx.Where(where, args...).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err := createRow(im.tx, row); err != nil {
+			return nil, fmt.Errorf("failed to create %s %s: %w", table, key, err)
+		}
+		stats.Created++
+		return row, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	im.report.Conflicts = append(im.report.Conflicts, table+" "+key)
+	if im.onConflict != ConflictOverwrite {
+		stats.Skipped++
+		return &existing, nil
+	}
+	if keep != nil {
+		keep(&existing)
+	}
+	if err := im.tx.Save(row).Error; err != nil {
+		return nil, fmt.Errorf("failed to update %s %s: %w", table, key, err)
+	}
+	stats.Updated++
+	return row, nil
+}
+
+// ImportDomainBundle recreates the rows of a bundle in one transaction, logging import_domain
+// as username. Existing rows are kept, replaced or make the import fail as onConflict says;
+// a dry run reports what would happen and rolls everything back. Alias domains whose other
+// domain, and domain admins whose administrator, do not exist are skipped with a warning.
+func ImportDomainBundle(db *gorm.DB, b *DomainBundle, onConflict string, dryRun bool, username, ip string) (*BundleImportReport, error) {
+	switch onConflict {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return nil, fmt.Errorf("unknown conflict policy %q, use skip, overwrite or fail", onConflict)
+	}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+
+	report := &BundleImportReport{DryRun: dryRun}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		im := &bundleImport{tx: tx, onConflict: onConflict, report: report}
+		if err := im.run(b); err != nil {
+			return err
+		}
+		if onConflict == ConflictFail && len(report.Conflicts) > 0 {
+			return fmt.Errorf("%d rows already exist, nothing was imported", len(report.Conflicts))
+		}
+		if err := LogAction(tx, username, ip, b.Domain.Domain, "import_domain", b.Domain.Domain); err != nil {
+			return err
+		}
+		if dryRun {
+			return errBundleDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBundleDryRun) {
+		return report, err
+	}
+	return report, nil
+}
+
+func (im *bundleImport) run(b *DomainBundle) error {
+	d := b.Domain.Domain
+	domain := b.Domain
+	if _, err := put(im, "domain", d, &domain, nil, "domain = ?", d); err != nil {
+		return err
+	}
+
+	for i := range b.Mailboxes {
+		m := b.Mailboxes[i]
+		if _, err := put(im, "mailbox", m.Username, &m, nil, "username = ?", m.Username); err != nil {
+			return err
+		}
+	}
+	for i := range b.Aliases {
+		a := b.Aliases[i]
+		if _, err := put(im, "alias", a.Address, &a, nil, "address = ?", a.Address); err != nil {
+			return err
+		}
+	}
+
+	for i := range b.AliasDomains {
+		ad := b.AliasDomains[i]
+		other := ad.TargetDomain
+		if other == d {
+			other = ad.AliasDomain
+		}
+		var count int64
+		im.tx.Model(&models.Domain{}).Where("domain = ?", other).Count(&count)
+		if count == 0 {
+			im.report.table("alias_domain").Skipped++
+			im.report.warn("alias domain %s -> %s skipped: domain %s does not exist", ad.AliasDomain, ad.TargetDomain, other)
+			continue
+		}
+		if _, err := put(im, "alias_domain", ad.AliasDomain, &ad, nil, "alias_domain = ?", ad.AliasDomain); err != nil {
+			return err
+		}
+	}
+
+	for i := range b.DomainAdmins {
+		da := b.DomainAdmins[i]
+		var count int64
+		im.tx.Model(&models.Admin{}).Where("username = ?", da.Username).Count(&count)
+		if count == 0 {
+			im.report.table("domain_admins").Skipped++
+			im.report.warn("domain admin %s skipped: the administrator does not exist", da.Username)
+			continue
+		}
+		da.ID = 0
+		keep := func(e *models.DomainAdmin) { da.ID = e.ID }
+		if _, err := put(im, "domain_admins", da.Username, &da, keep, "username = ? AND domain = ?", da.Username, d); err != nil {
+			return err
+		}
+	}
+
+	for i := range b.Vacations {
+		v := b.Vacations[i]
+		if _, err := put(im, "vacation", v.Email, &v, nil, "email = ?", v.Email); err != nil {
+			return err
+		}
+	}
+
+	for i := range b.Fetchmail {
+		f := b.Fetchmail[i]
+		key := fmt.Sprintf("%s (%s@%s)", f.Mailbox, f.SrcUser, f.SrcServer)
+		if IsEncryptedSecret(f.SrcPassword) {
+			if _, err := DecryptSecret(f.SrcPassword); err != nil {
+				im.report.warn("fetchmail entry %s@%s for %s: the source password cannot be decrypted with the local encryption_key", f.SrcUser, f.SrcServer, f.Mailbox)
+			}
+		} else {
+			// Plain text passwords of older versions are not stored as they are
+			var err error
+			f.SrcPassword, err = EncryptSecret(f.SrcPassword)
+			if errors.Is(err, ErrNoSecretKey) {
+				im.report.warn("fetchmail entry %s skipped: [fetchmail] encryption_key is not set", key)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		f.ID = 0
+		keep := func(e *models.Fetchmail) { f.ID = e.ID }
+		if _, err := put(im, "fetchmail", key, &f, keep, "mailbox = ? AND src_server = ? AND src_user = ?", f.Mailbox, f.SrcServer, f.SrcUser); err != nil {
+			return err
+		}
+	}
+
+	// Keys get new IDs: signing entries follow them
+	dkimIDs := map[int]int{}
+	for i := range b.DKIM {
+		k := b.DKIM[i]
+		oldID := k.ID
+		k.ID = 0
+		keep := func(e *models.DKIM) { k.ID = e.ID }
+		saved, err := put(im, "dkim", k.Selector+"._domainkey."+d, &k, keep, "domain_name = ? AND selector = ?", d, k.Selector)
+		if err != nil {
+			return err
+		}
+		dkimIDs[oldID] = saved.ID
+	}
+	for i := range b.DKIMSigning {
+		s := b.DKIMSigning[i]
+		s.ID = 0
+		s.DKIMID = dkimIDs[s.DKIMID]
+		keep := func(e *models.DKIMSigning) { s.ID = e.ID }
+		if _, err := put(im, "dkim_signing", s.Author, &s, keep, "author = ? AND dkim_id = ?", s.Author, s.DKIMID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
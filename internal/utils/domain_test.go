@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/testdb"
+)
+
+func TestValidateDomainLimits(t *testing.T) {
+	days := -5
+	tests := []struct {
+		name   string
+		domain models.Domain
+		field  string
+	}{
+		{"defaults", models.Domain{Aliases: 10, Mailboxes: 10, Quota: 2048}, ""},
+		{"disabled", models.Domain{Aliases: -1, Mailboxes: -1, Quota: -1}, ""},
+		{"aliases", models.Domain{Aliases: -2}, "aliases"},
+		{"mailboxes", models.Domain{Mailboxes: -2}, "mailboxes"},
+		{"quota", models.Domain{Quota: -2}, "quota"},
+		{"password expiry", models.Domain{PasswordExpiry: &days}, "password_expiry"},
+		{"send limit", models.Domain{SendLimit: -1}, "send_limit"},
+	}
+	for _, tt := range tests {
+		err := ValidateDomainLimits(tt.domain)
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		var fe *FieldError
+		if !errors.As(err, &fe) || fe.Field != tt.field {
+			t.Errorf("%s: got %v, want an error on %q", tt.name, err, tt.field)
+		}
+	}
+}
+
+func TestSetAliasGoto(t *testing.T) {
+	var a models.Alias
+	if err := SetAliasGoto(&a, "john@example.com,\n jane@example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.Goto != "john@example.com,jane@example.com" {
+		t.Errorf("got goto %q", a.Goto)
+	}
+
+	var fe *FieldError
+	if err := SetAliasGoto(&a, " , "); !errors.As(err, &fe) || fe.Field != "goto" {
+		t.Errorf("empty recipients: got %v, want an error on goto", err)
+	}
+}
+
+func TestDomainUsageTake(t *testing.T) {
+	d := &domainUsage{maxMailboxes: 2, maxAliases: -1, mailboxes: 1}
+	if err := d.take(true); err != nil {
+		t.Fatalf("first mailbox: unexpected error %v", err)
+	}
+	if err := d.take(true); err == nil {
+		t.Error("expected the mailbox limit to be reached")
+	}
+	if err := d.take(false); err == nil {
+		t.Error("expected aliases to be disabled")
+	}
+
+	unlimited := &domainUsage{mailboxes: 5000, aliases: 5000}
+	if unlimited.take(true) != nil || unlimited.take(false) != nil {
+		t.Error("0 must not limit mailboxes or aliases")
+	}
+}
+
+func TestNewMailboxAndAliasDomainLimits(t *testing.T) {
+	db := testdb.Open(t)
+	now := time.Now()
+	db.Create(&models.Domain{Domain: "example.com", Mailboxes: 1, Aliases: 1, Active: true, Created: now, Modified: now})
+	db.Create(&models.Domain{Domain: "example.net", Mailboxes: -1, Aliases: -1, Active: true, Created: now, Modified: now})
+	db.Create(&models.Mailbox{Username: "john@example.com", LocalPart: "john", Domain: "example.com", Active: true, Created: now, Modified: now})
+	// The alias of a mailbox does not count against the alias limit
+	db.Create(&models.Alias{Address: "john@example.com", Goto: "john@example.com", Domain: "example.com", Active: true, Created: now, Modified: now})
+
+	var fe *FieldError
+	if _, err := NewMailbox(db, "jane", "example.com"); !errors.As(err, &fe) || fe.Field != "mailboxes" {
+		t.Errorf("NewMailbox() over the limit = %v, want an error on mailboxes", err)
+	}
+	if _, err := NewAlias(db, "sales", "example.com"); err != nil {
+		t.Errorf("NewAlias() within the limit: unexpected error %v", err)
+	}
+	db.Create(&models.Alias{Address: "sales@example.com", Goto: "john@example.com", Domain: "example.com", Active: true, Created: now, Modified: now})
+	if _, err := NewAlias(db, "info", "example.com"); !errors.As(err, &fe) || fe.Field != "aliases" {
+		t.Errorf("NewAlias() over the limit = %v, want an error on aliases", err)
+	}
+
+	if _, err := NewMailbox(db, "jane", "example.net"); !errors.As(err, &fe) || fe.Field != "mailboxes" {
+		t.Errorf("NewMailbox() in a domain without mailboxes = %v, want an error on mailboxes", err)
+	}
+	if _, err := NewAlias(db, "info", "example.net"); !errors.As(err, &fe) || fe.Field != "aliases" {
+		t.Errorf("NewAlias() in a domain without aliases = %v, want an error on aliases", err)
+	}
+}
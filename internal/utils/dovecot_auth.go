@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-postfixadmin/internal/models"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// ErrUnknownMailbox is returned when a login does not resolve to an active mailbox of an active domain
+var ErrUnknownMailbox = errors.New("unknown or inactive mailbox")
+
+// DovecotUser is the passdb/userdb data of a mailbox as served to Dovecot
+type DovecotUser struct {
+	User         string   `json:"user"`               // real mailbox address, also for alias-domain logins
+	Password     string   `json:"password,omitempty"` // stored hash with a Dovecot {SCHEME} prefix
+	Home         string   `json:"home"`
+	UID          int      `json:"uid"`
+	GID          int      `json:"gid"`
+	QuotaRule    string   `json:"quota_rule"`
+	Active       bool     `json:"active"`
+	SMTPActive   bool     `json:"smtp_active"`
+	AppPasswords []string `json:"app_passwords,omitempty"` // hashes with a Dovecot {SCHEME} prefix
+}
+
+// DovecotEnabled reports whether the Dovecot auth endpoints are turned on in [dovecot]
+func DovecotEnabled() bool {
+	return viper.GetBool("dovecot.enabled") && viper.GetString("dovecot.secret") != ""
+}
+
+// dovecotBaseDir returns the directory maildirs are relative to (default /var/vmail)
+func dovecotBaseDir() string {
+	if dir := viper.GetString("dovecot.base_dir"); dir != "" {
+		return strings.TrimRight(dir, "/")
+	}
+	return "/var/vmail"
+}
+
+// dovecotID returns a configured uid/gid, defaulting to the vmail user of SETUP_MAILSERVER.md
+func dovecotID(key string) int {
+	if id := viper.GetInt(key); id > 0 {
+		return id
+	}
+	return 1001
+}
+
+// ResolveMailboxLogin returns the active mailbox a login refers to. A login in an active alias
+// domain (user@alias.example) resolves to the mailbox of the target domain (user@example.com).
+// The mailbox domain must be active as well.
+func ResolveMailboxLogin(db *gorm.DB, login string) (models.Mailbox, error) {
+	var mailbox models.Mailbox
+	login = strings.ToLower(strings.TrimSpace(login))
+	localPart, domain := SplitEmail(login)
+	if localPart == "" || domain == "" {
+		return mailbox, ErrUnknownMailbox
+	}
+
+	candidates := []string{login}
+	var aliasDomain models.AliasDomain
+	if err := db.Where("alias_domain = ? AND active = ?", domain, true).First(&aliasDomain).Error; err == nil {
+		candidates = append(candidates, localPart+"@"+aliasDomain.TargetDomain)
+	}
+
+	for _, username := range candidates {
+		err := db.Joins("JOIN domain ON domain.domain = mailbox.domain").
+			Where("mailbox.username = ? AND mailbox.active = ? AND domain.active = ?", username, true, true).
+			Select("mailbox.*").
+			First(&mailbox).Error
+		if err == nil {
+			return mailbox, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return mailbox, err
+		}
+	}
+	return mailbox, ErrUnknownMailbox
+}
+
+// DovecotPasswordHash adds the Dovecot {SCHEME} prefix to a stored hash so Dovecot can verify
+// it whatever its default_pass_scheme. It returns "" for hashes Dovecot cannot verify, and for
+// plaintext passwords unless [password] allow_plaintext is enabled, as CheckPassword does.
+func DovecotPasswordHash(hashed string) string {
+	switch prefix, hash := splitSchemePrefix(hashed); prefix {
+	case "":
+	case "PLAIN", "CLEAR", "CLEARTEXT":
+		if plaintextAllowed() {
+			return hashed
+		}
+		return ""
+	case "MD5":
+		// {MD5} is MD5-CRYPT for Dovecot, but CheckPassword reads it as a hex digest
+		if isMD5Hex(hash) {
+			return "{PLAIN-MD5}" + strings.ToLower(hash)
+		}
+		return ""
+	default:
+		return hashed
+	}
+	switch {
+	case strings.HasPrefix(hashed, "$2"):
+		return "{BLF-CRYPT}" + hashed
+	case strings.HasPrefix(hashed, "$6$"):
+		return "{SHA512-CRYPT}" + hashed
+	case strings.HasPrefix(hashed, "$5$"):
+		return "{SHA256-CRYPT}" + hashed
+	case strings.HasPrefix(hashed, "$1$"):
+		return "{MD5-CRYPT}" + hashed
+	case strings.HasPrefix(hashed, "$argon2id$"):
+		return "{ARGON2ID}" + hashed
+	case strings.HasPrefix(hashed, "$argon2i$"):
+		return "{ARGON2I}" + hashed
+	case strings.HasPrefix(hashed, "$argon2"):
+		// Other Argon2 variants are hashes CheckPassword knows but Dovecot does not
+		return ""
+	case isMD5Hex(hashed):
+		// Legacy PostfixAdmin "md5" stored the bare hex digest
+		return "{PLAIN-MD5}" + strings.ToLower(hashed)
+	}
+	if hashed != "" && plaintextAllowed() {
+		return "{PLAIN}" + hashed
+	}
+	return ""
+}
+
+// UserDB returns the data without the password hashes, as needed for userdb lookups
+func (u DovecotUser) UserDB() DovecotUser {
+	u.Password = ""
+	u.AppPasswords = nil
+	return u
+}
+
+// NewDovecotUser builds the passdb/userdb data of a mailbox
+func NewDovecotUser(db *gorm.DB, mailbox models.Mailbox) DovecotUser {
+	user := DovecotUser{
+		User:       mailbox.Username,
+		Password:   DovecotPasswordHash(mailbox.Password),
+		Home:       dovecotBaseDir() + "/" + strings.TrimRight(mailbox.Maildir, "/"),
+		UID:        dovecotID("dovecot.uid"),
+		GID:        dovecotID("dovecot.gid"),
+		QuotaRule:  fmt.Sprintf("*:bytes=%d", mailbox.Quota),
+		Active:     mailbox.Active,
+		SMTPActive: mailbox.SMTPActive,
+	}
+
+	appPasswords, _ := ListAppPasswords(db, mailbox.Username)
+	for _, p := range appPasswords {
+		if p.PasswordHash == nil {
+			continue
+		}
+		if hash := DovecotPasswordHash(*p.PasswordHash); hash != "" {
+			user.AppPasswords = append(user.AppPasswords, hash)
+		}
+	}
+	return user
+}
+
+// DovecotAuthenticate verifies a login for Dovecot against the mailbox password and its app
+// passwords. Logins for the "smtp" and "submission" services are refused when the mailbox
+// has smtp_active disabled. It reports whether the credentials are valid.
+func DovecotAuthenticate(db *gorm.DB, login, password, service string) (models.Mailbox, bool, error) {
+	mailbox, err := ResolveMailboxLogin(db, login)
+	if err != nil {
+		return mailbox, false, err
+	}
+	if !mailbox.SMTPActive && (service == "smtp" || service == "submission") {
+		return mailbox, false, nil
+	}
+
+	if match, _ := CheckPassword(password, mailbox.Password); match {
+		return mailbox, true, nil
+	}
+	match, err := CheckAppPassword(db, mailbox.Username, password)
+	return mailbox, match, err
+}
+
+// ListDovecotUsers returns the usernames of all active mailboxes of active domains, for
+// Dovecot user iteration (doveadm -A)
+func ListDovecotUsers(db *gorm.DB) ([]string, error) {
+	var usernames []string
+	err := db.Model(&models.Mailbox{}).
+		Joins("JOIN domain ON domain.domain = mailbox.domain").
+		Where("mailbox.active = ? AND domain.active = ?", true, true).
+		Order("mailbox.username").
+		Pluck("mailbox.username", &usernames).Error
+	return usernames, err
+}
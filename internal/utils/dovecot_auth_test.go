@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestDovecotPasswordHash(t *testing.T) {
+	tests := []struct {
+		hashed string
+		want   string
+	}{
+		{"$2y$10$abcdefghijklmnopqrstuv", "{BLF-CRYPT}$2y$10$abcdefghijklmnopqrstuv"},
+		{"$6$salt$hash", "{SHA512-CRYPT}$6$salt$hash"},
+		{"$5$salt$hash", "{SHA256-CRYPT}$5$salt$hash"},
+		{"$1$salt$hash", "{MD5-CRYPT}$1$salt$hash"},
+		{"$argon2id$v=19$m=65536,t=4,p=1$salt$hash", "{ARGON2ID}$argon2id$v=19$m=65536,t=4,p=1$salt$hash"},
+		{"$argon2i$v=19$m=65536,t=4,p=1$salt$hash", "{ARGON2I}$argon2i$v=19$m=65536,t=4,p=1$salt$hash"},
+		{"{SHA512-CRYPT}$6$salt$hash", "{SHA512-CRYPT}$6$salt$hash"},
+		{"{PLAIN-MD5}5f4dcc3b5aa765d61d8327deb882cf99", "{PLAIN-MD5}5f4dcc3b5aa765d61d8327deb882cf99"},
+		{"5F4DCC3B5AA765D61D8327DEB882CF99", "{PLAIN-MD5}5f4dcc3b5aa765d61d8327deb882cf99"},
+		{"{MD5}5F4DCC3B5AA765D61D8327DEB882CF99", "{PLAIN-MD5}5f4dcc3b5aa765d61d8327deb882cf99"},
+		{"{MD5}$1$salt$hash", ""},
+		{"$argon2d$v=19$m=65536,t=4,p=1$salt$hash", ""},
+		{"secret", ""},
+		{"{PLAIN}secret", ""},
+		{"{CLEAR}secret", ""},
+		{"{cleartext}secret", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := DovecotPasswordHash(tt.hashed); got != tt.want {
+			t.Errorf("DovecotPasswordHash(%q) = %q, want %q", tt.hashed, got, tt.want)
+		}
+	}
+
+	viper.Set("password.allow_plaintext", true)
+	defer viper.Set("password.allow_plaintext", false)
+	if got := DovecotPasswordHash("secret"); got != "{PLAIN}secret" {
+		t.Errorf("DovecotPasswordHash with plaintext allowed = %q, want {PLAIN}secret", got)
+	}
+	if got := DovecotPasswordHash("{CLEAR}secret"); got != "{CLEAR}secret" {
+		t.Errorf("DovecotPasswordHash({CLEAR}secret) with plaintext allowed = %q, want {CLEAR}secret", got)
+	}
+	for _, hashed := range []string{"5f4dcc3b5aa765d61d8327deb882cf99", "$argon2d$v=19$m=65536,t=4,p=1$salt$hash"} {
+		if got := DovecotPasswordHash(hashed); strings.HasPrefix(got, "{PLAIN}") {
+			t.Errorf("DovecotPasswordHash(%q) with plaintext allowed = %q, want no {PLAIN}", hashed, got)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// Listen opens "unix:/path" or "[inet:]host:port", the address forms Postfix uses for its
+// socketmap and policy services
+func Listen(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", strings.TrimPrefix(address, "inet:"))
+}
+
+// Dial connects to "unix:/path" or "[inet:]host:port", e.g. an LMTP socket
+func Dial(address string, timeout time.Duration) (net.Conn, error) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return net.DialTimeout("unix", path, timeout)
+	}
+	return net.DialTimeout("tcp", strings.TrimPrefix(address, "inet:"), timeout)
+}
@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// Kinds of the login_failure counters
+const (
+	LoginScopeUsername = "username"
+	LoginScopeIP       = "ip"
+)
+
+// Login portals. Each keeps its own counters, so failed IMAP logins do not lock the web
+// admin out and the other way round.
+const (
+	LoginPortalAdmin   = "admin"
+	LoginPortalUser    = "user"
+	LoginPortalDovecot = "dovecot"
+)
+
+// loginScope returns the login_failure scope of a counter of a portal, e.g. "admin:ip"
+func loginScope(portal, kind string) string {
+	return portal + ":" + kind
+}
+
+// LoginScopeKind returns the kind of counter, LoginScopeUsername or LoginScopeIP, of a scope
+func LoginScopeKind(scope string) string {
+	if _, kind, found := strings.Cut(scope, ":"); found {
+		return kind
+	}
+	return scope
+}
+
+// LoginScopePortal returns the portal of a scope, "" for counters shared by all portals
+// before they had their own
+func LoginScopePortal(scope string) string {
+	if portal, _, found := strings.Cut(scope, ":"); found {
+		return portal
+	}
+	return ""
+}
+
+// loginGuardSettings holds the [security] section of config.toml
+type loginGuardSettings struct {
+	maxFailures   int           // failures per username before it is locked
+	maxFailuresIP int           // failures per client IP before it is locked
+	window        time.Duration // failures older than this are forgotten
+	lockout       time.Duration // first lockout, doubled for every further failure
+	maxLockout    time.Duration
+}
+
+func loginGuardConfig() loginGuardSettings {
+	s := loginGuardSettings{
+		maxFailures:   viper.GetInt("security.max_failures"),
+		maxFailuresIP: viper.GetInt("security.max_failures_ip"),
+		window:        viper.GetDuration("security.failure_window"),
+		lockout:       viper.GetDuration("security.lockout"),
+		maxLockout:    viper.GetDuration("security.max_lockout"),
+	}
+	if s.maxFailures <= 0 {
+		s.maxFailures = 5
+	}
+	if s.maxFailuresIP <= 0 {
+		s.maxFailuresIP = 20
+	}
+	if s.window <= 0 {
+		s.window = 15 * time.Minute
+	}
+	if s.lockout <= 0 {
+		s.lockout = time.Minute
+	}
+	if s.maxLockout < s.lockout {
+		s.maxLockout = time.Hour
+	}
+	return s
+}
+
+// LoginGuardEnabled reports whether login lockout is on; it is unless [security] enabled = false
+func LoginGuardEnabled() bool {
+	return !viper.IsSet("security.enabled") || viper.GetBool("security.enabled")
+}
+
+// lockoutDuration returns how long to lock after the given number of consecutive failures:
+// nothing below threshold, then base doubling with every failure up to max.
+func lockoutDuration(failures, threshold int, base, max time.Duration) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	d := base
+	for i := threshold; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// LoginLockedUntil returns when the lock on the username or client IP expires in a portal,
+// if either is locked
+func LoginLockedUntil(db *gorm.DB, portal, username, ip string) (time.Time, bool) {
+	if !LoginGuardEnabled() {
+		return time.Time{}, false
+	}
+
+	var failures []models.LoginFailure
+	err := db.Where("((scope = ? AND subject = ?) OR (scope = ? AND subject = ?)) AND locked_until > ?",
+		loginScope(portal, LoginScopeUsername), username, loginScope(portal, LoginScopeIP), ip, time.Now()).Find(&failures).Error
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var until time.Time
+	for _, f := range failures {
+		if f.LockedUntil.After(until) {
+			until = *f.LockedUntil
+		}
+	}
+	return until, !until.IsZero()
+}
+
+// CheckLoginLock reports whether the username or IP is locked in a portal and, if so, logs
+// the blocked attempt
+func CheckLoginLock(db *gorm.DB, portal, username, ip, logDomain string) bool {
+	until, locked := LoginLockedUntil(db, portal, username, ip)
+	if !locked {
+		return false
+	}
+	data := fmt.Sprintf("%s (locked until %s)", username, until.Format("2006-01-02 15:04:05"))
+	if err := LogAction(db, username, ip, logDomain, "login_blocked", data); err != nil {
+		fmt.Printf("Failed to log login_blocked: %v\n", err)
+	}
+	return true
+}
+
+// RegisterLoginFailure counts a failed login to a portal for the username and the client IP,
+// locks whichever went over its limit and logs the attempt. It reports whether a lock was set.
+func RegisterLoginFailure(db *gorm.DB, portal, username, ip, logDomain string) bool {
+	cfg := loginGuardConfig()
+
+	if err := LogAction(db, username, ip, logDomain, "login_failed", username); err != nil {
+		fmt.Printf("Failed to log login_failed: %v\n", err)
+	}
+
+	if !LoginGuardEnabled() {
+		return false
+	}
+
+	locked := false
+	for _, s := range []struct {
+		scope, subject string
+		threshold      int
+	}{
+		{loginScope(portal, LoginScopeUsername), username, cfg.maxFailures},
+		{loginScope(portal, LoginScopeIP), ip, cfg.maxFailuresIP},
+	} {
+		if s.subject == "" {
+			continue
+		}
+		until, err := countFailure(db, s.scope, s.subject, s.threshold, cfg)
+		if err != nil {
+			fmt.Printf("Failed to record login failure: %v\n", err)
+			continue
+		}
+		if until != nil {
+			locked = true
+			data := fmt.Sprintf("%s %s locked until %s", s.scope, s.subject, until.Format("2006-01-02 15:04:05"))
+			if err := LogAction(db, username, ip, logDomain, "login_locked", data); err != nil {
+				fmt.Printf("Failed to log login_locked: %v\n", err)
+			}
+		}
+	}
+	return locked
+}
+
+// countFailure increments one counter and returns the new lock expiry when it gets locked
+func countFailure(db *gorm.DB, scope, subject string, threshold int, cfg loginGuardSettings) (*time.Time, error) {
+	now := time.Now()
+
+	var f models.LoginFailure
+	if err := db.Where(models.LoginFailure{Scope: scope, Subject: subject}).FirstOrInit(&f).Error; err != nil {
+		return nil, err
+	}
+	// Forget old failures, counting the window from the end of the last lock
+	last := f.LastFailure
+	if f.LockedUntil != nil && f.LockedUntil.After(last) {
+		last = *f.LockedUntil
+	}
+	if now.Sub(last) > cfg.window {
+		f.Failures = 0
+		f.LockedUntil = nil
+	}
+	f.Failures++
+	f.LastFailure = now
+
+	var until *time.Time
+	if d := lockoutDuration(f.Failures, threshold, cfg.lockout, cfg.maxLockout); d > 0 {
+		t := now.Add(d)
+		f.LockedUntil = &t
+		until = &t
+	}
+
+	return until, db.Save(&f).Error
+}
+
+// ClearLoginFailures forgets the failed attempts of the username and the client IP in a
+// portal after a successful login. A locked IP cannot log in, so only counters below the
+// limit are cleared.
+func ClearLoginFailures(db *gorm.DB, portal, username, ip string) {
+	db.Where("(scope = ? AND subject = ?) OR (scope = ? AND subject = ?)",
+		loginScope(portal, LoginScopeUsername), username, loginScope(portal, LoginScopeIP), ip).Delete(&models.LoginFailure{})
+}
+
+// ListLoginFailures returns the failure counters, most recent first
+func ListLoginFailures(db *gorm.DB) ([]models.LoginFailure, error) {
+	var failures []models.LoginFailure
+	err := db.Order("last_failure DESC").Find(&failures).Error
+	return failures, err
+}
+
+// DeleteLoginFailure clears a counter (and its lock) by ID
+func DeleteLoginFailure(db *gorm.DB, id int) (*models.LoginFailure, error) {
+	var f models.LoginFailure
+	if err := db.First(&f, id).Error; err != nil {
+		return nil, err
+	}
+	return &f, db.Delete(&f).Error
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/testdb"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{name: "Below threshold", failures: 4, want: 0},
+		{name: "At threshold", failures: 5, want: time.Minute},
+		{name: "Doubles", failures: 6, want: 2 * time.Minute},
+		{name: "Doubles again", failures: 8, want: 8 * time.Minute},
+		{name: "Capped", failures: 20, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lockoutDuration(tt.failures, 5, time.Minute, time.Hour); got != tt.want {
+				t.Errorf("lockoutDuration(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginPortalsLockSeparately(t *testing.T) {
+	db := testdb.Open(t)
+	const user, ip = "john@example.com", "198.51.100.20"
+
+	for i := 0; i < 5; i++ {
+		RegisterLoginFailure(db, LoginPortalDovecot, user, ip, "example.com")
+	}
+	if _, locked := LoginLockedUntil(db, LoginPortalDovecot, user, ip); !locked {
+		t.Fatal("five failed IMAP logins did not lock the username")
+	}
+	for _, portal := range []string{LoginPortalUser, LoginPortalAdmin} {
+		if _, locked := LoginLockedUntil(db, portal, user, ip); locked {
+			t.Errorf("failed IMAP logins locked the %s portal", portal)
+		}
+	}
+
+	// A successful web login clears its own counters only
+	RegisterLoginFailure(db, LoginPortalUser, user, ip, "example.com")
+	ClearLoginFailures(db, LoginPortalUser, user, ip)
+	if _, locked := LoginLockedUntil(db, LoginPortalDovecot, user, ip); !locked {
+		t.Error("a web login cleared the IMAP lock")
+	}
+	var failures []models.LoginFailure
+	db.Find(&failures)
+	for _, f := range failures {
+		if LoginScopePortal(f.Scope) != LoginPortalDovecot {
+			t.Errorf("counter %s %s left after a successful login", f.Scope, f.Subject)
+		}
+	}
+	if len(failures) != 2 {
+		t.Errorf("%d counters, want the IMAP username and IP counters", len(failures))
+	}
+}
+
+func TestLoginScope(t *testing.T) {
+	tests := []struct{ scope, portal, kind string }{
+		{loginScope(LoginPortalAdmin, LoginScopeIP), LoginPortalAdmin, LoginScopeIP},
+		{loginScope(LoginPortalDovecot, LoginScopeUsername), LoginPortalDovecot, LoginScopeUsername},
+		{"username", "", LoginScopeUsername},
+	}
+	for _, tt := range tests {
+		if portal, kind := LoginScopePortal(tt.scope), LoginScopeKind(tt.scope); portal != tt.portal || kind != tt.kind {
+			t.Errorf("scope %q: portal %q kind %q, want %q %q", tt.scope, portal, kind, tt.portal, tt.kind)
+		}
+	}
+}
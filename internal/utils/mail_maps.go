@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// MailMapFile is one generated Postfix or Dovecot configuration file
+type MailMapFile struct {
+	Name    string
+	Content string
+	Queries []string // SQL queries in the file, with Postfix or Dovecot placeholders
+	Dovecot bool     // %u is the full login (Dovecot) instead of the local part (Postfix)
+}
+
+// dbConnection holds the connection settings shared by the generated files
+type dbConnection struct {
+	driver   string // mysql or postgres
+	hostName string
+	port     int
+	socket   string
+	user     string
+	password string
+	dbName   string
+}
+
+// parseDBConnection extracts the connection settings from a GORM DSN
+func parseDBConnection(dsn, driver string) (dbConnection, error) {
+	conn := dbConnection{driver: driver}
+	if driver == "postgres" {
+		cfg, err := pgconn.ParseConfig(dsn)
+		if err != nil {
+			return conn, fmt.Errorf("invalid postgres DSN: %w", err)
+		}
+		conn.user, conn.password, conn.dbName = cfg.User, cfg.Password, cfg.Database
+		conn.hostName, conn.port = cfg.Host, int(cfg.Port)
+		if strings.HasPrefix(cfg.Host, "/") {
+			conn.socket = fmt.Sprintf("%s/.s.PGSQL.%d", cfg.Host, cfg.Port)
+		}
+		return conn, nil
+	}
+
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return conn, fmt.Errorf("invalid mysql DSN: %w", err)
+	}
+	conn.user, conn.password, conn.dbName = cfg.User, cfg.Passwd, cfg.DBName
+	if cfg.Net == "unix" {
+		conn.socket = cfg.Addr
+		conn.hostName = cfg.Addr
+		return conn, nil
+	}
+	host, port, found := strings.Cut(cfg.Addr, ":")
+	conn.hostName = host
+	conn.port = 3306
+	if found {
+		if p, err := strconv.Atoi(port); err == nil {
+			conn.port = p
+		}
+	}
+	return conn, nil
+}
+
+// postfixHosts returns the "hosts" value of a Postfix mysql/pgsql table
+func (c dbConnection) postfixHosts() string {
+	if c.socket != "" {
+		return "unix:" + c.socket
+	}
+	return fmt.Sprintf("%s:%d", c.hostName, c.port)
+}
+
+// dovecotConnect returns the "connect" value of dovecot-sql.conf.ext
+func (c dbConnection) dovecotConnect() string {
+	host := c.hostName
+	if c.driver != "postgres" && c.socket != "" {
+		host = c.socket
+	}
+	parts := []string{"host=" + host}
+	if c.socket == "" || c.driver == "postgres" {
+		parts = append(parts, "port="+strconv.Itoa(c.port))
+	}
+	parts = append(parts, "dbname="+c.dbName, "user="+c.user, "password="+c.password)
+	return strings.Join(parts, " ")
+}
+
+// postfixMapQueries are the Postfix lookup tables with their query, keyed by file name
+// without the mysql_/pgsql_ prefix. %s is the full key, %u the local part and %d the domain.
+var postfixMapQueries = []struct {
+	name, comment, query string
+}{
+	{"virtual_domains_maps.cf", "virtual_mailbox_domains: active domains and alias domains (not backup MX)",
+		"SELECT domain FROM domain WHERE domain='%s' AND backupmx='0' AND active='1' UNION SELECT alias_domain FROM alias_domain WHERE alias_domain='%s' AND active='1'"},
+	{"virtual_mailbox_maps.cf", "virtual_mailbox_maps",
+		"SELECT maildir FROM mailbox WHERE username='%s' AND active='1'"},
+	{"virtual_alias_domain_mailbox_maps.cf", "virtual_mailbox_maps: user@alias-domain to the mailbox of the target domain",
+		"SELECT maildir FROM mailbox,alias_domain WHERE alias_domain.alias_domain='%d' AND mailbox.username=CONCAT('%u','@',alias_domain.target_domain) AND mailbox.active='1' AND alias_domain.active='1'"},
+	{"virtual_alias_maps.cf", "virtual_alias_maps",
+		"SELECT goto FROM alias WHERE address='%s' AND active='1'"},
+	{"virtual_alias_domain_maps.cf", "virtual_alias_maps: user@alias-domain to the alias of the target domain",
+		"SELECT goto FROM alias,alias_domain WHERE alias_domain.alias_domain='%d' AND alias.address=CONCAT('%u','@',alias_domain.target_domain) AND alias.active='1' AND alias_domain.active='1'"},
+	{"virtual_alias_domain_catchall_maps.cf", "virtual_alias_maps: catch-all of the target domain of an alias domain",
+		"SELECT goto FROM alias,alias_domain WHERE alias_domain.alias_domain='%d' AND alias.address=CONCAT('@',alias_domain.target_domain) AND alias.active='1' AND alias_domain.active='1'"},
+	{"relay_domains_maps.cf", "relay_domains: domains this host is backup MX for",
+		"SELECT domain FROM domain WHERE domain='%s' AND backupmx='1' AND active='1'"},
+	{"transport_maps.cf", "transport_maps: per-domain transport",
+		"SELECT transport FROM domain WHERE domain='%s' AND active='1' AND transport<>''"},
+}
+
+// dovecotPassScheme returns the Dovecot default_pass_scheme for the configured password scheme
+func dovecotPassScheme() string {
+	scheme := PasswordScheme()
+	if name, ok := strings.CutPrefix(scheme, "dovecot:"); ok {
+		return name
+	}
+	switch scheme {
+	case SchemeSHA512Crypt:
+		return "SHA512-CRYPT"
+	case SchemeArgon2I:
+		return "ARGON2I"
+	case SchemeArgon2ID:
+		return "ARGON2ID"
+	}
+	return "BLF-CRYPT"
+}
+
+// Dovecot queries. %u is the login, %n its local part and %d its domain; logins in an alias
+// domain resolve to the mailbox of the target domain.
+const (
+	dovecotMailboxWhere  = "mailbox.active='1' AND domain.active='1' AND (mailbox.username='%u' OR mailbox.username=(SELECT CONCAT('%n','@',target_domain) FROM alias_domain WHERE alias_domain='%d' AND active='1'))"
+	dovecotPasswordQuery = "SELECT mailbox.username AS user, mailbox.password FROM mailbox JOIN domain ON domain.domain=mailbox.domain WHERE " + dovecotMailboxWhere
+	dovecotIterateQuery  = "SELECT mailbox.username AS user FROM mailbox JOIN domain ON domain.domain=mailbox.domain WHERE mailbox.active='1' AND domain.active='1'"
+)
+
+func dovecotUserQuery() string {
+	return fmt.Sprintf("SELECT CONCAT('%s/', mailbox.maildir) AS home, %d AS uid, %d AS gid, CONCAT('*:bytes=', mailbox.quota) AS quota_rule FROM mailbox JOIN domain ON domain.domain=mailbox.domain WHERE %s",
+		dovecotBaseDir(), dovecotID("dovecot.uid"), dovecotID("dovecot.gid"), dovecotMailboxWhere)
+}
+
+// GenerateMailMapFiles builds the Postfix map files (mysql_*.cf or pgsql_*.cf) and
+// dovecot-sql.conf.ext for a database connection
+func GenerateMailMapFiles(dsn, driver string) ([]MailMapFile, error) {
+	conn, err := parseDBConnection(dsn, driver)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, dovecotDriver := "mysql_", "mysql"
+	if driver == "postgres" {
+		prefix, dovecotDriver = "pgsql_", "pgsql"
+	}
+
+	var files []MailMapFile
+	for _, m := range postfixMapQueries {
+		content := fmt.Sprintf("# %s\n# Generated by postfixadmin --generate-maps\nuser     = %s\npassword = %s\nhosts    = %s\ndbname   = %s\nquery    = %s\n",
+			m.comment, conn.user, conn.password, conn.postfixHosts(), conn.dbName, m.query)
+		files = append(files, MailMapFile{Name: prefix + m.name, Content: content, Queries: []string{m.query}})
+	}
+
+	userQuery := dovecotUserQuery()
+	content := fmt.Sprintf(`# Generated by postfixadmin --generate-maps
+driver  = %s
+connect = %s
+
+# Must match [password] scheme of Go-PostfixAdmin; hashes with a {SCHEME} prefix override it
+default_pass_scheme = %s
+
+password_query = %s
+
+user_query = %s
+
+iterate_query = %s
+`, dovecotDriver, conn.dovecotConnect(), dovecotPassScheme(), dovecotPasswordQuery, userQuery, dovecotIterateQuery)
+	files = append(files, MailMapFile{
+		Name:    "dovecot-sql.conf.ext",
+		Content: content,
+		Queries: []string{dovecotPasswordQuery, userQuery, dovecotIterateQuery},
+		Dovecot: true,
+	})
+	return files, nil
+}
+
+// CheckMailMapQuery runs a query of a generated file against the database with the
+// placeholders replaced by a sample address and returns the number of rows
+func CheckMailMapQuery(db *gorm.DB, file MailMapFile, query, sampleAddress string) (int, error) {
+	localPart, domain := SplitEmail(sampleAddress)
+	escape := func(s string) string { return strings.ReplaceAll(s, "'", "''") }
+	user := localPart
+	if file.Dovecot {
+		user = sampleAddress
+	}
+	sql := strings.NewReplacer(
+		"%s", escape(sampleAddress),
+		"%u", escape(user),
+		"%n", escape(localPart),
+		"%d", escape(domain),
+	).Replace(query)
+
+	rows, err := db.Raw(sql).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	return count, rows.Err()
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// NewMailbox validates the address of a new mailbox against the domain and its mailbox limit,
+// and returns it with the default settings: active, SMTP enabled and no password. Set one with
+// SetMailboxPassword before CreateMailbox.
+func NewMailbox(db *gorm.DB, localPart, domain string) (models.Mailbox, error) {
+	localPart = strings.ToLower(strings.TrimSpace(localPart))
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	switch {
+	case domain == "":
+		return models.Mailbox{}, fieldError("domain", "Domain is required")
+	case localPart == "":
+		return models.Mailbox{}, fieldError("local_part", "Local part is required")
+	case len(localPart) < 4:
+		return models.Mailbox{}, fieldError("local_part", "Username must be at least 4 characters")
+	case !IsValidLocalPart(localPart):
+		return models.Mailbox{}, fieldError("local_part", "Invalid local part format. Use only letters, numbers, dots, hyphens, and underscores")
+	}
+
+	usage, err := loadDomainUsage(db, domain)
+	if err != nil {
+		return models.Mailbox{}, err
+	}
+	var count int64
+	username := localPart + "@" + domain
+	db.Model(&models.Mailbox{}).Where("username = ?", username).Count(&count)
+	if count > 0 {
+		return models.Mailbox{}, fieldError("local_part", "Mailbox already exists")
+	}
+	if err := usage.take(true); err != nil {
+		return models.Mailbox{}, err
+	}
+
+	now := time.Now()
+	return models.Mailbox{
+		Username:      username,
+		Maildir:       fmt.Sprintf("%s/%s/", domain, localPart),
+		LocalPart:     localPart,
+		Domain:        domain,
+		Created:       now,
+		Modified:      now,
+		Active:        true,
+		SMTPActive:    true,
+		TokenValidity: now.Add(3 * time.Hour),
+	}, nil
+}
+
+// SetMailboxPassword checks password against the password policy, returning a
+// *PasswordPolicyError when it is rejected, and stores its hash on the mailbox
+func SetMailboxPassword(db *gorm.DB, m *models.Mailbox, password string) error {
+	if err := ValidatePassword(db, TOTPKindMailbox, m.Username, password); err != nil {
+		return err
+	}
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	m.Password = hashed
+	m.PasswordExpiry = PasswordExpiryFor(db, m.Domain, time.Now())
+	return nil
+}
+
+// ValidateMailbox checks the quota and send limit of a mailbox
+func ValidateMailbox(m models.Mailbox) error {
+	switch {
+	case m.Quota < 0:
+		return fieldError("quota", "Quota cannot be negative")
+	case m.SendLimit < 0:
+		return fieldError("send_limit", "Send limit cannot be negative")
+	}
+	return nil
+}
+
+// CreateMailbox creates a mailbox returned by NewMailbox together with its self-referencing
+// alias, logging create_mailbox as username
+func CreateMailbox(db *gorm.DB, m *models.Mailbox, username, ip string) error {
+	if m.Password == "" {
+		return fieldError("password", "Password is required")
+	}
+	if err := ValidateMailbox(*m); err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(m).Error; err != nil {
+			return err
+		}
+		alias := models.Alias{
+			Address:  m.Username,
+			Goto:     m.Username,
+			Domain:   m.Domain,
+			Created:  m.Created,
+			Modified: m.Created,
+			Active:   true,
+		}
+		if err := tx.Create(&alias).Error; err != nil {
+			return err
+		}
+		if err := RecordPasswordHistory(tx, TOTPKindMailbox, m.Username, m.Password); err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, m.Domain, "create_mailbox", m.Username)
+	})
+}
+
+// UpdateMailbox saves a mailbox, logging edit_mailbox as username. passwordChanged records
+// the password set with SetMailboxPassword in the password history.
+func UpdateMailbox(db *gorm.DB, m *models.Mailbox, passwordChanged bool, username, ip string) error {
+	if err := ValidateMailbox(*m); err != nil {
+		return err
+	}
+	m.Modified = time.Now()
+	m.TokenValidity = time.Now().Add(3 * time.Hour)
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(m).Error; err != nil {
+			return err
+		}
+		if passwordChanged {
+			if err := RecordPasswordHistory(tx, TOTPKindMailbox, m.Username, m.Password); err != nil {
+				return err
+			}
+		}
+		return LogAction(tx, username, ip, m.Domain, "edit_mailbox", m.Username)
+	})
+}
+
+// DeleteMailbox removes a mailbox with its alias, vacation and app passwords, logging
+// delete_mailbox as username. With server.clean_up_maildir its maildir is removed as well.
+func DeleteMailbox(db *gorm.DB, m models.Mailbox, username, ip string) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("address = ?", m.Username).Delete(&models.Alias{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("email = ?", m.Username).Delete(&models.Vacation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("username = ?", m.Username).Delete(&models.MailboxAppPassword{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("username = ?", m.Username).Delete(&models.Mailbox{}).Error; err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, m.Domain, "delete_mailbox", m.Username)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The mailbox is gone even if its directory cannot be removed
+	if viper.GetBool("server.clean_up_maildir") {
+		if err := CleanupOrphanedMaildir(db, "/var/vmail", m.Domain, m.LocalPart); err != nil {
+			fmt.Printf("Warning: Failed to clean up orphaned directory for %s: %v\n", m.Username, err)
+		}
+	}
+	return nil
+}
@@ -11,18 +11,6 @@ import (
 // SendWelcomeEmail envia uma mensagem de boas-vindas para a caixa de correio recém-criada.
 // Utiliza configurações da seção [smtp] no config.toml.
 func SendWelcomeEmail(adminUsername, newMailbox string) error {
-	server := viper.GetString("smtp.server")
-	if server == "" {
-		server = "127.0.0.1"
-	}
-	port := viper.GetInt("smtp.port")
-	if port == 0 {
-		port = 25
-	}
-	smtpType := viper.GetString("smtp.type")
-	if smtpType == "" {
-		smtpType = "plain"
-	}
 	subject := viper.GetString("smtp.subject")
 	if subject == "" {
 		subject = "Welcome!"
@@ -32,24 +20,48 @@ func SendWelcomeEmail(adminUsername, newMailbox string) error {
 		body = "Hi,\n\nWelcome to your new account."
 	}
 
-	addr := fmt.Sprintf("%s:%d", server, port)
+	return SendMail(adminUsername, newMailbox, subject, body)
+}
 
+// SendMail envia uma mensagem de texto simples através do servidor da seção [smtp]
+func SendMail(from, to, subject, body string) error {
 	// Montagem simples dos cabeçalhos e corpo do e-mail no formato RFC 822
 	msg := []byte(fmt.Sprintf("To: %s\r\n"+
 		"From: %s\r\n"+
 		"Subject: %s\r\n"+
 		"\r\n"+
-		"%s\r\n", newMailbox, adminUsername, subject, body))
+		"%s\r\n", to, from, subject, body))
+
+	return SendMessage(from, to, msg)
+}
+
+// SendMessage entrega uma mensagem já montada (cabeçalhos e corpo) através do servidor da
+// seção [smtp]; from e to formam o envelope SMTP
+func SendMessage(from, to string, msg []byte) error {
+	server := viper.GetString("smtp.server")
+	if server == "" {
+		server = "127.0.0.1"
+	}
+	port := viper.GetInt("smtp.port")
+	if port == 0 {
+		port = 25
+	}
+	smtpType := viper.GetString("smtp.type")
+	if smtpType == "" {
+		smtpType = "plain"
+	}
+
+	addr := fmt.Sprintf("%s:%d", server, port)
 
 	// Envia o e-mail através do servidor SMTP configurado
 	switch smtpType {
 	case "tls":
-		return sendTLS(addr, server, adminUsername, newMailbox, msg)
+		return sendTLS(addr, server, from, to, msg)
 	case "starttls":
-		return sendStartTLS(addr, server, adminUsername, newMailbox, msg)
+		return sendStartTLS(addr, server, from, to, msg)
 	default: // "plain" ou vazio
 		// Força a conexão sem configuração automática de TLS
-		return sendPlain(addr, adminUsername, newMailbox, msg)
+		return sendPlain(addr, from, to, msg)
 	}
 }
 
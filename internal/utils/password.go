@@ -3,63 +3,180 @@ package utils
 import (
 	"crypto/md5"
 	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 
+	"go-postfixadmin/internal/models"
+
 	"github.com/GehirnInc/crypt"
 	_ "github.com/GehirnInc/crypt/md5_crypt"
+	_ "github.com/GehirnInc/crypt/sha256_crypt"
 	_ "github.com/GehirnInc/crypt/sha512_crypt"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Password schemes accepted in [password] scheme. The "dovecot:" forms store the hash with a
+// Dovecot {SCHEME} prefix, as written by "doveadm pw".
+const (
+	SchemeBcrypt             = "bcrypt"
+	SchemeSHA512Crypt        = "sha512-crypt"
+	SchemeArgon2I            = "argon2i"
+	SchemeArgon2ID           = "argon2id"
+	SchemeDovecotBlfCrypt    = "dovecot:BLF-CRYPT"
+	SchemeDovecotSHA512Crypt = "dovecot:SHA512-CRYPT"
+	SchemeDovecotArgon2I     = "dovecot:ARGON2I"
+	SchemeDovecotArgon2ID    = "dovecot:ARGON2ID"
 )
 
-// CheckPassword verifies if the plaintext password matches the hashed password
-// supports {MD5}, {CRYPT}, $6$ (SHA512-CRYPT), and Bcrypt ($2a$, $2y$, $2b$)
+// PasswordSchemes lists the supported values of [password] scheme
+var PasswordSchemes = []string{
+	SchemeBcrypt, SchemeSHA512Crypt, SchemeArgon2I, SchemeArgon2ID,
+	SchemeDovecotBlfCrypt, SchemeDovecotSHA512Crypt, SchemeDovecotArgon2I, SchemeDovecotArgon2ID,
+}
+
+// Argon2 parameters, matching the PHP password_hash() defaults used by PostfixAdmin
+const (
+	argon2Memory  = 64 * 1024
+	argon2Time    = 4
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// PasswordScheme returns the configured hashing scheme for new passwords (default bcrypt)
+func PasswordScheme() string {
+	scheme := viper.GetString("password.scheme")
+	for _, s := range PasswordSchemes {
+		if strings.EqualFold(scheme, s) {
+			return s
+		}
+	}
+	return SchemeBcrypt
+}
+
+// plaintextAllowed reports whether unhashed passwords in the database are accepted ([password] allow_plaintext)
+func plaintextAllowed() bool {
+	return viper.GetBool("password.allow_plaintext")
+}
+
+// CheckPassword verifies if the plaintext password matches the hashed password.
+// It supports bcrypt ($2a$, $2y$, $2b$), SHA512-CRYPT ($6$), SHA256-CRYPT ($5$), MD5-CRYPT ($1$), Argon2
+// ($argon2i$, $argon2id$), {MD5}/{PLAIN-MD5} and the Dovecot {SCHEME} prefixed forms of those.
+// Plaintext passwords are only accepted when [password] allow_plaintext is enabled.
 func CheckPassword(plain, hashed string) (bool, error) {
-	if strings.HasPrefix(hashed, "{MD5}") {
-		hash := md5.Sum([]byte(plain))
-		hexHash := hex.EncodeToString(hash[:])
-		return hexHash == hashed[5:], nil
-	}
-
-	hashed = strings.TrimPrefix(hashed, "{CRYPT}")
-
-	// Check for Bcrypt ($2a$, $2y$, $2b$)
-	// Check for Bcrypt ($2a$, $2y$, $2b$)
-	if strings.HasPrefix(hashed, "$2") {
-		// Go's bcrypt package expects $2a$ or $2b, but handles $2y$ by treating it as $2a$ if we replace it
-		// standard lib support for $2y$ might be limited, so normalize for check
-		normalizedHash := strings.Replace(hashed, "$2y$", "$2a$", 1)
-		err := bcrypt.CompareHashAndPassword([]byte(normalizedHash), []byte(plain))
-		return err == nil, nil
-	}
-
-	// For CRYPT and SHA512-CRYPT
-	cryptScheme := crypt.SHA512.New()
-	if strings.HasPrefix(hashed, "$1$") {
-		cryptScheme = crypt.MD5.New()
-	} else if strings.HasPrefix(hashed, "$6$") {
-		cryptScheme = crypt.SHA512.New()
-	} else {
-		// Fallback or simple crypt? PostfixAdmin often uses salt
-		// This is a simplified version.
-		return plain == hashed, nil
+	prefix, hash := splitSchemePrefix(hashed)
+	switch prefix {
+	case "MD5", "PLAIN-MD5":
+		sum := md5.Sum([]byte(plain))
+		return strings.EqualFold(hex.EncodeToString(sum[:]), hash), nil
+	case "PLAIN", "CLEAR", "CLEARTEXT":
+		return plaintextAllowed() && subtle.ConstantTimeCompare([]byte(plain), []byte(hash)) == 1, nil
 	}
 
-	err := cryptScheme.Verify(hashed, []byte(plain))
-	return err == nil, nil
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		// Go's bcrypt package does not know $2y$, which is the same algorithm as $2a$
+		normalizedHash := strings.Replace(hash, "$2y$", "$2a$", 1)
+		return bcrypt.CompareHashAndPassword([]byte(normalizedHash), []byte(plain)) == nil, nil
+	case strings.HasPrefix(hash, "$argon2"):
+		return checkArgon2(plain, hash)
+	case strings.HasPrefix(hash, "$1$"):
+		return crypt.MD5.New().Verify(hash, []byte(plain)) == nil, nil
+	case strings.HasPrefix(hash, "$5$"):
+		return crypt.SHA256.New().Verify(hash, []byte(plain)) == nil, nil
+	case strings.HasPrefix(hash, "$6$"):
+		return crypt.SHA512.New().Verify(hash, []byte(plain)) == nil, nil
+	}
+
+	if prefix == "" && plaintextAllowed() {
+		return subtle.ConstantTimeCompare([]byte(plain), []byte(hashed)) == 1, nil
+	}
+	return false, nil
 }
 
-// HashPassword generates a Bcrypt hash ($2y$10$) compatible with PHP/PostfixAdmin
+// splitSchemePrefix splits a Dovecot "{SCHEME}hash" into its upper-cased scheme and hash
+func splitSchemePrefix(hashed string) (string, string) {
+	if !strings.HasPrefix(hashed, "{") {
+		return "", hashed
+	}
+	end := strings.Index(hashed, "}")
+	if end < 0 {
+		return "", hashed
+	}
+	return strings.ToUpper(hashed[1:end]), hashed[end+1:]
+}
+
+// HashPassword hashes a password with the scheme configured in [password] scheme
 func HashPassword(plain string) (string, error) {
-	// Generate bcrypt hash with default cost (10)
-	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+	return HashPasswordWithScheme(plain, PasswordScheme())
+}
+
+// HashPasswordWithScheme hashes a password with one of PasswordSchemes
+func HashPasswordWithScheme(plain, scheme string) (string, error) {
+	switch scheme {
+	case SchemeBcrypt:
+		return HashPasswordBcrypt(plain)
+	case SchemeSHA512Crypt:
+		return HashPasswordSHA512Crypt(plain)
+	case SchemeArgon2I, SchemeArgon2ID:
+		return HashPasswordArgon2(plain, scheme == SchemeArgon2ID)
+	case SchemeDovecotBlfCrypt:
+		return withPrefix("{BLF-CRYPT}")(HashPasswordBcrypt(plain))
+	case SchemeDovecotSHA512Crypt:
+		return withPrefix("{SHA512-CRYPT}")(HashPasswordSHA512Crypt(plain))
+	case SchemeDovecotArgon2I:
+		return withPrefix("{ARGON2I}")(HashPasswordArgon2(plain, false))
+	case SchemeDovecotArgon2ID:
+		return withPrefix("{ARGON2ID}")(HashPasswordArgon2(plain, true))
+	}
+	return "", fmt.Errorf("unknown password scheme %q", scheme)
+}
+
+func withPrefix(prefix string) func(string, error) (string, error) {
+	return func(hash string, err error) (string, error) {
+		if err != nil {
+			return "", err
+		}
+		return prefix + hash, nil
 	}
-	// Replace $2a$ with $2y$ for PHP compatibility (fixes high-bit bug in old PHP versions)
-	// PostfixAdmin typically expects $2y$ prefix
-	return strings.Replace(string(hash), "$2a$", "$2y$", 1), nil
+}
+
+// hashScheme returns which of PasswordSchemes produced a hash, or "" for any other format
+func hashScheme(hashed string) string {
+	prefix, hash := splitSchemePrefix(hashed)
+	var scheme string
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		scheme = SchemeBcrypt
+	case strings.HasPrefix(hash, "$6$"):
+		scheme = SchemeSHA512Crypt
+	case strings.HasPrefix(hash, "$argon2id$"):
+		scheme = SchemeArgon2ID
+	case strings.HasPrefix(hash, "$argon2i$"):
+		scheme = SchemeArgon2I
+	default:
+		return ""
+	}
+
+	switch prefix {
+	case "":
+		return scheme
+	case "BLF-CRYPT", "SHA512-CRYPT", "ARGON2I", "ARGON2ID":
+		return "dovecot:" + prefix
+	}
+	return ""
+}
+
+// PasswordNeedsRehash reports whether a stored hash was not produced by the configured scheme
+func PasswordNeedsRehash(hashed string) bool {
+	return hashScheme(hashed) != PasswordScheme()
 }
 
 // HashPasswordMD5Crypt generates a MD5-CRYPT hash ($1$) with a random salt
@@ -78,11 +195,107 @@ func HashPasswordMD5Crypt(plain string) (string, error) {
 	return hash, nil
 }
 
-// HashPasswordBcrypt generates a Bcrypt hash ($2y$)
+// HashPasswordBcrypt generates a Bcrypt hash ($2y$) compatible with PHP/PostfixAdmin
 func HashPasswordBcrypt(plain string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
 	if err != nil {
 		return "", err
 	}
+	// PostfixAdmin and Dovecot expect the $2y$ prefix
 	return strings.Replace(string(bytes), "$2a$", "$2y$", 1), nil
 }
+
+// HashPasswordSHA512Crypt generates a SHA512-CRYPT hash ($6$) with a random salt
+func HashPasswordSHA512Crypt(plain string) (string, error) {
+	return crypt.SHA512.New().Generate([]byte(plain), nil)
+}
+
+// HashPasswordArgon2 generates an Argon2i or Argon2id hash in the PHC string format
+// ($argon2id$v=19$m=65536,t=4,p=1$salt$hash) used by PHP and Dovecot
+func HashPasswordArgon2(plain string, id bool) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	variant := "argon2i"
+	var key []byte
+	if id {
+		variant = "argon2id"
+		key = argon2.IDKey([]byte(plain), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	} else {
+		key = argon2.Key([]byte(plain), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	}
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", variant, argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkArgon2 verifies a password against an Argon2 PHC string
+func checkArgon2(plain, hashed string) (bool, error) {
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 {
+		return false, errors.New("invalid argon2 hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errors.New("unsupported argon2 version")
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, errors.New("invalid argon2 parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, errors.New("invalid argon2 salt")
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, errors.New("invalid argon2 hash")
+	}
+
+	var got []byte
+	switch parts[1] {
+	case "argon2id":
+		got = argon2.IDKey([]byte(plain), salt, time, memory, threads, uint32(len(want)))
+	case "argon2i":
+		got = argon2.Key([]byte(plain), salt, time, memory, threads, uint32(len(want)))
+	default:
+		return false, errors.New("unsupported argon2 variant")
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// RehashPassword stores a new hash of a password that was just verified at login when the
+// stored hash uses another scheme than the configured one. kind is TOTPKindAdmin or TOTPKindMailbox.
+func RehashPassword(db *gorm.DB, kind, username, plain, hashed string) {
+	if !PasswordNeedsRehash(hashed) {
+		return
+	}
+	rehashed, err := HashPassword(plain)
+	if err != nil {
+		fmt.Printf("Failed to rehash password of %s: %v\n", username, err)
+		return
+	}
+
+	var model interface{} = &models.Admin{}
+	if kind == TOTPKindMailbox {
+		model = &models.Mailbox{}
+	}
+	// Match the old hash so a concurrent password change is not overwritten
+	if err := db.Model(model).Where("username = ? AND password = ?", username, hashed).Update("password", rehashed).Error; err != nil {
+		fmt.Printf("Failed to rehash password of %s: %v\n", username, err)
+	}
+}
+
+// isMD5Hex reports whether s looks like a hex encoded MD5 digest
+func isMD5Hex(s string) bool {
+	if len(s) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
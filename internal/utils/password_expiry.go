@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// NoPasswordExpiry is the placeholder stored in mailbox.password_expiry when the password never expires
+var NoPasswordExpiry = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// domainPasswordExpiryDays returns the password lifetime of a domain in days, 0 when it does not expire
+func domainPasswordExpiryDays(db *gorm.DB, domain string) int {
+	var d models.Domain
+	if err := db.Select("password_expiry").Where("domain = ?", domain).First(&d).Error; err != nil {
+		return 0
+	}
+	if d.PasswordExpiry == nil || *d.PasswordExpiry < 0 {
+		return 0
+	}
+	return *d.PasswordExpiry
+}
+
+// PasswordExpiryFor returns the expiry of a mailbox password changed at the given time,
+// following the domain policy. It returns NoPasswordExpiry when the domain has none.
+func PasswordExpiryFor(db *gorm.DB, domain string, changed time.Time) time.Time {
+	days := domainPasswordExpiryDays(db, domain)
+	if days == 0 {
+		return NoPasswordExpiry
+	}
+	return changed.AddDate(0, 0, days)
+}
+
+// StartDomainPasswordExpiry gives every mailbox of the domain that has no expiry yet a full
+// password lifetime from now. It is called when a domain gains a password_expiry policy.
+func StartDomainPasswordExpiry(db *gorm.DB, domain string) error {
+	days := domainPasswordExpiryDays(db, domain)
+	if days == 0 {
+		return nil
+	}
+	return db.Model(&models.Mailbox{}).
+		Where("domain = ? AND password_expiry <= ?", domain, NoPasswordExpiry).
+		Update("password_expiry", time.Now().AddDate(0, 0, days)).Error
+}
+
+// HasPasswordExpiry reports whether an expiry date is set (rather than the NoPasswordExpiry placeholder)
+func HasPasswordExpiry(expiry time.Time) bool {
+	return expiry.After(NoPasswordExpiry)
+}
+
+// IsMailboxPasswordExpired reports whether the password of the mailbox has expired. Expiry is
+// only enforced while the domain still has a password_expiry policy.
+func IsMailboxPasswordExpired(db *gorm.DB, mailbox models.Mailbox) bool {
+	if !HasPasswordExpiry(mailbox.PasswordExpiry) || time.Now().Before(mailbox.PasswordExpiry) {
+		return false
+	}
+	return domainPasswordExpiryDays(db, mailbox.Domain) > 0
+}
+
+// ExpiringMailboxes returns active mailboxes whose password expires within the given number
+// of days (already expired ones included), soonest first
+func ExpiringMailboxes(db *gorm.DB, days int) ([]models.Mailbox, error) {
+	var mailboxes []models.Mailbox
+	err := db.Select("mailbox.*").Joins("JOIN domain ON domain.domain = mailbox.domain").
+		Where("mailbox.active = ? AND domain.password_expiry > 0", true).
+		Where("mailbox.password_expiry > ? AND mailbox.password_expiry < ?", NoPasswordExpiry, time.Now().AddDate(0, 0, days)).
+		Order("mailbox.password_expiry ASC").
+		Find(&mailboxes).Error
+	return mailboxes, err
+}
+
+// SendPasswordExpiryReminders emails every mailbox whose password expires within the given
+// number of days (and has not expired yet). An empty from defaults to postmaster@ the mailbox
+// domain. It returns how many reminders were sent.
+func SendPasswordExpiryReminders(db *gorm.DB, days int, from string) (int, error) {
+	mailboxes, err := ExpiringMailboxes(db, days)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	now := time.Now()
+	for _, m := range mailboxes {
+		if m.PasswordExpiry.Before(now) {
+			continue
+		}
+		sender := from
+		if sender == "" {
+			sender = "postmaster@" + m.Domain
+		}
+		body := fmt.Sprintf("Hi,\n\nThe password of %s expires on %s.\n\n"+
+			"Please log in to the user portal and choose a new password before then.",
+			m.Username, m.PasswordExpiry.Format("2006-01-02 15:04"))
+		if err := SendMail(sender, m.Username, "Your password expires soon", body); err != nil {
+			return sent, fmt.Errorf("failed to send reminder to %s: %w", m.Username, err)
+		}
+		sent++
+		if err := LogAction(db, "CLI", "127.0.0.1", m.Domain, "password_expiry_reminder", m.Username); err != nil {
+			fmt.Printf("Failed to log password_expiry_reminder: %v\n", err)
+		}
+	}
+	return sent, nil
+}
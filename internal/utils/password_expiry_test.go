@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHasPasswordExpiry(t *testing.T) {
+	if HasPasswordExpiry(NoPasswordExpiry) {
+		t.Error("NoPasswordExpiry must not count as an expiry date")
+	}
+	if HasPasswordExpiry(time.Time{}) {
+		t.Error("zero time must not count as an expiry date")
+	}
+	if !HasPasswordExpiry(time.Now().AddDate(0, 0, 30)) {
+		t.Error("a future date must count as an expiry date")
+	}
+}
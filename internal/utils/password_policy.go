@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go-postfixadmin/internal/models"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// PasswordPolicyError is returned when a password is rejected by the policy. Key is the
+// locale message ID and Data fills its placeholders, so the UI can show a translated message.
+type PasswordPolicyError struct {
+	Key  string
+	Data map[string]interface{}
+}
+
+// passwordPolicyMessages are the English messages of the policy errors, used by Error()
+var passwordPolicyMessages = map[string]string{
+	"PasswordPolicy_ErrTooShort":   "Password must be at least {{.MinLength}} characters",
+	"PasswordPolicy_ErrLower":      "Password must contain a lowercase letter",
+	"PasswordPolicy_ErrUpper":      "Password must contain an uppercase letter",
+	"PasswordPolicy_ErrDigit":      "Password must contain a digit",
+	"PasswordPolicy_ErrSymbol":     "Password must contain a symbol",
+	"PasswordPolicy_ErrUsername":   "Password must not contain the username or domain",
+	"PasswordPolicy_ErrReused":     "Password must differ from the last {{.History}} passwords",
+	"PasswordPolicy_ErrBreached":   "This password appears in a list of breached passwords",
+	"PasswordPolicy_ErrMustDiffer": "New password must differ from the current one",
+}
+
+func (e *PasswordPolicyError) Error() string {
+	msg, ok := passwordPolicyMessages[e.Key]
+	if !ok {
+		return e.Key
+	}
+	for k, v := range e.Data {
+		msg = strings.ReplaceAll(msg, "{{."+k+"}}", fmt.Sprint(v))
+	}
+	return msg
+}
+
+// MessageID returns the locale message ID of the error
+func (e *PasswordPolicyError) MessageID() string {
+	return e.Key
+}
+
+// MessageData returns the placeholder values of the error message
+func (e *PasswordPolicyError) MessageData() map[string]interface{} {
+	return e.Data
+}
+
+// passwordPolicySettings holds the [password_policy] section of config.toml
+type passwordPolicySettings struct {
+	minLength        int
+	requireLower     bool
+	requireUpper     bool
+	requireDigit     bool
+	requireSymbol    bool
+	disallowUsername bool   // reject passwords containing the local part or domain
+	history          int    // number of previous passwords that may not be reused
+	breachedFile     string // local list of breached passwords, plain or SHA-1 hex per line
+}
+
+func passwordPolicyConfig() passwordPolicySettings {
+	s := passwordPolicySettings{
+		minLength:        viper.GetInt("password_policy.min_length"),
+		requireLower:     viper.GetBool("password_policy.require_lower"),
+		requireUpper:     viper.GetBool("password_policy.require_upper"),
+		requireDigit:     viper.GetBool("password_policy.require_digit"),
+		requireSymbol:    viper.GetBool("password_policy.require_symbol"),
+		disallowUsername: viper.GetBool("password_policy.disallow_username"),
+		history:          viper.GetInt("password_policy.history"),
+		breachedFile:     viper.GetString("password_policy.breached_file"),
+	}
+	if s.minLength <= 0 {
+		s.minLength = 8
+	}
+	if s.history < 0 {
+		s.history = 0
+	}
+	return s
+}
+
+// PasswordMinLength returns the minimum password length of the policy
+func PasswordMinLength() int {
+	return passwordPolicyConfig().minLength
+}
+
+func policyError(key string, data map[string]interface{}) error {
+	return &PasswordPolicyError{Key: key, Data: data}
+}
+
+// checkPassword applies the rules that do not need the database
+func (s passwordPolicySettings) checkPassword(username, plain string) error {
+	if len([]rune(plain)) < s.minLength {
+		return policyError("PasswordPolicy_ErrTooShort", map[string]interface{}{"MinLength": strconv.Itoa(s.minLength)})
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range plain {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	switch {
+	case s.requireLower && !lower:
+		return policyError("PasswordPolicy_ErrLower", nil)
+	case s.requireUpper && !upper:
+		return policyError("PasswordPolicy_ErrUpper", nil)
+	case s.requireDigit && !digit:
+		return policyError("PasswordPolicy_ErrDigit", nil)
+	case s.requireSymbol && !symbol:
+		return policyError("PasswordPolicy_ErrSymbol", nil)
+	}
+
+	if s.disallowUsername && containsUsername(username, plain) {
+		return policyError("PasswordPolicy_ErrUsername", nil)
+	}
+
+	if s.breachedFile != "" {
+		breached, err := isBreachedPassword(s.breachedFile, plain)
+		if err != nil {
+			fmt.Printf("Failed to read breached password list: %v\n", err)
+		} else if breached {
+			return policyError("PasswordPolicy_ErrBreached", nil)
+		}
+	}
+	return nil
+}
+
+// containsUsername reports whether the password contains the local part, the domain or the
+// first label of the domain of username (parts shorter than 3 characters are ignored)
+func containsUsername(username, plain string) bool {
+	localPart, domain := SplitEmail(strings.ToLower(username))
+	label, _, _ := strings.Cut(domain, ".")
+	lowered := strings.ToLower(plain)
+	for _, part := range []string{localPart, domain, label} {
+		if len(part) >= 3 && strings.Contains(lowered, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// breachedList caches the SHA-1 hashes of the breached password file until it changes
+var breachedList struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	hashes  map[string]struct{}
+}
+
+// isBreachedPassword looks the password up in a local breached password list. Each line holds
+// either a plain password or its SHA-1 in hex, optionally followed by ":count" (HIBP format).
+func isBreachedPassword(path, plain string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	breachedList.Lock()
+	defer breachedList.Unlock()
+
+	if breachedList.path != path || !breachedList.modTime.Equal(info.ModTime()) {
+		hashes, err := loadBreachedList(path)
+		if err != nil {
+			return false, err
+		}
+		breachedList.path = path
+		breachedList.modTime = info.ModTime()
+		breachedList.hashes = hashes
+	}
+
+	_, found := breachedList.hashes[sha1Hex(plain)]
+	return found, nil
+}
+
+func loadBreachedList(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			hashes[strings.ToLower(hash)] = struct{}{}
+			continue
+		}
+		hashes[sha1Hex(line)] = struct{}{}
+	}
+	return hashes, scanner.Err()
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// ValidatePassword checks a new password of an admin or mailbox (kind is TOTPKindAdmin or
+// TOTPKindMailbox) against the policy in [password_policy], including the reuse history.
+// The returned error is a *PasswordPolicyError when the password is rejected.
+func ValidatePassword(db *gorm.DB, kind, username, plain string) error {
+	s := passwordPolicyConfig()
+	if err := s.checkPassword(username, plain); err != nil {
+		return err
+	}
+	if s.history == 0 || db == nil {
+		return nil
+	}
+
+	var model interface{} = &models.Admin{}
+	if kind == TOTPKindMailbox {
+		model = &models.Mailbox{}
+	}
+	var hashes []string
+	var current string
+	if err := db.Model(model).Select("password").Where("username = ?", username).Row().Scan(&current); err == nil && current != "" {
+		hashes = append(hashes, current)
+	}
+
+	var history []models.PasswordHistory
+	db.Where("kind = ? AND username = ?", kind, username).Order("id DESC").Limit(s.history).Find(&history)
+	for _, h := range history {
+		hashes = append(hashes, h.PasswordHash)
+	}
+
+	for _, hash := range hashes {
+		if match, err := CheckPassword(plain, hash); err == nil && match {
+			return policyError("PasswordPolicy_ErrReused", map[string]interface{}{"History": strconv.Itoa(s.history)})
+		}
+	}
+	return nil
+}
+
+// RecordPasswordHistory remembers a new password hash for the reuse check and drops entries
+// beyond the configured history. It does nothing when the history is disabled.
+func RecordPasswordHistory(db *gorm.DB, kind, username, hash string) error {
+	history := passwordPolicyConfig().history
+	if history == 0 {
+		return nil
+	}
+
+	entry := models.PasswordHistory{Kind: kind, Username: username, PasswordHash: hash, Created: time.Now()}
+	if err := db.Create(&entry).Error; err != nil {
+		return err
+	}
+
+	var keep []int
+	db.Model(&models.PasswordHistory{}).Where("kind = ? AND username = ?", kind, username).
+		Order("id DESC").Limit(history).Pluck("id", &keep)
+	return db.Where("kind = ? AND username = ? AND id NOT IN ?", kind, username, keep).
+		Delete(&models.PasswordHistory{}).Error
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	s := passwordPolicySettings{
+		minLength:        10,
+		requireLower:     true,
+		requireUpper:     true,
+		requireDigit:     true,
+		requireSymbol:    true,
+		disallowUsername: true,
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		wantKey  string
+	}{
+		{name: "Too short", password: "Ab1!", wantKey: "PasswordPolicy_ErrTooShort"},
+		{name: "No lowercase", password: "ABCDEFGH1!", wantKey: "PasswordPolicy_ErrLower"},
+		{name: "No uppercase", password: "abcdefgh1!", wantKey: "PasswordPolicy_ErrUpper"},
+		{name: "No digit", password: "Abcdefghi!", wantKey: "PasswordPolicy_ErrDigit"},
+		{name: "No symbol", password: "Abcdefghi1", wantKey: "PasswordPolicy_ErrSymbol"},
+		{name: "Contains local part", password: "Xjohn.doe1!", wantKey: "PasswordPolicy_ErrUsername"},
+		{name: "Contains domain label", password: "Example123!", wantKey: "PasswordPolicy_ErrUsername"},
+		{name: "Valid", password: "Tr0ub4dor&3x", wantKey: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.checkPassword("john.doe@example.com", tt.password)
+			if tt.wantKey == "" {
+				if err != nil {
+					t.Errorf("checkPassword(%q) = %v, want nil", tt.password, err)
+				}
+				return
+			}
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) || policyErr.Key != tt.wantKey {
+				t.Errorf("checkPassword(%q) = %v, want %s", tt.password, err, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestBreachedPasswordList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	// "password" in plain text and "letmein123" as HIBP-style SHA-1 with a count
+	content := "password\n" + sha1Hex("letmein123") + ":42\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, plain := range []string{"password", "letmein123"} {
+		if breached, err := isBreachedPassword(path, plain); err != nil || !breached {
+			t.Errorf("isBreachedPassword(%q) = %v, %v, want true", plain, breached, err)
+		}
+	}
+	if breached, _ := isBreachedPassword(path, "correct horse battery staple"); breached {
+		t.Error("isBreachedPassword() reported a password that is not listed")
+	}
+}
+
+func TestPasswordPolicyErrorMessage(t *testing.T) {
+	err := &PasswordPolicyError{Key: "PasswordPolicy_ErrTooShort", Data: map[string]interface{}{"MinLength": "12"}}
+	if got, want := err.Error(), "Password must be at least 12 characters"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
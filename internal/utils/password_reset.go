@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidResetToken is returned when a reset token is unknown or expired
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	// ErrResetRateLimited is returned when too many resets were requested for an IP or account
+	ErrResetRateLimited = errors.New("too many password reset requests")
+)
+
+// Reset requests are limited per client IP and per account
+var (
+	resetIPLimiter      = NewRateLimiter(10, time.Hour)
+	resetAccountLimiter = NewRateLimiter(3, time.Hour)
+)
+
+// PasswordResetEnabled reports whether the forgot-password flow is turned on in [password_reset]
+func PasswordResetEnabled() bool {
+	return viper.GetBool("password_reset.enabled") && viper.GetString("password_reset.base_url") != ""
+}
+
+// passwordResetTTL returns how long a reset link stays valid (default 1h)
+func passwordResetTTL() time.Duration {
+	ttl := viper.GetDuration("password_reset.token_ttl")
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return ttl
+}
+
+// passwordResetFrom returns the sender of reset emails, defaulting to noreply@ the base_url host
+func passwordResetFrom(baseURL string) string {
+	if from := viper.GetString("password_reset.from"); from != "" {
+		return from
+	}
+	host := "localhost"
+	if u, err := url.Parse(baseURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	return "noreply@" + host
+}
+
+// resetLogDomain returns the log domain for reset events: "ALL" for admins, the mailbox domain otherwise
+func resetLogDomain(kind, username string) string {
+	if kind == TOTPKindMailbox {
+		_, domain := SplitEmail(username)
+		return domain
+	}
+	return "ALL"
+}
+
+// RequestPasswordReset emails a reset link to the secondary address (email_other) of an
+// active admin or mailbox (kind is TOTPKindAdmin or TOTPKindMailbox). Unknown accounts and
+// accounts without email_other are ignored silently so the form does not reveal which exist.
+// resetPath is the path of the reset page, e.g. "/users/login/reset".
+func RequestPasswordReset(db *gorm.DB, kind, username, resetPath, ip string) error {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil
+	}
+
+	if !resetIPLimiter.Allow(ip) || !resetAccountLimiter.Allow(kind+":"+username) {
+		if err := LogAction(db, username, ip, resetLogDomain(kind, username), "password_reset_rate_limited", kind); err != nil {
+			fmt.Printf("Failed to log password_reset_rate_limited: %v\n", err)
+		}
+		return ErrResetRateLimited
+	}
+
+	var model interface{} = &models.Admin{}
+	if kind == TOTPKindMailbox {
+		model = &models.Mailbox{}
+	}
+
+	var emailOther string
+	err := db.Model(model).Select("email_other").Where("username = ? AND active = ?", username, true).Row().Scan(&emailOther)
+	if err != nil || emailOther == "" {
+		if err := LogAction(db, username, ip, resetLogDomain(kind, username), "password_reset_request", "no recovery address"); err != nil {
+			fmt.Printf("Failed to log password_reset_request: %v\n", err)
+		}
+		return nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(buf)
+
+	ttl := passwordResetTTL()
+	if err := db.Model(model).Where("username = ?", username).Updates(map[string]interface{}{
+		"token":          HashAPIToken(token),
+		"token_validity": time.Now().Add(ttl),
+	}).Error; err != nil {
+		return err
+	}
+
+	baseURL := strings.TrimRight(viper.GetString("password_reset.base_url"), "/")
+	link := baseURL + resetPath + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hi,\n\nA password reset was requested for %s.\n\n"+
+		"Open the link below to choose a new password. It is valid for %s:\n\n%s\n\n"+
+		"If you did not request this, you can ignore this message.", username, ttl, link)
+
+	if err := SendMail(passwordResetFrom(baseURL), emailOther, "Password reset for "+username, body); err != nil {
+		return fmt.Errorf("failed to send reset email: %w", err)
+	}
+
+	if err := LogAction(db, username, ip, resetLogDomain(kind, username), "password_reset_request", emailOther); err != nil {
+		fmt.Printf("Failed to log password_reset_request: %v\n", err)
+	}
+	return nil
+}
+
+// CheckResetToken returns the username owning a valid, unexpired reset token
+func CheckResetToken(db *gorm.DB, kind, token string) (string, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", ErrInvalidResetToken
+	}
+
+	var model interface{} = &models.Admin{}
+	if kind == TOTPKindMailbox {
+		model = &models.Mailbox{}
+	}
+
+	var username string
+	err := db.Model(model).Select("username").
+		Where("token = ? AND token_validity > ? AND active = ?", HashAPIToken(token), time.Now(), true).
+		Row().Scan(&username)
+	if err != nil || username == "" {
+		return "", ErrInvalidResetToken
+	}
+	return username, nil
+}
+
+// ResetPassword sets a new password for the owner of a valid reset token and invalidates the token.
+// It returns the username whose password was changed, or a *PasswordPolicyError when the new
+// password is rejected by the policy.
+func ResetPassword(db *gorm.DB, kind, token, newPassword, ip string) (string, error) {
+	username, err := CheckResetToken(db, kind, token)
+	if err != nil {
+		return "", err
+	}
+	if err := ValidatePassword(db, kind, username, newPassword); err != nil {
+		return "", err
+	}
+
+	hashed, err := HashPassword(newPassword)
+	if err != nil {
+		return "", err
+	}
+
+	var model interface{} = &models.Admin{}
+	updates := map[string]interface{}{
+		"password":       hashed,
+		"token":          "",
+		"token_validity": time.Now(),
+		"modified":       time.Now(),
+	}
+	if kind == TOTPKindMailbox {
+		model = &models.Mailbox{}
+		_, domain := SplitEmail(username)
+		updates["password_expiry"] = PasswordExpiryFor(db, domain, time.Now())
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(model).Where("username = ?", username).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := RecordPasswordHistory(tx, kind, username, hashed); err != nil {
+			return err
+		}
+		return LogAction(tx, username, ip, resetLogDomain(kind, username), "password_reset", kind)
+	})
+	if err != nil {
+		return "", err
+	}
+	return username, nil
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"strings"
 	"testing"
+
+	"github.com/spf13/viper"
 )
 
 func TestCheckPassword(t *testing.T) {
@@ -14,10 +16,16 @@ func TestCheckPassword(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:   "Plain match fallback",
+			name:   "Plaintext rejected without opt-in",
 			plain:  "password",
 			hashed: "password",
-			want:   true,
+			want:   false,
+		},
+		{
+			name:   "PLAIN prefix rejected without opt-in",
+			plain:  "password",
+			hashed: "{PLAIN}password",
+			want:   false,
 		},
 		{
 			name:   "MD5 prefix match",
@@ -105,3 +113,69 @@ func TestHashPasswordBcrypt(t *testing.T) {
 		t.Error("CheckPassword verified wrong bcrypt password")
 	}
 }
+
+func TestCheckPasswordPlaintextOptIn(t *testing.T) {
+	viper.Set("password.allow_plaintext", true)
+	defer viper.Set("password.allow_plaintext", false)
+
+	for _, hashed := range []string{"password", "{PLAIN}password"} {
+		if match, _ := CheckPassword("password", hashed); !match {
+			t.Errorf("CheckPassword(%q) = false with allow_plaintext, want true", hashed)
+		}
+	}
+	if match, _ := CheckPassword("other", "password"); match {
+		t.Error("CheckPassword() accepted a wrong plaintext password")
+	}
+}
+
+func TestHashPasswordWithScheme(t *testing.T) {
+	prefixes := map[string]string{
+		SchemeBcrypt:             "$2y$",
+		SchemeSHA512Crypt:        "$6$",
+		SchemeArgon2I:            "$argon2i$",
+		SchemeArgon2ID:           "$argon2id$",
+		SchemeDovecotBlfCrypt:    "{BLF-CRYPT}$2y$",
+		SchemeDovecotSHA512Crypt: "{SHA512-CRYPT}$6$",
+		SchemeDovecotArgon2I:     "{ARGON2I}$argon2i$",
+		SchemeDovecotArgon2ID:    "{ARGON2ID}$argon2id$",
+	}
+
+	for _, scheme := range PasswordSchemes {
+		t.Run(scheme, func(t *testing.T) {
+			hash, err := HashPasswordWithScheme("s3cret-pass", scheme)
+			if err != nil {
+				t.Fatalf("HashPasswordWithScheme() error = %v", err)
+			}
+			if !strings.HasPrefix(hash, prefixes[scheme]) {
+				t.Errorf("hash %q does not start with %q", hash, prefixes[scheme])
+			}
+			if match, err := CheckPassword("s3cret-pass", hash); err != nil || !match {
+				t.Errorf("CheckPassword() = %v, %v, want true", match, err)
+			}
+			if match, _ := CheckPassword("wrong-pass", hash); match {
+				t.Error("CheckPassword() verified a wrong password")
+			}
+			if got := hashScheme(hash); got != scheme {
+				t.Errorf("hashScheme() = %q, want %q", got, scheme)
+			}
+		})
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	viper.Set("password.scheme", SchemeArgon2ID)
+	defer viper.Set("password.scheme", "")
+
+	bcryptHash, _ := HashPasswordBcrypt("password")
+	argonHash, _ := HashPasswordArgon2("password", true)
+
+	if !PasswordNeedsRehash(bcryptHash) {
+		t.Error("bcrypt hash should need a rehash when the scheme is argon2id")
+	}
+	if PasswordNeedsRehash(argonHash) {
+		t.Error("argon2id hash should not need a rehash when the scheme is argon2id")
+	}
+	if !PasswordNeedsRehash("{MD5}5f4dcc3b5aa765d61d8327deb882cf99") {
+		t.Error("{MD5} hash should always need a rehash")
+	}
+}
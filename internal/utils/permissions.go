@@ -114,3 +114,21 @@ func GetAllMailboxes(db *gorm.DB, username string, isSuperAdmin bool, domainFilt
 
 	return mailboxes, isSuper, nil
 }
+
+// CanManageDomain reports whether the user may manage the given domain,
+// following the same rules as GetAllowedDomains.
+func CanManageDomain(db *gorm.DB, username string, isSuperAdmin bool, domain string) (bool, error) {
+	allowedDomains, isSuper, err := GetAllowedDomains(db, username, isSuperAdmin)
+	if err != nil {
+		return false, err
+	}
+	if isSuper {
+		return true, nil
+	}
+	for _, d := range allowedDomains {
+		if d == domain {
+			return true, nil
+		}
+	}
+	return false, nil
+}
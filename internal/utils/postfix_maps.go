@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-postfixadmin/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Postfix lookup tables served by the socketmap subcommand, named as in
+// "socketmap:inet:127.0.0.1:9998:<name>"
+const (
+	PostfixMapDomain    = "domain"    // virtual_mailbox_domains
+	PostfixMapMailbox   = "mailbox"   // virtual_mailbox_maps
+	PostfixMapAlias     = "alias"     // virtual_alias_maps
+	PostfixMapTransport = "transport" // transport_maps
+	PostfixMapRelay     = "relay"     // relay_domains
+)
+
+// PostfixMaps lists the supported lookup tables
+var PostfixMaps = []string{PostfixMapDomain, PostfixMapMailbox, PostfixMapAlias, PostfixMapTransport, PostfixMapRelay}
+
+// ErrUnknownPostfixMap is returned for a lookup in a table that is not one of PostfixMaps
+var ErrUnknownPostfixMap = errors.New("unknown map")
+
+// PostfixMapLookup answers a Postfix table lookup. It returns the result and whether the key
+// was found; err is only set for database failures, which Postfix should treat as temporary.
+func PostfixMapLookup(db *gorm.DB, mapName, key string) (string, bool, error) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if key == "" {
+		return "", false, nil
+	}
+	switch mapName {
+	case PostfixMapDomain:
+		return lookupVirtualDomain(db, key)
+	case PostfixMapMailbox:
+		return lookupVirtualMailbox(db, key)
+	case PostfixMapAlias:
+		return lookupVirtualAlias(db, key)
+	case PostfixMapTransport:
+		return lookupTransport(db, key)
+	case PostfixMapRelay:
+		return lookupRelayDomain(db, key)
+	}
+	return "", false, fmt.Errorf("%w %q", ErrUnknownPostfixMap, mapName)
+}
+
+// firstOrMiss runs a First query and maps "record not found" to a miss
+func firstOrMiss(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return false, err
+}
+
+// activeAliasTarget returns the target domain of an active alias domain whose target is active
+func activeAliasTarget(db *gorm.DB, domain string) (string, bool, error) {
+	var aliasDomain models.AliasDomain
+	found, err := firstOrMiss(db.Joins("JOIN domain ON domain.domain = alias_domain.target_domain").
+		Where("alias_domain.alias_domain = ? AND alias_domain.active = ? AND domain.active = ?", domain, true, true).
+		Select("alias_domain.*").
+		First(&aliasDomain).Error)
+	return aliasDomain.TargetDomain, found, err
+}
+
+// lookupVirtualDomain accepts active domains and active alias domains of active domains.
+// Backup MX domains are left to lookupRelayDomain, Postfix only relays mail for them.
+func lookupVirtualDomain(db *gorm.DB, domain string) (string, bool, error) {
+	if strings.Contains(domain, "@") || domain == "all" {
+		return "", false, nil
+	}
+	var d models.Domain
+	found, err := firstOrMiss(db.Where("domain = ? AND backupmx = ? AND active = ?", domain, false, true).First(&d).Error)
+	if found || err != nil {
+		return domain, found, err
+	}
+	if _, found, err := activeAliasTarget(db, domain); found || err != nil {
+		return domain, found, err
+	}
+	return "", false, nil
+}
+
+// lookupRelayDomain accepts the active domains this host is backup MX for
+func lookupRelayDomain(db *gorm.DB, domain string) (string, bool, error) {
+	if strings.Contains(domain, "@") {
+		return "", false, nil
+	}
+	var d models.Domain
+	found, err := firstOrMiss(db.Where("domain = ? AND backupmx = ? AND active = ?", domain, true, true).First(&d).Error)
+	if found || err != nil {
+		return domain, found, err
+	}
+	return "", false, nil
+}
+
+// lookupVirtualMailbox returns the maildir of an active mailbox, also for user@alias-domain
+func lookupVirtualMailbox(db *gorm.DB, address string) (string, bool, error) {
+	localPart, domain := SplitEmail(address)
+	if localPart == "" || domain == "" {
+		return "", false, nil
+	}
+
+	candidates := []string{address}
+	target, found, err := activeAliasTarget(db, domain)
+	if err != nil {
+		return "", false, err
+	}
+	if found {
+		candidates = append(candidates, localPart+"@"+target)
+	}
+
+	for _, username := range candidates {
+		var mailbox models.Mailbox
+		found, err := firstOrMiss(db.Where("username = ? AND active = ?", username, true).First(&mailbox).Error)
+		if found || err != nil {
+			return mailbox.Maildir, found, err
+		}
+	}
+	return "", false, nil
+}
+
+// lookupVirtualAlias returns the comma separated destinations of an active alias. Postfix looks
+// up "user@domain" first and then the catch-all "@domain"; in an alias domain both fall back
+// to the same address in the target domain.
+func lookupVirtualAlias(db *gorm.DB, address string) (string, bool, error) {
+	localPart, domain := SplitEmail(address)
+	if domain == "" {
+		return "", false, nil
+	}
+
+	candidates := []string{address}
+	target, found, err := activeAliasTarget(db, domain)
+	if err != nil {
+		return "", false, err
+	}
+	if found {
+		candidates = append(candidates, localPart+"@"+target)
+	}
+
+	for _, addr := range candidates {
+		var alias models.Alias
+		found, err := firstOrMiss(db.Where("address = ? AND active = ?", addr, true).First(&alias).Error)
+		if err != nil {
+			return "", false, err
+		}
+		if found {
+			if recipients := ParseRecipients(alias.Goto); len(recipients) > 0 {
+				return strings.Join(recipients, ","), true, nil
+			}
+		}
+	}
+	return "", false, nil
+}
+
+// lookupTransport returns Domain.Transport of an active domain; alias domains use the
+// transport of their target domain
+func lookupTransport(db *gorm.DB, domain string) (string, bool, error) {
+	if strings.Contains(domain, "@") {
+		return "", false, nil
+	}
+	if target, found, err := activeAliasTarget(db, domain); err != nil {
+		return "", false, err
+	} else if found {
+		domain = target
+	}
+
+	var d models.Domain
+	found, err := firstOrMiss(db.Where("domain = ? AND active = ?", domain, true).First(&d).Error)
+	if err != nil || !found || d.Transport == "" {
+		return "", false, err
+	}
+	return d.Transport, true, nil
+}
+
+// LastLogID returns the ID of the newest log entry. Every change made through the web
+// interface, the API or the CLI is logged, so a new ID means cached lookups may be stale.
+func LastLogID(db *gorm.DB) (int, error) {
+	var id *int
+	if err := db.Model(&models.Log{}).Select("MAX(id)").Row().Scan(&id); err != nil {
+		return 0, err
+	}
+	if id == nil {
+		return 0, nil
+	}
+	return *id, nil
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/testdb"
+)
+
+func TestPostfixMapLookup(t *testing.T) {
+	db := testdb.Open(t)
+	now := time.Now()
+	rows := []interface{}{
+		&models.Domain{Domain: "example.com", Transport: "lmtp:unix:private/dovecot-lmtp", Active: true, Created: now, Modified: now},
+		&models.Domain{Domain: "backup.org", BackupMX: true, Active: true, Created: now, Modified: now},
+		&models.AliasDomain{AliasDomain: "example.net", TargetDomain: "example.com", Active: true, Created: now, Modified: now},
+		&models.Mailbox{Username: "john@example.com", Domain: "example.com", LocalPart: "john", Maildir: "example.com/john/", Active: true, Created: now, Modified: now},
+		&models.Alias{Address: "info@example.com", Goto: "john@example.com", Domain: "example.com", Active: true, Created: now, Modified: now},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("create %T: %v", row, err)
+		}
+	}
+
+	tests := []struct {
+		mapName, key string
+		want         string
+		wantFound    bool
+	}{
+		{PostfixMapDomain, "example.com", "example.com", true},
+		{PostfixMapDomain, "Example.NET", "example.net", true},
+		{PostfixMapDomain, "backup.org", "", false},
+		{PostfixMapDomain, "unknown.org", "", false},
+		{PostfixMapRelay, "backup.org", "backup.org", true},
+		{PostfixMapRelay, "example.com", "", false},
+		{PostfixMapMailbox, "john@example.net", "example.com/john/", true},
+		{PostfixMapAlias, "info@example.net", "john@example.com", true},
+		{PostfixMapTransport, "example.net", "lmtp:unix:private/dovecot-lmtp", true},
+		{PostfixMapTransport, "backup.org", "", false},
+	}
+	for _, tt := range tests {
+		got, found, err := PostfixMapLookup(db, tt.mapName, tt.key)
+		if err != nil {
+			t.Errorf("PostfixMapLookup(%s, %s) error = %v", tt.mapName, tt.key, err)
+			continue
+		}
+		if got != tt.want || found != tt.wantFound {
+			t.Errorf("PostfixMapLookup(%s, %s) = %q, %v, want %q, %v", tt.mapName, tt.key, got, found, tt.want, tt.wantFound)
+		}
+	}
+
+	if _, _, err := PostfixMapLookup(db, "virtual", "example.com"); err == nil {
+		t.Error("PostfixMapLookup of an unknown map should fail")
+	}
+}
@@ -0,0 +1,644 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// legacyNoEnd is the end date PostfixAdmin gave vacations when it added activeuntil
+var legacyNoEnd = time.Date(2038, 1, 18, 0, 0, 0, 0, time.UTC)
+
+// PostfixAdminImportOptions controls ImportPostfixAdmin
+type PostfixAdminImportOptions struct {
+	TablePrefix    string // $CONF['database_prefix'] of the source
+	OnConflict     string // ConflictSkip, ConflictOverwrite or ConflictFail
+	DryRun         bool
+	HashPlaintext  bool   // hash clear text passwords with the configured scheme
+	SkipLog        bool   // leave the log table out
+	VacationDomain string // autoreply domain of the source, rewritten to [vacation] domain
+}
+
+// MigrationTableReport reconciles the rows of one table: read from the source, what the
+// import did with them, and the rows of the target table afterwards
+type MigrationTableReport struct {
+	Table   string
+	Source  int
+	Created int
+	Updated int
+	Skipped int
+	Target  int64
+}
+
+// PostfixAdminImportReport is the outcome of ImportPostfixAdmin
+type PostfixAdminImportReport struct {
+	SchemaVersion string // config version of the source, "" when it has no config table
+	Tables        []*MigrationTableReport
+	Conflicts     []string // rows that already existed
+	Warnings      []string
+	DryRun        bool
+}
+
+// postfixAdminImport reads a PostfixAdmin database and writes its rows through a bundleImport
+type postfixAdminImport struct {
+	*bundleImport
+	src     *gorm.DB
+	opts    PostfixAdminImportOptions
+	sources map[string]int
+	now     time.Time // import time, the value of zero dates
+}
+
+// ImportPostfixAdmin copies the domains, admins, mailboxes, aliases, vacations, fetchmail
+// entries, app passwords, TOTP exceptions, DKIM keys, config and log of a PHP PostfixAdmin
+// database into db in one transaction, logging migrate_postfixadmin as username. Older
+// schema versions are read column by column, missing columns get the value PostfixAdmin's
+// upgrade gave them, and password hashes are rewritten to forms CheckPassword verifies.
+func ImportPostfixAdmin(src, db *gorm.DB, opts PostfixAdminImportOptions, username, ip string) (*PostfixAdminImportReport, error) {
+	switch opts.OnConflict {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return nil, fmt.Errorf("unknown conflict policy %q, use skip, overwrite or fail", opts.OnConflict)
+	}
+
+	report := &PostfixAdminImportReport{DryRun: opts.DryRun}
+	bundleReport := &BundleImportReport{DryRun: opts.DryRun}
+	im := &postfixAdminImport{src: src, opts: opts, sources: map[string]int{}, now: time.Now()}
+
+	var err error
+	if report.SchemaVersion, err = im.schemaVersion(); err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		im.bundleImport = &bundleImport{tx: tx, onConflict: opts.OnConflict, report: bundleReport}
+		if err := im.run(); err != nil {
+			return err
+		}
+		if opts.OnConflict == ConflictFail && len(bundleReport.Conflicts) > 0 {
+			return fmt.Errorf("%d rows already exist, nothing was imported", len(bundleReport.Conflicts))
+		}
+		// Counted before a dry run rolls back
+		for _, t := range bundleReport.Tables {
+			var count int64
+			if err := tx.Table(t.Table).Count(&count).Error; err != nil {
+				return err
+			}
+			report.Tables = append(report.Tables, &MigrationTableReport{
+				Table: t.Table, Source: im.sources[t.Table],
+				Created: t.Created, Updated: t.Updated, Skipped: t.Skipped, Target: count,
+			})
+		}
+		if err := LogAction(tx, username, ip, "ALL", "migrate_postfixadmin", "schema version "+report.SchemaVersion); err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errBundleDryRun
+		}
+		return nil
+	})
+	report.Conflicts = bundleReport.Conflicts
+	report.Warnings = bundleReport.Warnings
+	if err != nil && !errors.Is(err, errBundleDryRun) {
+		return report, err
+	}
+	return report, nil
+}
+
+// schemaVersion returns the version PostfixAdmin keeps in its config table
+func (im *postfixAdminImport) schemaVersion() (string, error) {
+	table := im.opts.TablePrefix + "config"
+	if !im.src.Migrator().HasTable(table) {
+		return "", nil
+	}
+	var version string
+	err := im.src.Table(table).Where("name = ?", "version").Limit(1).Pluck("value", &version).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to read the schema version: %w", err)
+	}
+	return version, nil
+}
+
+// read loads the rows of a source table into dest, a pointer to a slice of a model. Only the
+// columns of the model that the table has are read, so columns an older schema version does
+// not have keep their zero value; the returned set names the columns read. A missing table
+// reads no rows.
+func (im *postfixAdminImport) read(table string, dest interface{}) (map[string]bool, error) {
+	name := im.opts.TablePrefix + table
+	im.report.table(table)
+	if !im.src.Migrator().HasTable(name) {
+		return nil, nil
+	}
+
+	columnTypes, err := im.src.Migrator().ColumnTypes(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the columns of %s: %w", name, err)
+	}
+	exists := map[string]bool{}
+	for _, c := range columnTypes {
+		exists[strings.ToLower(c.Name())] = true
+	}
+
+	stmt := &gorm.Statement{DB: im.src}
+	if err := stmt.Parse(dest); err != nil {
+		return nil, err
+	}
+	have := map[string]bool{}
+	var columns []string
+	for _, column := range stmt.Schema.DBNames {
+		if exists[column] {
+			have[column] = true
+			columns = append(columns, column)
+		}
+	}
+
+	if err := im.src.Table(name).Select(columns).Find(dest).Error; err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	rows := reflect.ValueOf(dest).Elem()
+	for i := 0; i < rows.Len(); i++ {
+		legacyDates(rows.Index(i), im.now)
+	}
+	im.sources[table] = rows.Len()
+	return have, nil
+}
+
+// legacyDates replaces the zero dates of a row, e.g. MySQL's 0000-00-00 or a column an older
+// schema does not have, by now. A zero password expiry means the password never expires.
+func legacyDates(row reflect.Value, now time.Time) {
+	for i := 0; i < row.NumField(); i++ {
+		switch f := row.Field(i).Addr().Interface().(type) {
+		case *time.Time:
+			if f.Year() >= 1000 {
+				continue
+			}
+			if row.Type().Field(i).Name == "PasswordExpiry" {
+				*f = NoPasswordExpiry
+			} else {
+				*f = now
+			}
+		case **time.Time:
+			if *f != nil && (*f).Year() < 1000 {
+				*f = nil
+			}
+		}
+	}
+}
+
+// password rewrites a password hash of the source so that CheckPassword verifies it, hashing
+// clear text passwords when asked to, and warns when the password cannot be verified
+func (im *postfixAdminImport) password(owner, hashed string) (string, error) {
+	if hashed == "" {
+		im.report.warn("%s has no password, it must be reset", owner)
+		return hashed, nil
+	}
+	normalized := legacyPasswordHash(hashed)
+	if isVerifiableHash(normalized) {
+		return normalized, nil
+	}
+
+	prefix, plain := splitSchemePrefix(normalized)
+	plaintext := prefix == "" || prefix == "PLAIN" || prefix == "CLEAR" || prefix == "CLEARTEXT"
+	switch {
+	case plaintext && im.opts.HashPlaintext:
+		return HashPassword(plain)
+	case plaintext && plaintextAllowed():
+		return normalized, nil
+	}
+	im.report.warn("%s: the password hash is not supported, the password must be reset", owner)
+	return normalized, nil
+}
+
+// legacyPasswordHash rewrites the hash formats of PostfixAdmin's encrypt settings that
+// CheckPassword reads differently: courier:md5 ({MD5} base64), courier:md5raw ({MD5RAW}),
+// md5 (bare hex), dovecot:MD5 ({MD5} MD5-CRYPT) and the .B64 and .HEX encodings of Dovecot
+func legacyPasswordHash(hashed string) string {
+	prefix, hash := splitSchemePrefix(hashed)
+
+	for _, enc := range []string{".B64", ".BASE64", ".HEX"} {
+		if !strings.HasSuffix(prefix, enc) {
+			continue
+		}
+		var decoded []byte
+		var err error
+		if enc == ".HEX" {
+			decoded, err = hex.DecodeString(hash)
+		} else {
+			decoded, err = base64.StdEncoding.DecodeString(hash)
+		}
+		if err != nil {
+			return hashed
+		}
+		prefix = strings.TrimSuffix(prefix, enc)
+		if (prefix == "MD5" || prefix == "PLAIN-MD5") && len(decoded) == 16 {
+			// The encoding applies to the digest, not to its hex form
+			return "{PLAIN-MD5}" + hex.EncodeToString(decoded)
+		}
+		return legacyPasswordHash("{" + prefix + "}" + string(decoded))
+	}
+
+	switch prefix {
+	case "MD5", "PLAIN-MD5", "MD5RAW":
+		if strings.HasPrefix(hash, "$1$") {
+			return "{MD5-CRYPT}" + hash
+		}
+		if isMD5Hex(hash) {
+			return "{PLAIN-MD5}" + strings.ToLower(hash)
+		}
+		if digest, err := base64.StdEncoding.DecodeString(hash); err == nil && len(digest) == 16 {
+			return "{PLAIN-MD5}" + hex.EncodeToString(digest)
+		}
+	case "":
+		if isMD5Hex(hash) {
+			return "{PLAIN-MD5}" + strings.ToLower(hash)
+		}
+	}
+	return hashed
+}
+
+// isVerifiableHash reports whether CheckPassword verifies a hash without allow_plaintext
+func isVerifiableHash(hashed string) bool {
+	prefix, hash := splitSchemePrefix(hashed)
+	switch prefix {
+	case "PLAIN-MD5":
+		return isMD5Hex(hash)
+	case "MD5", "PLAIN", "CLEAR", "CLEARTEXT":
+		return false
+	}
+	for _, p := range []string{"$2", "$argon2i$", "$argon2id$", "$1$", "$5$", "$6$"} {
+		if strings.HasPrefix(hash, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (im *postfixAdminImport) run() error {
+	var configs []models.Config
+	if _, err := im.read("config", &configs); err != nil {
+		return err
+	}
+	for i := range configs {
+		c := configs[i]
+		// The schema version belongs to the target database
+		if c.Name == "version" {
+			im.report.table("config").Skipped++
+			continue
+		}
+		c.ID = 0
+		keep := func(e *models.Config) { c.ID = e.ID }
+		if _, err := put(im.bundleImport, "config", c.Name, &c, keep, "name = ?", c.Name); err != nil {
+			return err
+		}
+	}
+
+	var domains []models.Domain
+	if _, err := im.read("domain", &domains); err != nil {
+		return err
+	}
+	for i := range domains {
+		d := domains[i]
+		if _, err := put(im.bundleImport, "domain", d.Domain, &d, nil, "domain = ?", d.Domain); err != nil {
+			return err
+		}
+	}
+
+	var admins []models.Admin
+	columns, err := im.read("admin", &admins)
+	if err != nil {
+		return err
+	}
+	// Before the superadmin column, superadmins were the admins of the domain ALL
+	var domainAdmins []models.DomainAdmin
+	if _, err := im.read("domain_admins", &domainAdmins); err != nil {
+		return err
+	}
+	superadmins := map[string]bool{}
+	for _, da := range domainAdmins {
+		if da.Domain == "ALL" {
+			superadmins[da.Username] = true
+		}
+	}
+	for i := range admins {
+		a := admins[i]
+		if !columns["superadmin"] {
+			a.Superadmin = superadmins[a.Username]
+		}
+		if a.Password, err = im.password("admin "+a.Username, a.Password); err != nil {
+			return err
+		}
+		if _, err := put(im.bundleImport, "admin", a.Username, &a, nil, "username = ?", a.Username); err != nil {
+			return err
+		}
+	}
+
+	for i := range domainAdmins {
+		da := domainAdmins[i]
+		da.ID = 0
+		keep := func(e *models.DomainAdmin) { da.ID = e.ID }
+		key := da.Username + " " + da.Domain
+		if _, err := put(im.bundleImport, "domain_admins", key, &da, keep, "username = ? AND domain = ?", da.Username, da.Domain); err != nil {
+			return err
+		}
+	}
+
+	var mailboxes []models.Mailbox
+	if columns, err = im.read("mailbox", &mailboxes); err != nil {
+		return err
+	}
+	for i := range mailboxes {
+		m := mailboxes[i]
+		localPart, domain := SplitEmail(m.Username)
+		if m.LocalPart == "" {
+			m.LocalPart = localPart
+		}
+		if m.Domain == "" {
+			m.Domain = domain
+		}
+		if !columns["smtp_active"] {
+			m.SMTPActive = true
+		}
+		if m.Password, err = im.password("mailbox "+m.Username, m.Password); err != nil {
+			return err
+		}
+		if _, err := put(im.bundleImport, "mailbox", m.Username, &m, nil, "username = ?", m.Username); err != nil {
+			return err
+		}
+	}
+
+	if err := im.aliases(); err != nil {
+		return err
+	}
+
+	var aliasDomains []models.AliasDomain
+	if _, err := im.read("alias_domain", &aliasDomains); err != nil {
+		return err
+	}
+	for i := range aliasDomains {
+		ad := aliasDomains[i]
+		if _, err := put(im.bundleImport, "alias_domain", ad.AliasDomain, &ad, nil, "alias_domain = ?", ad.AliasDomain); err != nil {
+			return err
+		}
+	}
+
+	if err := im.vacations(); err != nil {
+		return err
+	}
+	if err := im.fetchmail(); err != nil {
+		return err
+	}
+
+	var appPasswords []models.MailboxAppPassword
+	if _, err := im.read("mailbox_app_password", &appPasswords); err != nil {
+		return err
+	}
+	for i := range appPasswords {
+		p := appPasswords[i]
+		if p.Username == nil || p.PasswordHash == nil {
+			im.report.table("mailbox_app_password").Skipped++
+			im.report.warn("app password %d skipped: it has no username or password", p.ID)
+			continue
+		}
+		hash, err := im.password("app password of "+*p.Username, *p.PasswordHash)
+		if err != nil {
+			return err
+		}
+		p.PasswordHash = &hash
+		p.ID = 0
+		keep := func(e *models.MailboxAppPassword) { p.ID = e.ID }
+		if _, err := put(im.bundleImport, "mailbox_app_password", *p.Username, &p, keep, "username = ? AND password_hash = ?", *p.Username, hash); err != nil {
+			return err
+		}
+	}
+
+	var exceptions []models.TOTPExceptionAddress
+	if _, err := im.read("totp_exception_address", &exceptions); err != nil {
+		return err
+	}
+	for i := range exceptions {
+		e := exceptions[i]
+		e.ID = 0
+		keep := func(existing *models.TOTPExceptionAddress) { e.ID = existing.ID }
+		where, args := "ip = ? AND username IS NULL", []interface{}{e.IP}
+		if e.Username != nil {
+			where, args = "ip = ? AND username = ?", append(args, *e.Username)
+		}
+		if _, err := put(im.bundleImport, "totp_exception_address", e.IP, &e, keep, where, args...); err != nil {
+			return err
+		}
+	}
+
+	if err := im.dkim(); err != nil {
+		return err
+	}
+	if im.opts.SkipLog {
+		return nil
+	}
+	return im.log()
+}
+
+// aliases imports the aliases, moving the autoreply addresses of vacations from the autoreply
+// domain of the source to the configured one
+func (im *postfixAdminImport) aliases() error {
+	var aliases []models.Alias
+	if _, err := im.read("alias", &aliases); err != nil {
+		return err
+	}
+
+	from := strings.ToLower(im.opts.VacationDomain)
+	to := VacationDomain()
+	if from != "" && to == "" {
+		im.report.warn("autoreply addresses in %s kept: [vacation] domain is not set", from)
+	}
+	for i := range aliases {
+		a := aliases[i]
+		if a.Domain == "" {
+			_, a.Domain = SplitEmail(a.Address)
+		}
+		if from != "" && to != "" && from != to {
+			recipients := ParseRecipients(a.Goto)
+			for j, r := range recipients {
+				if strings.EqualFold(r, VacationAddress(a.Address, from)) {
+					recipients[j] = VacationAddress(a.Address, to)
+				}
+			}
+			a.Goto = strings.Join(recipients, ",")
+		}
+		if _, err := put(im.bundleImport, "alias", a.Address, &a, nil, "address = ?", a.Address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vacations imports the vacations of every layout: before activefrom and activeuntil they
+// answered without a period, and before vacation_notification senders were kept in cache
+func (im *postfixAdminImport) vacations() error {
+	var vacations []models.Vacation
+	columns, err := im.read("vacation", &vacations)
+	if err != nil {
+		return err
+	}
+	for i := range vacations {
+		v := vacations[i]
+		if v.Domain == "" {
+			_, v.Domain = SplitEmail(v.Email)
+		}
+		if !columns["activeuntil"] {
+			v.ActiveUntil = legacyNoEnd
+		}
+		if !columns["modified"] {
+			v.Modified = v.Created
+		}
+		if _, err := put(im.bundleImport, "vacation", v.Email, &v, nil, "email = ?", v.Email); err != nil {
+			return err
+		}
+	}
+
+	var notifications []models.VacationNotification
+	if columns, err = im.read("vacation_notification", &notifications); err != nil {
+		return err
+	}
+	for i := range notifications {
+		n := notifications[i]
+		if !columns["notified_at"] {
+			n.NotifiedAt = im.now
+		}
+		key := n.OnVacation + " " + n.Notified
+		if _, err := put(im.bundleImport, "vacation_notification", key, &n, nil, "on_vacation = ? AND notified = ?", n.OnVacation, n.Notified); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchmail imports the fetchmail entries, encrypting their passwords. Without an encryption
+// key, entries with a plain text password are skipped. Entries were all polled before the
+// active column.
+func (im *postfixAdminImport) fetchmail() error {
+	var entries []models.Fetchmail
+	columns, err := im.read("fetchmail", &entries)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		f := entries[i]
+		if !columns["active"] {
+			f.Active = true
+		}
+		if f.Domain == nil {
+			_, domain := SplitEmail(f.Mailbox)
+			f.Domain = &domain
+		}
+		key := fmt.Sprintf("%s (%s@%s)", f.Mailbox, f.SrcUser, f.SrcServer)
+		if !IsEncryptedSecret(f.SrcPassword) {
+			f.SrcPassword, err = EncryptSecret(f.SrcPassword)
+			if errors.Is(err, ErrNoSecretKey) {
+				im.report.warn("fetchmail entry %s skipped: [fetchmail] encryption_key is not set", key)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		f.ID = 0
+		keep := func(e *models.Fetchmail) { f.ID = e.ID }
+		if _, err := put(im.bundleImport, "fetchmail", key, &f, keep, "mailbox = ? AND src_server = ? AND src_user = ?", f.Mailbox, f.SrcServer, f.SrcUser); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dkim imports the DKIM keys and the signing table, which follows the new IDs of the keys
+func (im *postfixAdminImport) dkim() error {
+	var keys []models.DKIM
+	if _, err := im.read("dkim", &keys); err != nil {
+		return err
+	}
+	dkimIDs := map[int]int{}
+	for i := range keys {
+		k := keys[i]
+		oldID := k.ID
+		if k.KeyType == "" {
+			k.KeyType = DKIMKeyRSA
+		}
+		k.ID = 0
+		keep := func(e *models.DKIM) { k.ID = e.ID }
+		saved, err := put(im.bundleImport, "dkim", k.Selector+"._domainkey."+k.DomainName, &k, keep, "domain_name = ? AND selector = ?", k.DomainName, k.Selector)
+		if err != nil {
+			return err
+		}
+		dkimIDs[oldID] = saved.ID
+	}
+
+	var signing []models.DKIMSigning
+	if _, err := im.read("dkim_signing", &signing); err != nil {
+		return err
+	}
+	for i := range signing {
+		s := signing[i]
+		id, ok := dkimIDs[s.DKIMID]
+		if !ok {
+			im.report.table("dkim_signing").Skipped++
+			im.report.warn("DKIM signing entry %s skipped: key %d does not exist", s.Author, s.DKIMID)
+			continue
+		}
+		s.ID = 0
+		s.DKIMID = id
+		keep := func(e *models.DKIMSigning) { s.ID = e.ID }
+		if _, err := put(im.bundleImport, "dkim_signing", s.Author, &s, keep, "author = ? AND dkim_id = ?", s.Author, s.DKIMID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// log appends the log entries that the target does not have yet
+func (im *postfixAdminImport) log() error {
+	var entries []models.Log
+	if _, err := im.read("log", &entries); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	logKey := func(l models.Log) string {
+		return strings.Join([]string{l.Timestamp.UTC().Format(time.RFC3339), l.Username, l.Domain, l.Action, l.Data}, "\x00")
+	}
+	var existing []models.Log
+	if err := im.tx.Select("timestamp", "username", "domain", "action", "data").Find(&existing).Error; err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(existing))
+	for _, l := range existing {
+		seen[logKey(l)] = true
+	}
+
+	stats := im.report.table("log")
+	var missing []models.Log
+	for _, l := range entries {
+		if seen[logKey(l)] {
+			stats.Skipped++
+			continue
+		}
+		l.ID = 0
+		missing = append(missing, l)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if err := im.tx.CreateInBatches(missing, 500).Error; err != nil {
+		return fmt.Errorf("failed to create log entries: %w", err)
+	}
+	stats.Created += len(missing)
+	return nil
+}
@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go-postfixadmin/internal/models"
+	"go-postfixadmin/internal/testdb"
+
+	"github.com/GehirnInc/crypt"
+)
+
+func TestLegacyPasswordHash(t *testing.T) {
+	sha512, _ := crypt.SHA512.New().Generate([]byte("password"), nil)
+	sha256, _ := crypt.SHA256.New().Generate([]byte("password"), nil)
+	md5crypt, _ := HashPasswordMD5Crypt("password")
+
+	tests := []struct {
+		name   string
+		hashed string
+		want   string
+	}{
+		{"md5", "5F4DCC3B5AA765D61D8327DEB882CF99", "{PLAIN-MD5}5f4dcc3b5aa765d61d8327deb882cf99"},
+		{"courier:md5", "{MD5}X03MO1qnZdYdgyfeuILPmQ==", "{PLAIN-MD5}5f4dcc3b5aa765d61d8327deb882cf99"},
+		{"courier:md5raw", "{MD5RAW}5f4dcc3b5aa765d61d8327deb882cf99", "{PLAIN-MD5}5f4dcc3b5aa765d61d8327deb882cf99"},
+		{"dovecot:MD5", "{MD5}" + md5crypt, "{MD5-CRYPT}" + md5crypt},
+		{"dovecot:PLAIN-MD5.b64", "{PLAIN-MD5.B64}X03MO1qnZdYdgyfeuILPmQ==", "{PLAIN-MD5}5f4dcc3b5aa765d61d8327deb882cf99"},
+		{"sha512.b64", "{SHA512-CRYPT.B64}" + base64.StdEncoding.EncodeToString([]byte(sha512)), "{SHA512-CRYPT}" + sha512},
+		{"sha256-crypt", "{SHA256-CRYPT}" + sha256, "{SHA256-CRYPT}" + sha256},
+		{"md5crypt", md5crypt, md5crypt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := legacyPasswordHash(tt.hashed)
+			if got != tt.want {
+				t.Fatalf("legacyPasswordHash(%q) = %q, want %q", tt.hashed, got, tt.want)
+			}
+			if !isVerifiableHash(got) {
+				t.Errorf("isVerifiableHash(%q) = false", got)
+			}
+			if match, err := CheckPassword("password", got); !match || err != nil {
+				t.Errorf("CheckPassword(%q) = %v, %v", got, match, err)
+			}
+			if match, _ := CheckPassword("other", got); match {
+				t.Errorf("CheckPassword(%q) accepted a wrong password", got)
+			}
+		})
+	}
+
+	for _, hashed := range []string{"password", "{PLAIN}password", "{SSHA}abcdef", "{MD5}not-a-digest", "aBcDeFgHiJkLm"} {
+		if isVerifiableHash(legacyPasswordHash(hashed)) {
+			t.Errorf("isVerifiableHash(%q) = true, want false", hashed)
+		}
+	}
+}
+
+func TestLegacyDates(t *testing.T) {
+	type row struct {
+		Created        time.Time
+		PasswordExpiry time.Time
+		LastUsed       *time.Time
+		Name           string
+	}
+	zero := time.Time{}
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	created := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	r := row{LastUsed: &zero, Name: "a"}
+	legacyDates(reflect.ValueOf(&r).Elem(), now)
+	if !r.Created.Equal(now) || !r.PasswordExpiry.Equal(NoPasswordExpiry) || r.LastUsed != nil {
+		t.Errorf("zero dates: %+v", r)
+	}
+
+	r = row{Created: created, PasswordExpiry: created, LastUsed: &created}
+	legacyDates(reflect.ValueOf(&r).Elem(), now)
+	if !r.Created.Equal(created) || !r.PasswordExpiry.Equal(created) || r.LastUsed == nil || !r.LastUsed.Equal(created) {
+		t.Errorf("dates changed: %+v", r)
+	}
+}
+
+// legacySchema is a PostfixAdmin database from before the superadmin, smtp_active and
+// password_expiry columns, with the table prefix pfa_
+var legacySchema = []string{
+	`CREATE TABLE pfa_config (id INTEGER PRIMARY KEY, name VARCHAR(20), value VARCHAR(20))`,
+	`CREATE TABLE pfa_domain (domain VARCHAR(255) PRIMARY KEY, description VARCHAR(255), aliases INT, mailboxes INT,
+		maxquota BIGINT, quota BIGINT, transport VARCHAR(255), backupmx TINYINT, created DATETIME, modified DATETIME, active TINYINT)`,
+	`CREATE TABLE pfa_admin (username VARCHAR(255) PRIMARY KEY, password VARCHAR(255), created DATETIME, modified DATETIME, active TINYINT)`,
+	`CREATE TABLE pfa_domain_admins (username VARCHAR(255), domain VARCHAR(255), created DATETIME, active TINYINT)`,
+	`CREATE TABLE pfa_mailbox (username VARCHAR(255) PRIMARY KEY, password VARCHAR(255), name VARCHAR(255), maildir VARCHAR(255),
+		quota BIGINT, local_part VARCHAR(255), domain VARCHAR(255), created DATETIME, modified DATETIME, active TINYINT)`,
+	`CREATE TABLE pfa_alias (address VARCHAR(255) PRIMARY KEY, goto TEXT, domain VARCHAR(255), created DATETIME, modified DATETIME, active TINYINT)`,
+	`CREATE TABLE pfa_alias_domain (alias_domain VARCHAR(255) PRIMARY KEY, target_domain VARCHAR(255), created DATETIME, modified DATETIME, active TINYINT)`,
+
+	`INSERT INTO pfa_config (id, name, value) VALUES (1, 'version', '1840')`,
+	`INSERT INTO pfa_domain VALUES
+		('example.com', 'Example', 10, 10, 0, 0, 'virtual', 0, '2010-05-01 10:00:00', '2010-05-01 10:00:00', 1),
+		('example.net', '', 0, 0, 0, 0, 'virtual', 0, '2010-05-01 10:00:00', '2010-05-01 10:00:00', 1),
+		('old.org', '', 0, 0, 0, 0, 'virtual', 0, '2010-05-01 10:00:00', '2010-05-01 10:00:00', 0)`,
+	`INSERT INTO pfa_admin VALUES
+		('root@example.com', '{MD5-CRYPT-PLACEHOLDER}', '2010-05-01 10:00:00', '2010-05-01 10:00:00', 1),
+		('admin@example.com', '{MD5}X03MO1qnZdYdgyfeuILPmQ==', '2010-05-01 10:00:00', '2010-05-01 10:00:00', 1)`,
+	`INSERT INTO pfa_domain_admins VALUES
+		('root@example.com', 'ALL', '2010-05-01 10:00:00', 1),
+		('admin@example.com', 'example.com', '2010-05-01 10:00:00', 1)`,
+	`INSERT INTO pfa_mailbox VALUES
+		('john@example.com', '5F4DCC3B5AA765D61D8327DEB882CF99', 'John', 'example.com/john/', 0, 'john', 'example.com', '2010-05-01 10:00:00', '2010-05-01 10:00:00', 1),
+		('jane@example.com', '{PLAIN-MD5.B64}X03MO1qnZdYdgyfeuILPmQ==', 'Jane', 'example.com/jane/', 0, 'jane', 'example.com', '2010-05-01 10:00:00', '2010-05-01 10:00:00', 0)`,
+	`INSERT INTO pfa_alias VALUES
+		('john@example.com', 'john@example.com', 'example.com', '2010-05-01 10:00:00', '2010-05-01 10:00:00', 1),
+		('info@example.com', 'john@example.com,jane@example.com', 'example.com', '2010-05-01 10:00:00', '2010-05-01 10:00:00', 0)`,
+	`INSERT INTO pfa_alias_domain VALUES ('example.net', 'example.com', '2010-05-01 10:00:00', '2010-05-01 10:00:00', 1)`,
+}
+
+func TestImportPostfixAdmin(t *testing.T) {
+	md5crypt, _ := HashPasswordMD5Crypt("password")
+	src := testdb.Empty(t)
+	for _, stmt := range legacySchema {
+		if err := src.Exec(strings.Replace(stmt, "{MD5-CRYPT-PLACEHOLDER}", md5crypt, 1)).Error; err != nil {
+			t.Fatalf("create legacy database: %v", err)
+		}
+	}
+	db := testdb.Open(t)
+	db.Create(&models.Config{Name: "version", Value: "1900"})
+
+	// Overwrite, so that the schema version of the source would replace the target's
+	opts := PostfixAdminImportOptions{TablePrefix: "pfa_", OnConflict: ConflictOverwrite}
+	report, err := ImportPostfixAdmin(src, db, opts, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("ImportPostfixAdmin() error = %v", err)
+	}
+	if report.SchemaVersion != "1840" {
+		t.Errorf("schema version %q, want 1840", report.SchemaVersion)
+	}
+	if len(report.Warnings) != 0 {
+		t.Errorf("warnings %v", report.Warnings)
+	}
+
+	want := map[string]int64{"domain": 3, "admin": 2, "domain_admins": 2, "mailbox": 2, "alias": 2, "alias_domain": 1}
+	for _, tr := range report.Tables {
+		n, ok := want[tr.Table]
+		if !ok {
+			continue
+		}
+		if tr.Source != int(n) || tr.Created != int(n) || tr.Target != n {
+			t.Errorf("%s: report %+v, want %d read, created and in the target", tr.Table, *tr, n)
+		}
+		delete(want, tr.Table)
+	}
+	if len(want) != 0 {
+		t.Errorf("tables missing from the report: %v", want)
+	}
+
+	var version models.Config
+	db.First(&version, "name = ?", "version")
+	if version.Value != "1900" {
+		t.Errorf("target schema version %q, want 1900", version.Value)
+	}
+
+	var admins []models.Admin
+	db.Order("username").Find(&admins)
+	for _, a := range admins {
+		if a.Superadmin != (a.Username == "root@example.com") || !a.Active {
+			t.Errorf("admin %s: superadmin=%v active=%v", a.Username, a.Superadmin, a.Active)
+		}
+	}
+
+	var domain models.Domain
+	db.First(&domain, "domain = ?", "old.org")
+	if domain.Active {
+		t.Error("inactive domain imported as active")
+	}
+	var alias models.Alias
+	db.First(&alias, "address = ?", "info@example.com")
+	if alias.Active {
+		t.Error("inactive alias imported as active")
+	}
+
+	var mailboxes []models.Mailbox
+	db.Order("username").Find(&mailboxes)
+	for _, m := range mailboxes {
+		if m.Active != (m.Username == "john@example.com") || !m.SMTPActive {
+			t.Errorf("mailbox %s: active=%v smtp_active=%v", m.Username, m.Active, m.SMTPActive)
+		}
+		if !m.PasswordExpiry.Equal(NoPasswordExpiry) || m.Created.Year() != 2010 {
+			t.Errorf("mailbox %s: created %v, password expiry %v", m.Username, m.Created, m.PasswordExpiry)
+		}
+	}
+
+	passwords := map[string]string{}
+	for _, a := range admins {
+		passwords[a.Username] = a.Password
+	}
+	for _, m := range mailboxes {
+		passwords[m.Username] = m.Password
+	}
+	schemes := map[string]string{
+		"root@example.com":  "$1$",
+		"admin@example.com": "{PLAIN-MD5}",
+		"john@example.com":  "{PLAIN-MD5}",
+		"jane@example.com":  "{PLAIN-MD5}",
+	}
+	for user, prefix := range schemes {
+		hashed := passwords[user]
+		if !strings.HasPrefix(hashed, prefix) {
+			t.Errorf("%s: password %q, want a %s hash", user, hashed, prefix)
+		}
+		if match, err := CheckPassword("password", hashed); !match || err != nil {
+			t.Errorf("%s: CheckPassword(%q) = %v, %v", user, hashed, match, err)
+		}
+		if DovecotPasswordHash(hashed) == "" {
+			t.Errorf("%s: Dovecot cannot verify %q", user, hashed)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter allows at most limit events per key within a sliding window.
+// It is kept in memory, so the counters reset when the server restarts.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string][]time.Time
+}
+
+// NewRateLimiter creates a limiter allowing limit events per key in each window
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:  limit,
+		window: window,
+		hits:   make(map[string][]time.Time),
+	}
+}
+
+// Allow records an event for key and reports whether it is within the limit
+func (r *RateLimiter) Allow(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.prune(now)
+
+	if len(r.hits[key]) >= r.limit {
+		return false
+	}
+	r.hits[key] = append(r.hits[key], now)
+	return true
+}
+
+// prune drops events older than the window and forgets keys without events
+func (r *RateLimiter) prune(now time.Time) {
+	cutoff := now.Add(-r.window)
+	for key, times := range r.hits {
+		i := 0
+		for i < len(times) && !times[i].After(cutoff) {
+			i++
+		}
+		if i == len(times) {
+			delete(r.hits, key)
+		} else if i > 0 {
+			r.hits[key] = times[i:]
+		}
+	}
+}
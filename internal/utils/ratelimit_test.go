@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	r := NewRateLimiter(2, 50*time.Millisecond)
+
+	if !r.Allow("a") || !r.Allow("a") {
+		t.Fatal("Allow() should accept events up to the limit")
+	}
+	if r.Allow("a") {
+		t.Error("Allow() should reject events over the limit")
+	}
+	if !r.Allow("b") {
+		t.Error("Allow() should count keys separately")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !r.Allow("a") {
+		t.Error("Allow() should accept events again once the window has passed")
+	}
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// secretPrefix marks values encrypted by EncryptSecret; other values are legacy plain text
+const secretPrefix = "{AES-GCM}"
+
+// ErrNoSecretKey is returned when a secret is stored, or an encrypted one read, without
+// [fetchmail] encryption_key
+var ErrNoSecretKey = errors.New("fetchmail.encryption_key is not set")
+
+// secretCipher returns the AES-256-GCM cipher keyed by [fetchmail] encryption_key, nil when unset
+func secretCipher() (cipher.AEAD, error) {
+	key := viper.GetString("fetchmail.encryption_key")
+	if key == "" {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptSecret encrypts a credential stored in the database, e.g. a fetchmail source password.
+// Without an encryption key it fails with ErrNoSecretKey rather than store the plain text.
+func EncryptSecret(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	if aead == nil {
+		return "", ErrNoSecretKey
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret returns the plain text of a value stored by EncryptSecret. Values without the
+// encryption prefix are returned as they are.
+func DecryptSecret(stored string) (string, error) {
+	if !IsEncryptedSecret(stored) {
+		return stored, nil
+	}
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	if aead == nil {
+		return "", ErrNoSecretKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, secretPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("encrypted secret cannot be decrypted with the configured key")
+	}
+	return string(plain), nil
+}
+
+// IsEncryptedSecret reports whether a stored value was encrypted by EncryptSecret
+func IsEncryptedSecret(stored string) bool {
+	return strings.HasPrefix(stored, secretPrefix)
+}
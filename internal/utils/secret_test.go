@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSecretRoundTrip(t *testing.T) {
+	viper.Set("fetchmail.encryption_key", "test key")
+	defer viper.Set("fetchmail.encryption_key", "")
+
+	stored, err := EncryptSecret("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedSecret(stored) || stored == "s3cret" {
+		t.Fatalf("EncryptSecret() = %q", stored)
+	}
+	if again, _ := EncryptSecret("s3cret"); again == stored {
+		t.Error("EncryptSecret() reused a nonce")
+	}
+	if plain, err := DecryptSecret(stored); err != nil || plain != "s3cret" {
+		t.Errorf("DecryptSecret() = %q, %v", plain, err)
+	}
+
+	// Legacy plain text values are read as they are
+	if plain, err := DecryptSecret("legacy"); err != nil || plain != "legacy" {
+		t.Errorf("DecryptSecret(legacy) = %q, %v", plain, err)
+	}
+
+	viper.Set("fetchmail.encryption_key", "other key")
+	if _, err := DecryptSecret(stored); err == nil {
+		t.Error("DecryptSecret() accepted the wrong key")
+	}
+
+	viper.Set("fetchmail.encryption_key", "")
+	if _, err := DecryptSecret(stored); !errors.Is(err, ErrNoSecretKey) {
+		t.Errorf("DecryptSecret() without key error = %v", err)
+	}
+	if stored, err := EncryptSecret("s3cret"); !errors.Is(err, ErrNoSecretKey) || stored != "" {
+		t.Errorf("EncryptSecret() without key = %q, %v, want ErrNoSecretKey", stored, err)
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+
+	"go-postfixadmin/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// SenderAllowed reports whether an authenticated mailbox may use an envelope sender: its own
+// address (also in an alias domain of its domain), or an active alias that delivers to it.
+// The null sender of bounces is always allowed.
+func SenderAllowed(db *gorm.DB, mailbox models.Mailbox, sender string) (bool, error) {
+	sender = strings.ToLower(strings.TrimSpace(sender))
+	username := strings.ToLower(mailbox.Username)
+	if sender == "" || sender == username {
+		return true, nil
+	}
+
+	localPart, domain := SplitEmail(sender)
+	if localPart == "" || domain == "" {
+		return false, nil
+	}
+
+	candidates := []string{sender}
+	target, found, err := activeAliasTarget(db, domain)
+	if err != nil {
+		return false, err
+	}
+	if found {
+		mapped := localPart + "@" + target
+		if mapped == username {
+			return true, nil
+		}
+		candidates = append(candidates, mapped)
+	}
+
+	var aliases []models.Alias
+	if err := db.Where("address IN ? AND active = ?", candidates, true).Find(&aliases).Error; err != nil {
+		return false, err
+	}
+	for _, alias := range aliases {
+		recipients := ParseRecipients(strings.ToLower(alias.Goto))
+		if slices.Contains(recipients, username) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"image/png"
+	"net"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// Owners of TOTP secrets and recovery codes
+const (
+	TOTPKindAdmin   = "admin"
+	TOTPKindMailbox = "mailbox"
+)
+
+// RecoveryCodeCount is how many recovery codes are issued at once
+const RecoveryCodeCount = 10
+
+// TOTPEnrollment holds a freshly generated secret and its QR code for the enrollment page
+type TOTPEnrollment struct {
+	Secret string
+	URL    string
+	QRCode string // PNG as a data: URI
+}
+
+// NewTOTPEnrollment generates a new TOTP secret for the account
+func NewTOTPEnrollment(account string) (*TOTPEnrollment, error) {
+	issuer := viper.GetString("totp.issuer")
+	if issuer == "" {
+		issuer = "Go-PostfixAdmin"
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: issuer, AccountName: account})
+	if err != nil {
+		return nil, err
+	}
+	return enrollmentFromKey(key)
+}
+
+// TOTPEnrollmentFromURL rebuilds an enrollment (secret and QR code) from its otpauth:// URL
+func TOTPEnrollmentFromURL(url string) (*TOTPEnrollment, error) {
+	key, err := otp.NewKeyFromURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return enrollmentFromKey(key)
+}
+
+func enrollmentFromKey(key *otp.Key) (*TOTPEnrollment, error) {
+	img, err := key.Image(200, 200)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{
+		Secret: key.Secret(),
+		URL:    key.URL(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// ValidateTOTP checks a 6-digit code against the secret, allowing one period of clock skew
+func ValidateTOTP(secret, code string) bool {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if secret == "" || code == "" {
+		return false
+	}
+	return totp.Validate(code, secret)
+}
+
+// IsTOTPExempt reports whether the IP is listed in totp_exception_address for the
+// user. Rows without a username apply to everyone; the IP may be an address or a CIDR.
+func IsTOTPExempt(db *gorm.DB, username, ip string) bool {
+	clientIP := net.ParseIP(ip)
+	if clientIP == nil {
+		return false
+	}
+
+	var exceptions []models.TOTPExceptionAddress
+	if err := db.Where("username IS NULL OR username = ? OR username = ?", "", username).Find(&exceptions).Error; err != nil {
+		return false
+	}
+
+	for _, e := range exceptions {
+		if MatchIP(clientIP, e.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchIP reports whether ip equals the address or falls inside the CIDR given in pattern
+func MatchIP(ip net.IP, pattern string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if strings.Contains(pattern, "/") {
+		_, network, err := net.ParseCIDR(pattern)
+		return err == nil && network.Contains(ip)
+	}
+	other := net.ParseIP(pattern)
+	return other != nil && other.Equal(ip)
+}
+
+// normalizeRecoveryCode lowercases a code and strips separators typed by the user
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateRecoveryCodes replaces the user's recovery codes and returns the new plaintext codes
+func GenerateRecoveryCodes(db *gorm.DB, kind, username string) ([]string, error) {
+	const charset = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		for j := range b {
+			b[j] = charset[RandomInt(len(charset))]
+		}
+		codes = append(codes, string(b[:5])+"-"+string(b[5:]))
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("kind = ? AND username = ?", kind, username).Delete(&models.TOTPRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, code := range codes {
+			record := models.TOTPRecoveryCode{
+				Kind:     kind,
+				Username: username,
+				CodeHash: hashRecoveryCode(code),
+				Created:  time.Now(),
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode consumes an unused recovery code, returning false if it is unknown or already used
+func UseRecoveryCode(db *gorm.DB, kind, username, code string) (bool, error) {
+	if normalizeRecoveryCode(code) == "" {
+		return false, nil
+	}
+	now := time.Now()
+	result := db.Model(&models.TOTPRecoveryCode{}).
+		Where("kind = ? AND username = ? AND code_hash = ? AND used_at IS NULL", kind, username, hashRecoveryCode(code)).
+		Update("used_at", &now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has left
+func CountRecoveryCodes(db *gorm.DB, kind, username string) int64 {
+	var count int64
+	db.Model(&models.TOTPRecoveryCode{}).Where("kind = ? AND username = ? AND used_at IS NULL", kind, username).Count(&count)
+	return count
+}
+
+// SetTOTPSecret stores (or clears, when secret is nil) the TOTP secret of an admin or mailbox.
+// Clearing the secret also removes the recovery codes.
+func SetTOTPSecret(db *gorm.DB, kind, username string, secret *string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var model interface{} = &models.Admin{}
+		if kind == TOTPKindMailbox {
+			model = &models.Mailbox{}
+		}
+		if err := tx.Model(model).Where("username = ?", username).Update("totp_secret", secret).Error; err != nil {
+			return err
+		}
+		if secret == nil {
+			return tx.Where("kind = ? AND username = ?", kind, username).Delete(&models.TOTPRecoveryCode{}).Error
+		}
+		return nil
+	})
+}
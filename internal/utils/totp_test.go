@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMatchIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		ip      string
+		pattern string
+		want    bool
+	}{
+		{name: "Exact IPv4", ip: "192.168.1.10", pattern: "192.168.1.10", want: true},
+		{name: "Different IPv4", ip: "192.168.1.11", pattern: "192.168.1.10", want: false},
+		{name: "Inside CIDR", ip: "10.0.3.4", pattern: "10.0.0.0/16", want: true},
+		{name: "Outside CIDR", ip: "10.1.3.4", pattern: "10.0.0.0/16", want: false},
+		{name: "IPv6 CIDR", ip: "2001:db8::1", pattern: "2001:db8::/32", want: true},
+		{name: "Invalid pattern", ip: "10.0.0.1", pattern: "not-an-ip", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchIP(net.ParseIP(tt.ip), tt.pattern); got != tt.want {
+				t.Errorf("MatchIP(%q, %q) = %v, want %v", tt.ip, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	if hashRecoveryCode("abcde-fghjk") != hashRecoveryCode(" ABCDE FGHJK ") {
+		t.Error("hashRecoveryCode() should ignore case, spaces and dashes")
+	}
+	if hashRecoveryCode("abcde-fghjk") == hashRecoveryCode("abcde-fghjm") {
+		t.Error("hashRecoveryCode() returned the same hash for different codes")
+	}
+}
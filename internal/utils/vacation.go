@@ -0,0 +1,286 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// maxVacationDepth bounds the alias and alias domain hops followed by FindVacation
+const maxVacationDepth = 20
+
+// VacationDomain returns the autoreply domain routed to the vacation transport, "" when the
+// vacation aliases are not managed
+func VacationDomain() string {
+	return strings.ToLower(strings.TrimSpace(viper.GetString("vacation.domain")))
+}
+
+// VacationAddress returns the address in the autoreply domain that Postfix routes to the
+// vacation transport for email, e.g. user#example.com@autoreply.example.org
+func VacationAddress(email, vacationDomain string) string {
+	return strings.ReplaceAll(strings.ToLower(email), "@", "#") + "@" + vacationDomain
+}
+
+// Vacation states shown to users; only an active vacation is routed to the responder
+const (
+	VacationDisabled = "disabled"
+	VacationUpcoming = "upcoming"
+	VacationActive   = "active"
+	VacationExpired  = "expired"
+)
+
+// VacationState returns the state of a vacation at the given time: Active is the switch set
+// by the user, ActiveFrom and ActiveUntil bound the period it answers in
+func VacationState(v models.Vacation, now time.Time) string {
+	switch {
+	case !v.Active:
+		return VacationDisabled
+	case now.Before(v.ActiveFrom):
+		return VacationUpcoming
+	case now.After(v.ActiveUntil):
+		return VacationExpired
+	}
+	return VacationActive
+}
+
+// SyncVacationAlias adds the autoreply address of email to its alias while its vacation is
+// active and removes it otherwise, creating the alias of the mailbox when missing. It does
+// nothing when no autoreply domain is configured.
+func SyncVacationAlias(db *gorm.DB, email string) error {
+	_, _, err := syncVacationAlias(db, strings.ToLower(email), time.Now())
+	return err
+}
+
+// syncVacationAlias updates the alias of email for the vacation state at now and reports
+// whether the routing changed and whether it is now on. Senders answered before are
+// forgotten when routing starts.
+func syncVacationAlias(db *gorm.DB, email string, now time.Time) (changed, on bool, err error) {
+	vacationDomain := VacationDomain()
+	if vacationDomain == "" {
+		return false, false, nil
+	}
+
+	var v models.Vacation
+	err = db.Where("email = ?", email).First(&v).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, false, err
+	}
+	on = err == nil && VacationState(v, now) == VacationActive
+
+	var alias models.Alias
+	err = db.Where("address = ?", email).First(&alias).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if !on {
+			return false, false, nil
+		}
+		_, domain := SplitEmail(email)
+		alias = models.Alias{Address: email, Goto: email, Domain: domain, Created: now, Modified: now, Active: true}
+	} else if err != nil {
+		return false, false, err
+	}
+
+	current := ParseRecipients(alias.Goto)
+	recipients := WithoutVacationAddress(current, email)
+	wasOn := len(recipients) < len(current)
+	if on == wasOn {
+		return false, on, nil
+	}
+	if on {
+		recipients = append(recipients, VacationAddress(email, vacationDomain))
+		if err := db.Where("on_vacation = ?", email).Delete(&models.VacationNotification{}).Error; err != nil {
+			return false, on, err
+		}
+	}
+	alias.Goto = strings.Join(recipients, ",")
+	alias.Modified = now
+	return true, on, db.Save(&alias).Error
+}
+
+// VacationChange is a routing change made by ApplyVacationSchedule
+type VacationChange struct {
+	Email   string
+	Domain  string
+	Started bool // the vacation started answering; false when it stopped
+}
+
+// ApplyVacationSchedule starts and stops routing to the vacation responder for the enabled
+// vacations whose period began or ended, and returns the changes made
+func ApplyVacationSchedule(db *gorm.DB, now time.Time) ([]VacationChange, error) {
+	if VacationDomain() == "" {
+		return nil, nil
+	}
+	var vacations []models.Vacation
+	if err := db.Select("email", "domain").Where("active = ?", true).Find(&vacations).Error; err != nil {
+		return nil, err
+	}
+
+	var changes []VacationChange
+	for _, v := range vacations {
+		email := strings.ToLower(v.Email)
+		var changed, on bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			changed, on, err = syncVacationAlias(tx, email, now)
+			return err
+		})
+		if err != nil {
+			return changes, err
+		}
+		if changed {
+			changes = append(changes, VacationChange{Email: email, Domain: v.Domain, Started: on})
+		}
+	}
+	return changes, nil
+}
+
+// WithoutVacationAddress removes the autoreply address of email from an alias recipient list,
+// e.g. to show users only their own forwarding addresses
+func WithoutVacationAddress(recipients []string, email string) []string {
+	vacationDomain := VacationDomain()
+	if vacationDomain == "" {
+		return recipients
+	}
+	vacationAddress := VacationAddress(email, vacationDomain)
+	return slices.DeleteFunc(slices.Clone(recipients), func(r string) bool {
+		return strings.EqualFold(r, vacationAddress)
+	})
+}
+
+// FindVacation returns the vacation that answers for recipient at the given time, following
+// aliases that forward to an autoreply address, alias domains and catch-all aliases like
+// vacation.pl does. found is false when no active vacation applies.
+func FindVacation(db *gorm.DB, recipient, vacationDomain string, now time.Time) (models.Vacation, bool, error) {
+	return findVacation(db, strings.ToLower(recipient), vacationDomain, now, 0)
+}
+
+func findVacation(db *gorm.DB, email, vacationDomain string, now time.Time, depth int) (models.Vacation, bool, error) {
+	if depth >= maxVacationDepth {
+		return models.Vacation{}, false, fmt.Errorf("vacation lookup for %s: too many alias hops", email)
+	}
+
+	if v, found, err := activeVacation(db, email, now); err != nil || found {
+		return v, found, err
+	}
+
+	// An alias that also forwards to its own autoreply address: answer for the first
+	// destination that is on vacation
+	var alias models.Alias
+	err := db.Where("address = ?", email).First(&alias).Error
+	if err == nil {
+		recipients := ParseRecipients(strings.ToLower(alias.Goto))
+		if !slices.Contains(recipients, VacationAddress(email, vacationDomain)) {
+			return models.Vacation{}, false, nil
+		}
+		for _, r := range recipients {
+			if v, found, err := activeVacation(db, r, now); err != nil || found {
+				return v, found, err
+			}
+		}
+		return models.Vacation{}, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Vacation{}, false, err
+	}
+
+	localPart, domain := SplitEmail(email)
+	if localPart == "" || domain == "" {
+		return models.Vacation{}, false, nil
+	}
+
+	var aliasDomain models.AliasDomain
+	err = db.Where("alias_domain = ?", domain).First(&aliasDomain).Error
+	if err == nil {
+		return findVacation(db, localPart+"@"+strings.ToLower(aliasDomain.TargetDomain), vacationDomain, now, depth+1)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Vacation{}, false, err
+	}
+
+	// Catch-all of the domain: "@target" keeps the local part, anything else is followed as is
+	var catchAll models.Alias
+	err = db.Where("address = ?", "@"+domain).First(&catchAll).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Vacation{}, false, nil
+	}
+	if err != nil {
+		return models.Vacation{}, false, err
+	}
+	for _, dest := range ParseRecipients(strings.ToLower(catchAll.Goto)) {
+		if strings.HasPrefix(dest, "@") {
+			dest = localPart + dest
+		}
+		if dest == email {
+			continue
+		}
+		if v, found, err := findVacation(db, dest, vacationDomain, now, depth+1); err != nil || found {
+			return v, found, err
+		}
+	}
+	return models.Vacation{}, false, nil
+}
+
+// activeVacation returns the vacation of email when it is active at the given time
+func activeVacation(db *gorm.DB, email string, now time.Time) (models.Vacation, bool, error) {
+	var v models.Vacation
+	err := db.Where("email = ? AND active = ? AND activefrom <= ? AND activeuntil >= ?", email, true, now, now).
+		First(&v).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return v, false, nil
+	}
+	return v, err == nil, err
+}
+
+// VacationNotify reports whether sender should get a reply from the vacation and records the
+// notification. A sender is answered once per vacation period, or again after IntervalTime
+// seconds when the interval is set.
+func VacationNotify(db *gorm.DB, v models.Vacation, sender string, now time.Time) (bool, error) {
+	var n models.VacationNotification
+	err := db.Where("on_vacation = ? AND notified = ?", v.Email, sender).First(&n).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		n = models.VacationNotification{OnVacation: v.Email, Notified: sender, NotifiedAt: now}
+		if err := db.Create(&n).Error; err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !vacationReplyDue(n.NotifiedAt, v, now) {
+		return false, nil
+	}
+	err = db.Model(&models.VacationNotification{}).
+		Where("on_vacation = ? AND notified = ?", v.Email, sender).
+		Update("notified_at", now).Error
+	return err == nil, err
+}
+
+// vacationReplyDue reports whether a sender last answered at notifiedAt gets another reply
+func vacationReplyDue(notifiedAt time.Time, v models.Vacation, now time.Time) bool {
+	// Answered during an earlier vacation
+	if notifiedAt.Before(v.ActiveFrom) {
+		return true
+	}
+	interval := VacationIntervalSeconds(v.IntervalTime)
+	return interval > 0 && now.Sub(notifiedAt) > time.Duration(interval)*time.Second
+}
+
+// VacationIntervalSeconds returns the reply interval of a vacation in seconds. Older versions
+// stored the interval in days (1 or 7); those values are read as one day and one week.
+func VacationIntervalSeconds(interval int) int {
+	switch interval {
+	case 1:
+		return 86400
+	case 7:
+		return 604800
+	}
+	return interval
+}
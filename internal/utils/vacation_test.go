@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"go-postfixadmin/internal/models"
+
+	"github.com/spf13/viper"
+)
+
+func TestVacationAddress(t *testing.T) {
+	if got := VacationAddress("User@Example.com", "autoreply.example.org"); got != "user#example.com@autoreply.example.org" {
+		t.Errorf("VacationAddress() = %q", got)
+	}
+}
+
+func TestVacationReplyDue(t *testing.T) {
+	now := time.Date(2024, 7, 10, 12, 0, 0, 0, time.UTC)
+	v := models.Vacation{ActiveFrom: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name       string
+		notifiedAt time.Time
+		interval   int
+		want       bool
+	}{
+		{"earlier vacation", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), 0, true},
+		{"once per vacation", now.Add(-48 * time.Hour), 0, false},
+		{"interval not elapsed", now.Add(-time.Hour), 86400, false},
+		{"interval elapsed", now.Add(-48 * time.Hour), 86400, true},
+		{"legacy daily interval not elapsed", now.Add(-time.Hour), 1, false},
+		{"legacy daily interval elapsed", now.Add(-48 * time.Hour), 1, true},
+		{"legacy weekly interval not elapsed", now.Add(-48 * time.Hour), 7, false},
+	}
+	for _, tt := range tests {
+		v.IntervalTime = tt.interval
+		if got := vacationReplyDue(tt.notifiedAt, v, now); got != tt.want {
+			t.Errorf("%s: vacationReplyDue() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithoutVacationAddress(t *testing.T) {
+	recipients := []string{"user@example.com", "User#Example.com@autoreply.example.org", "other@example.net"}
+
+	viper.Set("vacation.domain", "")
+	if got := WithoutVacationAddress(recipients, "user@example.com"); len(got) != 3 {
+		t.Errorf("WithoutVacationAddress() without domain = %v", got)
+	}
+
+	viper.Set("vacation.domain", "autoreply.example.org")
+	defer viper.Set("vacation.domain", "")
+	got := WithoutVacationAddress(recipients, "user@example.com")
+	if len(got) != 2 || got[0] != "user@example.com" || got[1] != "other@example.net" {
+		t.Errorf("WithoutVacationAddress() = %v", got)
+	}
+	if len(recipients) != 3 {
+		t.Error("WithoutVacationAddress() modified its argument")
+	}
+}
+
+func TestVacationState(t *testing.T) {
+	now := time.Date(2024, 7, 10, 12, 0, 0, 0, time.UTC)
+	v := models.Vacation{
+		Active:      true,
+		ActiveFrom:  time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+		ActiveUntil: time.Date(2024, 7, 20, 0, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		now  time.Time
+		want string
+	}{
+		{now, VacationActive},
+		{v.ActiveFrom.Add(-time.Minute), VacationUpcoming},
+		{v.ActiveUntil.Add(time.Minute), VacationExpired},
+	}
+	for _, tt := range tests {
+		if got := VacationState(v, tt.now); got != tt.want {
+			t.Errorf("VacationState(%v) = %q, want %q", tt.now, got, tt.want)
+		}
+	}
+
+	v.Active = false
+	if got := VacationState(v, now); got != VacationDisabled {
+		t.Errorf("VacationState() of a disabled vacation = %q", got)
+	}
+}
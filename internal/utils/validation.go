@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	domainNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]{0,61}[a-zA-Z0-9]?(\.[a-zA-Z0-9][a-zA-Z0-9-]{0,61}[a-zA-Z0-9]?)+$`)
+	localPartRegex  = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+)
+
+// IsValidDomainName performs a basic DNS format check (e.g. example.com)
+func IsValidDomainName(name string) bool {
+	return domainNameRegex.MatchString(name)
+}
+
+// IsValidLocalPart checks that a mailbox local part only uses letters, numbers, dots, hyphens and underscores
+func IsValidLocalPart(localPart string) bool {
+	return localPartRegex.MatchString(localPart)
+}
+
+// SplitEmail splits an address into local part and domain. The domain is empty if there is no '@'.
+func SplitEmail(address string) (localPart, domain string) {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return address[:i], address[i+1:]
+	}
+	return address, ""
+}
+
+// ParseRecipients splits a goto list separated by newlines or commas, dropping empty entries
+func ParseRecipients(raw string) []string {
+	var recipients []string
+	for _, line := range strings.FieldsFunc(raw, func(r rune) bool { return r == '\n' || r == ',' }) {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			recipients = append(recipients, line)
+		}
+	}
+	return recipients
+}
+
+// FieldError is a validation failure of one input field. Forms show the message; the API
+// reports it under the field name.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+func fieldError(field, message string) error {
+	return &FieldError{Field: field, Message: message}
+}
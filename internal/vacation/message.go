@@ -0,0 +1,114 @@
+// Package vacation implements the vacation auto-responder run by the Postfix pipe transport
+// for the autoreply domain. It applies the loop, mailing list and bulk mail suppression
+// rules of vacation.pl before answering a message.
+package vacation
+
+import (
+	"bufio"
+	"io"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// Header holds the headers of an incoming message, keyed by canonical name
+type Header = textproto.MIMEHeader
+
+// ReadHeader reads the header block of a message. Unlike net/mail it accepts the sloppy
+// headers real mail carries: the block ends at the first blank or whitespace-only line and
+// lines without a colon are ignored.
+func ReadHeader(r io.Reader) (Header, error) {
+	h := Header{}
+	br := bufio.NewReader(r)
+	var name string
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			return h, nil
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			// Folded continuation of the previous header
+			if values := h[name]; name != "" && len(values) > 0 {
+				values[len(values)-1] += " " + strings.TrimSpace(line)
+			}
+		} else if key, value, found := strings.Cut(line, ":"); found {
+			name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(key))
+			h.Add(name, strings.TrimSpace(value))
+		} else {
+			name = ""
+		}
+
+		if err == io.EOF {
+			return h, nil
+		}
+	}
+}
+
+// headerRule suppresses replies to messages with a header value matching pattern; a nil
+// pattern matches any value
+type headerRule struct {
+	names   []string
+	pattern *regexp.Regexp
+}
+
+var (
+	spamYes = regexp.MustCompile(`(?i)^yes`)
+
+	headerRules = []headerRule{
+		{[]string{"X-Spam-Flag", "X-Spam-Status", "X-Barracuda-Spam-Status"}, spamYes},
+		{[]string{"X-Facebook-Notify"}, nil},
+		{[]string{"X-Amazon-Mail-Relay-Type"}, regexp.MustCompile(`(?i)^notification`)},
+		{[]string{"Precedence"}, regexp.MustCompile(`(?i)^(bulk|list|junk)`)},
+		{[]string{"X-Loop"}, regexp.MustCompile(`(?i)^postfix admin virtual vacation`)},
+		{[]string{"List-Id", "List-Post", "List-Unsubscribe"}, nil},
+		{[]string{"X-Dspam-Result"}, regexp.MustCompile(`(?i)^(spam|bl[ao]cklisted)`)},
+		{[]string{"X-Virus-Status", "X-Anti-Virus-Status", "X-Avas-Virus-Status"}, regexp.MustCompile(`(?i)^infected`)},
+		{[]string{"X-Avas-Spam-Status", "X-Spamtest-Status", "X-Crm114-Status", "X-Razor-Status", "X-Pyzor-Status"}, regexp.MustCompile(`(?i)^spam`)},
+		{[]string{"X-Osbf-Lua-Score"}, regexp.MustCompile(`^[0-9/.+-]+\s+\[[-S]\]`)},
+		{[]string{"X-Autogenerated"}, regexp.MustCompile(`(?i)^reply`)},
+		{[]string{"X-Auto-Response-Suppress"}, regexp.MustCompile(`(?i)^(oof|all)`)},
+	}
+
+	// DefaultNoReplyPattern matches sender addresses that never get a reply
+	DefaultNoReplyPattern = regexp.MustCompile(`(?i)^(noreply|no-reply|do_not_reply|no_reply|postmaster|mailer-daemon|listserv|majordomo|owner-|request-|bounces-)|(-(owner|request|bounces)@)`)
+
+	addressPattern = regexp.MustCompile("[\\w.\\-+'=^|$/{}~?*\\\\&!`%]+@[\\w.\\-]+\\w+")
+)
+
+// SuppressedBy returns the header that marks the message as spam, bulk or automatic mail,
+// or "" when it may be answered
+func SuppressedBy(h Header) string {
+	// "Auto-Submitted: no" is the only value sent by a person
+	if v := h.Get("Auto-Submitted"); v != "" && !strings.HasPrefix(strings.ToLower(v), "no") {
+		return "Auto-Submitted: " + v
+	}
+	for _, rule := range headerRules {
+		for _, name := range rule.names {
+			for _, v := range h.Values(name) {
+				if rule.pattern == nil || rule.pattern.MatchString(v) {
+					return name + ": " + v
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Addresses extracts the lowercased addresses of a header like To or Cc, without duplicates
+func Addresses(value string) []string {
+	var addresses []string
+	seen := make(map[string]bool)
+	for _, a := range addressPattern.FindAllString(value, -1) {
+		a = strings.ToLower(a)
+		if !seen[a] {
+			seen[a] = true
+			addresses = append(addresses, a)
+		}
+	}
+	return addresses
+}
@@ -0,0 +1,198 @@
+package vacation
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"go-postfixadmin/internal/models"
+)
+
+// LoopHeader is the X-Loop value of replies; messages carrying it are never answered
+const LoopHeader = "Postfix Admin Virtual Vacation"
+
+var (
+	fromDatePattern  = regexp.MustCompile(`(?i)<%From_Date>`)
+	untilDatePattern = regexp.MustCompile(`(?i)<%Until_Date>`)
+)
+
+// Responder answers messages for mailboxes on vacation. The lookup functions are normally
+// backed by the database.
+type Responder struct {
+	Domain     string         // autoreply domain, e.g. autoreply.example.org
+	Delimiter  string         // recipient delimiter stripped from autoreply addresses, e.g. "+"
+	NoReply    *regexp.Regexp // senders never answered, besides DefaultNoReplyPattern
+	NoVacation *regexp.Regexp // To: headers never answered
+	DateFormat string         // layout of <%From_Date> and <%Until_Date> (default 2006-01-02)
+
+	// Find returns the active vacation of a recipient
+	Find func(recipient string) (models.Vacation, bool, error)
+	// Notify records the reply to sender and reports whether one is due
+	Notify func(v models.Vacation, sender string) (bool, error)
+	// AccountName returns the display name used in the From header, may be nil
+	AccountName func(email string) (string, error)
+	// Send delivers a reply
+	Send func(from, to string, msg []byte) error
+
+	Now func() time.Time // defaults to time.Now
+}
+
+// Handle reads a message that sender sent to recipient and sends the vacation reply when
+// one is due. It returns why no reply was sent, "" when one was, and an error when a lookup
+// or the delivery failed.
+func (r *Responder) Handle(in io.Reader, sender, recipient string) (string, error) {
+	h, err := ReadHeader(in)
+	if err != nil {
+		return "", err
+	}
+	if header := SuppressedBy(h); header != "" {
+		return "header " + header, nil
+	}
+
+	recipient = r.Recipient(recipient)
+	from, to, messageID := h.Get("From"), h.Get("To"), h.Get("Message-Id")
+	if from == "" || to == "" || messageID == "" || sender == "" || recipient == "" {
+		return "missing From, To or Message-ID header or envelope address", nil
+	}
+	if r.NoVacation != nil && r.NoVacation.MatchString(to) {
+		return "To: " + to + " is excluded", nil
+	}
+
+	checks := []string{from, sender, recipient}
+	if replyTo := h.Get("Reply-To"); replyTo != "" {
+		checks = append(checks, replyTo)
+	}
+	for _, address := range checks {
+		if reason := r.noReply(address); reason != "" {
+			return reason, nil
+		}
+	}
+	sender = Addresses(sender)[0]
+	recipient = Addresses(recipient)[0]
+	if sender == recipient {
+		return "sender is the recipient", nil
+	}
+	for _, address := range append(Addresses(to), Addresses(h.Get("Cc"))...) {
+		if address == sender {
+			return "sender " + sender + " is also a header recipient", nil
+		}
+	}
+
+	v, found, err := r.Find(recipient)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return recipient + " has no active vacation", nil
+	}
+	due, err := r.Notify(v, sender)
+	if err != nil {
+		return "", err
+	}
+	if !due {
+		return sender + " was already notified", nil
+	}
+
+	msg, err := r.Reply(v, h, sender)
+	if err != nil {
+		return "", err
+	}
+	return "", r.Send(v.Email, sender, msg)
+}
+
+// Recipient converts an autoreply address (user#example.com@autoreply.example.org, possibly
+// with a delimiter extension) back to the mailbox address
+func (r *Responder) Recipient(recipient string) string {
+	recipient = strings.ToLower(recipient)
+	suffix := "@" + strings.ToLower(r.Domain)
+	if r.Domain == "" || !strings.HasSuffix(recipient, suffix) {
+		return recipient
+	}
+	address := strings.Replace(strings.TrimSuffix(recipient, suffix), "#", "@", 1)
+	if r.Delimiter != "" {
+		if i := strings.IndexAny(address, r.Delimiter); i > 0 {
+			address = address[:i]
+		}
+	}
+	return address
+}
+
+// noReply returns why an address is not answered, or ""
+func (r *Responder) noReply(address string) string {
+	if DefaultNoReplyPattern.MatchString(address) || (r.NoReply != nil && r.NoReply.MatchString(address)) {
+		return "address " + address + " matches the no-reply pattern"
+	}
+	if len(Addresses(address)) == 0 {
+		return "address " + address + " is not valid"
+	}
+	return ""
+}
+
+// Reply builds the vacation message answering the message with header h
+func (r *Responder) Reply(v models.Vacation, h Header, to string) ([]byte, error) {
+	now := time.Now()
+	if r.Now != nil {
+		now = r.Now()
+	}
+	layout := r.DateFormat
+	if layout == "" {
+		layout = "2006-01-02"
+	}
+
+	name := ""
+	if r.AccountName != nil {
+		var err error
+		if name, err = r.AccountName(v.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	var dec mime.WordDecoder
+	subject, err := dec.DecodeHeader(h.Get("Subject"))
+	if err != nil {
+		subject = h.Get("Subject")
+	}
+	subject = strings.ReplaceAll(v.Subject, "$SUBJECT", subject)
+
+	body := fromDatePattern.ReplaceAllLiteralString(v.Body, v.ActiveFrom.Format(layout))
+	body = untilDatePattern.ReplaceAllLiteralString(body, v.ActiveUntil.Format(layout))
+	body = strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n")
+
+	inReplyTo := h.Get("Message-Id")
+	references := strings.TrimSpace(h.Get("References") + " " + inReplyTo)
+
+	var buf bytes.Buffer
+	header := func(name, value string) { fmt.Fprintf(&buf, "%s: %s\r\n", name, value) }
+	header("From", (&mail.Address{Name: name, Address: v.Email}).String())
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", messageID(v.Email, now))
+	header("In-Reply-To", inReplyTo)
+	header("References", references)
+	header("Auto-Submitted", "auto-replied")
+	header("Precedence", "junk")
+	header("X-Loop", LoopHeader)
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	buf.WriteString("\r\n")
+	buf.WriteString(body)
+	buf.WriteString("\r\n")
+	return buf.Bytes(), nil
+}
+
+// messageID returns a new Message-ID in the domain of email
+func messageID(email string, now time.Time) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	domain := email[strings.LastIndex(email, "@")+1:]
+	return fmt.Sprintf("<vacation.%d.%s@%s>", now.Unix(), hex.EncodeToString(b), domain)
+}
@@ -0,0 +1,186 @@
+package vacation
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go-postfixadmin/internal/models"
+)
+
+const autoreply = "david#example.org@autoreply.example.org"
+
+// testResponder answers for david@example.org and records the replies it sends
+func testResponder(sent *[]string) *Responder {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	return &Responder{
+		Domain:    "autoreply.example.org",
+		Delimiter: "+",
+		Find: func(recipient string) (models.Vacation, bool, error) {
+			if recipient != "david@example.org" {
+				return models.Vacation{}, false, nil
+			}
+			return models.Vacation{
+				Email:       "david@example.org",
+				Subject:     "Out of office: $SUBJECT",
+				Body:        "Away from <%From_Date> until <%until_date>.\nDavid",
+				Active:      true,
+				ActiveFrom:  time.Date(2024, 6, 28, 0, 0, 0, 0, time.UTC),
+				ActiveUntil: time.Date(2024, 7, 14, 0, 0, 0, 0, time.UTC),
+			}, true, nil
+		},
+		Notify: func(v models.Vacation, sender string) (bool, error) { return true, nil },
+		Send: func(from, to string, msg []byte) error {
+			*sent = append(*sent, to+"\n"+string(msg))
+			return nil
+		},
+		Now: func() time.Time { return now },
+	}
+}
+
+func TestHandleFixtures(t *testing.T) {
+	tests := []struct {
+		file   string
+		sender string
+		reply  bool
+		reason string
+	}{
+		{"test-email.txt", "david1@example.org", true, ""},
+		{"asterisk-email.txt", "www-data@palepurple.net", true, ""},
+		{"mailing-list.txt", "fw-general-return-20540-david=example.org@lists.zend.com", false, "Precedence"},
+		{"spam.txt", "mary@ccr.org", false, "X-Spam-Flag"},
+		{"facebook.txt", "notification+meynbxsa@facebookmail.com", false, "X-Facebook-Notify"},
+		{"mail-myself.txt", "david@example.org", false, "sender is the recipient"},
+		{"teodor-smtp-envelope-headers.txt", "david@example.org", false, "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			var sent []string
+			reason, err := testResponder(&sent).Handle(f, tt.sender, autoreply)
+			if err != nil {
+				t.Fatalf("Handle() error = %v", err)
+			}
+			if tt.reply != (len(sent) == 1) {
+				t.Fatalf("Handle() sent %d replies, reason %q", len(sent), reason)
+			}
+			if !strings.Contains(reason, tt.reason) {
+				t.Errorf("Handle() reason = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestHandleRules(t *testing.T) {
+	base := "From: Someone <someone@example.net>\nTo: david@example.org\nSubject: hi\nMessage-ID: <1@example.net>\n"
+	tests := []struct {
+		name    string
+		headers string
+		sender  string
+		reply   bool
+	}{
+		{"plain", "", "someone@example.net", true},
+		{"auto-submitted no", "Auto-Submitted: no\n", "someone@example.net", true},
+		{"auto-replied", "Auto-Submitted: auto-replied\n", "someone@example.net", false},
+		{"own loop", "X-Loop: Postfix Admin Virtual Vacation\n", "someone@example.net", false},
+		{"list id", "List-Id: <list.example.net>\n", "someone@example.net", false},
+		{"auto response suppress", "X-Auto-Response-Suppress: OOF, AutoReply\n", "someone@example.net", false},
+		{"noreply sender", "", "noreply@example.net", false},
+		{"owner sender", "", "list-owner@example.net", false},
+		{"noreply reply-to", "Reply-To: no-reply@example.net\n", "someone@example.net", false},
+		{"sender in cc", "Cc: Other <other@example.net>,\n\tSomeone <someone@example.net>\n", "someone@example.net", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []string
+			msg := tt.headers + base + "\nbody\n"
+			reason, err := testResponder(&sent).Handle(strings.NewReader(msg), tt.sender, autoreply)
+			if err != nil {
+				t.Fatalf("Handle() error = %v", err)
+			}
+			if tt.reply != (len(sent) == 1) {
+				t.Errorf("Handle() sent %d replies, reason %q", len(sent), reason)
+			}
+		})
+	}
+
+	var sent []string
+	r := testResponder(&sent)
+	r.NoReply = regexp.MustCompile(`(?i)facebook|linkedin`)
+	r.Handle(strings.NewReader(base+"\n"), "news@linkedin.com", autoreply)
+	if len(sent) != 0 {
+		t.Error("Handle() answered a sender matching NoReply")
+	}
+}
+
+func TestRecipient(t *testing.T) {
+	r := &Responder{Domain: "autoreply.example.org", Delimiter: "+"}
+	tests := map[string]string{
+		"david#example.org@autoreply.example.org":     "david@example.org",
+		"David#Example.org@AUTOREPLY.example.org":     "david@example.org",
+		"david#example.org+ext@autoreply.example.org": "david@example.org",
+		"david@example.org":                           "david@example.org",
+	}
+	for in, want := range tests {
+		if got := r.Recipient(in); got != want {
+			t.Errorf("Recipient(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestReply(t *testing.T) {
+	var sent []string
+	f, err := os.Open(filepath.Join("testdata", "test-email.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := testResponder(&sent).Handle(f, "david1@example.org", autoreply); err != nil || len(sent) != 1 {
+		t.Fatalf("Handle() = %v, %d replies", err, len(sent))
+	}
+
+	reply := sent[0]
+	for _, want := range []string{
+		"david1@example.org\n",
+		"From: <david@example.org>\r\n",
+		"To: david1@example.org\r\n",
+		"Subject: Out of office: test email\r\n",
+		"In-Reply-To: <20080805191549.GA27905@codepoets.co.uk>\r\n",
+		"Auto-Submitted: auto-replied\r\n",
+		"Precedence: junk\r\n",
+		"X-Loop: " + LoopHeader + "\r\n",
+		"\r\n\r\nAway from 2024-06-28 until 2024-07-14.\r\nDavid\r\n",
+	} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("reply lacks %q:\n%s", want, reply)
+		}
+	}
+
+	// A reply must itself be suppressed, so two responders never loop
+	var again []string
+	msg := reply[strings.Index(reply, "\n")+1:]
+	if reason, _ := testResponder(&again).Handle(strings.NewReader(msg), "david@example.org", "david1#example.org@autoreply.example.org"); len(again) != 0 || reason == "" {
+		t.Errorf("Handle() answered its own reply")
+	}
+}
+
+func TestReadHeader(t *testing.T) {
+	h, err := ReadHeader(strings.NewReader("To: a@example.org,\n  b@example.org\nbroken line\nsubject: x\n \nBody: not a header\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h.Get("To"); got != "a@example.org, b@example.org" {
+		t.Errorf("To = %q", got)
+	}
+	if h.Get("Subject") != "x" || h.Get("Body") != "" {
+		t.Errorf("ReadHeader() = %v", h)
+	}
+}
@@ -157,6 +157,22 @@ var App = (function ($) {
         });
     }
 
+    // ─── Fetchmail Connection Test ───────────────────────────────
+    function testFetchmail(url, msgs) {
+        $.ajax({
+            url: url,
+            method: 'POST'
+        }).done(function (data) {
+            if (data.success) {
+                alert(msgs.success);
+            } else {
+                alert(msgs.error + (data.error || 'Unknown error'));
+            }
+        }).fail(function (err) {
+            alert(msgs.requestError + err.statusText);
+        });
+    }
+
     // ─── Auto-dismiss Flash Messages (FadeAlert) ─────────────────
     var ALERT_DEFAULT_DELAY = 4000;
     var ALERT_FADE_IN_MS = 300;
@@ -319,6 +335,7 @@ var App = (function ($) {
         checkPasswordMatch: checkPasswordMatch,
         generatePassword: generatePassword,
         confirmDeleteResource: confirmDeleteResource,
+        testFetchmail: testFetchmail,
         fadeAlert: fadeAlert,
         flashMessages: flashMessages,
         checkPasswordChangeIntention: checkPasswordChangeIntention,